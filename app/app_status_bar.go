@@ -24,6 +24,11 @@ func AppStatusBar(state *State) *dom.Node {
 			Color: colors.GREY_TEXT,
 		}))
 	}
+	if state.StatusBar.Sync != "" {
+		nodes = append(nodes, dom.Text(" "+state.StatusBar.Sync, styles.Style{
+			Color: colors.GREY_TEXT,
+		}))
+	}
 	if state.StatusBar.Error != "" {
 		nodes = append(nodes, dom.Text("  "+state.StatusBar.Error, styles.Style{
 			Bold:  true,
@@ -42,7 +47,7 @@ func AppStatusBar(state *State) *dom.Node {
 	}
 
 	// Spacer to push modes to the right
-	hasRightContent := state.ZenMode || state.ShowHistory || state.ShowNotes || state.FocusedEntry.IsSet() || state.ViewMode != states.ViewMode_Default
+	hasRightContent := state.ZenMode || state.TagFilter != "" || state.ShowHistory || state.ShowNotes || state.FocusedEntry.IsSet() || state.ViewMode != states.ViewMode_Default
 	if hasRightContent {
 		nodes = append(nodes, dom.Spacer(dom.WithMaxSize(40)))
 
@@ -64,6 +69,16 @@ func AppStatusBar(state *State) *dom.Node {
 			}))
 			modeCount++
 		}
+		if state.TagFilter != "" {
+			if modeCount > 0 {
+				nodes = append(nodes, dom.Text(" ", styles.Style{}))
+			}
+			nodes = append(nodes, dom.Text("#"+state.TagFilter, styles.Style{
+				Bold:  true,
+				Color: colors.GREY_TEXT,
+			}))
+			modeCount++
+		}
 		if state.ShowHistory {
 			if modeCount > 0 {
 				nodes = append(nodes, dom.Text(" ", styles.Style{}))
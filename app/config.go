@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/xhd2015/go-dom-tui/colors"
@@ -59,14 +60,7 @@ func saveConfigPageState(configState *states.ConfigPageState) error {
 	}
 
 	// Convert storage type to string
-	switch configState.SelectedStorageType {
-	case states.StorageType_LocalFile:
-		savedConfig.StorageType = "file"
-	case states.StorageType_Server:
-		savedConfig.StorageType = "server"
-	default: // StorageType_LocalSqlite
-		savedConfig.StorageType = "sqlite"
-	}
+	savedConfig.StorageType = storageTypeName(configState.SelectedStorageType)
 
 	// Update server settings
 	savedConfig.ServerAddr = configState.ServerAddr.Value
@@ -76,6 +70,52 @@ func saveConfigPageState(configState *states.ConfigPageState) error {
 	return data.SaveConfig(savedConfig)
 }
 
+// storageTypeName returns the --storage name of storageType
+func storageTypeName(storageType states.StorageType) string {
+	switch storageType {
+	case states.StorageType_LocalFile:
+		return "file"
+	case states.StorageType_Server:
+		return "server"
+	default: // StorageType_LocalSqlite
+		return "sqlite"
+	}
+}
+
+// migrateStorage copies the data of the running storage to the
+// selected one in the background, saving the config once verified
+func migrateStorage(state *State, configState *states.ConfigPageState) {
+	if configState.Migrating || state.OnMigrateStorage == nil {
+		return
+	}
+	storageType := storageTypeName(configState.SelectedStorageType)
+	serverAddr := configState.ServerAddr.Value
+	serverToken := configState.ServerAuthToken.Value
+	configState.Migrating = true
+	configState.MigrateStatus = "migrating to " + storageType + "..."
+	state.Enqueue(func(ctx context.Context) error {
+		defer func() {
+			configState.Migrating = false
+		}()
+		err := state.OnMigrateStorage(ctx, storageType, serverAddr, serverToken, func(msg string) {
+			configState.MigrateStatus = msg
+			if state.Refresh != nil {
+				state.Refresh()
+			}
+		})
+		if err != nil {
+			configState.MigrateStatus = "migration failed: " + err.Error()
+			return nil
+		}
+		if err := saveConfigPageState(configState); err != nil {
+			configState.MigrateStatus = "migrated, but failed to save config: " + err.Error()
+			return nil
+		}
+		configState.MigrateStatus = "migrated and saved, restart todo to use " + storageType
+		return nil
+	})
+}
+
 func ConfigPage(state *State) *dom.Node {
 	configState := state.Routes.Last().ConfigPage
 	storageTypes := []string{"local file", "local sqlite", "server"}
@@ -117,18 +157,7 @@ func ConfigPage(state *State) *dom.Node {
 	}
 
 	// Show server-specific options when server is selected
-	if configState.SelectedStorageType == 2 { // server
-		focusable := configState.ConfigPhase == states.ConfigPhase_PickingStorageDetail
-
-		var confirmBorderColor string
-		var cancelBorderColor string
-		if configState.ConfirmButtonFocused {
-			confirmBorderColor = colors.GREEN_SUCCESS
-		}
-		if configState.CancelButtonFocused {
-			cancelBorderColor = colors.RED_ERROR
-		}
-
+	if configState.SelectedStorageType == states.StorageType_Server {
 		configItems = append(configItems,
 			dom.Text("Server Address:", styles.Style{Bold: true}),
 			dom.Br(),
@@ -145,65 +174,15 @@ func ConfigPage(state *State) *dom.Node {
 				InputType:   "password",
 			}),
 			dom.Br(),
-			dom.Div(dom.DivProps{},
-				dom.TextWithProps("Save", dom.TextNodeProps{
-					Style: styles.Style{
-						Bold:        configState.ConfirmButtonFocused,
-						BorderColor: confirmBorderColor,
-					},
-					Focused:   configState.ConfirmButtonFocused,
-					Focusable: focusable,
-					OnBlur: func() {
-						configState.ConfirmButtonFocused = false
-					},
-					OnFocus: func() {
-						configState.ConfirmButtonFocused = true
-					},
-					OnKeyDown: func(d *dom.DOMEvent) {
-						switch d.KeydownEvent.KeyType {
-						case dom.KeyTypeEnter:
-							// Save config to file
-							err := saveConfigPageState(configState)
-							if err != nil {
-								// TODO: Handle error properly - maybe show in status bar
-								fmt.Printf("Error saving config: %v\n", err)
-							}
-							// Go back to main page
-							state.Routes.Pop()
-						case dom.KeyTypeRight:
-							// Move focus to Cancel button
-							configState.ConfirmButtonFocused = false
-							configState.CancelButtonFocused = true
-						}
-					},
-				}),
-				dom.Text("    "),
-				dom.TextWithProps("Cancel", dom.TextNodeProps{
-					Style: styles.Style{
-						Bold:        configState.CancelButtonFocused,
-						BorderColor: cancelBorderColor,
-					},
-					Focused:   configState.CancelButtonFocused,
-					Focusable: focusable,
-					OnFocus: func() {
-						configState.CancelButtonFocused = true
-					},
-					OnBlur: func() {
-						configState.CancelButtonFocused = false
-					},
-					OnKeyDown: func(d *dom.DOMEvent) {
-						switch d.KeydownEvent.KeyType {
-						case dom.KeyTypeEnter:
-							// Cancel - go back to main page without saving
-							state.Routes.Pop()
-						case dom.KeyTypeLeft:
-							// Move focus to Save button
-							configState.CancelButtonFocused = false
-							configState.ConfirmButtonFocused = true
-						}
-					},
-				}),
-			),
+		)
+	}
+
+	focusable := configState.ConfigPhase == states.ConfigPhase_PickingStorageDetail
+	configItems = append(configItems, configButtons(state, configState, focusable))
+	if configState.MigrateStatus != "" {
+		configItems = append(configItems,
+			dom.Br(),
+			dom.Text(configState.MigrateStatus, styles.Style{Color: colors.GREY_TEXT}),
 		)
 	}
 
@@ -211,3 +190,107 @@ func ConfigPage(state *State) *dom.Node {
 		dom.Div(dom.DivProps{}, configItems...),
 	)
 }
+
+// configButtons are Save, Migrate & save and Cancel, moved between
+// with left and right
+func configButtons(state *State, configState *states.ConfigPageState, focusable bool) *dom.Node {
+	var confirmBorderColor string
+	var migrateBorderColor string
+	var cancelBorderColor string
+	if configState.ConfirmButtonFocused {
+		confirmBorderColor = colors.GREEN_SUCCESS
+	}
+	if configState.MigrateButtonFocused {
+		migrateBorderColor = colors.GREEN_SUCCESS
+	}
+	if configState.CancelButtonFocused {
+		cancelBorderColor = colors.RED_ERROR
+	}
+
+	return dom.Div(dom.DivProps{},
+		dom.TextWithProps("Save", dom.TextNodeProps{
+			Style: styles.Style{
+				Bold:        configState.ConfirmButtonFocused,
+				BorderColor: confirmBorderColor,
+			},
+			Focused:   configState.ConfirmButtonFocused,
+			Focusable: focusable,
+			OnBlur: func() {
+				configState.ConfirmButtonFocused = false
+			},
+			OnFocus: func() {
+				configState.ConfirmButtonFocused = true
+			},
+			OnKeyDown: func(d *dom.DOMEvent) {
+				switch d.KeydownEvent.KeyType {
+				case dom.KeyTypeEnter:
+					// Save config to file
+					err := saveConfigPageState(configState)
+					if err != nil {
+						// TODO: Handle error properly - maybe show in status bar
+						fmt.Printf("Error saving config: %v\n", err)
+					}
+					// Go back to main page
+					state.Routes.Pop()
+				case dom.KeyTypeRight:
+					// Move focus to Migrate button
+					configState.ConfirmButtonFocused = false
+					configState.MigrateButtonFocused = true
+				}
+			},
+		}),
+		dom.Text("    "),
+		dom.TextWithProps("Migrate & save", dom.TextNodeProps{
+			Style: styles.Style{
+				Bold:        configState.MigrateButtonFocused,
+				BorderColor: migrateBorderColor,
+			},
+			Focused:   configState.MigrateButtonFocused,
+			Focusable: focusable,
+			OnBlur: func() {
+				configState.MigrateButtonFocused = false
+			},
+			OnFocus: func() {
+				configState.MigrateButtonFocused = true
+			},
+			OnKeyDown: func(d *dom.DOMEvent) {
+				switch d.KeydownEvent.KeyType {
+				case dom.KeyTypeEnter:
+					migrateStorage(state, configState)
+				case dom.KeyTypeLeft:
+					configState.MigrateButtonFocused = false
+					configState.ConfirmButtonFocused = true
+				case dom.KeyTypeRight:
+					configState.MigrateButtonFocused = false
+					configState.CancelButtonFocused = true
+				}
+			},
+		}),
+		dom.Text("    "),
+		dom.TextWithProps("Cancel", dom.TextNodeProps{
+			Style: styles.Style{
+				Bold:        configState.CancelButtonFocused,
+				BorderColor: cancelBorderColor,
+			},
+			Focused:   configState.CancelButtonFocused,
+			Focusable: focusable,
+			OnFocus: func() {
+				configState.CancelButtonFocused = true
+			},
+			OnBlur: func() {
+				configState.CancelButtonFocused = false
+			},
+			OnKeyDown: func(d *dom.DOMEvent) {
+				switch d.KeydownEvent.KeyType {
+				case dom.KeyTypeEnter:
+					// Cancel - go back to main page without saving
+					state.Routes.Pop()
+				case dom.KeyTypeLeft:
+					// Move focus to Migrate button
+					configState.CancelButtonFocused = false
+					configState.MigrateButtonFocused = true
+				}
+			},
+		}),
+	)
+}
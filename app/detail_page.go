@@ -62,6 +62,9 @@ func DetailPage(state *State, id int64) *dom.Node {
 			case dom.KeyTypeEsc:
 				if len(state.Routes) > 0 {
 					state.Routes.Pop()
+					if len(state.Routes) > 0 && state.Routes.Last().Type == states.RouteType_Detail {
+						states.LoadRevisions(state, state.Routes.Last().DetailPage.EntryID)
+					}
 					e.StopPropagation()
 				}
 			}
@@ -103,7 +106,12 @@ func DetailPage(state *State, id int64) *dom.Node {
 								item.DetailPage.SelectedNoteMode = models.SelectedNoteMode_Default
 								e.StopPropagation()
 							case dom.KeyTypeEnter:
-								state.OnUpdateNote(item.Data.ID, note.Data.ID, inputState.Value)
+								entryID, noteID, text := item.Data.ID, note.Data.ID, inputState.Value
+								state.Enqueue(func(ctx context.Context) error {
+									state.OnUpdateNote(ctx, entryID, noteID, text)
+									states.LoadRevisions(state, entryID)
+									return nil
+								})
 								item.DetailPage.SelectedNoteMode = models.SelectedNoteMode_Default
 							}
 						},
@@ -133,6 +141,15 @@ func DetailPage(state *State, id int64) *dom.Node {
 								inputState.FocusWithText(note.Data.Text)
 							case "d":
 								item.DetailPage.SelectedNoteMode = models.SelectedNoteMode_Deleting
+							case "u":
+								if state.OnUndo != nil {
+									entryID := item.Data.ID
+									state.Enqueue(func(ctx context.Context) error {
+										err := state.OnUndo(ctx)
+										states.LoadRevisions(state, entryID)
+										return err
+									})
+								}
 							case "y":
 								// copy to clipboard
 								err := clipboard.WriteAll(note.Data.Text)
@@ -154,7 +171,11 @@ func DetailPage(state *State, id int64) *dom.Node {
 						CancelText:     "[Cancel]",
 						SelectedButton: item.DetailPage.ConfirmDeleteButton,
 						OnDelete: func() {
-							state.OnDeleteNote(item.Data.ID, note.Data.ID)
+							entryID, noteID := item.Data.ID, note.Data.ID
+							state.Enqueue(func(ctx context.Context) error {
+								state.OnDeleteNote(ctx, entryID, noteID)
+								return nil
+							})
 							item.DetailPage.SelectedNoteMode = models.SelectedNoteMode_Default
 						},
 						OnCancel: func() {
@@ -181,7 +202,7 @@ func DetailPage(state *State, id int64) *dom.Node {
 					return true
 				}
 				state.Enqueue(func(ctx context.Context) error {
-					return state.OnAddNote(item.Data.ID, val)
+					return state.OnAddNote(ctx, item.Data.ID, val)
 				})
 				return true
 			},
@@ -227,6 +248,7 @@ func DetailPage(state *State, id int64) *dom.Node {
 							if nextItem != nil {
 								state.Routes.Push(states.DetailRoute(id))
 								nextItem.DetailPage.InputState.Reset()
+								states.LoadRevisions(state, id)
 							}
 						}
 					},
@@ -243,5 +265,7 @@ func DetailPage(state *State, id int64) *dom.Node {
 
 			return dom.Div(dom.DivProps{}, children...)
 		}(),
+
+		RevisionsSection(state, item),
 	)
 }
@@ -1,32 +1,18 @@
 package app
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/xhd2015/todo/data/exchange"
 	"github.com/xhd2015/todo/models"
 	"github.com/xhd2015/todo/models/states"
 )
 
-// ExportData represents the structure for exporting entries
-type ExportData struct {
-	Entries []ExportEntry `json:"entries"`
-}
-
-// ExportEntry represents a single entry with its notes for export
-type ExportEntry struct {
-	Data  *models.LogEntry `json:"data"`
-	Notes []ExportNote     `json:"notes"`
-}
-
-// ExportNote represents a single note for export
-type ExportNote struct {
-	Data *models.Note `json:"data"`
-}
-
-// ExportVisibleEntries exports the currently visible entries to a JSON file
+// ExportVisibleEntries exports the currently visible entries with
+// their notes to a JSON file, in the format of todo export
 func ExportVisibleEntries(filename string, visibleEntries []states.TreeEntry) error {
 	// Validate filename
 	if strings.TrimSpace(filename) == "" {
@@ -38,44 +24,26 @@ func ExportVisibleEntries(filename string, visibleEntries []states.TreeEntry) er
 		return fmt.Errorf("file %s already exists", filename)
 	}
 
-	// Create export data structure
-	exportData := ExportData{
-		Entries: make([]ExportEntry, 0, len(visibleEntries)),
+	doc := &exchange.Document{
+		Version:    exchange.Version,
+		ExportTime: time.Now(),
+		Entries:    make([]exchange.Entry, 0, len(visibleEntries)),
 	}
 
-	// Convert visible entries to export format
+	// Convert visible entries to export format, at every depth
 	for _, wrapperEntry := range visibleEntries {
 		if wrapperEntry.Type == models.LogEntryViewType_Log && wrapperEntry.Log != nil {
-			entry := wrapperEntry.Entry
-
-			exportEntry := ExportEntry{
-				Data:  entry.Data,
-				Notes: make([]ExportNote, 0, len(entry.Notes)),
-			}
-
-			// Add notes
-			for _, note := range entry.Notes {
-				exportEntry.Notes = append(exportEntry.Notes, ExportNote{
-					Data: note.Data,
-				})
-			}
-
-			exportData.Entries = append(exportData.Entries, exportEntry)
+			doc.Entries = append(doc.Entries, exchange.NewEntry(wrapperEntry.Entry))
 		}
-		// Note: We could also export notes separately if needed in the future
 	}
 
-	// Marshal to JSON with indentation
-	data, err := json.MarshalIndent(exportData, "", "  ")
+	file, err := os.Create(filename)
 	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
+		return fmt.Errorf("failed to write file: %w", err)
 	}
-
-	// Write to file
-	err = os.WriteFile(filename, data, 0644)
-	if err != nil {
+	defer file.Close()
+	if err := exchange.Write(file, doc); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
-
-	return nil
+	return file.Close()
 }
@@ -1,7 +1,8 @@
 package app
 
 import (
-	"github.com/xhd2015/todo/app/exp"
+	"strings"
+
 	"github.com/xhd2015/todo/models"
 	"github.com/xhd2015/todo/models/states"
 	"github.com/xhd2015/todo/ui/search"
@@ -89,12 +90,15 @@ type EntryOptions struct {
 	SearchSelectedID   models.EntryIdentity
 	SelectedSource     states.SelectedSource
 	ZenMode            bool
+	TagFilter          string
 	SearchActive       bool
 	Search             string
 	ShowNotes          bool
 	FocusingEntryID    models.EntryIdentity
 	ExpandAll          bool
 	ViewMode           states.ViewMode
+	Groups             []models.Group
+	GroupMapping       map[int64]int64
 	GroupCollapseState map[int64]bool
 }
 
@@ -107,15 +111,15 @@ func flattenEntryTree(entries models.LogEntryViews, opts EntryOptions) []states.
 
 	// Organize entries into groups if ViewMode is Group
 	if opts.ViewMode == states.ViewMode_Group {
-		entries = organizeEntriesIntoGroups(entries, opts.GroupCollapseState)
+		entries = organizeEntriesIntoGroups(entries, opts.Groups, opts.GroupMapping, opts.GroupCollapseState)
 	}
 
 	// Filter entries based on search query if active
-	entriesToRender := applyFilter(entries, opts.ZenMode, opts.SearchActive, opts.Search)
+	entriesToRender := applyFilter(entries, opts.ZenMode, opts.TagFilter, opts.SearchActive, opts.Search)
 
 	// Process collapsed entries to hide children and add count information
 	if !opts.ExpandAll {
-		entriesToRender, _, _ = processCollapsedEntries(entriesToRender, false, true, opts.SelectedID, opts.SearchSelectedID, opts.SearchActive, opts.ZenMode)
+		entriesToRender, _, _ = processCollapsedEntries(entriesToRender, false, true, opts.SelectedID, opts.SearchSelectedID, opts.SearchActive, opts.ZenMode, opts.TagFilter)
 	}
 
 	// Add top-level entries (ParentID == 0)
@@ -148,23 +152,18 @@ func flattenEntryTree(entries models.LogEntryViews, opts EntryOptions) []states.
 	return flatEntries
 }
 
-// organizeEntriesIntoGroups organizes entries into pseudo groups based on their properties
-func organizeEntriesIntoGroups(entries models.LogEntryViews, groupCollapseState map[int64]bool) models.LogEntryViews {
-	// Create group entries in order: Deadline, WorkPerf, LifeEnhance, WorkHack, LifeHack, Other
-	groupNames := []string{"Deadline", "WorkPerf", "LifeEnhance", "WorkHack", "LifeHack", "Other"}
-	groupEntries := make(models.LogEntryViews, 0, len(groupNames))
-
-	for i, name := range groupNames {
-		id := int64(i + 1) // Natural ID assignment: see GROUP_*_ID constants
-
+// organizeEntriesIntoGroups organizes entries into pseudo group entries, one
+// per stored group in order, followed by the virtual Other group
+func organizeEntriesIntoGroups(entries models.LogEntryViews, groups []models.Group, groupMapping map[int64]int64, groupCollapseState map[int64]bool) models.LogEntryViews {
+	groupEntries := make(models.LogEntryViews, 0, len(groups)+1)
+	newGroupEntry := func(id int64, name string) *models.LogEntryView {
 		// Determine if this group should be collapsed
 		collapsed, ok := groupCollapseState[id]
 		if !ok {
 			// Default: "Other" group is collapsed by default
 			collapsed = (id == states.GROUP_OTHER_ID)
 		}
-
-		groupEntries = append(groupEntries, &models.LogEntryView{
+		return &models.LogEntryView{
 			// Create a pseudo LogEntry for the group
 			Data: &models.LogEntry{
 				ID:        id,
@@ -172,13 +171,22 @@ func organizeEntriesIntoGroups(entries models.LogEntryViews, groupCollapseState
 				Collapsed: collapsed,
 			},
 			ViewType: models.LogEntryViewType_Group,
-		})
+		}
 	}
+	for _, group := range groups {
+		groupEntries = append(groupEntries, newGroupEntry(group.ID, group.Name))
+	}
+	groupEntries = append(groupEntries, newGroupEntry(states.GROUP_OTHER_ID, "Other"))
 
-	mapping := exp.GetMapping()
+	// copy since tag mappings are added below
+	mapping := make(map[int64]int64, len(groupMapping))
+	for entryID, groupID := range groupMapping {
+		mapping[entryID] = groupID
+	}
 
 	normalGroups := groupEntries[:len(groupEntries)-1]
 	otherGroup := groupEntries[len(groupEntries)-1]
+	addTagGroupMapping(entries, normalGroups, mapping)
 
 	// Use optimized queue-based approach instead of recursive mountToGroup
 	for _, entry := range entries {
@@ -188,6 +196,26 @@ func organizeEntriesIntoGroups(entries models.LogEntryViews, groupCollapseState
 	return groupEntries
 }
 
+// addTagGroupMapping maps entries without an explicit group mapping to the
+// first group named by one of their tags, e.g. #deadline or #workhack
+func addTagGroupMapping(entries models.LogEntryViews, groups models.LogEntryViews, mapping map[int64]int64) {
+	groupIDs := make(map[string]int64, len(groups))
+	for _, group := range groups {
+		groupIDs[strings.ToLower(group.Data.Text)] = group.Data.ID
+	}
+	for _, entry := range entries {
+		if _, ok := mapping[entry.Data.ID]; !ok {
+			for _, tag := range entry.Data.Tags() {
+				if groupID, ok := groupIDs[tag]; ok {
+					mapping[entry.Data.ID] = groupID
+					break
+				}
+			}
+		}
+		addTagGroupMapping(entry.Children, groups, mapping)
+	}
+}
+
 func addEntryRecursive(flatEntries []states.TreeEntry, entry *models.LogEntryView, depth int, prefix string, isLast bool, hasVerticalLine bool, globalShowNotes bool) []states.TreeEntry {
 	// Implement 'v implies n': if IncludeHistory is true, also show notes
 	// Also show notes if global notes mode is enabled
@@ -289,7 +317,7 @@ func addEntryRecursiveWithHistory(flatEntries []states.TreeEntry, entry *models.
 	return flatEntries
 }
 
-func applyFilter(list models.LogEntryViews, zenMode bool, searchActive bool, searchQuery string) models.LogEntryViews {
+func applyFilter(list models.LogEntryViews, zenMode bool, tagFilter string, searchActive bool, searchQuery string) models.LogEntryViews {
 	// Filter entries based on search query if active
 	entriesToRender := list
 
@@ -299,6 +327,13 @@ func applyFilter(list models.LogEntryViews, zenMode bool, searchActive bool, sea
 		})
 	}
 
+	if tagFilter != "" {
+		tags := []string{tagFilter}
+		entriesToRender = search.FilterEntries(entriesToRender, func(entry *models.LogEntryView) bool {
+			return entry.ViewType != models.LogEntryViewType_Group && entry.Data.HasTags(tags)
+		})
+	}
+
 	if searchActive {
 		// when searchQuery is empty, it means clear search labels
 		entriesToRender = search.FilterEntriesQuery(entriesToRender, searchQuery)
@@ -369,7 +404,7 @@ func findPathToEntry(entries models.LogEntryViews, targetEntry models.EntryIdent
 // and adds collapsed count information to the entry view
 // If expandAll is true, ignores collapse flags and shows all entries
 // The selectedID path is kept visible even if parents are collapsed
-func processCollapsedEntries(entries models.LogEntryViews, anyParentCollapsed bool, parentExpanded bool, selectedID models.EntryIdentity, searchSelectedID models.EntryIdentity, searchActive bool, zenMode bool) (visibleChildren models.LogEntryViews, collapsedChildren models.LogEntryViews, selfOrChildrenSelectedDisplay bool) {
+func processCollapsedEntries(entries models.LogEntryViews, anyParentCollapsed bool, parentExpanded bool, selectedID models.EntryIdentity, searchSelectedID models.EntryIdentity, searchActive bool, zenMode bool, tagFilter string) (visibleChildren models.LogEntryViews, collapsedChildren models.LogEntryViews, selfOrChildrenSelectedDisplay bool) {
 	showEntries := make(models.LogEntryViews, 0, len(entries))
 	collapsedEntries := make(models.LogEntryViews, 0, len(entries))
 
@@ -386,7 +421,7 @@ func processCollapsedEntries(entries models.LogEntryViews, anyParentCollapsed bo
 		// clonedEntry.Children
 		shouldCollapse := effectiveAnyParentCollapsed || clonedEntry.Data.Collapsed
 		childParentExpanded := !clonedEntry.Data.Collapsed
-		shownChildrenEntries, collapsedChildrenEntries, childrenSelectedDisplay := processCollapsedEntries(clonedEntry.Children, shouldCollapse, childParentExpanded, selectedID, searchSelectedID, searchActive, zenMode)
+		shownChildrenEntries, collapsedChildrenEntries, childrenSelectedDisplay := processCollapsedEntries(clonedEntry.Children, shouldCollapse, childParentExpanded, selectedID, searchSelectedID, searchActive, zenMode, tagFilter)
 
 		clonedEntry.Children = shownChildrenEntries
 		clonedEntry.CollapsedChildren = collapsedChildrenEntries
@@ -408,7 +443,7 @@ func processCollapsedEntries(entries models.LogEntryViews, anyParentCollapsed bo
 		// then select from children
 		if !selfOrChildrenSelected && effectiveAnyParentCollapsed {
 			addToShow = false
-			if len(shownChildrenEntries) > 0 || shouldShowEvenIfCollapsed(clonedEntry, searchActive, zenMode) {
+			if len(shownChildrenEntries) > 0 || shouldShowEvenIfCollapsed(clonedEntry, searchActive, zenMode, tagFilter) {
 				addToShow = true
 			}
 		}
@@ -434,13 +469,16 @@ func isSelectedDisplay(entry *models.LogEntryView, selectedID models.EntryIdenti
 	return false
 }
 
-func shouldShowEvenIfCollapsed(entry *models.LogEntryView, searchActive bool, zenMode bool) bool {
+func shouldShowEvenIfCollapsed(entry *models.LogEntryView, searchActive bool, zenMode bool, tagFilter string) bool {
 	if searchActive && isSearchMatchEntry(entry) {
 		return true
 	}
 	if zenMode && isZenModeEntry(entry) {
 		return true
 	}
+	if tagFilter != "" && entry.Data.HasTags([]string{tagFilter}) {
+		return true
+	}
 	return false
 }
 
@@ -21,12 +21,15 @@ func MainPage(state *State, availableHeight int) *dom.Node {
 		SearchSelectedID:   state.SearchSelectedEntry,
 		SelectedSource:     state.SelectFromSource,
 		ZenMode:            state.ZenMode,
+		TagFilter:          state.TagFilter,
 		SearchActive:       state.IsSearchActive,
 		Search:             state.SearchQuery,
 		ShowNotes:          state.ShowNotes,
 		FocusingEntryID:    state.FocusedEntry,
 		ExpandAll:          state.ExpandAll,
 		ViewMode:           state.ViewMode,
+		Groups:             state.Groups,
+		GroupMapping:       state.GroupMapping,
 		GroupCollapseState: state.GroupCollapseState.Copy(),
 	})
 
@@ -155,6 +158,7 @@ func MainPage(state *State, availableHeight int) *dom.Node {
 			// Navigate to the detail page of the entry that owns this note
 			// entryType indicates whether this came from a log entry or note
 			state.Routes.Push(states.DetailRoute(entryID))
+			states.LoadRevisions(state, entryID)
 
 			// Reset the input state for the target entry (same as regular todo items)
 			targetEntry := state.Entries.Get(entryID)
@@ -119,6 +119,42 @@ func MainInput(state *State, fullEntries []states.TreeEntry) *dom.Node {
 					return true
 				}
 
+				// Handle /tag command, without a name it clears the filter
+				if tag, found := strings.CutPrefix(s, "/tag"); found && (tag == "" || strings.HasPrefix(tag, " ")) {
+					state.TagFilter = models.NormalizeTag(tag)
+					return true
+				}
+
+				// Handle /token command replacing a refused server token
+				if token, found := strings.CutPrefix(s, "/token "); found {
+					token = strings.TrimSpace(token)
+					if state.OnSetToken == nil {
+						state.StatusBar.Error = "token is only used with --storage=server"
+						return true
+					}
+					if token == "" {
+						state.StatusBar.Error = "token requires a value: /token <token>"
+						return true
+					}
+					state.Enqueue(func(ctx context.Context) error {
+						return state.OnSetToken(ctx, token)
+					})
+					return true
+				}
+
+				// Handle /group command creating a group
+				if name, found := strings.CutPrefix(s, "/group "); found {
+					name = strings.TrimSpace(name)
+					if name == "" || state.OnAddGroup == nil {
+						state.StatusBar.Error = "group requires a name: /group <name>"
+						return true
+					}
+					state.Enqueue(func(ctx context.Context) error {
+						return state.OnAddGroup(ctx, name)
+					})
+					return true
+				}
+
 				switch s {
 				case "/history":
 					// Toggle ShowHistory and refresh entries
@@ -147,6 +183,11 @@ func MainInput(state *State, fullEntries []states.TreeEntry) *dom.Node {
 						})
 					}
 					return true
+				case "/retry":
+					if state.OnRetry != nil {
+						state.Enqueue(state.OnRetry)
+					}
+					return true
 				case "/zen":
 					state.ZenMode = !state.ZenMode
 					return true
@@ -205,6 +246,11 @@ func MainInput(state *State, fullEntries []states.TreeEntry) *dom.Node {
 					// Navigate to learning materials page
 					state.Routes.Push(states.LearningRoute())
 					return true
+				case "/trash":
+					state.Trash.SelectedIndex = 0
+					state.Routes.Push(states.TrashRoute())
+					states.LoadTrash(state)
+					return true
 				case "/switch":
 					// Toggle view mode between default and group
 					if state.ViewMode == states.ViewMode_Default {
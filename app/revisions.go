@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xhd2015/go-dom-tui/colors"
+	"github.com/xhd2015/go-dom-tui/dom"
+	"github.com/xhd2015/go-dom-tui/styles"
+	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/models/states"
+)
+
+// RevisionsSection lists the revisions of the entry and its notes,
+// latest first, each with what its change did. Enter restores one.
+func RevisionsSection(state *State, item *models.LogEntryView) *dom.Node {
+	revisionsState := &state.Revisions
+	if revisionsState.EntryID != item.Data.ID {
+		return dom.Fragment()
+	}
+
+	children := []*dom.Node{dom.H2(dom.DivProps{}, dom.Text("Revisions"))}
+	if revisionsState.Error != "" {
+		children = append(children, dom.Text("Error: "+revisionsState.Error), dom.Br())
+		return dom.Div(dom.DivProps{}, children...)
+	}
+	if revisionsState.Loading {
+		children = append(children, dom.Text("Loading..."), dom.Br())
+		return dom.Div(dom.DivProps{}, children...)
+	}
+	if len(revisionsState.Revisions) == 0 {
+		children = append(children, dom.Text("No revisions"), dom.Br())
+		return dom.Div(dom.DivProps{}, children...)
+	}
+
+	for i, revision := range revisionsState.Revisions {
+		selected := revisionsState.SelectedID == revision.ID
+		line := revision.ChangeTime.Local().Format("2006-01-02 15:04") + "  " + describeRevision(state, item, revisionsState.Revisions[:i], revision)
+		children = append(children, dom.TextWithProps(line, dom.TextNodeProps{
+			Focused:   selected,
+			Focusable: true,
+			Style: styles.Style{
+				Color: func() string {
+					if selected {
+						return colors.GREEN_SUCCESS
+					}
+					return ""
+				}(),
+			},
+			OnFocus: func() {
+				revisionsState.SelectedID = revision.ID
+			},
+			OnBlur: func() {
+				revisionsState.SelectedID = 0
+			},
+			OnKeyDown: func(e *dom.DOMEvent) {
+				if e.KeydownEvent.KeyType != dom.KeyTypeEnter {
+					return
+				}
+				e.StopPropagation()
+				if revisionsState.Restore == nil {
+					return
+				}
+				entryID := item.Data.ID
+				state.Enqueue(func(ctx context.Context) error {
+					err := revisionsState.Restore(ctx, revision)
+					states.LoadRevisions(state, entryID)
+					return err
+				})
+			},
+		}))
+		children = append(children, dom.Br())
+	}
+	return dom.Div(dom.DivProps{}, children...)
+}
+
+// describeRevision tells what the change replacing revision did: the
+// content after it is that of the next later revision of the same
+// entry or note, in later, or the current one
+func describeRevision(state *State, item *models.LogEntryView, later []models.Revision, revision models.Revision) string {
+	var after *models.Revision
+	for i := len(later) - 1; i >= 0; i-- {
+		if later[i].EntryID == revision.EntryID && later[i].NoteID == revision.NoteID {
+			after = &later[i]
+			break
+		}
+	}
+	if after == nil {
+		current, ok := currentRevision(item, revision)
+		if !ok {
+			return fmt.Sprintf("note %q, deleted since", revision.Text)
+		}
+		after = &current
+	}
+
+	if revision.NoteID != 0 {
+		return fmt.Sprintf("note %q → %q", revision.Text, after.Text)
+	}
+	var changes []string
+	if revision.Text != after.Text {
+		changes = append(changes, fmt.Sprintf("text %q → %q", revision.Text, after.Text))
+	}
+	if revision.Done != after.Done {
+		changes = append(changes, doneMark(revision.Done)+" → "+doneMark(after.Done))
+	}
+	if revision.ParentID != after.ParentID {
+		changes = append(changes, fmt.Sprintf("moved %s → %s", parentName(state, revision.ParentID), parentName(state, after.ParentID)))
+	}
+	if revision.HighlightLevel != after.HighlightLevel {
+		changes = append(changes, fmt.Sprintf("highlight %d → %d", revision.HighlightLevel, after.HighlightLevel))
+	}
+	if len(changes) == 0 {
+		// only the done time changed
+		return "done time changed"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// currentRevision returns the entry or note revision is of as it is now
+func currentRevision(item *models.LogEntryView, revision models.Revision) (models.Revision, bool) {
+	if revision.NoteID == 0 {
+		return models.EntryRevision(*item.Data, revision.ChangeTime), true
+	}
+	for _, note := range item.Notes {
+		if note.Data.ID == revision.NoteID {
+			return models.NoteRevision(*note.Data, revision.ChangeTime), true
+		}
+	}
+	return models.Revision{}, false
+}
+
+func doneMark(done bool) string {
+	if done {
+		return "[x]"
+	}
+	return "[ ]"
+}
+
+func parentName(state *State, parentID int64) string {
+	if parentID == 0 {
+		return "top level"
+	}
+	if parent := state.Entries.Get(parentID); parent != nil {
+		return fmt.Sprintf("%q", parent.Data.Text)
+	}
+	return fmt.Sprintf("#%d", parentID)
+}
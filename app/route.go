@@ -34,6 +34,8 @@ func RenderRoute(state *State, route states.Route, window *dom.Window) *dom.Node
 		return states.LearningPage(state, window.Width, availableHeight)
 	case states.RouteType_Reading:
 		return states.ReadingPage(state, route.ReadingPage.MaterialID, window.Width, availableHeight)
+	case states.RouteType_Trash:
+		return states.TrashPage(state, availableHeight)
 	default:
 		return dom.Text(fmt.Sprintf("unknown route: %d", route.Type), styles.Style{
 			Bold:  true,
@@ -110,7 +110,7 @@ func TodoTree(props TodoTreeProps) []*dom.Node {
 							e.StopPropagation()
 						case dom.KeyTypeEnter:
 							state.Enqueue(func(ctx context.Context) error {
-								return state.OnUpdate(entryType, entryID, state.SelectedInputState.Value)
+								return state.OnUpdate(ctx, entryType, entryID, state.SelectedInputState.Value)
 							})
 							state.SelectedEntryMode = states.SelectedEntryMode_Default
 						}
@@ -210,7 +210,9 @@ func TodoTree(props TodoTreeProps) []*dom.Node {
 			if state.SelectedEntryMode == states.SelectedEntryMode_DeleteConfirm && isSelected {
 				deleteText := "Delete todo?"
 				deleteButtonText := "[Delete]"
-				if props.State.ViewMode == states.ViewMode_Group {
+				if entryType == models.LogEntryViewType_Group {
+					deleteText = "Delete group?"
+				} else if props.State.ViewMode == states.ViewMode_Group {
 					deleteText = "Remove from group?"
 					deleteButtonText = "[Remove]"
 				}
@@ -223,13 +225,13 @@ func TodoTree(props TodoTreeProps) []*dom.Node {
 					OnDelete: func() {
 						next := state.Entries.FindNextOrLast(entryID)
 						state.Enqueue(func(ctx context.Context) error {
-							if props.State.ViewMode == states.ViewMode_Group {
-								err := state.OnRemoveFromGroup(entryType, entryID)
+							if props.State.ViewMode == states.ViewMode_Group && entryType != models.LogEntryViewType_Group {
+								err := state.OnRemoveFromGroup(ctx, entryType, entryID)
 								if err != nil {
 									return err
 								}
 							} else {
-								err := state.OnDelete(entryType, entryID)
+								err := state.OnDelete(ctx, entryType, entryID)
 								if err != nil {
 									return err
 								}
@@ -262,7 +264,7 @@ func TodoTree(props TodoTreeProps) []*dom.Node {
 						Text: "Promote",
 						OnSelect: func() {
 							state.Enqueue(func(ctx context.Context) error {
-								err := state.OnPromote(entryType, entryID)
+								err := state.OnPromote(ctx, entryType, entryID)
 								if err != nil {
 									return err
 								}
@@ -273,7 +275,10 @@ func TodoTree(props TodoTreeProps) []*dom.Node {
 					{
 						Text: "No Highlight",
 						OnSelect: func() {
-							state.OnUpdateHighlight(entryType, entryID, 0)
+							state.Enqueue(func(ctx context.Context) error {
+								state.OnUpdateHighlight(ctx, entryType, entryID, 0)
+								return nil
+							})
 							state.SelectedEntryMode = states.SelectedEntryMode_Default
 						}},
 				}
@@ -289,7 +294,10 @@ func TodoTree(props TodoTreeProps) []*dom.Node {
 						Text:  fmt.Sprintf("Highlight-%d", i+1),
 						Color: colors[i],
 						OnSelect: func() {
-							state.OnUpdateHighlight(entryType, entryID, i+1)
+							state.Enqueue(func(ctx context.Context) error {
+								state.OnUpdateHighlight(ctx, entryType, entryID, i+1)
+								return nil
+							})
 							state.SelectedEntryMode = states.SelectedEntryMode_Default
 						},
 					})
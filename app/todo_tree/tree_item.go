@@ -190,7 +190,7 @@ func TodoItem(props TodoItemProps) *dom.Node {
 			case dom.KeyTypeSpace:
 				// toggle status
 				state.Enqueue(func(ctx context.Context) error {
-					return state.OnToggle(entryType, entryID)
+					return state.OnToggle(ctx, entryType, entryID)
 				})
 			case dom.KeyTypeCtrlC:
 				if state.IsSearchActive {
@@ -254,7 +254,7 @@ func TodoItem(props TodoItemProps) *dom.Node {
 							// Default duration is 30 minutes
 							duration := 30 * time.Minute
 							state.Enqueue(func(ctx context.Context) error {
-								state.OnShowTop(entryID, item.Data.Text, duration)
+								state.OnShowTop(ctx, entryID, item.Data.Text, duration)
 								return nil
 							})
 						}
@@ -289,7 +289,7 @@ func TodoItem(props TodoItemProps) *dom.Node {
 							if parentID == 0 {
 								// No parent, focus on the group this entry belongs to
 								groupID := state.FindGroupForEntry(entryID)
-								if groupID > 0 {
+								if groupID != 0 {
 									state.Select(models.LogEntryViewType_Group, groupID)
 								}
 							} else {
@@ -305,8 +305,23 @@ func TodoItem(props TodoItemProps) *dom.Node {
 							state.Select(prevEntry.EntryType, prevEntry.ID)
 						}
 					}
+				case "J", "K":
+					// move group down or up in group mode
+					if entryType == models.LogEntryViewType_Group && state.OnReorderGroup != nil {
+						delta := 1
+						if key == "K" {
+							delta = -1
+						}
+						state.Enqueue(func(ctx context.Context) error {
+							return state.OnReorderGroup(ctx, entryID, delta)
+						})
+					}
 				case "z":
 					state.ZenMode = !state.ZenMode
+				case "u":
+					if state.OnUndo != nil {
+						state.Enqueue(state.OnUndo)
+					}
 				case "d":
 					state.SelectedEntryMode = states.SelectedEntryMode_DeleteConfirm
 					state.SelectedDeleteConfirmButton = 0
@@ -338,7 +353,7 @@ func TodoItem(props TodoItemProps) *dom.Node {
 							// Move the cutting item to be a child of the current item
 							if state.OnMove != nil {
 								state.Enqueue(func(ctx context.Context) error {
-									err := state.OnMove(state.CuttingEntry, entryIdentiy)
+									err := state.OnMove(ctx, state.CuttingEntry, entryIdentiy)
 									if err != nil {
 										return err
 									}
@@ -353,7 +368,7 @@ func TodoItem(props TodoItemProps) *dom.Node {
 					// toggle history inclusion for children (also enables notes)
 					if state.OnToggleVisibility != nil {
 						state.Enqueue(func(ctx context.Context) error {
-							err := state.OnToggleVisibility(entryID)
+							err := state.OnToggleVisibility(ctx, entryID)
 							if err != nil {
 								return err
 							}
@@ -364,7 +379,7 @@ func TodoItem(props TodoItemProps) *dom.Node {
 					// toggle notes display for this entry and its subtree
 					if state.OnToggleNotesDisplay != nil {
 						state.Enqueue(func(ctx context.Context) error {
-							err := state.OnToggleNotesDisplay(entryID)
+							err := state.OnToggleNotesDisplay(ctx, entryID)
 							if err != nil {
 								return err
 							}
@@ -393,6 +408,8 @@ func TodoItem(props TodoItemProps) *dom.Node {
 		},
 	}, dom.Fragment(
 		textNode,
+		renderDueBadge(item.Data, isSelected, time.Now()),
+		renderRepeatBadge(item.Data, isSelected),
 		func() *dom.Node {
 			if len(item.Notes) == 0 {
 				return nil
@@ -454,6 +471,52 @@ func TodoItem(props TodoItemProps) *dom.Node {
 	)
 }
 
+// renderDueBadge shows the due time, highlighted when due today or overdue,
+// or the scheduled time while it is still ahead
+func renderDueBadge(entry *models.LogEntry, isSelected bool, now time.Time) *dom.Node {
+	if entry == nil || entry.Done {
+		return nil
+	}
+	var text string
+	color := colors.GREY_TEXT
+	switch entry.DueStatus(now) {
+	case models.DueStatus_Overdue:
+		text = " (overdue " + models.FormatDueTime(*entry.DueTime, now) + ")"
+		color = colors.RED_ERROR
+	case models.DueStatus_Today:
+		text = " (due " + models.FormatDueTime(*entry.DueTime, now) + ")"
+		color = colors.TextHighlight
+	case models.DueStatus_Upcoming:
+		text = " (due " + models.FormatDueTime(*entry.DueTime, now) + ")"
+	default:
+		if entry.ScheduledTime == nil || !entry.ScheduledTime.After(now) {
+			return nil
+		}
+		text = " (starts " + models.FormatDueTime(*entry.ScheduledTime, now) + ")"
+	}
+	if isSelected && color == colors.GREY_TEXT {
+		color = colors.GREEN_SUCCESS
+	}
+	return dom.Text(text, styles.Style{
+		Color: color,
+		Bold:  color == colors.RED_ERROR,
+	})
+}
+
+// renderRepeatBadge shows the repeat rule of recurring entries
+func renderRepeatBadge(entry *models.LogEntry, isSelected bool) *dom.Node {
+	if entry == nil || entry.Repeat == "" {
+		return nil
+	}
+	color := colors.GREY_TEXT
+	if isSelected {
+		color = colors.GREEN_SUCCESS
+	}
+	return dom.Text(" ↻ "+entry.Repeat, styles.Style{
+		Color: color,
+	})
+}
+
 type TodoNoteProps struct {
 	Note       *models.NoteView
 	EntryID    int64 // ID of the entry that owns this note
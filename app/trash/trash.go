@@ -0,0 +1,149 @@
+package trash
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/go-dom-tui/colors"
+	"github.com/xhd2015/go-dom-tui/dom"
+	"github.com/xhd2015/go-dom-tui/styles"
+	"github.com/xhd2015/todo/component/layout"
+	"github.com/xhd2015/todo/models"
+)
+
+type TrashListProps struct {
+	// Entries are the deleted entries, each with the descendants
+	// deleted along with it
+	Entries         []*models.LogEntryView
+	SelectedIndex   int
+	ContainerHeight int
+	OnNavigateBack  func()
+	OnReload        func()
+	OnRestore       func(id int64)
+	OnNavigateUp    func()
+	OnNavigateDown  func()
+}
+
+func TrashList(props TrashListProps) *dom.Node {
+	return dom.Div(dom.DivProps{
+		Focusable: true,
+		Focused:   true,
+		OnKeyDown: func(event *dom.DOMEvent) {
+			keyEvent := event.KeydownEvent
+			if keyEvent == nil {
+				return
+			}
+
+			switch keyEvent.KeyType {
+			case dom.KeyTypeEsc:
+				if props.OnNavigateBack != nil {
+					props.OnNavigateBack()
+					event.StopPropagation()
+				}
+			case dom.KeyTypeUp:
+				if props.OnNavigateUp != nil {
+					props.OnNavigateUp()
+				}
+			case dom.KeyTypeDown:
+				if props.OnNavigateDown != nil {
+					props.OnNavigateDown()
+				}
+				event.PreventDefault()
+			case dom.KeyTypeEnter:
+				if props.OnRestore != nil && props.SelectedIndex >= 0 && props.SelectedIndex < len(props.Entries) {
+					props.OnRestore(props.Entries[props.SelectedIndex].Data.ID)
+				}
+				event.PreventDefault()
+			default:
+				key := string(keyEvent.Runes)
+				switch key {
+				case "r", "R":
+					if props.OnReload != nil {
+						props.OnReload()
+					}
+					event.PreventDefault()
+				}
+			}
+		},
+	},
+		func() *dom.Node {
+			const HEADER_LINES = 3 // Title + Help + Empty line
+			availableHeight := props.ContainerHeight - HEADER_LINES
+			if availableHeight < 5 {
+				availableHeight = 5
+			}
+
+			headerNodes := []*dom.Node{
+				dom.Div(dom.DivProps{},
+					dom.Text("Trash", styles.Style{
+						Bold: true,
+					}),
+				),
+				dom.Div(dom.DivProps{},
+					dom.Text("Press ↑/↓ to navigate, Enter to restore, 'r' to reload, ESC to go back", styles.Style{
+						Color: colors.TextSecondary,
+					}),
+				),
+				dom.Div(dom.DivProps{}, dom.Text("")),
+			}
+
+			if len(props.Entries) == 0 {
+				contentNode := dom.Div(dom.DivProps{},
+					dom.Text("Trash is empty", styles.Style{
+						Color: colors.TextSecondary,
+					}),
+				)
+				return dom.Fragment(append(headerNodes, contentNode)...)
+			}
+
+			itemNodes := make([]*dom.Node, 0, len(props.Entries))
+			for i, entry := range props.Entries {
+				itemNodes = append(itemNodes, renderTrashItem(entry, i == props.SelectedIndex))
+			}
+
+			scrollerNode := layout.VScroller(layout.VScrollerProps{
+				Children:      itemNodes,
+				Height:        availableHeight,
+				SelectedIndex: props.SelectedIndex,
+				SliceStart:    0,
+			})
+			return dom.Fragment(append(headerNodes, scrollerNode)...)
+		}(),
+	)
+}
+
+func renderTrashItem(entry *models.LogEntryView, isSelected bool) *dom.Node {
+	prefix := "  "
+	titleStyle := styles.Style{}
+	if isSelected {
+		prefix = "> "
+		titleStyle.Color = "2" // Green for selected
+		titleStyle.Bold = true
+	}
+
+	metaText := "   Deleted"
+	if entry.Data.DeletedTime != nil {
+		metaText += ": " + entry.Data.DeletedTime.Format("2006-01-02 15:04")
+	}
+	if n := countDescendants(entry); n > 0 {
+		metaText += fmt.Sprintf(" | with %d sub-entries", n)
+	}
+
+	return dom.Div(dom.DivProps{},
+		dom.Div(dom.DivProps{},
+			dom.Text(prefix+entry.Data.Text, titleStyle),
+		),
+		dom.Div(dom.DivProps{},
+			dom.Text(metaText, styles.Style{
+				Color: colors.TextSecondary,
+			}),
+		),
+	)
+}
+
+func countDescendants(entry *models.LogEntryView) int {
+	n := len(entry.Children)
+	for _, child := range entry.Children {
+		n += countDescendants(child)
+	}
+	return n
+}
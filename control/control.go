@@ -0,0 +1,375 @@
+// Package control lets scripts drive a running todo through a Unix
+// domain socket in the config dir. A client writes one JSON Request
+// per line and reads one JSON Response per line, on one connection
+// as many times as it likes.
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/todo/models"
+)
+
+// commands carried in Request.Command
+const (
+	CommandAdd     = "add"
+	CommandDone    = "done"
+	CommandToggle  = "toggle"
+	CommandEdit    = "edit"
+	CommandRemove  = "rm"
+	CommandMove    = "mv"
+	CommandAddNote = "add-note"
+	CommandFocus   = "focus"
+	CommandShowTop = "show-top"
+)
+
+// response codes carried in Response.Code, as the server uses them
+const (
+	CodeOK         = 0
+	CodeBadRequest = 400
+	CodeNotFound   = 404
+	CodeAmbiguous  = 409
+	CodeInternal   = 500
+)
+
+var (
+	// ErrInvalid matches commands that cannot apply as asked, e.g.
+	// moving a todo under itself
+	ErrInvalid = errors.New("invalid command")
+	// ErrNotFound matches selectors that match no entry
+	ErrNotFound = errors.New("not found")
+	// ErrAmbiguous matches selectors that match more than the one
+	// entry a command needs, e.g. the parent of add
+	ErrAmbiguous = errors.New("ambiguous")
+)
+
+// Request is a command. Entries are given by selectors, an ID like
+// "12" or a path of texts from the top like "Work/Release/*", each
+// part a pattern as of path.Match.
+type Request struct {
+	Command string `json:"command"`
+	// Selectors are the entries of done, toggle, rm and mv, and the
+	// only entry of edit, add-note, focus and show-top
+	Selectors []string `json:"selectors,omitempty"`
+	// Texts are the entries add adds
+	Texts []string `json:"texts,omitempty"`
+	// Text is the text of edit and add-note
+	Text string `json:"text,omitempty"`
+	// Parent is the entry under which add and mv put entries, "" or
+	// "0" for the top level
+	Parent string `json:"parent,omitempty"`
+	// Undo tells done to mark the entries not done
+	Undo bool `json:"undo,omitempty"`
+	// Duration is how long show-top shows the entry, like "30m"
+	Duration string `json:"duration,omitempty"`
+}
+
+type Response struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg,omitempty"`
+	// Entries are the entries the command affected, as they are after it
+	Entries []models.LogEntry `json:"entries,omitempty"`
+}
+
+// DefaultShowTopDuration is how long show-top shows an entry when the
+// request does not tell, as 't' in the TUI does
+const DefaultShowTopDuration = 30 * time.Minute
+
+// Handler carries out the commands, returning the entries they
+// affected. The instance implements it, and so does Client by sending
+// them to the instance.
+type Handler interface {
+	Add(ctx context.Context, texts []string, parent string) ([]models.LogEntry, error)
+	Done(ctx context.Context, selectors []string, done bool) ([]models.LogEntry, error)
+	Toggle(ctx context.Context, selectors []string) ([]models.LogEntry, error)
+	Edit(ctx context.Context, selector string, text string) ([]models.LogEntry, error)
+	Remove(ctx context.Context, selectors []string) ([]models.LogEntry, error)
+	Move(ctx context.Context, selectors []string, parent string) ([]models.LogEntry, error)
+	AddNote(ctx context.Context, selector string, text string) ([]models.LogEntry, error)
+	Focus(ctx context.Context, selector string) error
+	ShowTop(ctx context.Context, selector string, duration time.Duration) error
+}
+
+// Listener accepts the connections of the control socket
+type Listener struct {
+	path     string
+	listener net.Listener
+	handler  Handler
+
+	wg sync.WaitGroup
+}
+
+// Listen listens on the socket at path. A socket file left at path,
+// e.g. by an instance that crashed, is replaced: the caller makes
+// sure no other instance runs.
+func Listen(path string, handler Handler) (*Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	// the socket acts as the user, no one else may connect
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &Listener{path: path, listener: listener, handler: handler}, nil
+}
+
+// Serve handles connections until ctx is done, then closes the
+// listener and removes the socket
+func (l *Listener) Serve(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		l.listener.Close()
+	})
+	defer stop()
+	defer l.wg.Wait()
+	defer os.Remove(l.path)
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (l *Listener) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = badRequest("invalid request: %v", err)
+		} else {
+			resp = l.handle(ctx, &req)
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (l *Listener) handle(ctx context.Context, req *Request) Response {
+	switch req.Command {
+	case CommandAdd:
+		if len(req.Texts) == 0 || slices.Contains(req.Texts, "") {
+			return badRequest("add requires text")
+		}
+	case CommandDone, CommandToggle, CommandRemove, CommandMove:
+		if len(req.Selectors) == 0 {
+			return badRequest("%s requires selectors", req.Command)
+		}
+	case CommandEdit, CommandAddNote, CommandFocus, CommandShowTop:
+		if len(req.Selectors) != 1 {
+			return badRequest("%s requires one selector", req.Command)
+		}
+	default:
+		return badRequest("unknown command: %q", req.Command)
+	}
+	if (req.Command == CommandEdit || req.Command == CommandAddNote) && req.Text == "" {
+		return badRequest("%s requires text", req.Command)
+	}
+
+	var entries []models.LogEntry
+	var err error
+	switch req.Command {
+	case CommandAdd:
+		entries, err = l.handler.Add(ctx, req.Texts, req.Parent)
+	case CommandDone:
+		entries, err = l.handler.Done(ctx, req.Selectors, !req.Undo)
+	case CommandToggle:
+		entries, err = l.handler.Toggle(ctx, req.Selectors)
+	case CommandEdit:
+		entries, err = l.handler.Edit(ctx, req.Selectors[0], req.Text)
+	case CommandRemove:
+		entries, err = l.handler.Remove(ctx, req.Selectors)
+	case CommandMove:
+		entries, err = l.handler.Move(ctx, req.Selectors, req.Parent)
+	case CommandAddNote:
+		entries, err = l.handler.AddNote(ctx, req.Selectors[0], req.Text)
+	case CommandFocus:
+		err = l.handler.Focus(ctx, req.Selectors[0])
+	case CommandShowTop:
+		duration := DefaultShowTopDuration
+		if req.Duration != "" {
+			duration, err = time.ParseDuration(req.Duration)
+			if err != nil || duration <= 0 {
+				return badRequest("invalid duration: %q", req.Duration)
+			}
+		}
+		err = l.handler.ShowTop(ctx, req.Selectors[0], duration)
+	}
+	if err != nil {
+		code := CodeInternal
+		switch {
+		case errors.Is(err, ErrInvalid):
+			code = CodeBadRequest
+		case errors.Is(err, ErrNotFound):
+			code = CodeNotFound
+		case errors.Is(err, ErrAmbiguous):
+			code = CodeAmbiguous
+		}
+		return Response{Code: code, Msg: err.Error()}
+	}
+	return Response{Code: CodeOK, Entries: entries}
+}
+
+func badRequest(format string, args ...any) Response {
+	return Response{Code: CodeBadRequest, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Client sends commands to a running instance
+type Client struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+// Dial connects to the instance listening at path. It fails if there
+// is none, e.g. with a socket file but no one accepting.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, scanner: bufio.NewScanner(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Call sends req and returns the error of the response, if any
+func (c *Client) Call(ctx context.Context, req Request) (Response, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if _, err := c.conn.Write(append(body, '\n')); err != nil {
+		return Response{}, c.callError(ctx, err)
+	}
+	if !c.scanner.Scan() {
+		err := c.scanner.Err()
+		if err == nil {
+			err = errors.New("instance closed the connection")
+		}
+		return Response{}, c.callError(ctx, err)
+	}
+	var resp Response
+	if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+		return Response{}, fmt.Errorf("invalid response: %w", err)
+	}
+	switch resp.Code {
+	case CodeOK:
+		return resp, nil
+	case CodeBadRequest:
+		return resp, &instanceError{msg: resp.Msg, kind: ErrInvalid}
+	case CodeNotFound:
+		return resp, &instanceError{msg: resp.Msg, kind: ErrNotFound}
+	case CodeAmbiguous:
+		return resp, &instanceError{msg: resp.Msg, kind: ErrAmbiguous}
+	default:
+		return resp, fmt.Errorf("instance error (code %d): %s", resp.Code, resp.Msg)
+	}
+}
+
+// instanceError is the error the instance responded with, its message
+// tells the kind already
+type instanceError struct {
+	msg  string
+	kind error
+}
+
+func (e *instanceError) Error() string { return e.msg }
+func (e *instanceError) Unwrap() error { return e.kind }
+
+func (c *Client) callError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("failed to send command: %w", err)
+}
+
+func (c *Client) Add(ctx context.Context, texts []string, parent string) ([]models.LogEntry, error) {
+	resp, err := c.Call(ctx, Request{Command: CommandAdd, Texts: texts, Parent: parent})
+	return resp.Entries, err
+}
+
+func (c *Client) Done(ctx context.Context, selectors []string, done bool) ([]models.LogEntry, error) {
+	resp, err := c.Call(ctx, Request{Command: CommandDone, Selectors: selectors, Undo: !done})
+	return resp.Entries, err
+}
+
+func (c *Client) Toggle(ctx context.Context, selectors []string) ([]models.LogEntry, error) {
+	resp, err := c.Call(ctx, Request{Command: CommandToggle, Selectors: selectors})
+	return resp.Entries, err
+}
+
+func (c *Client) Edit(ctx context.Context, selector string, text string) ([]models.LogEntry, error) {
+	resp, err := c.Call(ctx, Request{Command: CommandEdit, Selectors: []string{selector}, Text: text})
+	return resp.Entries, err
+}
+
+func (c *Client) Remove(ctx context.Context, selectors []string) ([]models.LogEntry, error) {
+	resp, err := c.Call(ctx, Request{Command: CommandRemove, Selectors: selectors})
+	return resp.Entries, err
+}
+
+func (c *Client) Move(ctx context.Context, selectors []string, parent string) ([]models.LogEntry, error) {
+	resp, err := c.Call(ctx, Request{Command: CommandMove, Selectors: selectors, Parent: parent})
+	return resp.Entries, err
+}
+
+func (c *Client) AddNote(ctx context.Context, selector string, text string) ([]models.LogEntry, error) {
+	resp, err := c.Call(ctx, Request{Command: CommandAddNote, Selectors: []string{selector}, Text: text})
+	return resp.Entries, err
+}
+
+func (c *Client) Focus(ctx context.Context, selector string) error {
+	_, err := c.Call(ctx, Request{Command: CommandFocus, Selectors: []string{selector}})
+	return err
+}
+
+// ShowTop shows the entry on top for duration, 0 for DefaultShowTopDuration
+func (c *Client) ShowTop(ctx context.Context, selector string, duration time.Duration) error {
+	req := Request{Command: CommandShowTop, Selectors: []string{selector}}
+	if duration > 0 {
+		req.Duration = duration.String()
+	}
+	_, err := c.Call(ctx, req)
+	return err
+}
@@ -0,0 +1,190 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/models"
+)
+
+type fakeHandler struct {
+	added    []string
+	toggled  []string
+	duration time.Duration
+}
+
+func (h *fakeHandler) Add(ctx context.Context, texts []string, parent string) ([]models.LogEntry, error) {
+	var entries []models.LogEntry
+	for _, text := range texts {
+		h.added = append(h.added, text)
+		entries = append(entries, models.LogEntry{ID: int64(len(h.added)), Text: text})
+	}
+	return entries, nil
+}
+
+func (h *fakeHandler) Done(ctx context.Context, selectors []string, done bool) ([]models.LogEntry, error) {
+	return nil, fmt.Errorf("%w: %s matches 2 todos", ErrAmbiguous, selectors[0])
+}
+
+func (h *fakeHandler) Toggle(ctx context.Context, selectors []string) ([]models.LogEntry, error) {
+	if selectors[0] != "1" {
+		return nil, ErrNotFound
+	}
+	h.toggled = append(h.toggled, selectors...)
+	return []models.LogEntry{{ID: 1, Done: true}}, nil
+}
+
+func (h *fakeHandler) Edit(ctx context.Context, selector string, text string) ([]models.LogEntry, error) {
+	return nil, nil
+}
+
+func (h *fakeHandler) Remove(ctx context.Context, selectors []string) ([]models.LogEntry, error) {
+	return nil, nil
+}
+
+func (h *fakeHandler) Move(ctx context.Context, selectors []string, parent string) ([]models.LogEntry, error) {
+	return nil, fmt.Errorf("%w: cannot move todo 1 under itself", ErrInvalid)
+}
+
+func (h *fakeHandler) AddNote(ctx context.Context, selector string, text string) ([]models.LogEntry, error) {
+	return nil, errors.New("notes are broken")
+}
+
+func (h *fakeHandler) Focus(ctx context.Context, selector string) error {
+	return nil
+}
+
+func (h *fakeHandler) ShowTop(ctx context.Context, selector string, duration time.Duration) error {
+	h.duration = duration
+	return nil
+}
+
+func startListener(t *testing.T, handler Handler) string {
+	// unix socket paths are short, t.TempDir may be too long
+	dir, err := os.MkdirTemp("", "todo-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "todo.sock")
+
+	// a socket left by a crashed instance
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := Listen(path, handler)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- listener.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expect socket removed, stat: %v", err)
+		}
+	})
+	return path
+}
+
+func TestCommands(t *testing.T) {
+	handler := &fakeHandler{}
+	path := startListener(t, handler)
+
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	entries, err := client.Add(ctx, []string{"write release notes", "tag v1.2.0"}, "")
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if len(entries) != 2 || entries[1].ID != 2 || entries[1].Text != "tag v1.2.0" {
+		t.Fatalf("expect entries 1 and 2 added, got %+v", entries)
+	}
+
+	entries, err = client.Toggle(ctx, []string{"1"})
+	if err != nil {
+		t.Fatalf("toggle: %v", err)
+	}
+	if len(entries) != 1 || !entries[0].Done {
+		t.Fatalf("expect entry 1 done, got %+v", entries)
+	}
+	if _, err := client.Toggle(ctx, []string{"2"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if _, err := client.Done(ctx, []string{"Work/*"}, true); !errors.Is(err, ErrAmbiguous) {
+		t.Fatalf("expect ErrAmbiguous, got %v", err)
+	}
+	if _, err := client.Move(ctx, []string{"1"}, "1"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expect ErrInvalid, got %v", err)
+	}
+	_, err = client.AddNote(ctx, "1", "waiting")
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalid) {
+		t.Fatalf("expect instance error, got %v", err)
+	}
+	if len(handler.toggled) != 1 {
+		t.Fatalf("expect 1 toggle, got %v", handler.toggled)
+	}
+
+	if err := client.ShowTop(ctx, "1", 0); err != nil {
+		t.Fatalf("show-top: %v", err)
+	}
+	if handler.duration != DefaultShowTopDuration {
+		t.Fatalf("expect default duration, got %v", handler.duration)
+	}
+	if err := client.ShowTop(ctx, "1", 45*time.Minute); err != nil {
+		t.Fatalf("show-top: %v", err)
+	}
+	if handler.duration != 45*time.Minute {
+		t.Fatalf("expect 45m, got %v", handler.duration)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	path := startListener(t, &fakeHandler{})
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	for _, req := range []Request{
+		{Command: "archive", Selectors: []string{"1"}},
+		{Command: CommandAdd},
+		{Command: CommandAdd, Texts: []string{""}},
+		{Command: CommandDone},
+		{Command: CommandEdit, Selectors: []string{"1", "2"}, Text: "x"},
+		{Command: CommandAddNote, Selectors: []string{"1"}},
+		{Command: CommandShowTop, Selectors: []string{"1"}, Duration: "soon"},
+	} {
+		resp, err := client.Call(ctx, req)
+		if !errors.Is(err, ErrInvalid) || resp.Code != CodeBadRequest {
+			t.Fatalf("%s: expect code %d, got %d: %v", req.Command, CodeBadRequest, resp.Code, err)
+		}
+	}
+}
+
+func TestDialWithoutInstance(t *testing.T) {
+	dir, err := os.MkdirTemp("", "todo-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := Dial(filepath.Join(dir, "todo.sock")); err == nil {
+		t.Fatal("expect dial to fail without an instance")
+	}
+}
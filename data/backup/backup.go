@@ -0,0 +1,299 @@
+// Package backup keeps rotating snapshots of a local store and
+// restores them. Snapshots are taken with the backup API for sqlite
+// and by copying the file for file storage, each checked before it is
+// kept, and thinned out by a Retention.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage/filestore"
+	"github.com/xhd2015/todo/data/storage/sqlite"
+)
+
+// DefaultInterval is how often Run takes a backup
+const DefaultInterval = time.Hour
+
+// idLayout is the layout of backup IDs, which sort by time
+const idLayout = "20060102-150405"
+
+// Store is a store that can be backed up
+type Store interface {
+	// Snapshot writes a consistent copy of the store to file
+	Snapshot(ctx context.Context, file string) error
+	// Check verifies that file is an intact copy of the store
+	Check(file string) error
+	// Replace swaps the store for the copy in file, moving the file
+	Replace(file string) error
+}
+
+// NewSQLiteStore returns the sqlite database at filePath as a Store
+func NewSQLiteStore(filePath string) Store {
+	return sqliteStore(filePath)
+}
+
+// NewFileStore returns the data file at filePath as a Store
+func NewFileStore(filePath string) Store {
+	return fileStore(filePath)
+}
+
+type sqliteStore string
+
+func (s sqliteStore) Snapshot(ctx context.Context, file string) error {
+	return sqlite.Backup(ctx, string(s), file)
+}
+
+func (s sqliteStore) Check(file string) error {
+	return sqlite.Check(file)
+}
+
+func (s sqliteStore) Replace(file string) error {
+	return sqlite.Replace(string(s), file)
+}
+
+type fileStore string
+
+func (s fileStore) Snapshot(ctx context.Context, file string) error {
+	return filestore.Snapshot(string(s), file)
+}
+
+func (s fileStore) Check(file string) error {
+	return filestore.Check(file)
+}
+
+func (s fileStore) Replace(file string) error {
+	return filestore.Replace(string(s), file)
+}
+
+// Retention tells how many backups to keep: the latest one of each of
+// the last Hourly hours, Daily days and Weekly weeks that have one.
+// The latest backup is always kept.
+type Retention struct {
+	Hourly int
+	Daily  int
+	Weekly int
+}
+
+var DefaultRetention = Retention{Hourly: 24, Daily: 7, Weekly: 4}
+
+type Backup struct {
+	// ID is the local time the backup was taken, like 20250901-093000
+	ID   string
+	Time time.Time
+	File string
+	Size int64
+}
+
+// Manager keeps the backups of a store in a directory
+type Manager struct {
+	dir       string
+	ext       string
+	store     Store
+	retention Retention
+}
+
+// New returns a Manager keeping the backups of store in dir as files
+// with extension ext, like ".db"
+func New(dir string, ext string, store Store, retention Retention) *Manager {
+	return &Manager{
+		dir:       dir,
+		ext:       ext,
+		store:     store,
+		retention: retention,
+	}
+}
+
+// List returns the backups, latest first
+func (m *Manager) List() ([]Backup, error) {
+	files, err := os.ReadDir(m.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var backups []Backup
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, m.ext) {
+			continue
+		}
+		id := strings.TrimSuffix(name, m.ext)
+		t, err := time.ParseInLocation(idLayout, id, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Backup{
+			ID:   id,
+			Time: t,
+			File: filepath.Join(m.dir, name),
+			Size: info.Size(),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ID > backups[j].ID
+	})
+	return backups, nil
+}
+
+// Create takes a backup and prunes the old ones. Backups are taken at
+// most once a second, a second one returns the first.
+func (m *Manager) Create(ctx context.Context) (*Backup, error) {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id := now.Format(idLayout)
+	file := filepath.Join(m.dir, id+m.ext)
+	if _, err := os.Stat(file); err == nil {
+		return m.get(id)
+	}
+
+	tmp := filepath.Join(m.dir, id+".tmp")
+	defer os.Remove(tmp)
+	if err := m.store.Snapshot(ctx, tmp); err != nil {
+		return nil, fmt.Errorf("failed to take backup: %w", err)
+	}
+	if err := m.store.Check(tmp); err != nil {
+		return nil, fmt.Errorf("backup is not intact: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return nil, err
+	}
+	if _, err := m.Prune(); err != nil {
+		return nil, err
+	}
+	return m.get(id)
+}
+
+func (m *Manager) get(id string) (*Backup, error) {
+	backups, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, backup := range backups {
+		if backup.ID == id {
+			return &backup, nil
+		}
+	}
+	return nil, fmt.Errorf("backup %s not found", id)
+}
+
+// Prune deletes the backups the retention does not keep, and returns them
+func (m *Manager) Prune() ([]Backup, error) {
+	backups, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	keep := Keep(backups, m.retention)
+	var removed []Backup
+	for _, backup := range backups {
+		if keep[backup.ID] {
+			continue
+		}
+		if err := os.Remove(backup.File); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backup)
+	}
+	return removed, nil
+}
+
+// Keep returns the IDs of the backups, latest first, that retention keeps
+func Keep(backups []Backup, retention Retention) map[string]bool {
+	keep := make(map[string]bool)
+	if len(backups) == 0 {
+		return keep
+	}
+	keep[backups[0].ID] = true
+	periods := []struct {
+		n   int
+		key func(t time.Time) string
+	}{
+		{retention.Hourly, func(t time.Time) string { return t.Format("2006010215") }},
+		{retention.Daily, func(t time.Time) string { return t.Format("20060102") }},
+		{retention.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+	}
+	for _, period := range periods {
+		seen := make(map[string]bool)
+		for _, backup := range backups {
+			if len(seen) >= period.n {
+				break
+			}
+			key := period.key(backup.Time)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			keep[backup.ID] = true
+		}
+	}
+	return keep
+}
+
+// Restore checks the backup and swaps the store for a copy of it,
+// after taking a backup of the store as it is. It returns that backup,
+// nil if the store did not exist. Processes using a sqlite store must
+// be stopped first.
+func (m *Manager) Restore(ctx context.Context, id string) (*Backup, error) {
+	backup, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.Check(backup.File); err != nil {
+		return nil, fmt.Errorf("backup %s is not intact: %w", id, err)
+	}
+	// copied first, as backing up the store may prune it
+	tmp := filepath.Join(m.dir, id+".restore")
+	defer os.Remove(tmp)
+	data, err := os.ReadFile(backup.File)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return nil, err
+	}
+	if err := m.store.Check(tmp); err != nil {
+		return nil, fmt.Errorf("copy of backup %s is not intact: %w", id, err)
+	}
+
+	current, err := m.Create(ctx)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to back up the store before restoring: %w", err)
+	}
+	if err := m.store.Replace(tmp); err != nil {
+		return nil, fmt.Errorf("failed to restore backup %s: %w", id, err)
+	}
+	return current, nil
+}
+
+// Run takes a backup now and then every interval until ctx is done,
+// passing errors to onError. A store not written yet is not an error.
+func (m *Manager) Run(ctx context.Context, interval time.Duration, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.Create(ctx); err != nil && !errors.Is(err, os.ErrNotExist) && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package backup_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data/backup"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/data/storage/filestore"
+	"github.com/xhd2015/todo/data/storage/sqlite"
+	"github.com/xhd2015/todo/models"
+)
+
+func TestKeep(t *testing.T) {
+	base := time.Date(2025, 9, 10, 12, 0, 0, 0, time.Local)
+	var backups []backup.Backup
+	// every 20 minutes for two weeks, latest first
+	for i := 0; i < 14*24*3; i++ {
+		at := base.Add(-time.Duration(i) * 20 * time.Minute)
+		backups = append(backups, backup.Backup{ID: at.Format("20060102-150405"), Time: at})
+	}
+	keep := backup.Keep(backups, backup.Retention{Hourly: 3, Daily: 2, Weekly: 2})
+	want := []string{
+		"20250910-120000", // latest, of the hour, of the day and of the week
+		"20250910-114000", // of the hours before
+		"20250910-104000",
+		"20250909-234000", // of the day before
+		"20250907-234000", // of the week before, Sunday
+	}
+	if len(keep) != len(want) {
+		t.Fatalf("expected %d backups kept, got %v", len(want), keep)
+	}
+	for _, id := range want {
+		if !keep[id] {
+			t.Fatalf("expected %s kept, got %v", id, keep)
+		}
+	}
+
+	keep = backup.Keep(backups, backup.Retention{})
+	if len(keep) != 1 || !keep[backups[0].ID] {
+		t.Fatalf("expected only the latest kept, got %v", keep)
+	}
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		ext      string
+		open     func(t *testing.T, file string) storage.LogEntryService
+		newStore func(file string) backup.Store
+	}{
+		{
+			name: "sqlite",
+			ext:  ".db",
+			open: func(t *testing.T, file string) storage.LogEntryService {
+				store, err := sqlite.New(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { store.Close() })
+				return &sqlite.LogEntrySQLiteStore{SQLiteStore: store}
+			},
+			newStore: backup.NewSQLiteStore,
+		},
+		{
+			name: "file",
+			ext:  ".json",
+			open: func(t *testing.T, file string) storage.LogEntryService {
+				store, err := filestore.Open(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return store.LogEntryService()
+			},
+			newStore: backup.NewFileStore,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			file := filepath.Join(dir, "lifelog"+tt.ext)
+			manager := backup.New(filepath.Join(dir, "backups"), tt.ext, tt.newStore(file), backup.DefaultRetention)
+
+			if _, err := manager.Create(ctx); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected no backup of a missing store, got %v", err)
+			}
+			entries := tt.open(t, file)
+			if _, err := entries.Add(ctx, models.LogEntry{Text: "before"}); err != nil {
+				t.Fatal(err)
+			}
+			b, err := manager.Create(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Size == 0 {
+				t.Fatalf("expected a non-empty backup, got %+v", b)
+			}
+			if _, err := entries.Add(ctx, models.LogEntry{Text: "after"}); err != nil {
+				t.Fatal(err)
+			}
+
+			// a corrupt backup is refused
+			corrupt := filepath.Join(dir, "backups", "20000101-000000"+tt.ext)
+			if err := os.WriteFile(corrupt, []byte("garbage"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := manager.Restore(ctx, "20000101-000000"); err == nil {
+				t.Fatalf("expected the corrupt backup refused")
+			}
+			if err := os.Remove(corrupt); err != nil {
+				t.Fatal(err)
+			}
+
+			// backups are a second apart at least
+			time.Sleep(time.Until(b.Time.Add(time.Second)))
+			current, err := manager.Restore(ctx, b.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current == nil || current.ID == b.ID {
+				t.Fatalf("expected the store backed up before restoring, got %+v", current)
+			}
+			list, _, err := tt.open(t, file).List(ctx, storage.LogEntryListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 || list[0].Text != "before" {
+				t.Fatalf("expected the store as backed up, got %+v", list)
+			}
+			backups, err := manager.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// of the same hour only the latest is kept
+			if len(backups) != 1 || backups[0].ID != current.ID {
+				t.Fatalf("expected the latest backup only, got %+v", backups)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package exchange moves the content of a store in and out as a
+// Document, the schema of `todo export` and `todo import`
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xhd2015/todo/models"
+)
+
+// Version is the current Document schema version. Files exported
+// before the schema was versioned read as version 0, they only
+// have entries.
+const Version = 1
+
+// Document is the whole content of a store. Entries are listed
+// flat at every depth, linked by their ParentID. IDs are those of
+// the exporting store, importing maps them to new ones.
+type Document struct {
+	Version    int       `json:"version"`
+	ExportTime time.Time `json:"export_time"`
+
+	Entries    []Entry             `json:"entries"`
+	Happenings []*models.Happening `json:"happenings,omitempty"`
+	States     []State             `json:"states,omitempty"`
+
+	// Groups are ordered by position, GroupMemberships refer to
+	// their IDs
+	Groups           []models.Group           `json:"groups,omitempty"`
+	GroupMemberships []models.GroupMembership `json:"group_memberships,omitempty"`
+}
+
+type Entry struct {
+	Data  *models.LogEntry `json:"data"`
+	Notes []Note           `json:"notes"`
+}
+
+type Note struct {
+	Data *models.Note `json:"data"`
+}
+
+// State is a state record with its events, oldest first
+type State struct {
+	Data   *models.State        `json:"data"`
+	Events []*models.StateEvent `json:"events,omitempty"`
+}
+
+// Read decodes a Document, refusing those of a newer schema
+func Read(r io.Reader) (*Document, error) {
+	var doc Document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+	if doc.Version > Version {
+		return nil, fmt.Errorf("document version %d is newer than the supported %d, upgrade todo to import it", doc.Version, Version)
+	}
+	for i, entry := range doc.Entries {
+		if entry.Data == nil {
+			return nil, fmt.Errorf("entry %d has no data", i)
+		}
+	}
+	return &doc, nil
+}
+
+// Write encodes the Document as indented JSON
+func Write(w io.Writer, doc *Document) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Tree returns the entries of the document as views with their
+// notes, nested by ParentID in document order
+func (doc *Document) Tree() []*models.LogEntryView {
+	roots, children := docTree(doc.Entries)
+	var views func(entries []Entry) []*models.LogEntryView
+	views = func(entries []Entry) []*models.LogEntryView {
+		result := make([]*models.LogEntryView, 0, len(entries))
+		for _, entry := range entries {
+			view := &models.LogEntryView{
+				Data:     entry.Data,
+				Children: views(children[entry.Data.ID]),
+			}
+			for _, note := range entry.Notes {
+				if note.Data != nil {
+					view.Notes = append(view.Notes, &models.NoteView{Data: note.Data})
+				}
+			}
+			result = append(result, view)
+		}
+		return result
+	}
+	return views(roots)
+}
+
+// NewEntry converts an entry view with its notes, but not its
+// children
+func NewEntry(view *models.LogEntryView) Entry {
+	entry := Entry{
+		Data:  view.Data,
+		Notes: make([]Note, 0, len(view.Notes)),
+	}
+	for _, note := range view.Notes {
+		entry.Notes = append(entry.Notes, Note{Data: note.Data})
+	}
+	return entry
+}
@@ -0,0 +1,430 @@
+package exchange_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/exchange"
+	"github.com/xhd2015/todo/data/storage/filestore"
+	"github.com/xhd2015/todo/data/storage/sqlite"
+	"github.com/xhd2015/todo/models"
+)
+
+func sqliteServices(t *testing.T) *data.Services {
+	store, err := sqlite.New(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return &data.Services{
+		LogEntry:       &sqlite.LogEntrySQLiteStore{SQLiteStore: store},
+		LogNote:        &sqlite.LogNoteSQLiteStore{SQLiteStore: store},
+		Happening:      &sqlite.HappeningSQLiteStore{SQLiteStore: store},
+		StateRecording: &sqlite.StateRecordingSQLiteStore{SQLiteStore: store},
+		Group:          &sqlite.GroupSQLiteStore{SQLiteStore: store},
+	}
+}
+
+func fileServices(t *testing.T) *data.Services {
+	store, err := filestore.Open(filepath.Join(t.TempDir(), "lifelog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &data.Services{
+		LogEntry:       store.LogEntryService(),
+		LogNote:        store.LogNoteService(),
+		Happening:      store.HappeningService(),
+		StateRecording: store.StateRecordingService(),
+		Group:          store.GroupService(),
+	}
+}
+
+// seed fills a store with nested entries, notes, happenings, states
+// and groups. Times are whole seconds, as sqlite keeps them.
+func seed(t *testing.T, services *data.Services) {
+	t.Helper()
+	ctx := context.Background()
+	base := time.Date(2025, 9, 1, 9, 30, 0, 0, time.Local)
+	at := func(minutes int) time.Time {
+		return base.Add(time.Duration(minutes) * time.Minute)
+	}
+	add := func(entry models.LogEntry) int64 {
+		t.Helper()
+		entry.CreateTime = at(len(entry.Text))
+		entry.UpdateTime = entry.CreateTime
+		id, err := services.LogEntry.Add(ctx, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	doneTime := at(90)
+	dueTime := at(24 * 60)
+
+	projectID := add(models.LogEntry{Text: "project #work", HighlightLevel: 2, Collapsed: true})
+	taskID := add(models.LogEntry{Text: "write design", ParentID: projectID, DueTime: &dueTime})
+	add(models.LogEntry{Text: "review", ParentID: taskID, Done: true, DoneTime: &doneTime})
+	// the same text at another place is a different entry
+	add(models.LogEntry{Text: "review", ParentID: projectID})
+	waterID := add(models.LogEntry{Text: "water plants", Repeat: "daily", Done: true, DoneTime: &doneTime})
+	add(models.LogEntry{Text: "water plants", Repeat: "daily", PreviousID: waterID})
+
+	if _, err := services.LogNote.Add(ctx, taskID, models.Note{Text: "draft in docs", CreateTime: at(5), UpdateTime: at(6)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.LogNote.Add(ctx, taskID, models.Note{Text: "ask for review", CreateTime: at(7), UpdateTime: at(7)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := services.Happening.Add(ctx, &models.Happening{Content: "shipped v1", CreateTime: at(100), UpdateTime: at(100)}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := services.StateRecording.CreateState(ctx, &models.State{Name: "energy", Scope: "human", Score: 1.5, CreateTime: at(1), UpdateTime: at(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.StateRecording.AddStateEvent(ctx, &models.StateEvent{StateRecordID: state.ID, DeltaScore: 1.5, Scope: "human", CreateTime: at(2), UpdateTime: at(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	readingID, err := services.Group.AddGroup(ctx, models.Group{Name: "Reading"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := services.Group.SetMembership(ctx, models.GroupMembership{EntryID: taskID, GroupID: readingID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.Group.SetMembership(ctx, models.GroupMembership{EntryID: waterID, GroupID: 0}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// node is an entry of a document with IDs replaced by what they
+// refer to, so documents of different stores compare equal
+type node struct {
+	Entry    models.LogEntry
+	Previous string
+	Group    string
+	Notes    []models.Note
+	Children []*node
+}
+
+type canonical struct {
+	Tree       []*node
+	Happenings []models.Happening
+	States     []exchange.State
+	Groups     []string
+}
+
+func canonicalize(doc *exchange.Document) canonical {
+	groupNames := make(map[int64]string)
+	var c canonical
+	for _, group := range doc.Groups {
+		groupNames[group.ID] = group.Name
+		c.Groups = append(c.Groups, group.Name)
+	}
+	memberships := make(map[int64]string)
+	for _, membership := range doc.GroupMemberships {
+		memberships[membership.EntryID] = "group:" + groupNames[membership.GroupID]
+	}
+
+	texts := make(map[int64]string)
+	nodes := make(map[int64]*node)
+	for _, entry := range doc.Entries {
+		texts[entry.Data.ID] = entry.Data.Text
+		n := &node{Entry: *entry.Data, Group: memberships[entry.Data.ID]}
+		for _, note := range entry.Notes {
+			note := *note.Data
+			note.ID, note.EntryID = 0, 0
+			n.Notes = append(n.Notes, note)
+		}
+		nodes[entry.Data.ID] = n
+	}
+	for _, entry := range doc.Entries {
+		n := nodes[entry.Data.ID]
+		n.Previous = texts[entry.Data.PreviousID]
+		if parent, ok := nodes[entry.Data.ParentID]; ok {
+			parent.Children = append(parent.Children, n)
+		} else {
+			c.Tree = append(c.Tree, n)
+		}
+	}
+	for _, n := range nodes {
+		n.Entry.ID, n.Entry.ParentID, n.Entry.PreviousID = 0, 0, 0
+		sortNodes(n.Children)
+	}
+	sortNodes(c.Tree)
+
+	for _, happening := range doc.Happenings {
+		h := *happening
+		h.ID = 0
+		c.Happenings = append(c.Happenings, h)
+	}
+	for _, state := range doc.States {
+		s := *state.Data
+		s.ID = 0
+		var events []*models.StateEvent
+		for _, event := range state.Events {
+			e := *event
+			e.ID, e.StateRecordID = 0, 0
+			events = append(events, &e)
+		}
+		c.States = append(c.States, exchange.State{Data: &s, Events: events})
+	}
+	return c
+}
+
+func sortNodes(nodes []*node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Entry.Text != nodes[j].Entry.Text {
+			return nodes[i].Entry.Text < nodes[j].Entry.Text
+		}
+		return nodes[i].Previous < nodes[j].Previous
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	targets := []struct {
+		name     string
+		services func(t *testing.T) *data.Services
+	}{
+		{name: "sqlite", services: sqliteServices},
+		{name: "file", services: fileServices},
+	}
+	for _, target := range targets {
+		t.Run(target.name, func(t *testing.T) {
+			ctx := context.Background()
+			source := sqliteServices(t)
+			seed(t, source)
+			doc, err := exchange.Export(ctx, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(doc.Entries) != 6 {
+				t.Fatalf("expected entries at every depth exported, got %d", len(doc.Entries))
+			}
+
+			var buf bytes.Buffer
+			if err := exchange.Write(&buf, doc); err != nil {
+				t.Fatal(err)
+			}
+			read, err := exchange.Read(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			services := target.services(t)
+			result, err := exchange.Import(ctx, services, read, exchange.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Entries != 6 || result.Notes != 2 || result.Happenings != 1 || result.States != 1 || result.StateEvents != 1 {
+				t.Fatalf("unexpected import result: %+v", result)
+			}
+
+			reexported, err := exchange.Export(ctx, services)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// compared as JSON, as backends differ in time locations
+			want, err := json.MarshalIndent(canonicalize(doc), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(canonicalize(reexported), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(want) != string(got) {
+				t.Fatalf("tree changed by the round trip\nwant: %s\ngot: %s", want, got)
+			}
+
+			// importing again adds nothing
+			result, err = exchange.Import(ctx, services, read, exchange.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Entries != 0 || result.SkippedEntries != 6 || result.Happenings != 0 || result.States != 0 || result.Groups != 0 {
+				t.Fatalf("expected everything skipped, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestReadLegacy(t *testing.T) {
+	ctx := context.Background()
+	// written by todo export before the schema was versioned
+	legacy := `{"entries": [
+		{"data": {"id": 7, "text": "child", "parent_id": 3}, "notes": [{"data": {"id": 1, "text": "note"}}]},
+		{"data": {"id": 3, "text": "parent"}, "notes": []}
+	]}`
+	doc, err := exchange.Read(strings.NewReader(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := sqliteServices(t)
+	result, err := exchange.Import(context.Background(), services, doc, exchange.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Entries != 2 || result.Notes != 1 {
+		t.Fatalf("unexpected import result: %+v", result)
+	}
+	m := data.NewLogManager(services)
+	if err := m.InitWithHistory(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 1 || m.Entries[0].Data.Text != "parent" || len(m.Entries[0].Children) != 1 || m.Entries[0].Children[0].Data.Text != "child" {
+		t.Fatalf("expected the child imported under its parent, got %+v", m.Entries)
+	}
+
+	if _, err := exchange.Read(strings.NewReader(`{"version": 99, "entries": []}`)); err == nil {
+		t.Fatalf("expected a newer document refused")
+	}
+}
+
+// edited returns a copy of the store's document, with "write design"
+// updated later and its notes changed, and "project #work" changed
+// without being updated
+func edited(t *testing.T, services *data.Services) *exchange.Document {
+	t.Helper()
+	doc, err := exchange.Export(context.Background(), services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := exchange.Write(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	doc, err = exchange.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range doc.Entries {
+		switch entry.Data.Text {
+		case "write design":
+			dueTime := entry.Data.DueTime.Add(24 * time.Hour)
+			entry.Data.DueTime = &dueTime
+			entry.Data.UpdateTime = entry.Data.UpdateTime.Add(time.Hour)
+			draft := entry.Notes[0].Data
+			draft.Text = "draft in docs, v2"
+			draft.UpdateTime = draft.UpdateTime.Add(time.Hour)
+			entry.Notes[1] = exchange.Note{Data: &models.Note{Text: "share with team", CreateTime: draft.UpdateTime, UpdateTime: draft.UpdateTime}}
+		case "project #work":
+			entry.Data.HighlightLevel = 3
+		}
+	}
+	return doc
+}
+
+func TestImportStrategies(t *testing.T) {
+	tests := []struct {
+		strategy exchange.Strategy
+		want     exchange.ImportResult
+		notes    []string
+		level    int
+	}{
+		{
+			strategy: exchange.Strategy_Skip,
+			want:     exchange.ImportResult{SkippedEntries: 6, SkippedHappenings: 1, SkippedStates: 1},
+			notes:    []string{"draft in docs", "ask for review"},
+			level:    2,
+		},
+		{
+			strategy: exchange.Strategy_MergeByPath,
+			want:     exchange.ImportResult{ChangedEntries: 1, SkippedEntries: 5, Notes: 2, SkippedHappenings: 1, SkippedStates: 1},
+			notes:    []string{"draft in docs", "ask for review", "draft in docs, v2", "share with team"},
+			level:    2,
+		},
+		{
+			strategy: exchange.Strategy_Overwrite,
+			want:     exchange.ImportResult{ChangedEntries: 2, SkippedEntries: 4, Notes: 2, DeletedNotes: 2, SkippedHappenings: 1, SkippedStates: 1},
+			notes:    []string{"draft in docs, v2", "share with team"},
+			level:    3,
+		},
+		{
+			strategy: exchange.Strategy_MergeByID,
+			want:     exchange.ImportResult{ChangedEntries: 1, SkippedEntries: 5, Notes: 1, ChangedNotes: 1, SkippedHappenings: 1, SkippedStates: 1},
+			notes:    []string{"draft in docs, v2", "ask for review", "share with team"},
+			level:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			ctx := context.Background()
+			services := sqliteServices(t)
+			seed(t, services)
+			doc := edited(t, services)
+
+			// a dry run predicts the result without changing the store
+			plan, err := exchange.NewPlan(ctx, services, doc, tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := *plan.Summary(); got != tt.want {
+				t.Fatalf("expected plan %+v, got %+v", tt.want, got)
+			}
+			current, err := exchange.Export(ctx, services)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current.Entries[0].Data.HighlightLevel != 2 || len(current.Entries[1].Notes) != 2 {
+				t.Fatalf("expected the store unchanged by planning")
+			}
+
+			result, err := exchange.Import(ctx, services, doc, exchange.Options{Strategy: tt.strategy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *result != tt.want {
+				t.Fatalf("expected result %+v, got %+v", tt.want, *result)
+			}
+
+			m := data.NewLogManager(services)
+			if err := m.InitWithHistory(ctx, true); err != nil {
+				t.Fatal(err)
+			}
+			var project, task *models.LogEntryView
+			for _, entry := range m.Entries {
+				if entry.Data.Text == "project #work" {
+					project = entry
+				}
+			}
+			for _, child := range project.Children {
+				if child.Data.Text == "write design" {
+					task = child
+				}
+			}
+			if project.Data.HighlightLevel != tt.level {
+				t.Fatalf("expected highlight level %d, got %d", tt.level, project.Data.HighlightLevel)
+			}
+			var notes []string
+			for _, note := range task.Notes {
+				notes = append(notes, note.Data.Text)
+			}
+			sort.Strings(notes)
+			sort.Strings(tt.notes)
+			if strings.Join(notes, "|") != strings.Join(tt.notes, "|") {
+				t.Fatalf("expected notes %q, got %q", tt.notes, notes)
+			}
+			wantDue := time.Date(2025, 9, 2, 9, 30, 0, 0, time.Local)
+			if tt.strategy != exchange.Strategy_Skip {
+				wantDue = wantDue.Add(24 * time.Hour)
+			}
+			if task.Data.DueTime == nil || !task.Data.DueTime.Equal(wantDue) {
+				t.Fatalf("expected due time %v, got %v", wantDue, task.Data.DueTime)
+			}
+		})
+	}
+
+	if _, err := exchange.ParseStrategy("newest"); err == nil {
+		t.Fatalf("expected an unknown strategy refused")
+	}
+}
@@ -0,0 +1,133 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// happeningPageSize pages through happenings, as the http backend
+// caps lists without a limit
+const happeningPageSize = 500
+
+// Export reads the whole store into a Document, entries in trash
+// excepted
+func Export(ctx context.Context, services *data.Services) (*Document, error) {
+	doc := &Document{
+		Version:    Version,
+		ExportTime: time.Now(),
+	}
+
+	entries, _, err := services.LogEntry.List(ctx, storage.LogEntryListOptions{IncludeHistory: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entries: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	entryIDs := make([]int64, 0, len(entries))
+	exported := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		entryIDs = append(entryIDs, entry.ID)
+		exported[entry.ID] = true
+	}
+	notes, err := services.LogNote.ListForEntries(ctx, entryIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	doc.Entries = make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		entryNotes := notes[entry.ID]
+		sort.Slice(entryNotes, func(i, j int) bool {
+			return entryNotes[i].ID < entryNotes[j].ID
+		})
+		exportEntry := Entry{
+			Data:  &entry,
+			Notes: make([]Note, 0, len(entryNotes)),
+		}
+		for _, note := range entryNotes {
+			exportEntry.Notes = append(exportEntry.Notes, Note{Data: &note})
+		}
+		doc.Entries = append(doc.Entries, exportEntry)
+	}
+
+	if services.Happening != nil {
+		doc.Happenings, err = listHappenings(services.Happening)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if services.StateRecording != nil {
+		states, err := services.StateRecording.ListStates(ctx, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list states: %w", err)
+		}
+		sort.Slice(states, func(i, j int) bool {
+			return states[i].ID < states[j].ID
+		})
+		for _, state := range states {
+			events, err := services.StateRecording.GetStateEvents(ctx, state.ID, 0)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list events of state %s: %w", state.Name, err)
+			}
+			sort.Slice(events, func(i, j int) bool {
+				if !events[i].CreateTime.Equal(events[j].CreateTime) {
+					return events[i].CreateTime.Before(events[j].CreateTime)
+				}
+				return events[i].ID < events[j].ID
+			})
+			doc.States = append(doc.States, State{Data: state, Events: events})
+		}
+	}
+
+	if services.Group != nil {
+		doc.Groups, err = services.Group.ListGroups(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list groups: %w", err)
+		}
+		memberships, err := services.Group.ListMemberships(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list group memberships: %w", err)
+		}
+		for _, membership := range memberships {
+			if exported[membership.EntryID] {
+				doc.GroupMemberships = append(doc.GroupMemberships, membership)
+			}
+		}
+		sort.Slice(doc.GroupMemberships, func(i, j int) bool {
+			return doc.GroupMemberships[i].EntryID < doc.GroupMemberships[j].EntryID
+		})
+	}
+	return doc, nil
+}
+
+// listHappenings lists all happenings, oldest first
+func listHappenings(svc storage.HappeningService) ([]*models.Happening, error) {
+	var happenings []*models.Happening
+	for {
+		page, total, err := svc.List(storage.HappeningListOptions{
+			Offset: len(happenings),
+			Limit:  happeningPageSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list happenings: %w", err)
+		}
+		happenings = append(happenings, page...)
+		if len(page) < happeningPageSize || int64(len(happenings)) >= total {
+			break
+		}
+	}
+	sort.Slice(happenings, func(i, j int) bool {
+		if !happenings[i].CreateTime.Equal(happenings[j].CreateTime) {
+			return happenings[i].CreateTime.Before(happenings[j].CreateTime)
+		}
+		return happenings[i].ID < happenings[j].ID
+	})
+	return happenings, nil
+}
@@ -0,0 +1,229 @@
+package exchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xhd2015/todo/internal/recur"
+	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/ui/tree"
+)
+
+// icsTimeLayout writes times in UTC, which every calendar reads
+// without a VTIMEZONE
+const icsTimeLayout = "20060102T150405Z"
+
+// icsLineLimit is the longest content line in octets, longer ones
+// are folded
+const icsLineLimit = 75
+
+type ICSHappening string
+
+const (
+	// ICSHappening_Event writes happenings as events, shown by calendars
+	ICSHappening_Event ICSHappening = "event"
+	// ICSHappening_Journal writes happenings as journal entries
+	ICSHappening_Journal ICSHappening = "journal"
+)
+
+type ICSOptions struct {
+	// Happenings defaults to ICSHappening_Event
+	Happenings ICSHappening
+}
+
+// ParseICSHappening parses the component of happenings, empty for
+// ICSHappening_Event
+func ParseICSHappening(s string) (ICSHappening, error) {
+	switch ICSHappening(s) {
+	case "", ICSHappening_Event:
+		return ICSHappening_Event, nil
+	case ICSHappening_Journal:
+		return ICSHappening_Journal, nil
+	}
+	return "", fmt.Errorf("unknown happening component %q, available: event, journal", s)
+}
+
+// WriteICS writes the document as an iCalendar (RFC 5545) VCALENDAR.
+// Entries are VTODOs, linked to their parent by RELATED-TO, and
+// happenings VEVENTs or VJOURNALs. States and groups are left out.
+func WriteICS(w io.Writer, doc *Document, opts ICSOptions) error {
+	iw := &icsWriter{w: bufio.NewWriter(w)}
+	stamp := doc.ExportTime
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//xhd2015//todo//EN")
+	iw.line("CALSCALE", "GREGORIAN")
+
+	tree.Walk(doc.Tree(), func(depth int, view *models.LogEntryView) {
+		entry := view.Data
+		iw.line("BEGIN", "VTODO")
+		iw.line("UID", entryUUID(entry.ID))
+		iw.time("DTSTAMP", stamp)
+		iw.time("CREATED", entry.CreateTime)
+		iw.time("LAST-MODIFIED", entry.UpdateTime)
+		iw.text("SUMMARY", entry.Text)
+		if len(view.Notes) > 0 {
+			notes := make([]string, 0, len(view.Notes))
+			for _, note := range view.Notes {
+				notes = append(notes, note.Data.Text)
+			}
+			iw.text("DESCRIPTION", strings.Join(notes, "\n\n"))
+		}
+		if tags := models.ParseTags(entry.Text); len(tags) > 0 {
+			escaped := make([]string, 0, len(tags))
+			for _, tag := range tags {
+				escaped = append(escaped, escapeICSText(tag))
+			}
+			iw.line("CATEGORIES", strings.Join(escaped, ","))
+		}
+		if entry.HighlightLevel > 0 {
+			// 1 is the highest of iCalendar priorities, 5 the medium
+			iw.line("PRIORITY", fmt.Sprint(max(1, 6-entry.HighlightLevel)))
+		}
+		// DTSTART must come before DUE
+		scheduled := entry.ScheduledTime != nil && (entry.DueTime == nil || entry.ScheduledTime.Before(*entry.DueTime))
+		if scheduled {
+			iw.time("DTSTART", *entry.ScheduledTime)
+		}
+		if entry.DueTime != nil {
+			iw.time("DUE", *entry.DueTime)
+		}
+		// recurrence is counted from DTSTART
+		if rule := icsRecurrence(entry.Repeat); rule != "" && scheduled {
+			iw.line("RRULE", rule)
+		}
+		if entry.Done {
+			iw.line("STATUS", "COMPLETED")
+			iw.line("PERCENT-COMPLETE", "100")
+			if entry.DoneTime != nil {
+				iw.time("COMPLETED", *entry.DoneTime)
+			}
+		} else {
+			iw.line("STATUS", "NEEDS-ACTION")
+		}
+		if depth > 0 {
+			iw.line("RELATED-TO;RELTYPE=PARENT", entryUUID(entry.ParentID))
+		}
+		iw.line("END", "VTODO")
+	})
+
+	component := "VEVENT"
+	if opts.Happenings == ICSHappening_Journal {
+		component = "VJOURNAL"
+	}
+	for _, happening := range doc.Happenings {
+		iw.line("BEGIN", component)
+		iw.line("UID", nameUUID(fmt.Sprintf("todo:happening:%d", happening.ID)))
+		iw.time("DTSTAMP", stamp)
+		iw.time("DTSTART", happening.CreateTime)
+		iw.time("LAST-MODIFIED", happening.UpdateTime)
+		// calendars show the summary, a journal its description
+		summary, _, _ := strings.Cut(strings.TrimSpace(happening.Content), "\n")
+		iw.text("SUMMARY", summary)
+		if component == "VJOURNAL" || summary != strings.TrimSpace(happening.Content) {
+			iw.text("DESCRIPTION", happening.Content)
+		}
+		if component == "VEVENT" {
+			iw.line("TRANSP", "TRANSPARENT")
+		}
+		iw.line("END", component)
+	}
+
+	iw.line("END", "VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+// icsRecurrence converts a repeat rule to an RRULE value. Monthly
+// rules on days some months lack skip those months in iCalendar.
+func icsRecurrence(repeat string) string {
+	if repeat == "" {
+		return ""
+	}
+	rule, err := recur.Parse(repeat)
+	if err != nil {
+		return ""
+	}
+	switch rule.Kind {
+	case recur.Kind_Daily:
+		return "FREQ=DAILY"
+	case recur.Kind_Weekdays:
+		return "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"
+	case recur.Kind_EveryDays:
+		if rule.N%7 == 0 {
+			if rule.N == 7 {
+				return "FREQ=WEEKLY"
+			}
+			return fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d", rule.N/7)
+		}
+		return fmt.Sprintf("FREQ=DAILY;INTERVAL=%d", rule.N)
+	case recur.Kind_Monthly:
+		return fmt.Sprintf("FREQ=MONTHLY;BYMONTHDAY=%d", rule.N)
+	}
+	return ""
+}
+
+// icsWriter writes content lines, folded and ended by CRLF, keeping
+// the first error
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (iw *icsWriter) time(name string, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	iw.line(name, t.UTC().Format(icsTimeLayout))
+}
+
+func (iw *icsWriter) text(name string, value string) {
+	iw.line(name, escapeICSText(value))
+}
+
+func (iw *icsWriter) line(name string, value string) {
+	if iw.err != nil {
+		return
+	}
+	_, iw.err = iw.w.WriteString(foldICSLine(name+":"+value) + "\r\n")
+}
+
+// escapeICSText escapes a TEXT value
+func escapeICSText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// foldICSLine breaks a content line into lines of at most 75 octets,
+// continuation lines starting with a space, never inside a UTF-8
+// sequence
+func foldICSLine(line string) string {
+	if len(line) <= icsLineLimit {
+		return line
+	}
+	var b strings.Builder
+	limit := icsLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space counts
+		limit = icsLineLimit - 1
+	}
+	b.WriteString(line)
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package exchange_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xhd2015/todo/data/exchange"
+	"github.com/xhd2015/todo/models"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// icsDocument has times in two zones, text to escape and fold, and
+// every kind of component
+func icsDocument() *exchange.Document {
+	shanghai := time.FixedZone("CST", 8*60*60)
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2025, 9, day, hour, minute, 0, 0, shanghai)
+	}
+	ptr := func(t time.Time) *time.Time {
+		return &t
+	}
+	created := at(1, 9, 30)
+	return &exchange.Document{
+		Version:    exchange.Version,
+		ExportTime: time.Date(2025, 9, 5, 12, 0, 0, 0, time.UTC),
+		Entries: []exchange.Entry{
+			{Data: &models.LogEntry{ID: 1, Text: "project #work", HighlightLevel: 2, CreateTime: created, UpdateTime: created}},
+			{
+				Data: &models.LogEntry{ID: 2, ParentID: 1, Text: "write design; then review, maybe \\ not", CreateTime: created, UpdateTime: at(2, 10, 0),
+					ScheduledTime: ptr(at(2, 9, 0)), DueTime: ptr(at(3, 17, 0)), Repeat: "weekdays"},
+				Notes: []exchange.Note{
+					{Data: &models.Note{Text: "draft in docs:\nsection 1\nsection 2"}},
+					{Data: &models.Note{Text: "设计文档需要在周五之前完成评审，然后再同步给所有相关的同事和合作伙伴，以便大家提前准备"}},
+				},
+			},
+			{Data: &models.LogEntry{ID: 3, ParentID: 2, Text: "review", Done: true, DoneTime: ptr(time.Date(2025, 9, 3, 8, 15, 0, 0, time.UTC)), CreateTime: created, UpdateTime: created}},
+			{Data: &models.LogEntry{ID: 4, Text: "water plants", Repeat: "monthly:15", CreateTime: created, UpdateTime: created}},
+		},
+		Happenings: []*models.Happening{
+			{ID: 1, Content: "shipped v1", CreateTime: at(4, 18, 0), UpdateTime: at(4, 18, 0)},
+			{ID: 2, Content: "retro\nwent well, mostly", CreateTime: at(5, 9, 0), UpdateTime: at(5, 9, 5)},
+		},
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	tests := []struct {
+		golden string
+		opts   exchange.ICSOptions
+	}{
+		{golden: "export.ics"},
+		{golden: "export_journal.ics", opts: exchange.ICSOptions{Happenings: exchange.ICSHappening_Journal}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := exchange.WriteICS(&buf, icsDocument(), tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+				if len(line) > 75 || !utf8.ValidString(line) {
+					t.Fatalf("expected lines folded to 75 octets at rune boundaries, got %q", line)
+				}
+			}
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != string(want) {
+				t.Fatalf("output differs from %s, rerun with -update if intended\ngot:\n%s", golden, buf.String())
+			}
+		})
+	}
+}
+
+// TestWriteICSFromSQLite exports from sqlite, which keeps local wall
+// clocks, under a zone other than UTC
+func TestWriteICSFromSQLite(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("CST", 8*60*60)
+	defer func() { time.Local = local }()
+
+	ctx := context.Background()
+	services := sqliteServices(t)
+	created := time.Date(2026, 10, 17, 10, 0, 0, 0, time.Local)
+	done := time.Date(2026, 10, 17, 11, 30, 0, 0, time.Local)
+	due := time.Date(2026, 10, 18, 17, 0, 0, 0, time.Local)
+	_, err := services.LogEntry.Add(ctx, models.LogEntry{
+		Text: "ship v2", Done: true, DoneTime: &done, DueTime: &due,
+		CreateTime: created, UpdateTime: done,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = services.Happening.Add(ctx, &models.Happening{Content: "shipped v2", CreateTime: done, UpdateTime: done})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := exchange.Export(ctx, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := exchange.WriteICS(&buf, doc, exchange.ICSOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\r\n")
+	for _, want := range []string{
+		"CREATED:20261017T020000Z",
+		"LAST-MODIFIED:20261017T033000Z",
+		"COMPLETED:20261017T033000Z",
+		"DUE:20261018T090000Z",
+		"DTSTART:20261017T033000Z",
+	} {
+		if !slices.Contains(lines, want) {
+			t.Fatalf("expected %s in\n%s", want, buf.String())
+		}
+	}
+}
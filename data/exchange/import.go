@@ -0,0 +1,280 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// ImportResult counts what Import added, changed and skipped
+type ImportResult struct {
+	Entries           int
+	ChangedEntries    int
+	SkippedEntries    int
+	Notes             int
+	ChangedNotes      int
+	DeletedNotes      int
+	Happenings        int
+	SkippedHappenings int
+	States            int
+	SkippedStates     int
+	StateEvents       int
+	Groups            int
+	GroupMemberships  int
+	// TrashedEntries is, for Migrate, the number of entries in trash
+	// of the source, which are not copied
+	TrashedEntries int
+}
+
+type Options struct {
+	// Strategy defaults to Strategy_Skip
+	Strategy Strategy
+	// Progress, if set, is called after each item imported, stage is
+	// one of "entries", "happenings", "states" and "group memberships"
+	Progress func(stage string, done int, total int)
+}
+
+// Import adds the content of the document to the store under new
+// IDs, keeping the hierarchy. With the default Strategy_Skip, what
+// the store already has is skipped, so importing a document twice
+// adds it once:
+//   - entries with the same text under the same parent, their
+//     children go under the entry already there
+//   - happenings with the same content and create time
+//   - states with the same name, with their events
+//
+// Groups are matched by name and added if missing.
+func Import(ctx context.Context, services *data.Services, doc *Document, opts Options) (*ImportResult, error) {
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = Strategy_Skip
+	}
+	plan, err := NewPlan(ctx, services, doc, strategy)
+	if err != nil {
+		return nil, err
+	}
+	plan.Progress = opts.Progress
+	return plan.Apply(ctx, services)
+}
+
+// Apply changes the store as planned. Planning and applying against
+// a store changed in between is not guarded against.
+func (p *Plan) Apply(ctx context.Context, services *data.Services) (*ImportResult, error) {
+	result := &ImportResult{}
+	progress := func(stage string, done int, total int) {
+		if p.Progress != nil {
+			p.Progress(stage, done, total)
+		}
+	}
+	var totalEntries, doneEntries int
+	var count func(plans []*EntryPlan)
+	count = func(plans []*EntryPlan) {
+		for _, ep := range plans {
+			totalEntries++
+			count(ep.Children)
+		}
+	}
+	count(p.Entries)
+
+	// entryIDs maps the IDs in the document to those in the store,
+	// added maps only the entries added
+	entryIDs := make(map[int64]int64)
+	added := make(map[int64]bool)
+	var apply func(plans []*EntryPlan, parentID int64) error
+	apply = func(plans []*EntryPlan, parentID int64) error {
+		for _, ep := range plans {
+			id, err := applyEntry(ctx, services, ep, parentID, entryIDs, result)
+			if err != nil {
+				return err
+			}
+			entryIDs[ep.Entry.Data.ID] = id
+			if ep.Action == Action_Add {
+				added[ep.Entry.Data.ID] = true
+			}
+			doneEntries++
+			progress("entries", doneEntries, totalEntries)
+			if err := apply(ep.Children, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := apply(p.Entries, 0); err != nil {
+		return nil, err
+	}
+
+	result.SkippedHappenings = p.SkippedHappenings
+	if err := importHappenings(ctx, services.Happening, p.Happenings, result, progress); err != nil {
+		return nil, err
+	}
+	result.SkippedStates = p.SkippedStates
+	if err := importStates(ctx, services.StateRecording, p.States, result, progress); err != nil {
+		return nil, err
+	}
+	if p.groupIDs != nil {
+		if err := p.importGroups(ctx, services.Group, entryIDs, added, result, progress); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// applyEntry adds or changes the entry, returning its ID in the store
+func applyEntry(ctx context.Context, services *data.Services, ep *EntryPlan, parentID int64, entryIDs map[int64]int64, result *ImportResult) (int64, error) {
+	switch ep.Action {
+	case Action_Skip:
+		result.SkippedEntries++
+		return ep.ExistingID, nil
+	case Action_Change:
+		if len(ep.Changes) > 0 {
+			if err := services.LogEntry.Update(ctx, ep.ExistingID, ep.Update); err != nil {
+				return 0, fmt.Errorf("failed to update entry %d: %w", ep.ExistingID, err)
+			}
+		}
+		for _, note := range ep.UpdateNotes {
+			if err := services.LogNote.Update(ctx, ep.ExistingID, note.ID, note.Update); err != nil {
+				return 0, fmt.Errorf("failed to update note %d: %w", note.ID, err)
+			}
+			result.ChangedNotes++
+		}
+		for _, noteID := range ep.DeleteNotes {
+			if err := services.LogNote.Delete(ctx, ep.ExistingID, noteID); err != nil {
+				return 0, fmt.Errorf("failed to delete note %d: %w", noteID, err)
+			}
+			result.DeletedNotes++
+		}
+		if err := addNotes(ctx, services, ep.ExistingID, ep.AddNotes, result); err != nil {
+			return 0, err
+		}
+		result.ChangedEntries++
+		return ep.ExistingID, nil
+	}
+
+	newEntry := *ep.Entry.Data
+	newEntry.ID = 0
+	newEntry.ParentID = parentID
+	// occurrences link to earlier ones only if those were imported too
+	newEntry.PreviousID = entryIDs[ep.Entry.Data.PreviousID]
+	newEntry.DeletedTime = nil
+	id, err := services.LogEntry.Add(ctx, newEntry)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add entry: %w", err)
+	}
+	result.Entries++
+
+	notes := make([]models.Note, 0, len(ep.Entry.Notes))
+	for _, note := range ep.Entry.Notes {
+		if note.Data != nil {
+			notes = append(notes, *note.Data)
+		}
+	}
+	if err := addNotes(ctx, services, id, notes, result); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func addNotes(ctx context.Context, services *data.Services, entryID int64, notes []models.Note, result *ImportResult) error {
+	for _, note := range notes {
+		note.ID = 0
+		note.EntryID = entryID
+		if _, err := services.LogNote.Add(ctx, entryID, note); err != nil {
+			return fmt.Errorf("failed to add note: %w", err)
+		}
+		result.Notes++
+	}
+	return nil
+}
+
+func importHappenings(ctx context.Context, svc storage.HappeningService, happenings []*models.Happening, result *ImportResult, progress func(stage string, done int, total int)) error {
+	for i, happening := range happenings {
+		newHappening := *happening
+		newHappening.ID = 0
+		if _, err := svc.Add(ctx, &newHappening); err != nil {
+			return fmt.Errorf("failed to add happening: %w", err)
+		}
+		result.Happenings++
+		progress("happenings", i+1, len(happenings))
+	}
+	return nil
+}
+
+func importStates(ctx context.Context, svc storage.StateRecordingService, states []State, result *ImportResult, progress func(stage string, done int, total int)) error {
+	stateIDs := make(map[int64]int64, len(states))
+	for i, state := range states {
+		newState := *state.Data
+		newState.ID = 0
+		newState.ParentStateRecordID = stateIDs[state.Data.ParentStateRecordID]
+		created, err := svc.CreateState(ctx, &newState)
+		if err != nil {
+			return fmt.Errorf("failed to create state %s: %w", state.Data.Name, err)
+		}
+		stateIDs[state.Data.ID] = created.ID
+		result.States++
+
+		for _, event := range state.Events {
+			if event == nil {
+				continue
+			}
+			newEvent := *event
+			newEvent.ID = 0
+			newEvent.StateRecordID = created.ID
+			if _, err := svc.AddStateEvent(ctx, &newEvent); err != nil {
+				return fmt.Errorf("failed to add event of state %s: %w", state.Data.Name, err)
+			}
+			result.StateEvents++
+		}
+		progress("states", i+1, len(states))
+	}
+	return nil
+}
+
+// importGroups adds the missing groups and the memberships of the
+// added entries
+func (p *Plan) importGroups(ctx context.Context, svc storage.GroupService, entryIDs map[int64]int64, added map[int64]bool, result *ImportResult, progress func(stage string, done int, total int)) error {
+	groupIDs := make(map[int64]int64, len(p.groupIDs)+len(p.Groups))
+	for docID, id := range p.groupIDs {
+		groupIDs[docID] = id
+	}
+	// added groups go last, in the order of the document
+	for _, group := range p.Groups {
+		id, err := svc.AddGroup(ctx, models.Group{Name: group.Name})
+		if err != nil {
+			return fmt.Errorf("failed to add group %s: %w", group.Name, err)
+		}
+		groupIDs[group.ID] = id
+		result.Groups++
+	}
+
+	for i, membership := range p.GroupMemberships {
+		if err := setMembership(ctx, svc, membership, groupIDs, entryIDs, added, result); err != nil {
+			return err
+		}
+		progress("group memberships", i+1, len(p.GroupMemberships))
+	}
+	return nil
+}
+
+// setMembership sets the group of an added entry, mapping the IDs of
+// the document to those of the store
+func setMembership(ctx context.Context, svc storage.GroupService, membership models.GroupMembership, groupIDs map[int64]int64, entryIDs map[int64]int64, added map[int64]bool, result *ImportResult) error {
+	if !added[membership.EntryID] {
+		return nil
+	}
+	groupID, ok := groupIDs[membership.GroupID]
+	if membership.GroupID != 0 && !ok {
+		return nil
+	}
+	err := svc.SetMembership(ctx, models.GroupMembership{
+		EntryID: entryIDs[membership.EntryID],
+		GroupID: groupID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set group of entry %d: %w", membership.EntryID, err)
+	}
+	result.GroupMemberships++
+	return nil
+}
@@ -0,0 +1,173 @@
+package exchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/ui/tree"
+)
+
+// markdownTimeLayout is the layout of done times in Markdown,
+// in local time
+const markdownTimeLayout = "2006-01-02 15:04"
+
+var (
+	markdownItemPattern = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s+(?:\[([ xX])\](?:\s+|$))?(.*)$`)
+	markdownDonePattern = regexp.MustCompile(`\s*\(done (\d{4}-\d{2}-\d{2}(?: \d{2}:\d{2})?)\)$`)
+)
+
+// WriteMarkdown writes the entries of the document as GitHub task
+// lists, children indented by two spaces, done entries followed by
+// their done time as "(done 2025-09-01 11:00)". Notes are blockquotes
+// under their entry, separated by blank lines. Happenings, states
+// and groups are left out.
+func WriteMarkdown(w io.Writer, doc *Document) error {
+	bw := bufio.NewWriter(w)
+	tree.Walk(doc.Tree(), func(depth int, entry *models.LogEntryView) {
+		indent := strings.Repeat("  ", depth)
+		check := " "
+		if entry.Data.Done {
+			check = "x"
+		}
+		bw.WriteString(indent + "- [" + check + "] " + strings.Join(strings.Fields(entry.Data.Text), " "))
+		if entry.Data.Done && entry.Data.DoneTime != nil {
+			bw.WriteString(" (done " + entry.Data.DoneTime.Local().Format(markdownTimeLayout) + ")")
+		}
+		bw.WriteString("\n")
+
+		for i, note := range entry.Notes {
+			if i > 0 {
+				bw.WriteString("\n")
+			}
+			for _, line := range strings.Split(strings.TrimSpace(note.Data.Text), "\n") {
+				line = strings.TrimRight(line, " \t\r")
+				if line == "" {
+					bw.WriteString(indent + "  >\n")
+					continue
+				}
+				bw.WriteString(indent + "  > " + line + "\n")
+			}
+		}
+	})
+	return bw.Flush()
+}
+
+// ReadMarkdown parses an outline of nested lists into a Document,
+// as written by WriteMarkdown. Any list item is an entry, done if
+// checked, and blockquotes under an item are its notes. Headings,
+// paragraphs and code blocks are skipped. Entries get IDs in
+// outline order, from 1.
+func ReadMarkdown(r io.Reader) (*Document, error) {
+	doc := &Document{Version: Version}
+
+	type openItem struct {
+		indent int
+		id     int64
+	}
+	// items are the items enclosing the current line, innermost last
+	var items []openItem
+	var noteLines []string
+	var noteEntry int64
+	flushNote := func() {
+		if noteEntry != 0 && len(noteLines) > 0 {
+			entry := &doc.Entries[noteEntry-1]
+			entry.Notes = append(entry.Notes, Note{Data: &models.Note{Text: strings.Join(noteLines, "\n")}})
+		}
+		noteLines = nil
+		noteEntry = 0
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	var fence string
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.ReplaceAll(strings.TrimRight(scanner.Text(), " \t\r"), "\t", "    ")
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			flushNote()
+			fence = trimmed[:3]
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ">") {
+			// the note belongs to the innermost item it is indented under
+			var owner int64
+			for i := len(items) - 1; i >= 0; i-- {
+				if items[i].indent < indent {
+					owner = items[i].id
+					break
+				}
+			}
+			if owner == 0 {
+				flushNote()
+				continue
+			}
+			if owner != noteEntry {
+				flushNote()
+				noteEntry = owner
+			}
+			text := strings.TrimPrefix(trimmed, ">")
+			noteLines = append(noteLines, strings.TrimPrefix(text, " "))
+			continue
+		}
+		flushNote()
+
+		match := markdownItemPattern.FindStringSubmatch(trimmed)
+		if match == nil {
+			if trimmed != "" && indent == 0 {
+				// a heading or paragraph ends the list
+				items = nil
+			}
+			continue
+		}
+		for len(items) > 0 && items[len(items)-1].indent >= indent {
+			items = items[:len(items)-1]
+		}
+
+		entry := &models.LogEntry{
+			Done: match[1] == "x" || match[1] == "X",
+			Text: strings.TrimSpace(match[2]),
+		}
+		if entry.Done {
+			if done := markdownDonePattern.FindStringSubmatch(entry.Text); done != nil {
+				layout := markdownTimeLayout
+				if len(done[1]) == len("2006-01-02") {
+					layout = "2006-01-02"
+				}
+				doneTime, err := time.ParseInLocation(layout, done[1], time.Local)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid done time %q: %w", lineNo, done[1], err)
+				}
+				entry.DoneTime = &doneTime
+				entry.Text = strings.TrimSpace(entry.Text[:len(entry.Text)-len(done[0])])
+			}
+		}
+		if entry.Text == "" {
+			continue
+		}
+		entry.ID = int64(len(doc.Entries) + 1)
+		if len(items) > 0 {
+			entry.ParentID = items[len(items)-1].id
+		}
+		doc.Entries = append(doc.Entries, Entry{Data: entry, Notes: []Note{}})
+		items = append(items, openItem{indent: indent, id: entry.ID})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read markdown: %w", err)
+	}
+	flushNote()
+	return doc, nil
+}
@@ -0,0 +1,96 @@
+package exchange_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data/exchange"
+)
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	// the file store keeps time zones, sqlite reads times as UTC
+	services := fileServices(t)
+	seed(t, services)
+	doc, err := exchange.Export(context.Background(), services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := exchange.WriteMarkdown(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	want := `- [ ] project #work
+  - [ ] write design
+    > draft in docs
+
+    > ask for review
+    - [x] review (done 2025-09-01 11:00)
+  - [ ] review
+- [x] water plants (done 2025-09-01 11:00)
+- [ ] water plants
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected markdown\nwant:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	read, err := exchange.ReadMarkdown(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := exchange.WriteMarkdown(&again, read); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != want {
+		t.Fatalf("outline changed by the round trip\nwant:\n%s\ngot:\n%s", want, again.String())
+	}
+}
+
+func TestReadMarkdown(t *testing.T) {
+	outline := "# Plan\n" +
+		"\n" +
+		"Some intro, not a todo.\n" +
+		"\n" +
+		"* [X] ship it (done 2025-09-01)\n" +
+		"\t- plain bullet\n" +
+		"\t  > first line\n" +
+		"\t  >\n" +
+		"\t  > second paragraph\n" +
+		"\n" +
+		"```\n" +
+		"- [ ] not a todo\n" +
+		"```\n" +
+		"1. [ ] numbered\n" +
+		"   - [x] unknown done time\n"
+	doc, err := exchange.ReadMarkdown(strings.NewReader(outline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(doc.Entries))
+	}
+	ship, bullet, numbered, child := doc.Entries[0].Data, doc.Entries[1], doc.Entries[2].Data, doc.Entries[3].Data
+	if ship.Text != "ship it" || !ship.Done || ship.DoneTime == nil || !ship.DoneTime.Equal(time.Date(2025, 9, 1, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("unexpected checked item: %+v", ship)
+	}
+	if bullet.Data.Text != "plain bullet" || bullet.Data.Done || bullet.Data.ParentID != ship.ID {
+		t.Fatalf("expected the bullet a child of the checked item, got %+v", bullet.Data)
+	}
+	if len(bullet.Notes) != 1 || bullet.Notes[0].Data.Text != "first line\n\nsecond paragraph" {
+		t.Fatalf("unexpected notes: %+v", bullet.Notes)
+	}
+	if numbered.Text != "numbered" || numbered.ParentID != 0 {
+		t.Fatalf("expected the numbered item top-level, got %+v", numbered)
+	}
+	if child.ParentID != numbered.ID || !child.Done || child.DoneTime != nil {
+		t.Fatalf("unexpected child: %+v", child)
+	}
+
+	if _, err := exchange.ReadMarkdown(strings.NewReader("- [x] bad (done 2025-13-01)\n")); err == nil {
+		t.Fatalf("expected an invalid done time refused")
+	}
+}
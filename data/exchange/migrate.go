@@ -0,0 +1,174 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// Migrate copies everything of one store into another, which must be
+// empty or hold an earlier, interrupted migration: entries already
+// copied are matched by path and get their missing notes. A target
+// holding anything else is refused before anything is written.
+// Entries in trash stay behind, counted in TrashedEntries. The copy
+// is verified by exporting it again.
+func Migrate(ctx context.Context, from *data.Services, to *data.Services, progress func(stage string, done int, total int)) (*ImportResult, error) {
+	doc, err := Export(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+	trashed, _, err := from.LogEntry.List(ctx, storage.LogEntryListOptions{IncludeHistory: true, Deleted: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash of source: %w", err)
+	}
+	existing, err := Export(ctx, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target: %w", err)
+	}
+	if err := checkPartOf(doc, existing); err != nil {
+		return nil, fmt.Errorf("target is neither empty nor an earlier migration of the source: %w", err)
+	}
+	result, err := Import(ctx, to, doc, Options{Strategy: Strategy_MergeByPath, Progress: progress})
+	if err != nil {
+		return nil, err
+	}
+	result.TrashedEntries = len(trashed)
+	copied, err := Export(ctx, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target: %w", err)
+	}
+	if err := Verify(doc, copied); err != nil {
+		return result, fmt.Errorf("verification failed: %w", err)
+	}
+	return result, nil
+}
+
+// checkPartOf checks that got has no more of each kind of item than
+// want, and its entries only at paths of texts want has
+func checkPartOf(want *Document, got *Document) error {
+	wantCounts, gotCounts := countItems(want), countItems(got)
+	for i, count := range gotCounts {
+		if count.n > wantCounts[i].n {
+			return fmt.Errorf("%d %s, more than the %d of the source", count.n, count.name, wantCounts[i].n)
+		}
+	}
+	paths := make(map[string]bool, len(want.Entries))
+	walkPaths("", want.Tree(), func(path string) error {
+		paths[path] = true
+		return nil
+	})
+	return walkPaths("", got.Tree(), func(path string) error {
+		if !paths[path] {
+			return fmt.Errorf("%q is not in the source", path)
+		}
+		return nil
+	})
+}
+
+// walkPaths calls fn with the path of texts of each entry, parents
+// first
+func walkPaths(prefix string, views []*models.LogEntryView, fn func(path string) error) error {
+	for _, view := range views {
+		path := prefix + strings.TrimSpace(view.Data.Text)
+		if err := fn(path); err != nil {
+			return err
+		}
+		if err := walkPaths(path+" / ", view.Children, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks that got has the content of want, regardless of IDs:
+// the same number of each kind of item, and entries of the same text,
+// done state and number of notes nested the same way
+func Verify(want *Document, got *Document) error {
+	wantCounts, gotCounts := countItems(want), countItems(got)
+	for i, count := range wantCounts {
+		if gotCounts[i].n != count.n {
+			return fmt.Errorf("expected %d %s, got %d", count.n, count.name, gotCounts[i].n)
+		}
+	}
+	return compareShapes("", shapes(want.Tree()), shapes(got.Tree()))
+}
+
+type itemCount struct {
+	name string
+	n    int
+}
+
+func countItems(doc *Document) []itemCount {
+	var notes, events int
+	for _, entry := range doc.Entries {
+		notes += len(entry.Notes)
+	}
+	for _, state := range doc.States {
+		events += len(state.Events)
+	}
+	return []itemCount{
+		{"entries", len(doc.Entries)},
+		{"notes", notes},
+		{"happenings", len(doc.Happenings)},
+		{"states", len(doc.States)},
+		{"state events", events},
+		{"group memberships", len(doc.GroupMemberships)},
+	}
+}
+
+// shape is an entry reduced to what survives a migration
+type shape struct {
+	label    string
+	children []*shape
+	// key is the label followed by the keys of the children
+	key string
+}
+
+// shapes sorts siblings by key, as their order depends on the IDs of
+// the store
+func shapes(views []*models.LogEntryView) []*shape {
+	result := make([]*shape, 0, len(views))
+	for _, view := range views {
+		label := strings.TrimSpace(view.Data.Text)
+		if view.Data.Done {
+			label = "[x] " + label
+		}
+		if len(view.Notes) > 0 {
+			label += fmt.Sprintf(" (%d notes)", len(view.Notes))
+		}
+		sh := &shape{label: label, children: shapes(view.Children)}
+		keys := make([]string, 0, len(sh.children))
+		for _, child := range sh.children {
+			keys = append(keys, child.key)
+		}
+		sh.key = label + "{" + strings.Join(keys, ",") + "}"
+		result = append(result, sh)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].key < result[j].key
+	})
+	return result
+}
+
+func compareShapes(path string, want []*shape, got []*shape) error {
+	for i, w := range want {
+		if i >= len(got) {
+			return fmt.Errorf("missing %q", path+w.label)
+		}
+		if got[i].label != w.label {
+			return fmt.Errorf("expected %q, got %q", path+w.label, path+got[i].label)
+		}
+		if err := compareShapes(path+w.label+" / ", w.children, got[i].children); err != nil {
+			return err
+		}
+	}
+	if len(got) > len(want) {
+		return fmt.Errorf("unexpected %q", path+got[len(want)].label)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package exchange_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/todo/data/exchange"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	source := sqliteServices(t)
+	seed(t, source)
+	target := fileServices(t)
+
+	stages := make(map[string]int)
+	progress := func(stage string, done int, total int) {
+		if done > total {
+			t.Fatalf("%s: done %d of %d", stage, done, total)
+		}
+		stages[stage] = total
+	}
+	result, err := exchange.Migrate(ctx, source, target, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Entries != 6 || result.Notes != 2 || result.Happenings != 1 || result.States != 1 || result.StateEvents != 1 || result.GroupMemberships != 2 {
+		t.Fatalf("unexpected migrate result: %+v", result)
+	}
+	if stages["entries"] != 6 || stages["group memberships"] != 2 {
+		t.Fatalf("unexpected progress: %v", stages)
+	}
+
+	// migrating again copies nothing
+	result, err = exchange.Migrate(ctx, source, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Entries != 0 || result.Notes != 0 || result.Happenings != 0 || result.States != 0 {
+		t.Fatalf("expected nothing copied again, got %+v", result)
+	}
+
+	want, err := exchange.Export(ctx, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := exchange.Export(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range got.Entries {
+		if entry.Data.Text == "review" && entry.Data.Done {
+			entry.Data.Done = false
+		}
+	}
+	err = exchange.Verify(want, got)
+	if err == nil || !strings.Contains(err.Error(), `"project #work / write design (2 notes) / [x] review"`) {
+		t.Fatalf("expected the changed entry reported, got %v", err)
+	}
+	got.Happenings = nil
+	if err := exchange.Verify(want, got); err == nil || err.Error() != "expected 1 happenings, got 0" {
+		t.Fatalf("expected the missing happening reported, got %v", err)
+	}
+}
+
+func TestMigrateRefusesOtherTarget(t *testing.T) {
+	ctx := context.Background()
+	source := sqliteServices(t)
+	seed(t, source)
+	trashedID, err := source.LogEntry.Add(ctx, models.LogEntry{Text: "old idea"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.LogEntry.Delete(ctx, trashedID); err != nil {
+		t.Fatal(err)
+	}
+
+	target := fileServices(t)
+	if _, err := target.LogEntry.Add(ctx, models.LogEntry{Text: "project #work"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.LogEntry.Add(ctx, models.LogEntry{Text: "groceries"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = exchange.Migrate(ctx, source, target, nil)
+	if err == nil || !strings.Contains(err.Error(), `"groceries" is not in the source`) {
+		t.Fatalf("expected the target refused, got %v", err)
+	}
+	entries, _, err := target.LogEntry.List(ctx, storage.LogEntryListOptions{IncludeHistory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the target untouched, got %d entries", len(entries))
+	}
+
+	// an earlier migration is completed, the trash counted
+	target = fileServices(t)
+	if _, err := target.LogEntry.Add(ctx, models.LogEntry{Text: "project #work"}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := exchange.Migrate(ctx, source, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SkippedEntries != 1 || result.TrashedEntries != 1 {
+		t.Fatalf("unexpected migrate result: %+v", result)
+	}
+}
@@ -0,0 +1,507 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// Strategy decides what importing does with the entries the store
+// already has. An entry's path is the texts from its root down to
+// it, entries with the same path are the same entry.
+type Strategy string
+
+const (
+	// Strategy_Skip leaves the entries matched by path as they are
+	Strategy_Skip Strategy = "skip"
+	// Strategy_Overwrite replaces the fields and notes of the
+	// entries matched by path with those of the document
+	Strategy_Overwrite Strategy = "overwrite"
+	// Strategy_MergeByID matches entries by ID, for documents exported
+	// from the same store, and keeps the more recently updated version
+	Strategy_MergeByID Strategy = "merge-by-id"
+	// Strategy_MergeByPath matches entries by path, and keeps the
+	// more recently updated version
+	Strategy_MergeByPath Strategy = "merge-by-path"
+)
+
+var Strategies = []Strategy{Strategy_Skip, Strategy_Overwrite, Strategy_MergeByID, Strategy_MergeByPath}
+
+// ParseStrategy parses a strategy name, empty for Strategy_Skip
+func ParseStrategy(s string) (Strategy, error) {
+	if s == "" {
+		return Strategy_Skip, nil
+	}
+	for _, strategy := range Strategies {
+		if Strategy(s) == strategy {
+			return strategy, nil
+		}
+	}
+	names := make([]string, len(Strategies))
+	for i, strategy := range Strategies {
+		names[i] = string(strategy)
+	}
+	return "", fmt.Errorf("unknown strategy %q, available: %s", s, strings.Join(names, ", "))
+}
+
+type Action int
+
+const (
+	Action_Add Action = iota
+	Action_Change
+	Action_Skip
+)
+
+// EntryPlan is what importing does with an entry of the document
+type EntryPlan struct {
+	Action Action
+	Entry  Entry
+	// ExistingID is the entry of the store it matched, 0 if added
+	ExistingID int64
+
+	// Update sets the changed fields, Changes names them
+	Update  models.LogEntryOptional
+	Changes []string
+
+	// AddNotes, UpdateNotes and DeleteNotes change the notes of
+	// the matched entry
+	AddNotes    []models.Note
+	UpdateNotes []NoteUpdate
+	DeleteNotes []int64
+
+	Children []*EntryPlan
+}
+
+type NoteUpdate struct {
+	ID     int64
+	Update models.NoteOptional
+}
+
+// Plan is what importing a document does, see NewPlan
+type Plan struct {
+	Strategy Strategy
+	// Entries are the top-level entries of the document
+	Entries []*EntryPlan
+
+	Happenings        []*models.Happening
+	SkippedHappenings int
+	States            []State
+	SkippedStates     int
+
+	// Groups are the groups of the document missing in the store,
+	// groupIDs maps the others to those of the store
+	Groups           []models.Group
+	groupIDs         map[int64]int64
+	GroupMemberships []models.GroupMembership
+
+	// Progress is called by Apply after each item, see Options
+	Progress func(stage string, done int, total int)
+}
+
+// NewPlan compares the document with the store, without changing
+// it. Happenings with the same content and create time, and states
+// with the same name, are skipped whatever the strategy. Groups
+// are matched by name and added if missing.
+func NewPlan(ctx context.Context, services *data.Services, doc *Document, strategy Strategy) (*Plan, error) {
+	existing, _, err := services.LogEntry.List(ctx, storage.LogEntryListOptions{IncludeHistory: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entries: %w", err)
+	}
+	s := &store{
+		byID:    make(map[int64]models.LogEntry, len(existing)),
+		byPath:  make(map[entryKey][]int64, len(existing)),
+		claimed: make(map[int64]bool),
+	}
+	sort.Slice(existing, func(i, j int) bool {
+		return existing[i].ID < existing[j].ID
+	})
+	ids := make([]int64, 0, len(existing))
+	for _, entry := range existing {
+		s.byID[entry.ID] = entry
+		key := newEntryKey(entry.ParentID, entry.Text)
+		s.byPath[key] = append(s.byPath[key], entry.ID)
+		ids = append(ids, entry.ID)
+	}
+	if strategy != Strategy_Skip {
+		s.notes, err = services.LogNote.ListForEntries(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list notes: %w", err)
+		}
+	}
+
+	p := &Plan{Strategy: strategy}
+	roots, children := docTree(doc.Entries)
+	// parent is the matched parent, nil under added entries
+	var planEntries func(entries []Entry, parent *models.LogEntry) []*EntryPlan
+	planEntries = func(entries []Entry, parent *models.LogEntry) []*EntryPlan {
+		plans := make([]*EntryPlan, 0, len(entries))
+		for _, entry := range entries {
+			ep := s.planEntry(entry, parent, strategy)
+			var matched *models.LogEntry
+			if ep.Action != Action_Add {
+				existing := s.byID[ep.ExistingID]
+				matched = &existing
+			}
+			ep.Children = planEntries(children[entry.Data.ID], matched)
+			plans = append(plans, ep)
+		}
+		return plans
+	}
+	p.Entries = planEntries(roots, &models.LogEntry{})
+
+	if len(doc.Happenings) > 0 && services.Happening != nil {
+		if err := p.planHappenings(services.Happening, doc.Happenings); err != nil {
+			return nil, err
+		}
+	}
+	if len(doc.States) > 0 && services.StateRecording != nil {
+		if err := p.planStates(ctx, services.StateRecording, doc.States); err != nil {
+			return nil, err
+		}
+	}
+	if services.Group != nil && (len(doc.Groups) > 0 || len(doc.GroupMemberships) > 0) {
+		if err := p.planGroups(ctx, services.Group, doc); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// store is what the store has before importing
+type store struct {
+	byID map[int64]models.LogEntry
+	// byPath lists the entries of a path oldest first, claimed are
+	// those matched already
+	byPath  map[entryKey][]int64
+	claimed map[int64]bool
+	notes   map[int64][]models.Note
+}
+
+type entryKey struct {
+	parentID int64
+	text     string
+}
+
+func newEntryKey(parentID int64, text string) entryKey {
+	return entryKey{parentID: parentID, text: strings.TrimSpace(text)}
+}
+
+// planEntry matches the entry to one of the store. By path, only
+// entries under a matched parent match, the zero entry for top-level.
+func (s *store) planEntry(entry Entry, parent *models.LogEntry, strategy Strategy) *EntryPlan {
+	ep := &EntryPlan{Action: Action_Add, Entry: entry}
+
+	var existing models.LogEntry
+	var found bool
+	if strategy == Strategy_MergeByID {
+		existing, found = s.byID[entry.Data.ID]
+	} else if parent != nil {
+		if id, ok := s.matchPath(newEntryKey(parent.ID, entry.Data.Text)); ok {
+			existing, found = s.byID[id]
+		}
+	}
+	if !found {
+		return ep
+	}
+	ep.ExistingID = existing.ID
+	ep.Action = Action_Skip
+	if strategy == Strategy_Skip {
+		return ep
+	}
+
+	// merging keeps the more recently updated fields, but adds the
+	// missing notes either way
+	newer := strategy == Strategy_Overwrite || entry.Data.UpdateTime.Unix() > existing.UpdateTime.Unix()
+	if newer {
+		ep.Update, ep.Changes = diffEntry(existing, *entry.Data)
+	}
+	s.planNotes(ep, strategy)
+	if len(ep.Changes) > 0 || len(ep.AddNotes) > 0 || len(ep.UpdateNotes) > 0 || len(ep.DeleteNotes) > 0 {
+		ep.Action = Action_Change
+	}
+	return ep
+}
+
+// matchPath returns the first unclaimed entry of the path, so
+// occurrences of a repeating entry match one each. Once all are
+// claimed, the first one matches again.
+func (s *store) matchPath(key entryKey) (int64, bool) {
+	ids := s.byPath[key]
+	if len(ids) == 0 {
+		return 0, false
+	}
+	for _, id := range ids {
+		if !s.claimed[id] {
+			s.claimed[id] = true
+			return id, true
+		}
+	}
+	return ids[0], true
+}
+
+// planNotes matches notes by text, or by ID for Strategy_MergeByID
+// where the more recently updated text wins. Overwriting deletes
+// the notes missing in the document.
+func (s *store) planNotes(ep *EntryPlan, strategy Strategy) {
+	existing := s.notes[ep.ExistingID]
+	byText := make(map[string]int, len(existing))
+	byID := make(map[int64]int, len(existing))
+	for i, note := range existing {
+		byText[strings.TrimSpace(note.Text)] = i
+		byID[note.ID] = i
+	}
+	kept := make(map[int]bool, len(existing))
+	for _, note := range ep.Entry.Notes {
+		if note.Data == nil {
+			continue
+		}
+		if i, ok := byText[strings.TrimSpace(note.Data.Text)]; ok {
+			kept[i] = true
+			continue
+		}
+		if i, ok := byID[note.Data.ID]; ok && strategy == Strategy_MergeByID {
+			kept[i] = true
+			if note.Data.UpdateTime.Unix() > existing[i].UpdateTime.Unix() {
+				text, updateTime := note.Data.Text, note.Data.UpdateTime
+				ep.UpdateNotes = append(ep.UpdateNotes, NoteUpdate{
+					ID:     existing[i].ID,
+					Update: models.NoteOptional{Text: &text, UpdateTime: &updateTime},
+				})
+			}
+			continue
+		}
+		ep.AddNotes = append(ep.AddNotes, *note.Data)
+	}
+	if strategy == Strategy_Overwrite {
+		for i, note := range existing {
+			if !kept[i] {
+				ep.DeleteNotes = append(ep.DeleteNotes, note.ID)
+			}
+		}
+	}
+}
+
+// diffEntry returns the update that turns old into entry, and the
+// names of the changed fields. The hierarchy is left as it is.
+func diffEntry(old models.LogEntry, entry models.LogEntry) (models.LogEntryOptional, []string) {
+	var update models.LogEntryOptional
+	var changes []string
+	if old.Text != entry.Text {
+		update.Text = &entry.Text
+		changes = append(changes, "text")
+	}
+	if old.Done != entry.Done {
+		update.Done = &entry.Done
+		changes = append(changes, "done")
+	}
+	if !sameOptionalTime(old.DoneTime, entry.DoneTime) {
+		update.DoneTime = &entry.DoneTime
+		changes = append(changes, "done_time")
+	}
+	// documents written by hand may leave out the create time
+	if !entry.CreateTime.IsZero() && !sameTime(old.CreateTime, entry.CreateTime) {
+		update.CreateTime = &entry.CreateTime
+		changes = append(changes, "create_time")
+	}
+	if old.AdjustedTopTime != entry.AdjustedTopTime {
+		update.AdjustedTopTime = &entry.AdjustedTopTime
+		changes = append(changes, "adjusted_top_time")
+	}
+	if old.HighlightLevel != entry.HighlightLevel {
+		update.HighlightLevel = &entry.HighlightLevel
+		changes = append(changes, "highlight_level")
+	}
+	if old.Collapsed != entry.Collapsed {
+		update.Collapsed = &entry.Collapsed
+		changes = append(changes, "collapsed")
+	}
+	if !sameOptionalTime(old.DueTime, entry.DueTime) {
+		update.DueTime = &entry.DueTime
+		changes = append(changes, "due_time")
+	}
+	if !sameOptionalTime(old.ScheduledTime, entry.ScheduledTime) {
+		update.ScheduledTime = &entry.ScheduledTime
+		changes = append(changes, "scheduled_time")
+	}
+	if old.Repeat != entry.Repeat {
+		update.Repeat = &entry.Repeat
+		changes = append(changes, "repeat")
+	}
+	if len(changes) > 0 && !entry.UpdateTime.IsZero() {
+		update.UpdateTime = &entry.UpdateTime
+	}
+	return update, changes
+}
+
+// times are compared in seconds, as sqlite keeps them
+func sameTime(a time.Time, b time.Time) bool {
+	return a.Unix() == b.Unix()
+}
+
+func sameOptionalTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return sameTime(*a, *b)
+}
+
+// docTree returns the top-level entries of the document and the
+// children of each entry, in document order. Entries whose parent
+// is not in the document are top-level, as is the first entry of a
+// parent cycle.
+func docTree(entries []Entry) ([]Entry, map[int64][]Entry) {
+	inDoc := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		inDoc[entry.Data.ID] = true
+	}
+	children := make(map[int64][]Entry)
+	var roots []Entry
+	for _, entry := range entries {
+		if entry.Data.ParentID == 0 || !inDoc[entry.Data.ParentID] {
+			roots = append(roots, entry)
+			continue
+		}
+		children[entry.Data.ParentID] = append(children[entry.Data.ParentID], entry)
+	}
+
+	reached := make(map[int64]bool, len(entries))
+	var reach func(id int64)
+	reach = func(id int64) {
+		if reached[id] {
+			return
+		}
+		reached[id] = true
+		for _, child := range children[id] {
+			reach(child.Data.ID)
+		}
+	}
+	for _, root := range roots {
+		reach(root.Data.ID)
+	}
+	for _, entry := range entries {
+		if reached[entry.Data.ID] {
+			continue
+		}
+		// drop it from its parent's children, so the cycle is cut
+		siblings := children[entry.Data.ParentID]
+		for i, sibling := range siblings {
+			if sibling.Data.ID == entry.Data.ID {
+				children[entry.Data.ParentID] = append(siblings[:i:i], siblings[i+1:]...)
+				break
+			}
+		}
+		roots = append(roots, entry)
+		reach(entry.Data.ID)
+	}
+	return roots, children
+}
+
+type happeningKey struct {
+	content    string
+	createTime int64
+}
+
+func (p *Plan) planHappenings(svc storage.HappeningService, happenings []*models.Happening) error {
+	existing, err := listHappenings(svc)
+	if err != nil {
+		return err
+	}
+	seen := make(map[happeningKey]bool, len(existing))
+	for _, happening := range existing {
+		seen[happeningKey{happening.Content, happening.CreateTime.Unix()}] = true
+	}
+	for _, happening := range happenings {
+		if happening == nil {
+			continue
+		}
+		if seen[happeningKey{happening.Content, happening.CreateTime.Unix()}] {
+			p.SkippedHappenings++
+			continue
+		}
+		p.Happenings = append(p.Happenings, happening)
+	}
+	return nil
+}
+
+func (p *Plan) planStates(ctx context.Context, svc storage.StateRecordingService, states []State) error {
+	existing, err := svc.ListStates(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list states: %w", err)
+	}
+	names := make(map[string]bool, len(existing))
+	for _, state := range existing {
+		names[state.Name] = true
+	}
+	for _, state := range states {
+		if state.Data == nil {
+			continue
+		}
+		if names[state.Data.Name] {
+			p.SkippedStates++
+			continue
+		}
+		p.States = append(p.States, state)
+	}
+	return nil
+}
+
+func (p *Plan) planGroups(ctx context.Context, svc storage.GroupService, doc *Document) error {
+	existing, err := svc.ListGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list groups: %w", err)
+	}
+	p.groupIDs = make(map[int64]int64, len(doc.Groups))
+	for _, group := range doc.Groups {
+		for _, g := range existing {
+			if strings.EqualFold(g.Name, group.Name) {
+				p.groupIDs[group.ID] = g.ID
+				break
+			}
+		}
+		if _, ok := p.groupIDs[group.ID]; !ok {
+			p.Groups = append(p.Groups, group)
+		}
+	}
+	p.GroupMemberships = doc.GroupMemberships
+	return nil
+}
+
+// Summary counts what applying the plan does
+func (p *Plan) Summary() *ImportResult {
+	result := &ImportResult{
+		Happenings:        len(p.Happenings),
+		SkippedHappenings: p.SkippedHappenings,
+		States:            len(p.States),
+		SkippedStates:     p.SkippedStates,
+		Groups:            len(p.Groups),
+	}
+	for _, state := range p.States {
+		result.StateEvents += len(state.Events)
+	}
+	var count func(plans []*EntryPlan)
+	count = func(plans []*EntryPlan) {
+		for _, ep := range plans {
+			switch ep.Action {
+			case Action_Add:
+				result.Entries++
+				result.Notes += len(ep.Entry.Notes)
+			case Action_Change:
+				result.ChangedEntries++
+				result.Notes += len(ep.AddNotes)
+				result.ChangedNotes += len(ep.UpdateNotes)
+				result.DeletedNotes += len(ep.DeleteNotes)
+			case Action_Skip:
+				result.SkippedEntries++
+			}
+			count(ep.Children)
+		}
+	}
+	count(p.Entries)
+	return result
+}
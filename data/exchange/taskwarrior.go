@@ -0,0 +1,358 @@
+package exchange
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/todo/internal/recur"
+	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/ui/tree"
+)
+
+// taskwarriorTimeLayout is the UTC time format of task export
+const taskwarriorTimeLayout = "20060102T150405Z"
+
+// taskwarriorTask is a task as written by `task export`
+type taskwarriorTask struct {
+	UUID        string                  `json:"uuid"`
+	Description string                  `json:"description"`
+	Status      string                  `json:"status"`
+	Entry       string                  `json:"entry,omitempty"`
+	Modified    string                  `json:"modified,omitempty"`
+	End         string                  `json:"end,omitempty"`
+	Due         string                  `json:"due,omitempty"`
+	Scheduled   string                  `json:"scheduled,omitempty"`
+	Recur       string                  `json:"recur,omitempty"`
+	Priority    string                  `json:"priority,omitempty"`
+	Project     string                  `json:"project,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	Depends     taskwarriorDepends      `json:"depends,omitempty"`
+	Annotations []taskwarriorAnnotation `json:"annotations,omitempty"`
+	// Parent is the template of a recurring task's instances
+	Parent string `json:"parent,omitempty"`
+}
+
+type taskwarriorAnnotation struct {
+	Entry       string `json:"entry,omitempty"`
+	Description string `json:"description"`
+}
+
+// taskwarriorDepends reads both the array of Taskwarrior 2.6 and
+// the comma separated string of earlier versions
+type taskwarriorDepends []string
+
+func (d *taskwarriorDepends) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*d = nil
+		for _, uuid := range strings.Split(s, ",") {
+			if uuid = strings.TrimSpace(uuid); uuid != "" {
+				*d = append(*d, uuid)
+			}
+		}
+		return nil
+	}
+	var uuids []string
+	if err := json.Unmarshal(data, &uuids); err != nil {
+		return err
+	}
+	*d = uuids
+	return nil
+}
+
+// Taskwarrior priorities map to highlight levels
+var taskwarriorLevels = map[string]int{"L": 1, "M": 2, "H": 3}
+
+func taskwarriorPriority(level int) string {
+	switch {
+	case level >= 3:
+		return "H"
+	case level == 2:
+		return "M"
+	case level == 1:
+		return "L"
+	}
+	return ""
+}
+
+func formatTaskwarriorTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(taskwarriorTimeLayout)
+}
+
+func parseTaskwarriorTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(taskwarriorTimeLayout, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	t = t.Local()
+	return &t, nil
+}
+
+// entryUUID derives a stable UUID from an entry ID, so that
+// exporting twice gives the same tasks
+func entryUUID(id int64) string {
+	return nameUUID(fmt.Sprintf("todo:%d", id))
+}
+
+// nameUUID returns the version 5 style UUID of name
+func nameUUID(name string) string {
+	sum := sha1.Sum([]byte(name))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// WriteTaskwarrior writes the entries of the document as the JSON
+// array of `task export`, readable by `task import`. Parents depend
+// on their children, notes are annotations and tags come from the
+// #tags of the text. Happenings, states and groups are left out.
+func WriteTaskwarrior(w io.Writer, doc *Document) error {
+	tasks := make([]*taskwarriorTask, 0, len(doc.Entries))
+	tree.Walk(doc.Tree(), func(depth int, view *models.LogEntryView) {
+		entry := view.Data
+		task := &taskwarriorTask{
+			UUID:        entryUUID(entry.ID),
+			Description: entry.Text,
+			Status:      "pending",
+			Entry:       formatTaskwarriorTime(&entry.CreateTime),
+			Modified:    formatTaskwarriorTime(&entry.UpdateTime),
+			Due:         formatTaskwarriorTime(entry.DueTime),
+			Scheduled:   formatTaskwarriorTime(entry.ScheduledTime),
+			Priority:    taskwarriorPriority(entry.HighlightLevel),
+			Tags:        models.ParseTags(entry.Text),
+		}
+		if entry.Done {
+			task.Status = "completed"
+			task.End = formatTaskwarriorTime(entry.DoneTime)
+			if task.End == "" {
+				task.End = task.Modified
+			}
+		}
+		// Taskwarrior refuses recurring tasks without a due time
+		if entry.Repeat != "" && entry.DueTime != nil {
+			task.Recur = entry.Repeat
+		}
+		for _, child := range view.Children {
+			task.Depends = append(task.Depends, entryUUID(child.Data.ID))
+		}
+		for _, note := range view.Notes {
+			task.Annotations = append(task.Annotations, taskwarriorAnnotation{
+				Entry:       formatTaskwarriorTime(&note.Data.CreateTime),
+				Description: note.Data.Text,
+			})
+		}
+		tasks = append(tasks, task)
+	})
+
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadTaskwarrior parses the output of `task export` into a
+// Document. Deleted tasks and the instances of recurring tasks are
+// skipped, the recurring task itself becomes a repeating entry.
+// A task goes under the first task depending on it, or else under
+// entries made for the parts of its project, e.g. "home.garden".
+func ReadTaskwarrior(r io.Reader) (*Document, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tasks: %w", err)
+	}
+	tasks, err := decodeTaskwarrior(content)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Version: Version}
+	ids := make(map[string]int64, len(tasks))
+	templates := make(map[string]bool)
+	for _, task := range tasks {
+		if task.Status == "recurring" {
+			templates[task.UUID] = true
+		}
+	}
+	var kept []*taskwarriorTask
+	for _, task := range tasks {
+		if task.Status == "deleted" || templates[task.Parent] {
+			continue
+		}
+		entry, err := taskwarriorEntry(task)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", task.UUID, err)
+		}
+		entry.Data.ID = int64(len(doc.Entries) + 1)
+		if task.UUID != "" {
+			ids[task.UUID] = entry.Data.ID
+		}
+		doc.Entries = append(doc.Entries, entry)
+		kept = append(kept, task)
+	}
+
+	parents := make(map[int64]int64, len(kept))
+	// isAncestor tells whether id is parentID or above it
+	isAncestor := func(id int64, parentID int64) bool {
+		for ; parentID != 0; parentID = parents[parentID] {
+			if parentID == id {
+				return true
+			}
+		}
+		return false
+	}
+	for i, task := range kept {
+		id := doc.Entries[i].Data.ID
+		for _, uuid := range task.Depends {
+			child, ok := ids[uuid]
+			if !ok || parents[child] != 0 || isAncestor(child, id) {
+				continue
+			}
+			parents[child] = id
+		}
+	}
+
+	projects := make(map[string]int64)
+	var projectID func(project string) int64
+	projectID = func(project string) int64 {
+		if id, ok := projects[project]; ok {
+			return id
+		}
+		var parentID int64
+		name := project
+		if i := strings.LastIndex(project, "."); i >= 0 {
+			parentID = projectID(project[:i])
+			name = project[i+1:]
+		}
+		id := int64(len(doc.Entries) + 1)
+		doc.Entries = append(doc.Entries, Entry{
+			Data:  &models.LogEntry{ID: id, Text: name, ParentID: parentID},
+			Notes: []Note{},
+		})
+		projects[project] = id
+		return id
+	}
+	for i, task := range kept {
+		entry := doc.Entries[i].Data
+		if parentID, ok := parents[entry.ID]; ok {
+			entry.ParentID = parentID
+		} else if project := strings.Trim(task.Project, "."); project != "" {
+			entry.ParentID = projectID(project)
+		}
+	}
+	return doc, nil
+}
+
+// decodeTaskwarrior reads a JSON array of tasks, or the one task
+// per line of Taskwarrior before 2.4
+func decodeTaskwarrior(content []byte) ([]*taskwarriorTask, error) {
+	content = bytes.TrimSpace(content)
+	var tasks []*taskwarriorTask
+	if len(content) > 0 && content[0] == '[' {
+		if err := json.Unmarshal(content, &tasks); err != nil {
+			return nil, fmt.Errorf("failed to parse tasks: %w", err)
+		}
+		return tasks, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ",")
+		if line == "" {
+			continue
+		}
+		var task taskwarriorTask
+		if err := json.Unmarshal([]byte(line), &task); err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse task: %w", lineNo, err)
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks, scanner.Err()
+}
+
+// taskwarriorEntry converts a task without its hierarchy
+func taskwarriorEntry(task *taskwarriorTask) (Entry, error) {
+	text := strings.TrimSpace(task.Description)
+	// tags missing in the text are appended as #tags
+	hasTag := make(map[string]bool)
+	for _, tag := range models.ParseTags(text) {
+		hasTag[tag] = true
+	}
+	for _, tag := range task.Tags {
+		if !hasTag[models.NormalizeTag(tag)] {
+			text += " #" + tag
+		}
+	}
+	entry := &models.LogEntry{
+		Text:           text,
+		Done:           task.Status == "completed",
+		HighlightLevel: taskwarriorLevels[task.Priority],
+	}
+
+	var err error
+	times := []struct {
+		value string
+		dst   **time.Time
+	}{
+		{task.End, &entry.DoneTime},
+		{task.Due, &entry.DueTime},
+		{task.Scheduled, &entry.ScheduledTime},
+	}
+	for _, t := range times {
+		if *t.dst, err = parseTaskwarriorTime(t.value); err != nil {
+			return Entry{}, err
+		}
+	}
+	if !entry.Done {
+		entry.DoneTime = nil
+	}
+	createTime, err := parseTaskwarriorTime(task.Entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	if createTime != nil {
+		entry.CreateTime = *createTime
+		entry.UpdateTime = *createTime
+	}
+	updateTime, err := parseTaskwarriorTime(task.Modified)
+	if err != nil {
+		return Entry{}, err
+	}
+	if updateTime != nil {
+		entry.UpdateTime = *updateTime
+	}
+	if task.Recur != "" {
+		// rules Taskwarrior has and todo not, like "quarterly", are dropped
+		if rule, err := recur.Parse(task.Recur); err == nil {
+			entry.Repeat = rule.String()
+		}
+	}
+
+	notes := make([]Note, 0, len(task.Annotations))
+	for _, annotation := range task.Annotations {
+		note := &models.Note{Text: annotation.Description}
+		createTime, err := parseTaskwarriorTime(annotation.Entry)
+		if err != nil {
+			return Entry{}, err
+		}
+		if createTime != nil {
+			note.CreateTime = *createTime
+			note.UpdateTime = *createTime
+		}
+		notes = append(notes, Note{Data: note})
+	}
+	return Entry{Data: entry, Notes: notes}, nil
+}
@@ -0,0 +1,104 @@
+package exchange_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data/exchange"
+)
+
+func TestTaskwarriorRoundTrip(t *testing.T) {
+	services := fileServices(t)
+	seed(t, services)
+	doc, err := exchange.Export(context.Background(), services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := exchange.WriteTaskwarrior(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	read, err := exchange.ReadTaskwarrior(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := exchange.WriteTaskwarrior(&again, read); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != buf.String() {
+		t.Fatalf("tasks changed by the round trip\nwant:\n%s\ngot:\n%s", buf.String(), again.String())
+	}
+
+	var md bytes.Buffer
+	if err := exchange.WriteMarkdown(&md, read); err != nil {
+		t.Fatal(err)
+	}
+	want := `- [ ] project #work
+  - [ ] write design
+    > draft in docs
+
+    > ask for review
+    - [x] review (done 2025-09-01 11:00)
+  - [ ] review
+- [x] water plants (done 2025-09-01 11:00)
+- [ ] water plants
+`
+	if md.String() != want {
+		t.Fatalf("expected the hierarchy kept\nwant:\n%s\ngot:\n%s", want, md.String())
+	}
+}
+
+func TestReadTaskwarrior(t *testing.T) {
+	// as written by Taskwarrior 2.5, depends as a string
+	tasks := `[
+{"uuid":"a","description":"Plant tomatoes","status":"pending","project":"home.garden","tags":["outdoor"],"priority":"H","entry":"20250901T080000Z","due":"20250910T170000Z","annotations":[{"entry":"20250902T080000Z","description":"buy seeds"}]},
+{"uuid":"b","description":"Release","status":"pending","project":"work","depends":"c,missing"},
+{"uuid":"c","description":"Write changelog #docs","status":"completed","project":"work","tags":["docs"],"end":"20250903T120000Z"},
+{"uuid":"d","description":"Old idea","status":"deleted"},
+{"uuid":"e","description":"Water plants","status":"recurring","recur":"daily","due":"20250901T070000Z"},
+{"uuid":"f","description":"Water plants","status":"pending","parent":"e","due":"20250902T070000Z"}
+]`
+	doc, err := exchange.ReadTaskwarrior(strings.NewReader(tasks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var md bytes.Buffer
+	if err := exchange.WriteMarkdown(&md, doc); err != nil {
+		t.Fatal(err)
+	}
+	want := `- [ ] Water plants
+- [ ] home
+  - [ ] garden
+    - [ ] Plant tomatoes #outdoor
+      > buy seeds
+- [ ] work
+  - [ ] Release
+    - [x] Write changelog #docs (done ` + time.Date(2025, 9, 3, 12, 0, 0, 0, time.UTC).Local().Format("2006-01-02 15:04") + `)
+`
+	if md.String() != want {
+		t.Fatalf("unexpected hierarchy\nwant:\n%s\ngot:\n%s", want, md.String())
+	}
+	plant, water := doc.Entries[0].Data, doc.Entries[3].Data
+	if plant.HighlightLevel != 3 || !plant.DueTime.Equal(time.Date(2025, 9, 10, 17, 0, 0, 0, time.UTC)) || !plant.CreateTime.Equal(time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected entry: %+v", plant)
+	}
+	if water.Text != "Water plants" || water.Repeat != "daily" {
+		t.Fatalf("expected the recurring task a repeating entry, got %+v", water)
+	}
+
+	// one task per line, as written before Taskwarrior 2.4
+	lines := `{"uuid":"a","description":"one","status":"pending"},
+{"uuid":"b","description":"two","status":"pending","depends":["a"]}`
+	doc, err = exchange.ReadTaskwarrior(strings.NewReader(lines))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Entries) != 2 || doc.Entries[0].Data.ParentID != doc.Entries[1].Data.ID {
+		t.Fatalf("expected one under two, got %+v", doc.Entries)
+	}
+}
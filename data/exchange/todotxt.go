@@ -0,0 +1,224 @@
+package exchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/todo/internal/recur"
+	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/ui/tree"
+)
+
+// todo.txt dates are days, due and threshold dates may carry a
+// time of day as an extension
+const (
+	todoTxtDateLayout = "2006-01-02"
+	todoTxtTimeLayout = "2006-01-02T15:04"
+)
+
+var (
+	todoTxtDatePattern     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	todoTxtPriorityPattern = regexp.MustCompile(`^\(([A-Z])\)$`)
+)
+
+// todo.txt priorities map to highlight levels, (A) the highest
+const todoTxtPriorities = "ABCDE"
+
+func todoTxtPriority(level int) string {
+	if level <= 0 {
+		return ""
+	}
+	if level > len(todoTxtPriorities) {
+		level = len(todoTxtPriorities)
+	}
+	return string(todoTxtPriorities[len(todoTxtPriorities)-level])
+}
+
+func todoTxtLevel(priority string) int {
+	i := strings.Index(todoTxtPriorities, priority)
+	if i < 0 {
+		// F to Z
+		return 1
+	}
+	return len(todoTxtPriorities) - i
+}
+
+// WriteTodoTxt writes the entries of the document in the todo.txt
+// format, one per line in outline order:
+//
+//	x 2025-09-01 2025-08-30 review pri:B due:2025-09-02T17:00 p:3
+//
+// Priorities are the highlight levels, 5 for (A) down to 1 for (E).
+// The hierarchy is kept with the id: and p: keys on parents and
+// children, the repeat rule with rec:. Notes, happenings, states
+// and groups are left out.
+func WriteTodoTxt(w io.Writer, doc *Document) error {
+	views := doc.Tree()
+	// only parents get an id:
+	parents := make(map[int64]bool)
+	tree.Walk(views, func(depth int, entry *models.LogEntryView) {
+		if len(entry.Children) > 0 {
+			parents[entry.Data.ID] = true
+		}
+	})
+
+	bw := bufio.NewWriter(w)
+	tree.Walk(views, func(depth int, view *models.LogEntryView) {
+		entry := view.Data
+		var parts []string
+		priority := todoTxtPriority(entry.HighlightLevel)
+		if entry.Done {
+			parts = append(parts, "x")
+			if entry.DoneTime != nil {
+				parts = append(parts, entry.DoneTime.Local().Format(todoTxtDateLayout))
+			} else if !entry.CreateTime.IsZero() {
+				// a creation date needs a completion date before it
+				parts = append(parts, entry.UpdateTime.Local().Format(todoTxtDateLayout))
+			}
+		} else if priority != "" {
+			parts = append(parts, "("+priority+")")
+		}
+		if !entry.CreateTime.IsZero() {
+			parts = append(parts, entry.CreateTime.Local().Format(todoTxtDateLayout))
+		}
+		parts = append(parts, strings.Fields(entry.Text)...)
+
+		if entry.Done && priority != "" {
+			parts = append(parts, "pri:"+priority)
+		}
+		if entry.DueTime != nil {
+			parts = append(parts, "due:"+formatTodoTxtTime(*entry.DueTime))
+		}
+		if entry.ScheduledTime != nil {
+			parts = append(parts, "t:"+formatTodoTxtTime(*entry.ScheduledTime))
+		}
+		if entry.Repeat != "" {
+			parts = append(parts, "rec:"+entry.Repeat)
+		}
+		if parents[entry.ID] {
+			parts = append(parts, fmt.Sprintf("id:%d", entry.ID))
+		}
+		if depth > 0 {
+			parts = append(parts, fmt.Sprintf("p:%d", entry.ParentID))
+		}
+		bw.WriteString(strings.Join(parts, " ") + "\n")
+	})
+	return bw.Flush()
+}
+
+func formatTodoTxtTime(t time.Time) string {
+	t = t.Local()
+	if t.Hour() == 0 && t.Minute() == 0 {
+		return t.Format(todoTxtDateLayout)
+	}
+	return t.Format(todoTxtTimeLayout)
+}
+
+func parseTodoTxtTime(s string) (time.Time, error) {
+	layout := todoTxtDateLayout
+	if len(s) > len(todoTxtDateLayout) {
+		layout = todoTxtTimeLayout
+	}
+	return time.ParseInLocation(layout, s, time.Local)
+}
+
+// ReadTodoTxt parses a todo.txt file into a Document, as written
+// by WriteTodoTxt. Projects and contexts stay in the text, unknown
+// keys too. Entries get IDs in line order, from 1.
+func ReadTodoTxt(r io.Reader) (*Document, error) {
+	doc := &Document{Version: Version}
+	// keyIDs maps id: values to entries, parentKeys the p: values
+	keyIDs := make(map[string]int64)
+	parentKeys := make(map[int64]string)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		entry := &models.LogEntry{ID: int64(len(doc.Entries) + 1)}
+		var priority string
+		if words[0] == "x" {
+			entry.Done = true
+			words = words[1:]
+			if len(words) > 0 && todoTxtDatePattern.MatchString(words[0]) {
+				doneTime, err := parseTodoTxtTime(words[0])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid completion date %q: %w", lineNo, words[0], err)
+				}
+				entry.DoneTime = &doneTime
+				words = words[1:]
+			}
+		} else if m := todoTxtPriorityPattern.FindStringSubmatch(words[0]); m != nil {
+			priority = m[1]
+			words = words[1:]
+		}
+		if len(words) > 0 && todoTxtDatePattern.MatchString(words[0]) {
+			createTime, err := parseTodoTxtTime(words[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid creation date %q: %w", lineNo, words[0], err)
+			}
+			entry.CreateTime = createTime
+			entry.UpdateTime = createTime
+			words = words[1:]
+		}
+
+		var text []string
+		for _, word := range words {
+			key, value, ok := strings.Cut(word, ":")
+			// URLs are no keys
+			if !ok || value == "" || strings.HasPrefix(value, "/") {
+				text = append(text, word)
+				continue
+			}
+			switch key {
+			case "due", "t":
+				t, err := parseTodoTxtTime(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid date %q: %w", lineNo, word, err)
+				}
+				if key == "due" {
+					entry.DueTime = &t
+				} else {
+					entry.ScheduledTime = &t
+				}
+			case "pri":
+				priority = strings.ToUpper(value)
+			case "rec":
+				rule, err := recur.Parse(strings.TrimPrefix(value, "+"))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				entry.Repeat = rule.String()
+			case "id":
+				keyIDs[value] = entry.ID
+			case "p":
+				parentKeys[entry.ID] = value
+			default:
+				text = append(text, word)
+			}
+		}
+		entry.Text = strings.Join(text, " ")
+		if priority != "" {
+			entry.HighlightLevel = todoTxtLevel(priority)
+		}
+		doc.Entries = append(doc.Entries, Entry{Data: entry, Notes: []Note{}})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read todo.txt: %w", err)
+	}
+
+	for _, entry := range doc.Entries {
+		if key, ok := parentKeys[entry.Data.ID]; ok {
+			// a p: of a missing id: leaves the entry top-level
+			entry.Data.ParentID = keyIDs[key]
+		}
+	}
+	return doc, nil
+}
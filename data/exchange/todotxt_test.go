@@ -0,0 +1,76 @@
+package exchange_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data/exchange"
+)
+
+func TestTodoTxtRoundTrip(t *testing.T) {
+	services := fileServices(t)
+	seed(t, services)
+	doc, err := exchange.Export(context.Background(), services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := exchange.WriteTodoTxt(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	want := `(D) 2025-09-01 project #work id:1
+2025-09-01 write design due:2025-09-02T09:30 id:2 p:1
+x 2025-09-01 2025-09-01 review p:2
+2025-09-01 review p:1
+x 2025-09-01 2025-09-01 water plants rec:daily
+2025-09-01 water plants rec:daily
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected todo.txt\nwant:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	read, err := exchange.ReadTodoTxt(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := exchange.WriteTodoTxt(&again, read); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != want {
+		t.Fatalf("todo.txt changed by the round trip\nwant:\n%s\ngot:\n%s", want, again.String())
+	}
+}
+
+func TestReadTodoTxt(t *testing.T) {
+	lines := "(A) Call mom +family @phone due:2025-09-10 see https://example.com\n" +
+		"\n" +
+		"x 2025-09-02 2025-08-30 Pay rent pri:C rec:+1w\n" +
+		"(Q) Read book status:later\n"
+	doc, err := exchange.ReadTodoTxt(strings.NewReader(lines))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(doc.Entries))
+	}
+	call, rent, book := doc.Entries[0].Data, doc.Entries[1].Data, doc.Entries[2].Data
+	if call.Text != "Call mom +family @phone see https://example.com" || call.HighlightLevel != 5 || call.DueTime == nil || !call.DueTime.Equal(time.Date(2025, 9, 10, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("unexpected entry: %+v", call)
+	}
+	if rent.Text != "Pay rent" || !rent.Done || rent.HighlightLevel != 3 || rent.Repeat != "weekly" ||
+		!rent.DoneTime.Equal(time.Date(2025, 9, 2, 0, 0, 0, 0, time.Local)) || !rent.CreateTime.Equal(time.Date(2025, 8, 30, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("unexpected entry: %+v", rent)
+	}
+	if book.Text != "Read book status:later" || book.HighlightLevel != 1 {
+		t.Fatalf("unexpected entry: %+v", book)
+	}
+
+	if _, err := exchange.ReadTodoTxt(strings.NewReader("Pay rent due:tomorrow\n")); err == nil {
+		t.Fatalf("expected an invalid due date refused")
+	}
+}
@@ -0,0 +1,205 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/xhd2015/todo/data/mem"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// LoadGroups reloads Groups and GroupMapping from storage
+func (m *LogManager) LoadGroups(ctx context.Context) error {
+	if m.GroupService == nil {
+		return nil
+	}
+	groups, err := m.GroupService.ListGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load groups: %w", err)
+	}
+	memberships, err := m.GroupService.ListMemberships(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load group memberships: %w", err)
+	}
+	sortGroups(groups)
+	mapping := make(map[int64]int64, len(memberships))
+	for _, membership := range memberships {
+		mapping[membership.EntryID] = membership.GroupID
+	}
+	m.Groups = groups
+	m.GroupMapping = mapping
+	return nil
+}
+
+func sortGroups(groups []models.Group) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Position != groups[j].Position {
+			return groups[i].Position < groups[j].Position
+		}
+		return groups[i].ID < groups[j].ID
+	})
+}
+
+func (m *LogManager) AddGroup(ctx context.Context, name string) (int64, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, fmt.Errorf("group name cannot be empty")
+	}
+	id, err := m.GroupService.AddGroup(ctx, models.Group{Name: name})
+	if err != nil {
+		return 0, err
+	}
+	return id, m.LoadGroups(ctx)
+}
+
+func (m *LogManager) RenameGroup(ctx context.Context, id int64, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+	err := m.GroupService.UpdateGroup(ctx, id, models.GroupOptional{Name: &name})
+	if err != nil {
+		return err
+	}
+	return m.LoadGroups(ctx)
+}
+
+// DeleteGroup deletes the group, its entries fall back to
+// their parents' groups
+func (m *LogManager) DeleteGroup(ctx context.Context, id int64) error {
+	err := m.GroupService.DeleteGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+	return m.LoadGroups(ctx)
+}
+
+// MoveGroup moves the group delta places, negative is up.
+// Moving past either end is a no-op.
+func (m *LogManager) MoveGroup(ctx context.Context, id int64, delta int) error {
+	idx := -1
+	for i, group := range m.Groups {
+		if group.ID == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("group with id %d not found", id)
+	}
+	target := idx + delta
+	if target < 0 || target >= len(m.Groups) || target == idx {
+		return nil
+	}
+
+	// renumber so that positions stay distinct even if they were not
+	groups := append([]models.Group(nil), m.Groups...)
+	moved := groups[idx]
+	groups = append(groups[:idx], groups[idx+1:]...)
+	groups = append(groups[:target], append([]models.Group{moved}, groups[target:]...)...)
+	for i, group := range groups {
+		position := i + 1
+		if group.Position == position {
+			continue
+		}
+		err := m.GroupService.UpdateGroup(ctx, group.ID, models.GroupOptional{Position: &position})
+		if err != nil {
+			return err
+		}
+	}
+	return m.LoadGroups(ctx)
+}
+
+// SetEntryGroup puts the entry into the group, groupID 0
+// detaches it from any group
+func (m *LogManager) SetEntryGroup(ctx context.Context, entryID int64, groupID int64) error {
+	// undoing detaches an entry that had no explicit group
+	oldGroupID := m.GroupMapping[entryID]
+	err := m.GroupService.SetMembership(ctx, models.GroupMembership{
+		EntryID: entryID,
+		GroupID: groupID,
+	})
+	if err != nil {
+		return err
+	}
+	m.record(step{
+		undo: func(ctx context.Context) error {
+			return m.SetEntryGroup(ctx, entryID, oldGroupID)
+		},
+		redo: func(ctx context.Context) error {
+			return m.SetEntryGroup(ctx, entryID, groupID)
+		},
+	})
+	if m.GroupMapping == nil {
+		m.GroupMapping = make(map[int64]int64)
+	}
+	m.GroupMapping[entryID] = groupID
+	return nil
+}
+
+// legacyLogGroup is a record of the former log_group.json
+type legacyLogGroup struct {
+	LogID   int64
+	GroupID int64
+}
+
+// the former hardcoded groups had IDs 1 to 5, 6 was "Other"
+const legacyMaxGroupID = 5
+
+// ImportLegacyGroupMapping imports the entry to group mapping of the
+// former log_group.json at path, then renames it with an ".imported"
+// suffix so it is imported only once. A missing file imports nothing.
+func ImportLegacyGroupMapping(ctx context.Context, groups storage.GroupService, path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var legacy mem.JSONStorage
+	if err := json.Unmarshal(content, &legacy); err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	// records were appended on every change, the last one wins
+	mapping := make(map[int64]int64)
+	var order []int64
+	for _, raw := range legacy.Data {
+		var record legacyLogGroup
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if record.LogID == 0 {
+			continue
+		}
+		groupID := record.GroupID
+		if groupID < 0 || groupID > legacyMaxGroupID {
+			groupID = 0
+		}
+		if _, ok := mapping[record.LogID]; !ok {
+			order = append(order, record.LogID)
+		}
+		mapping[record.LogID] = groupID
+	}
+
+	for _, logID := range order {
+		err := groups.SetMembership(ctx, models.GroupMembership{
+			EntryID: logID,
+			GroupID: mapping[logID],
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to import group of entry %d: %w", logID, err)
+		}
+	}
+	if err := os.Rename(path, path+".imported"); err != nil {
+		return 0, err
+	}
+	return len(order), nil
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"errors"
 	"sort"
 	"sync"
 	"time"
@@ -90,10 +91,14 @@ func (hm *HappeningManager) AddHappening(ctx context.Context, content string) (*
 	return newHappening, nil
 }
 
-// UpdateHappening updates a happening and updates the cache internally
+// UpdateHappening updates a happening and updates the cache internally.
+// A conflict drops the cache, the happening changed elsewhere.
 func (hm *HappeningManager) UpdateHappening(ctx context.Context, id int64, update *models.HappeningOptional) (*models.Happening, error) {
 	updatedHappening, err := hm.service.Update(ctx, id, update)
 	if err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			hm.InvalidateCache()
+		}
 		return nil, err
 	}
 
@@ -126,6 +131,57 @@ func (hm *HappeningManager) InvalidateCache() {
 	hm.loading = false
 }
 
+// Reload lists the happenings again if they were loaded, e.g. after
+// they were changed elsewhere. Cached happenings still there are
+// updated in place. It returns the happenings and whether any changed.
+func (hm *HappeningManager) Reload() ([]*models.Happening, bool, error) {
+	hm.mutex.RLock()
+	loaded := hm.loaded
+	hm.mutex.RUnlock()
+	if !loaded {
+		return nil, false, nil
+	}
+
+	happenings, _, err := hm.service.List(storage.HappeningListOptions{
+		Limit: 20,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Slice(happenings, func(i, j int) bool {
+		return happenings[i].CreateTime.Before(happenings[j].CreateTime)
+	})
+
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+	changed := len(happenings) != len(hm.cachedHappenings)
+	existing := make(map[int64]*models.Happening, len(hm.cachedHappenings))
+	for _, happening := range hm.cachedHappenings {
+		existing[happening.ID] = happening
+	}
+	for i, happening := range happenings {
+		cached := existing[happening.ID]
+		if cached == nil {
+			changed = true
+			continue
+		}
+		if !sameJSON(cached, happening) {
+			changed = true
+			*cached = *happening
+		}
+		if i < len(hm.cachedHappenings) && hm.cachedHappenings[i] != cached {
+			changed = true
+		}
+		happenings[i] = cached
+	}
+	hm.cachedHappenings = happenings
+	hm.loaded = true
+
+	reloaded := make([]*models.Happening, len(happenings))
+	copy(reloaded, happenings)
+	return reloaded, changed, nil
+}
+
 // loadAndCache performs the actual loading and caching
 func (hm *HappeningManager) loadAndCache(ctx context.Context) ([]*models.Happening, error) {
 	hm.mutex.Lock()
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// DefaultHistoryLimit is the number of actions that can be undone
+const DefaultHistoryLimit = 100
+
+// History records how to revert and replay the mutations of a
+// LogManager, see LogManager.Undo and LogManager.Redo
+type History struct {
+	// Limit caps the number of undoable actions, the oldest go first
+	Limit int
+
+	undo []*action
+	redo []*action
+
+	// batch collects the steps of LogManager.Batch
+	batch  *action
+	paused bool
+
+	// noteIDs maps the IDs of deleted notes to those they were added
+	// back under, by backends that cannot keep them
+	noteIDs map[int64]int64
+}
+
+// action is what one undo or redo reverts or replays
+type action struct {
+	steps []step
+}
+
+type step struct {
+	undo func(ctx context.Context) error
+	redo func(ctx context.Context) error
+}
+
+func NewHistory(limit int) *History {
+	return &History{
+		Limit:   limit,
+		noteIDs: make(map[int64]int64),
+	}
+}
+
+func (h *History) CanUndo() bool {
+	return h != nil && len(h.undo) > 0
+}
+
+func (h *History) CanRedo() bool {
+	return h != nil && len(h.redo) > 0
+}
+
+func (h *History) push(a *action) {
+	h.undo = append(h.undo, a)
+	if h.Limit > 0 && len(h.undo) > h.Limit {
+		h.undo = append([]*action(nil), h.undo[len(h.undo)-h.Limit:]...)
+	}
+	h.redo = nil
+}
+
+// noteID returns the current ID of a note that may have been
+// deleted and added back
+func (h *History) noteID(id int64) int64 {
+	if h == nil {
+		return id
+	}
+	for {
+		next, ok := h.noteIDs[id]
+		if !ok {
+			return id
+		}
+		id = next
+	}
+}
+
+func (m *LogManager) record(s step) {
+	h := m.History
+	if h == nil || h.paused {
+		return
+	}
+	if h.batch != nil {
+		h.batch.steps = append(h.batch.steps, s)
+		return
+	}
+	h.push(&action{steps: []step{s}})
+}
+
+// Batch runs fn and records the mutations it makes as one action,
+// undone and redone together
+func (m *LogManager) Batch(fn func() error) error {
+	h := m.History
+	if h == nil || h.paused || h.batch != nil {
+		return fn()
+	}
+	h.batch = &action{}
+	err := fn()
+	batch := h.batch
+	h.batch = nil
+	if len(batch.steps) > 0 {
+		h.push(batch)
+	}
+	return err
+}
+
+// withoutHistory runs fn without recording its mutations
+func (m *LogManager) withoutHistory(fn func() error) error {
+	h := m.History
+	if h == nil || h.paused {
+		return fn()
+	}
+	h.paused = true
+	defer func() {
+		h.paused = false
+	}()
+	return fn()
+}
+
+// Undo reverts the last action. It returns false if there is
+// nothing to undo.
+func (m *LogManager) Undo(ctx context.Context) (bool, error) {
+	h := m.History
+	if !h.CanUndo() {
+		return false, nil
+	}
+	a := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	err := m.withoutHistory(func() error {
+		for i := len(a.steps) - 1; i >= 0; i-- {
+			if err := a.steps[i].undo(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return true, fmt.Errorf("failed to undo: %w", err)
+	}
+	h.redo = append(h.redo, a)
+	return true, nil
+}
+
+// Redo replays the last undone action. It returns false if there
+// is nothing to redo.
+func (m *LogManager) Redo(ctx context.Context) (bool, error) {
+	h := m.History
+	if !h.CanRedo() {
+		return false, nil
+	}
+	a := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	err := m.withoutHistory(func() error {
+		for _, s := range a.steps {
+			if err := s.redo(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return true, fmt.Errorf("failed to redo: %w", err)
+	}
+	h.undo = append(h.undo, a)
+	return true, nil
+}
+
+func (h *History) mapNote(oldID int64, newID int64) {
+	if h != nil && oldID != newID {
+		h.noteIDs[oldID] = newID
+	}
+}
+
+// deleteNote deletes the note and returns it as it was
+func (m *LogManager) deleteNote(ctx context.Context, entryID int64, noteID int64) (models.Note, error) {
+	entry, err := m.Get(entryID)
+	if err != nil {
+		return models.Note{}, err
+	}
+	var deleted models.Note
+	for _, n := range entry.Notes {
+		if n.Data.ID == noteID {
+			deleted = *n.Data
+			break
+		}
+	}
+	err = m.LogNoteService.Delete(ctx, entryID, noteID)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	for i, n := range entry.Notes {
+		if n.Data.ID == noteID {
+			entry.Notes = append(entry.Notes[:i], entry.Notes[i+1:]...)
+			break
+		}
+	}
+	deleted.EntryID = entryID
+	return deleted, nil
+}
+
+// restoreNote adds a deleted note back, under its original ID if the
+// backend can keep it
+func (m *LogManager) restoreNote(ctx context.Context, note models.Note) error {
+	entry, err := m.Get(note.EntryID)
+	if err != nil {
+		return err
+	}
+	if restorer, ok := m.LogEntryService.(storage.LogEntryRestorer); ok {
+		if err := restorer.Restore(ctx, nil, []models.Note{note}); err != nil {
+			return err
+		}
+	} else {
+		id, err := m.LogNoteService.Add(ctx, note.EntryID, note)
+		if err != nil {
+			return err
+		}
+		m.History.mapNote(note.ID, id)
+		note.ID = id
+	}
+	entry.Notes = append(entry.Notes, &models.NoteView{Data: &note})
+	sort.SliceStable(entry.Notes, func(i, j int) bool {
+		return entry.Notes[i].Data.ID < entry.Notes[j].Data.ID
+	})
+	return nil
+}
+
+// revertEntryUpdate returns the update that sets the fields
+// changed by update back to their values in old
+func revertEntryUpdate(old models.LogEntry, update models.LogEntryOptional) models.LogEntryOptional {
+	var revert models.LogEntryOptional
+	if update.Text != nil {
+		revert.Text = &old.Text
+	}
+	if update.Done != nil {
+		revert.Done = &old.Done
+	}
+	if update.DoneTime != nil {
+		revert.DoneTime = &old.DoneTime
+	}
+	if update.CreateTime != nil {
+		revert.CreateTime = &old.CreateTime
+	}
+	if update.UpdateTime != nil {
+		revert.UpdateTime = &old.UpdateTime
+	}
+	if update.AdjustedTopTime != nil {
+		revert.AdjustedTopTime = &old.AdjustedTopTime
+	}
+	if update.HighlightLevel != nil {
+		revert.HighlightLevel = &old.HighlightLevel
+	}
+	if update.Collapsed != nil {
+		revert.Collapsed = &old.Collapsed
+	}
+	if update.ParentID != nil {
+		revert.ParentID = &old.ParentID
+	}
+	if update.DueTime != nil {
+		revert.DueTime = &old.DueTime
+	}
+	if update.ScheduledTime != nil {
+		revert.ScheduledTime = &old.ScheduledTime
+	}
+	if update.Repeat != nil {
+		revert.Repeat = &old.Repeat
+	}
+	return revert
+}
+
+func revertNoteUpdate(old models.Note, update models.NoteOptional) models.NoteOptional {
+	var revert models.NoteOptional
+	if update.Text != nil {
+		revert.Text = &old.Text
+	}
+	if update.CreateTime != nil {
+		revert.CreateTime = &old.CreateTime
+	}
+	if update.UpdateTime != nil {
+		revert.UpdateTime = &old.UpdateTime
+	}
+	return revert
+}
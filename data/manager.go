@@ -2,12 +2,14 @@ package data
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"time"
 
 	"github.com/xhd2015/todo/data/storage"
 	"github.com/xhd2015/todo/data/storage/http"
+	"github.com/xhd2015/todo/internal/recur"
 	"github.com/xhd2015/todo/models"
 )
 
@@ -17,7 +19,15 @@ type Services struct {
 	LogNote           storage.LogNoteService
 	Happening         storage.HappeningService
 	StateRecording    storage.StateRecordingService
+	Group             storage.GroupService
+	Search            storage.SearchService
+	Revision          storage.RevisionService
 	LearningMaterials *http.LearningMaterialsHttpService
+	// ServerClient is the client of the server storage, nil for others
+	ServerClient *http.Client
+	// Changes tells when the storage was changed elsewhere, nil if
+	// it cannot tell
+	Changes storage.ChangeFeed
 }
 
 type LogManager struct {
@@ -25,11 +35,25 @@ type LogManager struct {
 	LogNoteService        storage.LogNoteService
 	HappeningService      storage.HappeningService
 	StateRecordingService storage.StateRecordingService
+	GroupService          storage.GroupService
+	RevisionService       storage.RevisionService
 
 	Entries []*models.LogEntryView
 
+	// Groups are ordered by position, GroupMapping maps
+	// entry ID to group ID, 0 for a detached entry
+	Groups       []models.Group
+	GroupMapping map[int64]int64
+
 	// Happening manager with internal caching
 	HappeningManager *HappeningManager
+
+	// History records entry and note mutations for Undo and Redo
+	History *History
+
+	// conflicted applies again the last update refused by storage
+	// because it was changed elsewhere, see RetryConflicted
+	conflicted func(ctx context.Context) error
 }
 
 func NewLogManager(services *Services) *LogManager {
@@ -38,21 +62,24 @@ func NewLogManager(services *Services) *LogManager {
 		LogNoteService:        services.LogNote,
 		HappeningService:      services.Happening,
 		StateRecordingService: services.StateRecording,
+		GroupService:          services.Group,
+		RevisionService:       services.Revision,
 		HappeningManager:      NewHappeningManager(services.Happening),
+		History:               NewHistory(DefaultHistoryLimit),
 	}
 }
 
-func (m *LogManager) InitWithHistory(showHistory bool) error {
-	entries, err := loadEntries(m.LogEntryService, m.LogNoteService, showHistory)
+func (m *LogManager) InitWithHistory(ctx context.Context, showHistory bool) error {
+	entries, err := loadEntries(ctx, m.LogEntryService, m.LogNoteService, showHistory)
 	if err != nil {
 		return err
 	}
 	m.Entries = entries
-	return nil
+	return m.LoadGroups(ctx)
 }
 
-func loadEntries(svc storage.LogEntryService, noteSvc storage.LogNoteService, showHistory bool) ([]*models.LogEntryView, error) {
-	entries, _, err := svc.List(storage.LogEntryListOptions{
+func loadEntries(ctx context.Context, svc storage.LogEntryService, noteSvc storage.LogNoteService, showHistory bool) ([]*models.LogEntryView, error) {
+	entries, _, err := svc.List(ctx, storage.LogEntryListOptions{
 		IncludeHistory: showHistory,
 	})
 	if err != nil {
@@ -62,10 +89,6 @@ func loadEntries(svc storage.LogEntryService, noteSvc storage.LogNoteService, sh
 	// No need for manual filtering anymore - the storage layer handles it
 	filteredEntries := entries
 
-	var entriesView []*models.LogEntryView
-	// Create a map for quick lookup
-	entryMap := make(map[int64]*models.LogEntryView)
-
 	// Collect all entry IDs for batch note loading
 	entryIDs := make([]int64, 0, len(filteredEntries))
 	for _, entry := range filteredEntries {
@@ -73,12 +96,21 @@ func loadEntries(svc storage.LogEntryService, noteSvc storage.LogNoteService, sh
 	}
 
 	// Batch load all notes for all entries
-	allNotes, err := noteSvc.ListForEntries(entryIDs)
+	allNotes, err := noteSvc.ListForEntries(ctx, entryIDs)
 	if err != nil {
 		return nil, err
 	}
+	return buildEntryViews(filteredEntries, allNotes), nil
+}
 
-	for _, entry := range filteredEntries {
+// buildEntryViews arranges entries with their notes into trees, and
+// returns the roots. Entries whose parent is missing are left out.
+func buildEntryViews(entries []models.LogEntry, allNotes map[int64][]models.Note) []*models.LogEntryView {
+	var entriesView []*models.LogEntryView
+	// Create a map for quick lookup
+	entryMap := make(map[int64]*models.LogEntryView)
+
+	for _, entry := range entries {
 		notes := allNotes[entry.ID] // Get notes for this entry
 		notesView := make([]*models.NoteView, 0, len(notes))
 		for _, note := range notes {
@@ -116,12 +148,12 @@ func loadEntries(svc storage.LogEntryService, noteSvc storage.LogNoteService, sh
 
 	sortEntries(rootEntries)
 
-	return rootEntries, nil
+	return rootEntries
 }
 
 // Init initializes with default behavior (no history)
-func (m *LogManager) Init() error {
-	return m.InitWithHistory(false)
+func (m *LogManager) Init(ctx context.Context) error {
+	return m.InitWithHistory(ctx, false)
 }
 
 func sortEntries(entries []*models.LogEntryView) {
@@ -155,22 +187,42 @@ func isNewer(a *models.LogEntryView, b *models.LogEntryView) bool {
 	return a.Data.AdjustedTopTime > b.Data.AdjustedTopTime
 }
 
-func (m *LogManager) Add(entry models.LogEntry) (int64, error) {
+func (m *LogManager) Add(ctx context.Context, entry models.LogEntry) (int64, error) {
 	if entry.CreateTime.IsZero() {
 		entry.CreateTime = time.Now()
 	}
 	if entry.UpdateTime.IsZero() {
 		entry.UpdateTime = time.Now()
 	}
-	id, err := m.LogEntryService.Add(entry)
+	id, err := m.LogEntryService.Add(ctx, entry)
 	if err != nil {
 		return 0, err
 	}
 	entry.ID = id
-	entryView := &models.LogEntryView{
+	m.attach(newEntryView(entry, nil))
+
+	m.record(step{
+		undo: func(ctx context.Context) error {
+			return m.Delete(ctx, id)
+		},
+		redo: func(ctx context.Context) error {
+			return m.Undelete(ctx, id)
+		},
+	})
+	return id, nil
+}
+
+func newEntryView(entry models.LogEntry, notes []models.Note) *models.LogEntryView {
+	notesView := make([]*models.NoteView, 0, len(notes))
+	for _, note := range notes {
+		notesView = append(notesView, &models.NoteView{
+			Data: &note,
+		})
+	}
+	return &models.LogEntryView{
 		Data:     &entry,
 		ViewType: models.LogEntryViewType_Log,
-		Notes:    []*models.NoteView{},
+		Notes:    notesView,
 		Children: []*models.LogEntryView{},
 		DetailPage: &models.EntryOnDetailPage{
 			InputState: models.InputState{
@@ -178,29 +230,30 @@ func (m *LogManager) Add(entry models.LogEntry) (int64, error) {
 			},
 		},
 	}
+}
 
-	// If this entry has a parent, add it to parent's children
-	if entry.ParentID != 0 {
-		var findAndAddToParent func(entries []*models.LogEntryView) bool
-		findAndAddToParent = func(entries []*models.LogEntryView) bool {
-			for _, existingEntry := range entries {
-				if existingEntry.Data.ID == entry.ParentID {
-					existingEntry.Children = append(existingEntry.Children, entryView)
-					return true
-				}
-				if findAndAddToParent(existingEntry.Children) {
-					return true
-				}
+// attach adds the view to the children of its parent, or
+// to the top-level entries if it has none
+func (m *LogManager) attach(entryView *models.LogEntryView) {
+	parentID := entryView.Data.ParentID
+	if parentID == 0 {
+		m.Entries = append(m.Entries, entryView)
+		return
+	}
+	var findAndAddToParent func(entries []*models.LogEntryView) bool
+	findAndAddToParent = func(entries []*models.LogEntryView) bool {
+		for _, existingEntry := range entries {
+			if existingEntry.Data.ID == parentID {
+				existingEntry.Children = append(existingEntry.Children, entryView)
+				return true
+			}
+			if findAndAddToParent(existingEntry.Children) {
+				return true
 			}
-			return false
 		}
-		findAndAddToParent(m.Entries)
-	} else {
-		// Only add root entries (ParentID == 0) to the top-level entries
-		m.Entries = append(m.Entries, entryView)
+		return false
 	}
-
-	return id, nil
+	findAndAddToParent(m.Entries)
 }
 
 func (m *LogManager) Get(id int64) (*models.LogEntryView, error) {
@@ -225,7 +278,10 @@ func (m *LogManager) Get(id int64) (*models.LogEntryView, error) {
 	return result, nil
 }
 
-func (m *LogManager) Update(id int64, entry models.LogEntryOptional) error {
+// Update updates the entry unless it was changed elsewhere since it was
+// loaded, in which case it returns a *storage.ConflictError
+func (m *LogManager) Update(ctx context.Context, id int64, entry models.LogEntryOptional) error {
+	retry := entry
 	if entry.UpdateTime == nil {
 		t := time.Now()
 		entry.UpdateTime = &t
@@ -236,11 +292,31 @@ func (m *LogManager) Update(id int64, entry models.LogEntryOptional) error {
 		return err
 	}
 	oldParentID := targetEntry.Data.ParentID
+	old := *targetEntry.Data
 
-	err = m.LogEntryService.Update(id, entry)
+	// the steps recorded below keep entry, which carries no
+	// precondition, they are guarded when they run
+	guarded := entry
+	if guarded.IfUpdateTime == nil && !old.UpdateTime.IsZero() {
+		guarded.IfUpdateTime = &old.UpdateTime
+	}
+	err = m.LogEntryService.Update(ctx, id, guarded)
 	if err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			m.conflicted = func(ctx context.Context) error {
+				return m.Update(ctx, id, retry)
+			}
+		}
 		return err
 	}
+	m.record(step{
+		undo: func(ctx context.Context) error {
+			return m.Update(ctx, id, revertEntryUpdate(old, entry))
+		},
+		redo: func(ctx context.Context) error {
+			return m.Update(ctx, id, entry)
+		},
+	})
 
 	var hasAdjustedTopTime bool
 	var parentChanged bool
@@ -288,16 +364,113 @@ func (m *LogManager) Update(id int64, entry models.LogEntryOptional) error {
 	return nil
 }
 
-func (m *LogManager) Delete(id int64) error {
-	err := m.LogEntryService.Delete(id)
+// AddNextOccurrence adds the next occurrence of the recurring entry id,
+// done at doneTime, as its sibling. It returns 0 if the entry does not
+// repeat or its next occurrence exists already, e.g. after undo and redo.
+func (m *LogManager) AddNextOccurrence(ctx context.Context, id int64, doneTime time.Time) (int64, error) {
+	entry, err := m.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	if entry.Data.Repeat == "" || m.findNextOccurrence(m.Entries, id) != nil {
+		return 0, nil
+	}
+	next, err := recur.NextOccurrence(*entry.Data, doneTime)
+	if err != nil {
+		return 0, err
+	}
+	nextID, err := m.Add(ctx, next)
+	if err != nil {
+		return 0, err
+	}
+	sortEntries(m.Entries)
+	return nextID, nil
+}
+
+func (m *LogManager) findNextOccurrence(entries []*models.LogEntryView, id int64) *models.LogEntryView {
+	for _, e := range entries {
+		if e.Data.PreviousID == id {
+			return e
+		}
+		if found := m.findNextOccurrence(e.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Delete moves the entry with its descendants to trash
+func (m *LogManager) Delete(ctx context.Context, id int64) error {
+	err := m.LogEntryService.Delete(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	m.deleteEntry(id)
+	m.record(step{
+		undo: func(ctx context.Context) error {
+			return m.Undelete(ctx, id)
+		},
+		redo: func(ctx context.Context) error {
+			return m.Delete(ctx, id)
+		},
+	})
 	return nil
 }
 
+// Undelete restores the entry with the descendants deleted along
+// from trash
+func (m *LogManager) Undelete(ctx context.Context, id int64) error {
+	err := m.LogEntryService.Undelete(ctx, id)
+	if err != nil {
+		return err
+	}
+	m.record(step{
+		undo: func(ctx context.Context) error {
+			return m.Delete(ctx, id)
+		},
+		redo: func(ctx context.Context) error {
+			return m.Undelete(ctx, id)
+		},
+	})
+
+	// done descendants come back too, they were deleted along
+	entry, err := m.GetTree(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	m.attach(entry)
+	sortEntries(m.Entries)
+	return nil
+}
+
+// Trash lists the entries in trash, each with the descendants
+// deleted along with it, most recently deleted first
+func (m *LogManager) Trash(ctx context.Context) ([]*models.LogEntryView, error) {
+	entries, _, err := m.LogEntryService.List(ctx, storage.LogEntryListOptions{Deleted: true})
+	if err != nil {
+		return nil, err
+	}
+	views := make(map[int64]*models.LogEntryView, len(entries))
+	for _, entry := range entries {
+		views[entry.ID] = newEntryView(entry, nil)
+	}
+	var roots []*models.LogEntryView
+	for _, entry := range entries {
+		view := views[entry.ID]
+		parent, ok := views[entry.ParentID]
+		if ok && parent.Data.DeletedTime.Equal(*entry.DeletedTime) {
+			parent.Children = append(parent.Children, view)
+			continue
+		}
+		roots = append(roots, view)
+	}
+	sort.SliceStable(roots, func(i, j int) bool {
+		return roots[i].Data.DeletedTime.After(*roots[j].Data.DeletedTime)
+	})
+	return roots, nil
+}
+
 func (m *LogManager) deleteEntry(id int64) *models.LogEntryView {
 	// bread-first search
 	var foundEntry *models.LogEntryView
@@ -326,7 +499,7 @@ func (m *LogManager) deleteEntry(id int64) *models.LogEntryView {
 	return foundEntry
 }
 
-func (m *LogManager) AddNote(entryID int64, note models.Note) error {
+func (m *LogManager) AddNote(ctx context.Context, entryID int64, note models.Note) error {
 	entry, err := m.Get(entryID)
 	if err != nil {
 		return err
@@ -338,7 +511,7 @@ func (m *LogManager) AddNote(entryID int64, note models.Note) error {
 	if note.UpdateTime.IsZero() {
 		note.UpdateTime = time.Now()
 	}
-	id, err := m.LogNoteService.Add(entryID, note)
+	id, err := m.LogNoteService.Add(ctx, entryID, note)
 	if err != nil {
 		return err
 	}
@@ -348,39 +521,79 @@ func (m *LogManager) AddNote(entryID int64, note models.Note) error {
 		Data: &note,
 	})
 
+	var deleted models.Note
+	m.record(step{
+		undo: func(ctx context.Context) (err error) {
+			deleted, err = m.deleteNote(ctx, entryID, m.History.noteID(id))
+			return err
+		},
+		redo: func(ctx context.Context) error {
+			return m.restoreNote(ctx, deleted)
+		},
+	})
 	return nil
 }
 
-func (m *LogManager) DeleteNote(entryID int64, noteID int64) error {
-	entry, err := m.Get(entryID)
+func (m *LogManager) DeleteNote(ctx context.Context, entryID int64, noteID int64) error {
+	deleted, err := m.deleteNote(ctx, entryID, noteID)
 	if err != nil {
 		return err
 	}
+	m.record(step{
+		undo: func(ctx context.Context) error {
+			return m.restoreNote(ctx, deleted)
+		},
+		redo: func(ctx context.Context) (err error) {
+			deleted, err = m.deleteNote(ctx, entryID, m.History.noteID(noteID))
+			return err
+		},
+	})
+	return nil
+}
+
+// UpdateNote updates the note unless it was changed elsewhere since it
+// was loaded, like Update
+func (m *LogManager) UpdateNote(ctx context.Context, entryID int64, noteID int64, note models.NoteOptional) error {
+	retry := note
+	if note.UpdateTime == nil {
+		t := time.Now()
+		note.UpdateTime = &t
+	}
 
-	err = m.LogNoteService.Delete(entryID, noteID)
+	entry, err := m.Get(entryID)
 	if err != nil {
 		return err
 	}
 
-	for i, n := range entry.Notes {
+	var old models.Note
+	for _, n := range entry.Notes {
 		if n.Data.ID == noteID {
-			entry.Notes = append(entry.Notes[:i], entry.Notes[i+1:]...)
+			old = *n.Data
 			break
 		}
 	}
-	return nil
-}
 
-func (m *LogManager) UpdateNote(entryID int64, noteID int64, note models.NoteOptional) error {
-	entry, err := m.Get(entryID)
-	if err != nil {
-		return err
+	guarded := note
+	if guarded.IfUpdateTime == nil && !old.UpdateTime.IsZero() {
+		guarded.IfUpdateTime = &old.UpdateTime
 	}
-
-	err = m.LogNoteService.Update(entryID, noteID, note)
+	err = m.LogNoteService.Update(ctx, entryID, noteID, guarded)
 	if err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			m.conflicted = func(ctx context.Context) error {
+				return m.UpdateNote(ctx, entryID, noteID, retry)
+			}
+		}
 		return err
 	}
+	m.record(step{
+		undo: func(ctx context.Context) error {
+			return m.UpdateNote(ctx, entryID, m.History.noteID(noteID), revertNoteUpdate(old, note))
+		},
+		redo: func(ctx context.Context) error {
+			return m.UpdateNote(ctx, entryID, m.History.noteID(noteID), note)
+		},
+	})
 
 	for _, n := range entry.Notes {
 		if n.Data.ID == noteID {
@@ -391,24 +604,65 @@ func (m *LogManager) UpdateNote(entryID int64, noteID int64, note models.NoteOpt
 	return nil
 }
 
-func (m *LogManager) Move(id int64, newParentID int64) error {
-	err := m.LogEntryService.Move(id, newParentID)
+// RetryConflicted applies again the last update refused because the
+// entry or note was changed elsewhere. It is meant to follow a reload,
+// after which the update applies on top of the other change.
+func (m *LogManager) RetryConflicted(ctx context.Context) error {
+	retry := m.conflicted
+	if retry == nil {
+		return fmt.Errorf("no conflicting change to retry")
+	}
+	m.conflicted = nil
+	return retry(ctx)
+}
+
+func (m *LogManager) Move(ctx context.Context, id int64, newParentID int64) error {
+	err := m.LogEntryService.Move(ctx, id, newParentID)
 	if err != nil {
 		return err
 	}
+	// storage times the move itself, later updates are checked
+	// against that time
+	tree, err := m.LogEntryService.GetTree(ctx, id, false)
+	if err != nil {
+		return err
+	}
+	var updateTime time.Time
+	for _, entry := range tree {
+		if entry.ID == id {
+			updateTime = entry.UpdateTime
+		}
+	}
 
 	// first, remove from old parent
 	moved := m.deleteEntry(id)
 	if moved == nil {
 		return nil
 	}
+	oldParentID := moved.Data.ParentID
+	m.record(step{
+		undo: func(ctx context.Context) error {
+			return m.Move(ctx, id, oldParentID)
+		},
+		redo: func(ctx context.Context) error {
+			return m.Move(ctx, id, newParentID)
+		},
+	})
+
+	if newParentID == 0 {
+		moved.Data.ParentID = 0
+		moved.Data.UpdateTime = updateTime
+		m.Entries = append(m.Entries, moved)
+		flatSortEntries(m.Entries)
+		return nil
+	}
 
 	// then, add to new parent
 	var traverse func(entry *models.LogEntryView) bool
 	traverse = func(entry *models.LogEntryView) bool {
 		if entry.Data.ID == newParentID {
 			moved.Data.ParentID = newParentID
-			moved.Data.UpdateTime = time.Now()
+			moved.Data.UpdateTime = updateTime
 			entry.Children = append(entry.Children, moved)
 			flatSortEntries(entry.Children)
 			return true
@@ -449,7 +703,7 @@ func (m *LogManager) GetTree(ctx context.Context, id int64, includeHistory bool)
 	}
 
 	// Batch load all notes for all entries
-	allNotes, err := m.LogNoteService.ListForEntries(entryIDs)
+	allNotes, err := m.LogNoteService.ListForEntries(ctx, entryIDs)
 	if err != nil {
 		return nil, err
 	}
@@ -505,7 +759,7 @@ func (m *LogManager) GetTree(ctx context.Context, id int64, includeHistory bool)
 }
 
 // ToggleCollapsed toggles the collapsed state of an entry
-func (m *LogManager) ToggleCollapsed(id int64) error {
+func (m *LogManager) ToggleCollapsed(ctx context.Context, id int64) error {
 	entry, err := m.Get(id)
 	if err != nil {
 		return err
@@ -514,8 +768,11 @@ func (m *LogManager) ToggleCollapsed(id int64) error {
 	// Toggle the collapsed state
 	newCollapsed := !entry.Data.Collapsed
 
-	err = m.Update(id, models.LogEntryOptional{
-		Collapsed: &newCollapsed,
+	// collapsing only changes the view, it is not undone
+	err = m.withoutHistory(func() error {
+		return m.Update(ctx, id, models.LogEntryOptional{
+			Collapsed: &newCollapsed,
+		})
 	})
 	if err != nil {
 		return err
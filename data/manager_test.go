@@ -0,0 +1,1151 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/data/storage/filestore"
+	storagehttp "github.com/xhd2015/todo/data/storage/http"
+	"github.com/xhd2015/todo/data/storage/memory"
+	"github.com/xhd2015/todo/data/storage/sqlite"
+	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/server"
+)
+
+func sqliteServices(t *testing.T) *data.Services {
+	return openSQLiteServices(t, filepath.Join(t.TempDir(), "todo.db"))
+}
+
+func openSQLiteServices(t *testing.T, file string) *data.Services {
+	store, err := sqlite.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return &data.Services{
+		LogEntry:       &sqlite.LogEntrySQLiteStore{SQLiteStore: store},
+		LogNote:        &sqlite.LogNoteSQLiteStore{SQLiteStore: store},
+		Happening:      &sqlite.HappeningSQLiteStore{SQLiteStore: store},
+		StateRecording: &sqlite.StateRecordingSQLiteStore{SQLiteStore: store},
+		Group:          &sqlite.GroupSQLiteStore{SQLiteStore: store},
+		Search:         &sqlite.SearchSQLiteStore{SQLiteStore: store},
+		Revision:       &sqlite.RevisionSQLiteStore{SQLiteStore: store},
+		Changes:        store,
+	}
+}
+
+func fileServices(t *testing.T) *data.Services {
+	store, err := filestore.Open(filepath.Join(t.TempDir(), "lifelog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storeServices(store)
+}
+
+func storeServices(store *memory.BaseStore) *data.Services {
+	return &data.Services{
+		LogEntry:       store.LogEntryService(),
+		LogNote:        store.LogNoteService(),
+		Happening:      store.HappeningService(),
+		StateRecording: store.StateRecordingService(),
+		Group:          store.GroupService(),
+		Search:         store.SearchService(),
+		Revision:       store.RevisionService(),
+		Changes:        store,
+	}
+}
+
+func httpServices(t *testing.T) *data.Services {
+	ts := httptest.NewServer(server.New(sqliteServices(t), "secret"))
+	t.Cleanup(ts.Close)
+	return clientServices(ts.URL + server.APIPrefix)
+}
+
+func clientServices(serverAddr string) *data.Services {
+	client := storagehttp.NewClient(serverAddr, "secret")
+	return &data.Services{
+		LogEntry:       storagehttp.NewLogEntryService(client),
+		LogNote:        storagehttp.NewLogNoteService(client),
+		Happening:      storagehttp.NewHappeningService(client),
+		StateRecording: storagehttp.NewStateRecordingService(client),
+		Group:          storagehttp.NewGroupService(client),
+		Search:         storagehttp.NewSearchService(client),
+		Revision:       storagehttp.NewRevisionService(client),
+		Changes:        client,
+	}
+}
+
+var backends = []struct {
+	name     string
+	services func(t *testing.T) *data.Services
+}{
+	{name: "sqlite", services: sqliteServices},
+	{name: "file", services: fileServices},
+	{name: "http", services: httpServices},
+}
+
+func TestAddNextOccurrence(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			services := backend.services(t)
+			m := data.NewLogManager(services)
+			if err := m.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			parentID, err := m.Add(ctx, models.LogEntry{Text: "chores"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			due := time.Date(2025, 9, 3, 17, 0, 0, 0, time.Local)
+			id, err := m.Add(ctx, models.LogEntry{Text: "water plants", ParentID: parentID, DueTime: &due, Repeat: "daily"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.AddNote(ctx, id, models.Note{Text: "used 1l"}); err != nil {
+				t.Fatal(err)
+			}
+
+			done := true
+			doneTime := time.Date(2025, 9, 3, 16, 0, 0, 0, time.Local)
+			doneTimePtr := &doneTime
+			if err := m.Update(ctx, id, models.LogEntryOptional{Done: &done, DoneTime: &doneTimePtr}); err != nil {
+				t.Fatal(err)
+			}
+			nextID, err := m.AddNextOccurrence(ctx, id, doneTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nextID == 0 {
+				t.Fatalf("expected next occurrence to be added")
+			}
+			// done again after undo must not add another one
+			again, err := m.AddNextOccurrence(ctx, id, doneTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != 0 {
+				t.Fatalf("expected no duplicate occurrence, got %d", again)
+			}
+
+			// reload from storage
+			reloaded := data.NewLogManager(services)
+			if err := reloaded.InitWithHistory(ctx, true); err != nil {
+				t.Fatal(err)
+			}
+			next, err := reloaded.Get(nextID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantDue := due.AddDate(0, 0, 1)
+			if next.Data.Done || next.Data.ParentID != parentID || next.Data.PreviousID != id ||
+				next.Data.Repeat != "daily" || next.Data.DueTime == nil || !next.Data.DueTime.Equal(wantDue) {
+				t.Fatalf("unexpected next occurrence: %+v", next.Data)
+			}
+			previous, err := reloaded.Get(next.Data.PreviousID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !previous.Data.Done || len(previous.Notes) != 1 {
+				t.Fatalf("expected previous occurrence done with its notes, got %+v", previous)
+			}
+		})
+	}
+}
+
+func TestListByTags(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			entries := backend.services(t).LogEntry
+			work, err := entries.Add(ctx, models.LogEntry{Text: "fix login #work #urgent"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := entries.Add(ctx, models.LogEntry{Text: "buy milk #home"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := entries.Add(ctx, models.LogEntry{Text: "issue #123 is not a tag"}); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				tags []string
+				want int
+			}{
+				{tags: []string{"work"}, want: 1},
+				{tags: []string{"#Work", "urgent"}, want: 1},
+				{tags: []string{"work", "home"}, want: 0},
+				{tags: []string{"123"}, want: 0},
+				{tags: nil, want: 3},
+			}
+			for _, tt := range tests {
+				list, total, err := entries.List(ctx, storage.LogEntryListOptions{Tags: tt.tags})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if total != int64(tt.want) || len(list) != tt.want {
+					t.Errorf("tags %v: expected %d entries, got %d", tt.tags, tt.want, len(list))
+				}
+			}
+
+			// retagging through an update reindexes the entry
+			text := "fix login #home"
+			if err := entries.Update(ctx, work, models.LogEntryOptional{Text: &text}); err != nil {
+				t.Fatal(err)
+			}
+			list, _, err := entries.List(ctx, storage.LogEntryListOptions{Tags: []string{"home"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 2 {
+				t.Fatalf("expected 2 entries tagged #home after update, got %d", len(list))
+			}
+			if err := entries.Delete(ctx, work); err != nil {
+				t.Fatal(err)
+			}
+			list, _, err = entries.List(ctx, storage.LogEntryListOptions{Tags: []string{"home"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 {
+				t.Fatalf("expected 1 entry tagged #home after delete, got %d", len(list))
+			}
+		})
+	}
+}
+
+func TestGroups(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			services := backend.services(t)
+			m := data.NewLogManager(services)
+			if err := m.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if got := groupNames(m.Groups); got != "Deadline,WorkPerf,LifeEnhance,WorkHack,LifeHack" {
+				t.Fatalf("unexpected default groups: %s", got)
+			}
+
+			readingID, err := m.AddGroup(ctx, " Reading ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.RenameGroup(ctx, readingID, "Books"); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.MoveGroup(ctx, readingID, -2); err != nil {
+				t.Fatal(err)
+			}
+			// moving past the top is a no-op
+			if err := m.MoveGroup(ctx, 1, -1); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.DeleteGroup(ctx, 2); err != nil {
+				t.Fatal(err)
+			}
+
+			entryID, err := m.Add(ctx, models.LogEntry{Text: "read a chapter"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherID, err := m.Add(ctx, models.LogEntry{Text: "file taxes"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.SetEntryGroup(ctx, entryID, readingID); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.SetEntryGroup(ctx, otherID, 1); err != nil {
+				t.Fatal(err)
+			}
+			// detaching keeps a membership that blocks tag mapping
+			if err := m.SetEntryGroup(ctx, otherID, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			// reload from storage
+			reloaded := data.NewLogManager(services)
+			if err := reloaded.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if got := groupNames(reloaded.Groups); got != "Deadline,LifeEnhance,Books,WorkHack,LifeHack" {
+				t.Fatalf("unexpected groups after changes: %s", got)
+			}
+			groupID, ok := reloaded.GroupMapping[otherID]
+			if reloaded.GroupMapping[entryID] != readingID || !ok || groupID != 0 {
+				t.Fatalf("unexpected group mapping: %v", reloaded.GroupMapping)
+			}
+
+			// deleting a group or purging an entry drops its memberships
+			if err := reloaded.DeleteGroup(ctx, readingID); err != nil {
+				t.Fatal(err)
+			}
+			if err := reloaded.Delete(ctx, otherID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := services.LogEntry.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if err := reloaded.LoadGroups(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if len(reloaded.GroupMapping) != 0 {
+				t.Fatalf("expected no memberships left, got %v", reloaded.GroupMapping)
+			}
+		})
+	}
+}
+
+func TestImportLegacyGroupMapping(t *testing.T) {
+	ctx := context.Background()
+	services := sqliteServices(t)
+	file := filepath.Join(t.TempDir(), "log_group.json")
+	legacy := `{"data":[
+		{"ID":1,"LogID":10,"GroupID":2},
+		{"ID":2,"LogID":11,"GroupID":3},
+		{"ID":3,"LogID":10,"GroupID":0},
+		{"ID":4,"LogID":12,"GroupID":6}
+	],"next_id":5}`
+	if err := os.WriteFile(file, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := data.ImportLegacyGroupMapping(ctx, services.Group, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 entries imported, got %d", n)
+	}
+	memberships, err := services.Group.ListMemberships(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.GroupMembership{{EntryID: 10, GroupID: 0}, {EntryID: 11, GroupID: 3}, {EntryID: 12, GroupID: 0}}
+	if len(memberships) != len(want) {
+		t.Fatalf("expected %v, got %v", want, memberships)
+	}
+	for i := range want {
+		if memberships[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, memberships)
+		}
+	}
+
+	// the file is renamed, so a second run imports nothing
+	if _, err := os.Stat(file + ".imported"); err != nil {
+		t.Fatal(err)
+	}
+	n, err = data.ImportLegacyGroupMapping(ctx, services.Group, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected nothing imported the second time, got %d", n)
+	}
+}
+
+func groupNames(groups []models.Group) string {
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSearch(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			services := backend.services(t)
+			deployID, err := services.LogEntry.Add(ctx, models.LogEntry{Text: "deploy the staging db"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			docsID, err := services.LogEntry.Add(ctx, models.LogEntry{Text: "write docs", Done: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := services.LogNote.Add(ctx, docsID, models.Note{Text: "mention the deploy rollback"}); err != nil {
+				t.Fatal(err)
+			}
+			happening, err := services.Happening.Add(ctx, &models.Happening{Content: "deploy went fine"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := func(q string) []int64 {
+				t.Helper()
+				results, err := services.Search.Search(ctx, storage.SearchOptions{Query: q})
+				if err != nil {
+					t.Fatalf("search %q: %v", q, err)
+				}
+				var ids []int64
+				for _, result := range results {
+					ids = append(ids, result.ID)
+				}
+				return ids
+			}
+			same := func(a []int64, b ...int64) bool {
+				if len(a) != len(b) {
+					return false
+				}
+				for i := range a {
+					if a[i] != b[i] {
+						return false
+					}
+				}
+				return true
+			}
+
+			// text matches rank above note matches
+			if got := ids("deploy"); len(got) != 3 || got[len(got)-1] != docsID {
+				t.Errorf("deploy: expected 3 results with the note match last, got %v", got)
+			}
+			if got := ids(`"staging db"`); !same(got, deployID) {
+				t.Errorf("phrase: expected [%d], got %v", deployID, got)
+			}
+			if got := ids("note:rollback"); !same(got, docsID) {
+				t.Errorf("note: expected [%d], got %v", docsID, got)
+			}
+			if got := ids("deploy done:no"); !same(got, deployID) {
+				t.Errorf("done:no: expected [%d], got %v", deployID, got)
+			}
+			if got := ids("went OR writ*"); len(got) != 2 {
+				t.Errorf("or/prefix: expected 2 results, got %v", got)
+			}
+			if got := ids("deploy before:2000-01-01"); len(got) != 0 {
+				t.Errorf("before: expected no results, got %v", got)
+			}
+
+			results, err := services.Search.Search(ctx, storage.SearchOptions{Query: "rollback"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || !strings.Contains(results[0].NoteSnippet, models.HighlightStart+"rollback"+models.HighlightEnd) {
+				t.Fatalf("expected a highlighted note snippet, got %+v", results)
+			}
+
+			// the index follows updates and deletes
+			text := "deploy production"
+			if err := services.LogEntry.Update(ctx, deployID, models.LogEntryOptional{Text: &text}); err != nil {
+				t.Fatal(err)
+			}
+			if got := ids("staging"); len(got) != 0 {
+				t.Errorf("expected no staging after update, got %v", got)
+			}
+			if err := services.Happening.Delete(ctx, happening.ID); err != nil {
+				t.Fatal(err)
+			}
+			if got := ids("deploy"); len(got) != 2 {
+				t.Errorf("expected 2 results after deleting the happening, got %v", got)
+			}
+
+			if _, err := services.Search.Search(ctx, storage.SearchOptions{Query: "done:maybe"}); err == nil {
+				t.Errorf("expected an error for an invalid qualifier")
+			}
+		})
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			services := backend.services(t)
+			m := data.NewLogManager(services)
+			if err := m.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			reload := func() *data.LogManager {
+				t.Helper()
+				reloaded := data.NewLogManager(services)
+				if err := reloaded.InitWithHistory(ctx, true); err != nil {
+					t.Fatal(err)
+				}
+				return reloaded
+			}
+			undo := func() {
+				t.Helper()
+				if ok, err := m.Undo(ctx); err != nil || !ok {
+					t.Fatalf("undo: %v, %v", ok, err)
+				}
+			}
+			redo := func() {
+				t.Helper()
+				if ok, err := m.Redo(ctx); err != nil || !ok {
+					t.Fatalf("redo: %v, %v", ok, err)
+				}
+			}
+
+			parentID, err := m.Add(ctx, models.LogEntry{Text: "project"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			childID, err := m.Add(ctx, models.LogEntry{Text: "task", ParentID: parentID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			subID, err := m.Add(ctx, models.LogEntry{Text: "subtask", ParentID: childID, Done: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.AddNote(ctx, childID, models.Note{Text: "details"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.SetEntryGroup(context.Background(), childID, 2); err != nil {
+				t.Fatal(err)
+			}
+
+			text := "task renamed"
+			if err := m.Update(ctx, childID, models.LogEntryOptional{Text: &text}); err != nil {
+				t.Fatal(err)
+			}
+			undo()
+			if child, _ := reload().Get(childID); child == nil || child.Data.Text != "task" {
+				t.Fatalf("expected text reverted, got %+v", child)
+			}
+			redo()
+
+			if err := m.Delete(ctx, parentID); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []int64{parentID, childID, subID} {
+				if _, err := reload().Get(id); err == nil {
+					t.Fatalf("expected entry %d deleted with its parent", id)
+				}
+			}
+
+			// the subtree comes back with its notes, group and IDs
+			undo()
+			reloaded := reload()
+			child, err := reloaded.Get(childID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if child.Data.Text != text || child.Data.ParentID != parentID || len(child.Notes) != 1 || child.Notes[0].Data.Text != "details" {
+				t.Fatalf("unexpected restored child: %+v", child)
+			}
+			if len(child.Children) != 1 || child.Children[0].Data.ID != subID || !child.Children[0].Data.Done {
+				t.Fatalf("expected restored subtask, got %+v", child.Children)
+			}
+			if reloaded.GroupMapping[childID] != 2 {
+				t.Fatalf("expected group restored, got %v", reloaded.GroupMapping)
+			}
+			if _, err := m.Get(subID); err != nil {
+				t.Fatalf("expected restored subtask in view: %v", err)
+			}
+
+			redo()
+			if _, err := reload().Get(parentID); err == nil {
+				t.Fatalf("expected parent deleted again")
+			}
+			undo()
+
+			if err := m.Move(ctx, subID, 0); err != nil {
+				t.Fatal(err)
+			}
+			undo()
+			if sub, _ := reload().Get(subID); sub == nil || sub.Data.ParentID != childID {
+				t.Fatalf("expected move reverted, got %+v", sub)
+			}
+
+			noteID := child.Notes[0].Data.ID
+			if err := m.DeleteNote(ctx, childID, noteID); err != nil {
+				t.Fatal(err)
+			}
+			undo()
+			if child, _ := reload().Get(childID); child == nil || len(child.Notes) != 1 || child.Notes[0].Data.ID != noteID {
+				t.Fatalf("expected note restored, got %+v", child)
+			}
+
+			// a new change drops what was undone
+			if err := m.Update(ctx, childID, models.LogEntryOptional{Text: &text}); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := m.Redo(ctx); err != nil || ok {
+				t.Fatalf("expected nothing to redo, got %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+// withoutRestore hides the Restore method of a LogEntryService
+type withoutRestore struct {
+	storage.LogEntryService
+}
+
+func TestUndoDeleteNoteWithNewID(t *testing.T) {
+	ctx := context.Background()
+	services := sqliteServices(t)
+	services.LogEntry = withoutRestore{services.LogEntry}
+	m := data.NewLogManager(services)
+	if err := m.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	entryID, err := m.Add(ctx, models.LogEntry{Text: "task"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddNote(ctx, entryID, models.Note{Text: "details"}); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := m.Get(entryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteID := entry.Notes[0].Data.ID
+	text := "details renamed"
+	if err := m.UpdateNote(ctx, entryID, noteID, models.NoteOptional{Text: &text}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteNote(ctx, entryID, noteID); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := m.Undo(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded := data.NewLogManager(services)
+	if err := reloaded.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	entry, err = reloaded.Get(entryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// undoing the rename must follow the note to its new ID
+	if len(entry.Notes) != 1 || entry.Notes[0].Data.ID == noteID || entry.Notes[0].Data.Text != "details" {
+		t.Fatalf("expected the note added back under a new ID with its text reverted, got %+v", entry.Notes)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			services := backend.services(t)
+			m := data.NewLogManager(services)
+			if err := m.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			parentID, err := m.Add(ctx, models.LogEntry{Text: "project"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			childID, err := m.Add(ctx, models.LogEntry{Text: "release task", ParentID: parentID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.AddNote(ctx, childID, models.Note{Text: "details"}); err != nil {
+				t.Fatal(err)
+			}
+			otherID, err := m.Add(ctx, models.LogEntry{Text: "other"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := m.Delete(ctx, parentID); err != nil {
+				t.Fatal(err)
+			}
+			entries, _, err := services.LogEntry.List(ctx, storage.LogEntryListOptions{IncludeHistory: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].ID != otherID {
+				t.Fatalf("expected only the other entry listed, got %+v", entries)
+			}
+			if tree, err := services.LogEntry.GetTree(context.Background(), childID, true); err == nil && len(tree) > 0 {
+				t.Fatalf("expected deleted child not found by GetTree")
+			}
+			results, err := services.Search.Search(context.Background(), storage.SearchOptions{Query: "release"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 0 {
+				t.Fatalf("expected deleted entries not searched, got %+v", results)
+			}
+
+			trash, err := m.Trash(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(trash) != 1 || trash[0].Data.ID != parentID || len(trash[0].Children) != 1 || trash[0].Data.DeletedTime == nil {
+				t.Fatalf("expected the deleted subtree in trash, got %+v", trash)
+			}
+			if err := services.LogEntry.Delete(ctx, parentID); err == nil {
+				t.Fatalf("expected deleting an entry in trash to fail")
+			}
+
+			// a child restored without its parent becomes top-level
+			if err := m.Undelete(ctx, childID); err != nil {
+				t.Fatal(err)
+			}
+			child, err := m.Get(childID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if child.Data.ParentID != 0 || child.Data.DeletedTime != nil || len(child.Notes) != 1 {
+				t.Fatalf("unexpected restored child: %+v", child.Data)
+			}
+			if err := services.LogEntry.Undelete(ctx, childID); err == nil {
+				t.Fatalf("expected undeleting an entry not in trash to fail")
+			}
+
+			// nothing was deleted before the cutoff yet
+			purged, err := services.LogEntry.Purge(ctx, time.Now().Add(-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if purged != 0 {
+				t.Fatalf("expected nothing purged, got %d", purged)
+			}
+			if err := m.Delete(ctx, childID); err != nil {
+				t.Fatal(err)
+			}
+			purged, err = services.LogEntry.Purge(ctx, time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if purged != 2 {
+				t.Fatalf("expected 2 entries purged, got %d", purged)
+			}
+			trash, err = m.Trash(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(trash) != 0 {
+				t.Fatalf("expected empty trash, got %+v", trash)
+			}
+			notes, err := services.LogNote.ListForEntries(ctx, []int64{childID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(notes[childID]) != 0 {
+				t.Fatalf("expected notes purged, got %+v", notes)
+			}
+		})
+	}
+}
+
+// times sent with another offset than the local one, e.g. by a client
+// of todo serve in another zone, keep their instant
+func TestTimesWithOtherOffsets(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("CST", 8*60*60)
+	defer func() { time.Local = local }()
+
+	ctx := context.Background()
+	for _, backend := range []struct {
+		name     string
+		services func(t *testing.T) *data.Services
+	}{
+		{name: "sqlite", services: sqliteServices},
+		{name: "http", services: httpServices},
+	} {
+		t.Run(backend.name, func(t *testing.T) {
+			services := backend.services(t)
+			created := time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)
+			due := time.Date(2026, 10, 17, 17, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+			id, err := services.LogEntry.Add(ctx, models.LogEntry{Text: "call", CreateTime: created, UpdateTime: created, DueTime: &due})
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, _, err := services.LogEntry.List(ctx, storage.LogEntryListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].ID != id {
+				t.Fatalf("expected the entry, got %+v", entries)
+			}
+			if !entries[0].CreateTime.Equal(created) || entries[0].DueTime == nil || !entries[0].DueTime.Equal(due) {
+				t.Fatalf("expected created %v and due %v, got %v and %v", created, due, entries[0].CreateTime, entries[0].DueTime)
+			}
+		})
+	}
+}
+
+func TestConflict(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			services := backend.services(t)
+			m := data.NewLogManager(services)
+			if err := m.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			// the changes below land within a second
+			created := time.Date(2026, 10, 17, 10, 0, 0, 100*int(time.Millisecond), time.Local)
+			later := created.Add(11 * time.Millisecond)
+			entryID, err := m.Add(ctx, models.LogEntry{Text: "task", CreateTime: created, UpdateTime: created})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.AddNote(ctx, entryID, models.Note{Text: "details", CreateTime: created, UpdateTime: created}); err != nil {
+				t.Fatal(err)
+			}
+			entry, err := m.Get(entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			noteID := entry.Notes[0].Data.ID
+
+			stale := data.NewLogManager(services)
+			if err := stale.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			text := "task by m"
+			if err := m.Update(ctx, entryID, models.LogEntryOptional{Text: &text, UpdateTime: &later}); err != nil {
+				t.Fatal(err)
+			}
+			noteText := "details by m"
+			if err := m.UpdateNote(ctx, entryID, noteID, models.NoteOptional{Text: &noteText, UpdateTime: &later}); err != nil {
+				t.Fatal(err)
+			}
+
+			staleText := "task by stale"
+			err = stale.Update(ctx, entryID, models.LogEntryOptional{Text: &staleText})
+			var conflict *storage.ConflictError
+			if !errors.As(err, &conflict) || conflict.Kind != "entry" || conflict.ID != entryID {
+				t.Fatalf("expected a conflict on entry %d, got %v", entryID, err)
+			}
+			staleNote := "details by stale"
+			if err := stale.UpdateNote(ctx, entryID, noteID, models.NoteOptional{Text: &staleNote}); !errors.Is(err, storage.ErrConflict) {
+				t.Fatalf("expected a conflict on the note, got %v", err)
+			}
+			reloaded := data.NewLogManager(services)
+			if err := reloaded.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			entry, err = reloaded.Get(entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Data.Text != text || entry.Notes[0].Data.Text != noteText {
+				t.Fatalf("expected the changes of m kept, got %q, %q", entry.Data.Text, entry.Notes[0].Data.Text)
+			}
+
+			// reloading and retrying applies the last refused change, of the note
+			if err := stale.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := stale.RetryConflicted(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := stale.RetryConflicted(ctx); err == nil {
+				t.Fatalf("expected nothing left to retry")
+			}
+			entry, err = stale.Get(entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Notes[0].Data.Text != staleNote {
+				t.Fatalf("expected the note retried, got %q", entry.Notes[0].Data.Text)
+			}
+
+			happening, err := services.Happening.Add(context.Background(), &models.Happening{Content: "met", CreateTime: created, UpdateTime: created})
+			if err != nil {
+				t.Fatal(err)
+			}
+			content := "met again"
+			_, err = services.Happening.Update(context.Background(), happening.ID, &models.HappeningOptional{Content: &content, IfUpdateTime: &later})
+			if !errors.Is(err, storage.ErrConflict) {
+				t.Fatalf("expected a conflict on the happening, got %v", err)
+			}
+			_, err = services.Happening.Update(context.Background(), happening.ID, &models.HappeningOptional{Content: &content, IfUpdateTime: &happening.UpdateTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			services := backend.services(t)
+			m := data.NewLogManager(services)
+			if err := m.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			parentID, err := m.Add(ctx, models.LogEntry{Text: "project"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			entryID, err := m.Add(ctx, models.LogEntry{Text: "v1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.AddNote(ctx, entryID, models.Note{Text: "n1"}); err != nil {
+				t.Fatal(err)
+			}
+			entry, err := m.Get(entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			noteID := entry.Notes[0].Data.ID
+
+			// asOf lies well apart from the changes
+			time.Sleep(time.Second)
+			asOf := time.Now()
+			time.Sleep(time.Second)
+
+			text := "v2"
+			done := true
+			if err := m.Update(ctx, entryID, models.LogEntryOptional{Text: &text, Done: &done}); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Move(ctx, entryID, parentID); err != nil {
+				t.Fatal(err)
+			}
+			noteText := "n2"
+			if err := m.UpdateNote(ctx, entryID, noteID, models.NoteOptional{Text: &noteText}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Add(ctx, models.LogEntry{Text: "later"}); err != nil {
+				t.Fatal(err)
+			}
+
+			revisions, err := m.ListRevisions(ctx, entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(revisions) != 3 {
+				t.Fatalf("expected 3 revisions, got %+v", revisions)
+			}
+			if revisions[0].NoteID != noteID || revisions[0].Text != "n1" {
+				t.Fatalf("expected the note revision latest, got %+v", revisions[0])
+			}
+			if revisions[1].Text != "v2" || !revisions[1].Done || revisions[1].ParentID != 0 {
+				t.Fatalf("expected the revision before the move, got %+v", revisions[1])
+			}
+			if revisions[2].Text != "v1" || revisions[2].Done {
+				t.Fatalf("expected the revision before the update, got %+v", revisions[2])
+			}
+
+			asOfManager := data.NewLogManager(services)
+			if err := asOfManager.InitAsOf(ctx, asOf, false); err != nil {
+				t.Fatal(err)
+			}
+			var texts []string
+			for _, entry := range asOfManager.Entries {
+				texts = append(texts, entry.Data.Text)
+			}
+			slices.Sort(texts)
+			if strings.Join(texts, ",") != "project,v1" {
+				t.Fatalf("expected the entries as of then, got %v", texts)
+			}
+			entry, err = asOfManager.Get(entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Data.Done || entry.Data.ParentID != 0 || entry.Notes[0].Data.Text != "n1" {
+				t.Fatalf("expected the entry as of then, got %+v, note %q", entry.Data, entry.Notes[0].Data.Text)
+			}
+
+			if err := m.RestoreRevision(ctx, revisions[2]); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.RestoreRevision(ctx, revisions[0]); err != nil {
+				t.Fatal(err)
+			}
+			reloaded := data.NewLogManager(services)
+			if err := reloaded.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			entry, err = reloaded.Get(entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Data.Text != "v1" || entry.Data.Done || entry.Data.ParentID != 0 || entry.Notes[0].Data.Text != "n1" {
+				t.Fatalf("expected the entry restored, got %+v, note %q", entry.Data, entry.Notes[0].Data.Text)
+			}
+			// restoring is a change too, of the text and of the parent
+			revisions, err = m.ListRevisions(ctx, entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(revisions) != 6 {
+				t.Fatalf("expected the restores recorded, got %+v", revisions)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			services := backend.services(t)
+			m := data.NewLogManager(services)
+			if err := m.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			keptID, err := m.Add(ctx, models.LogEntry{Text: "kept"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.AddNote(ctx, keptID, models.Note{Text: "note"}); err != nil {
+				t.Fatal(err)
+			}
+			goneID, err := m.Add(ctx, models.LogEntry{Text: "gone"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the first reload may bring in times as storage keeps them
+			if _, err := m.Reload(ctx, false); err != nil {
+				t.Fatal(err)
+			}
+			if changed, err := m.Reload(ctx, false); err != nil || changed {
+				t.Fatalf("expected nothing changed, got %v, %v", changed, err)
+			}
+			kept, err := m.Get(keptID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept.IncludeNotes = true
+			note := kept.Notes[0]
+
+			elsewhere := data.NewLogManager(services)
+			if err := elsewhere.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+			text := "kept, edited elsewhere"
+			if err := elsewhere.Update(ctx, keptID, models.LogEntryOptional{Text: &text}); err != nil {
+				t.Fatal(err)
+			}
+			noteText := "note, edited elsewhere"
+			if err := elsewhere.UpdateNote(ctx, keptID, note.Data.ID, models.NoteOptional{Text: &noteText}); err != nil {
+				t.Fatal(err)
+			}
+			if err := elsewhere.Delete(ctx, goneID); err != nil {
+				t.Fatal(err)
+			}
+			addedID, err := elsewhere.Add(ctx, models.LogEntry{Text: "added elsewhere"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changed, err := m.Reload(ctx, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !changed {
+				t.Fatal("expected the changes found")
+			}
+			reloaded, err := m.Get(keptID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reloaded != kept || !reloaded.IncludeNotes {
+				t.Fatal("expected the view of the kept entry kept")
+			}
+			if kept.Data.Text != text || kept.DetailPage.InputState.Value != text {
+				t.Fatalf("expected the text updated, got %q", kept.Data.Text)
+			}
+			if len(kept.Notes) != 1 || kept.Notes[0] != note || note.Data.Text != noteText {
+				t.Fatalf("expected the note view kept and updated, got %+v", kept.Notes)
+			}
+			if _, err := m.Get(goneID); err == nil {
+				t.Fatal("expected the deleted entry gone")
+			}
+			if _, err := m.Get(addedID); err != nil {
+				t.Fatalf("expected the added entry: %v", err)
+			}
+		})
+	}
+}
+
+func TestChangeFeed(t *testing.T) {
+	sqliteInterval, memoryInterval := sqlite.WatchInterval, memory.WatchInterval
+	sqlite.WatchInterval, memory.WatchInterval = 10*time.Millisecond, 10*time.Millisecond
+	defer func() {
+		sqlite.WatchInterval, memory.WatchInterval = sqliteInterval, memoryInterval
+	}()
+
+	// each opens the same data twice, as two processes would
+	feeds := []struct {
+		name string
+		open func(t *testing.T) (watched *data.Services, other *data.Services)
+	}{
+		{name: "sqlite", open: func(t *testing.T) (*data.Services, *data.Services) {
+			file := filepath.Join(t.TempDir(), "todo.db")
+			return openSQLiteServices(t, file), openSQLiteServices(t, file)
+		}},
+		{name: "file", open: func(t *testing.T) (*data.Services, *data.Services) {
+			file := filepath.Join(t.TempDir(), "lifelog.json")
+			open := func() *data.Services {
+				store, err := filestore.NewFileDataStore(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return storeServices(memory.NewBaseStore(store))
+			}
+			return open(), open()
+		}},
+		{name: "http", open: func(t *testing.T) (*data.Services, *data.Services) {
+			ts := httptest.NewServer(server.New(sqliteServices(t), "secret"))
+			t.Cleanup(ts.Close)
+			return clientServices(ts.URL + server.APIPrefix), clientServices(ts.URL + server.APIPrefix)
+		}},
+	}
+	for _, feed := range feeds {
+		t.Run(feed.name, func(t *testing.T) {
+			watched, other := feed.open(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := data.NewLogManager(watched)
+			if err := m.Init(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			changes := make(chan struct{}, 1)
+			done := make(chan error, 1)
+			go func() {
+				done <- watched.Changes.Watch(ctx, func() {
+					select {
+					case changes <- struct{}{}:
+					default:
+					}
+				})
+			}()
+			// let the watch take its starting point
+			time.Sleep(200 * time.Millisecond)
+
+			id, err := data.NewLogManager(other).Add(ctx, models.LogEntry{Text: "added elsewhere"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-changes:
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the change told")
+			}
+			changed, err := m.Reload(ctx, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Get(id); !changed || err != nil {
+				t.Fatalf("expected the added entry reloaded, got %v, %v", changed, err)
+			}
+
+			cancel()
+			if err := <-done; !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected the watch cancelled, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/xhd2015/todo/models"
+)
+
+// Reload loads the entries, notes and groups again, e.g. after they
+// were changed elsewhere, and applies the difference to Entries in
+// place: entries still there keep their views, with the state of the
+// view like IncludeNotes or the detail page input, only their data,
+// notes and children are replaced. Entries showing their history get
+// it reloaded too. It reports whether anything changed.
+func (m *LogManager) Reload(ctx context.Context, showHistory bool) (bool, error) {
+	entries, err := loadEntries(ctx, m.LogEntryService, m.LogNoteService, showHistory)
+	if err != nil {
+		return false, err
+	}
+
+	views := make(map[int64]*models.LogEntryView)
+	indexViews(m.Entries, views)
+	merger := &viewMerger{views: views}
+	merged := merger.merge(m.Entries, entries)
+
+	// entries showing history have children the listing leaves out,
+	// merge left them as they were
+	var withHistory []*models.LogEntryView
+	walkViews(merged, func(view *models.LogEntryView) {
+		if view.IncludeHistory {
+			withHistory = append(withHistory, view)
+		}
+	})
+	for _, view := range withHistory {
+		tree, err := m.GetTree(ctx, view.Data.ID, true)
+		if err != nil {
+			return false, err
+		}
+		view.Children = merger.merge(view.Children, tree.Children)
+	}
+	m.Entries = merged
+
+	groups, mapping := m.Groups, m.GroupMapping
+	if err := m.LoadGroups(ctx); err != nil {
+		return merger.changed, err
+	}
+	changed := merger.changed || !sameJSON(groups, m.Groups) || !sameJSON(mapping, m.GroupMapping)
+	return changed, nil
+}
+
+// viewMerger merges freshly loaded views into the existing ones
+type viewMerger struct {
+	// views are the existing views by entry ID
+	views   map[int64]*models.LogEntryView
+	changed bool
+}
+
+// merge returns fresh with each view replaced by the existing one of
+// the same entry, updated to the fresh data. old is the list fresh
+// replaces, telling whether the order changed.
+func (vm *viewMerger) merge(old []*models.LogEntryView, fresh []*models.LogEntryView) []*models.LogEntryView {
+	if len(old) != len(fresh) {
+		vm.changed = true
+	}
+	merged := make([]*models.LogEntryView, 0, len(fresh))
+	for i, view := range fresh {
+		existing := vm.views[view.Data.ID]
+		if existing == nil {
+			vm.changed = true
+			view.Children = vm.merge(nil, view.Children)
+			merged = append(merged, view)
+			continue
+		}
+		if i < len(old) && old[i] != existing {
+			vm.changed = true
+		}
+		if !sameJSON(existing.Data, view.Data) {
+			vm.changed = true
+			// keep what is being typed on the detail page
+			if existing.DetailPage != nil && existing.DetailPage.InputState.Value == existing.Data.Text {
+				existing.DetailPage.InputState.Value = view.Data.Text
+			}
+			*existing.Data = *view.Data
+		}
+		existing.Notes = vm.mergeNotes(existing.Notes, view.Notes)
+		if !existing.IncludeHistory {
+			existing.Children = vm.merge(existing.Children, view.Children)
+		}
+		merged = append(merged, existing)
+	}
+	return merged
+}
+
+// mergeNotes is merge for the notes of an entry
+func (vm *viewMerger) mergeNotes(old []*models.NoteView, fresh []*models.NoteView) []*models.NoteView {
+	if len(old) != len(fresh) {
+		vm.changed = true
+	}
+	existing := make(map[int64]*models.NoteView, len(old))
+	for _, note := range old {
+		existing[note.Data.ID] = note
+	}
+	merged := make([]*models.NoteView, 0, len(fresh))
+	for i, note := range fresh {
+		view := existing[note.Data.ID]
+		if view == nil {
+			vm.changed = true
+			merged = append(merged, note)
+			continue
+		}
+		if i < len(old) && old[i] != view {
+			vm.changed = true
+		}
+		if !sameJSON(view.Data, note.Data) {
+			vm.changed = true
+			*view.Data = *note.Data
+		}
+		merged = append(merged, view)
+	}
+	return merged
+}
+
+func indexViews(entries []*models.LogEntryView, views map[int64]*models.LogEntryView) {
+	walkViews(entries, func(view *models.LogEntryView) {
+		views[view.Data.ID] = view
+	})
+}
+
+func walkViews(entries []*models.LogEntryView, fn func(view *models.LogEntryView)) {
+	for _, view := range entries {
+		fn(view)
+		walkViews(view.Children, fn)
+	}
+}
+
+// sameJSON compares values by their JSON, which ignores the monotonic
+// clock reading that times created locally carry
+func sameJSON(a any, b any) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(x) == string(y)
+}
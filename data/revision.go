@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+var errNoRevisions = errors.New("revisions are not supported by this storage")
+
+// ListRevisions lists the revisions of the entry and its notes, latest change first
+func (m *LogManager) ListRevisions(ctx context.Context, entryID int64) ([]models.Revision, error) {
+	if m.RevisionService == nil {
+		return nil, errNoRevisions
+	}
+	return m.RevisionService.ListRevisions(ctx, storage.RevisionListOptions{EntryID: entryID})
+}
+
+// RestoreRevision changes the entry or note of revision back to it, as
+// one step to undo. An entry whose parent of then is gone stays where it is.
+func (m *LogManager) RestoreRevision(ctx context.Context, revision models.Revision) error {
+	if revision.NoteID != 0 {
+		return m.UpdateNote(ctx, revision.EntryID, revision.NoteID, models.NoteOptional{Text: &revision.Text})
+	}
+	entry, err := m.Get(revision.EntryID)
+	if err != nil {
+		return err
+	}
+	parentID := entry.Data.ParentID
+	return m.Batch(func() error {
+		doneTime := revision.DoneTime
+		err := m.Update(ctx, revision.EntryID, models.LogEntryOptional{
+			Text:           &revision.Text,
+			Done:           &revision.Done,
+			DoneTime:       &doneTime,
+			HighlightLevel: &revision.HighlightLevel,
+		})
+		if err != nil {
+			return err
+		}
+		if revision.ParentID == parentID {
+			return nil
+		}
+		if revision.ParentID != 0 {
+			if _, err := m.Get(revision.ParentID); err != nil {
+				return nil
+			}
+		}
+		return m.Move(ctx, revision.EntryID, revision.ParentID)
+	})
+}
+
+// InitAsOf loads the entries as they were at asOf, from the entries
+// there are now, in trash too, and their revisions changed after asOf.
+// Entries purged and notes deleted since are missing. Without
+// showHistory, entries done before the day of asOf are left out like
+// Init leaves out those done before today.
+func (m *LogManager) InitAsOf(ctx context.Context, asOf time.Time, showHistory bool) error {
+	if m.RevisionService == nil {
+		return errNoRevisions
+	}
+	live, _, err := m.LogEntryService.List(ctx, storage.LogEntryListOptions{IncludeHistory: true})
+	if err != nil {
+		return err
+	}
+	trashed, _, err := m.LogEntryService.List(ctx, storage.LogEntryListOptions{Deleted: true})
+	if err != nil {
+		return err
+	}
+	revisions, err := m.RevisionService.ListRevisions(ctx, storage.RevisionListOptions{ChangedAfter: asOf})
+	if err != nil {
+		return err
+	}
+	// latest first, so the earliest change of each wins
+	entryRevisions := make(map[int64]models.Revision)
+	noteRevisions := make(map[int64]models.Revision)
+	for _, revision := range revisions {
+		if revision.NoteID != 0 {
+			noteRevisions[revision.NoteID] = revision
+		} else {
+			entryRevisions[revision.EntryID] = revision
+		}
+	}
+
+	at := asOf.In(time.Local)
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.Local)
+	var entries []models.LogEntry
+	var entryIDs []int64
+	for _, entry := range append(live, trashed...) {
+		if entry.CreateTime.After(at) {
+			continue
+		}
+		if entry.DeletedTime != nil && !entry.DeletedTime.After(at) {
+			continue
+		}
+		if revision, ok := entryRevisions[entry.ID]; ok {
+			revision.ApplyTo(&entry)
+		}
+		if !showHistory && entry.Done && entry.DoneTime != nil && entry.DoneTime.Before(day) {
+			continue
+		}
+		entry.DeletedTime = nil
+		entries = append(entries, entry)
+		entryIDs = append(entryIDs, entry.ID)
+	}
+
+	allNotes, err := m.LogNoteService.ListForEntries(ctx, entryIDs)
+	if err != nil {
+		return err
+	}
+	for entryID, notes := range allNotes {
+		var kept []models.Note
+		for _, note := range notes {
+			if note.CreateTime.After(at) {
+				continue
+			}
+			if revision, ok := noteRevisions[note.ID]; ok {
+				note.Text = revision.Text
+			}
+			kept = append(kept, note)
+		}
+		allNotes[entryID] = kept
+	}
+	m.Entries = buildEntryViews(entries, allNotes)
+	return m.LoadGroups(ctx)
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConflict matches every *ConflictError with errors.Is
+var ErrConflict = errors.New("changed elsewhere")
+
+// ConflictError is returned by updates whose IfUpdateTime precondition
+// does not hold: the entry, note or happening was changed since it was
+// read, and applying the update would overwrite that change
+type ConflictError struct {
+	// Kind is "entry", "note" or "happening"
+	Kind string `json:"kind"`
+	ID   int64  `json:"id"`
+	// UpdateTime is the update time found in storage
+	UpdateTime time.Time `json:"update_time"`
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %d was changed elsewhere at %s", e.Kind, e.ID, e.UpdateTime.Format("2006-01-02 15:04:05"))
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// CheckUpdateTime returns a *ConflictError unless ifUpdateTime is nil
+// or the same instant as updateTime, to the nanosecond: two updates
+// within a second must not pass each other's check.
+func CheckUpdateTime(kind string, id int64, ifUpdateTime *time.Time, updateTime time.Time) error {
+	if ifUpdateTime == nil || ifUpdateTime.Equal(updateTime) {
+		return nil
+	}
+	return &ConflictError{Kind: kind, ID: id, UpdateTime: updateTime}
+}
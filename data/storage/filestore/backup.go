@@ -0,0 +1,59 @@
+package filestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Snapshot copies the data file to dest. Save replaces the file by
+// renaming, so reading it without the lock still sees one version.
+func Snapshot(filePath string, dest string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest, data, 0644)
+}
+
+// Check verifies that filePath is a data file NewFileDataStore can
+// load, with every ID below NextID
+func Check(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	var fileData FileData
+	if err := json.Unmarshal(data, &fileData); err != nil {
+		return fmt.Errorf("not a todo data file: %w", err)
+	}
+	maxID := int64(0)
+	for _, entry := range fileData.LogEntries {
+		maxID = max(maxID, entry.ID)
+	}
+	for _, note := range fileData.Notes {
+		maxID = max(maxID, note.ID)
+	}
+	for _, happening := range fileData.Happenings {
+		maxID = max(maxID, happening.ID)
+	}
+	if maxID > 0 && maxID >= fileData.NextID {
+		return fmt.Errorf("corrupt data file: ID %d is not below next_id %d", maxID, fileData.NextID)
+	}
+	return nil
+}
+
+// Replace swaps the data file at filePath for src under the lock, so
+// other processes reload it on their next operation
+func Replace(filePath string, src string) error {
+	f, err := os.OpenFile(filePath+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer f.Close()
+	if err := lockFile(f, true); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", filePath, err)
+	}
+	defer unlockFile(f)
+	return os.Rename(src, filePath)
+}
@@ -4,16 +4,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/xhd2015/todo/data/storage"
 	"github.com/xhd2015/todo/data/storage/memory"
 	"github.com/xhd2015/todo/models"
 )
 
-// FileDataStore implements DataStore interface for file-based storage
+// FileDataStore implements DataStore interface for file-based storage.
+// It also implements memory.Syncer: operations hold an advisory lock on
+// "<file>.lock" and reload the file when another process changed it.
 type FileDataStore struct {
 	filePath string
 	data     *FileData
+
+	lockFile *os.File
+	// modification time and size of the file when last loaded or saved
+	modTime time.Time
+	size    int64
 }
 
 type FileData struct {
@@ -22,7 +33,12 @@ type FileData struct {
 	Happenings  []models.Happening  `json:"happenings"`
 	States      []models.State      `json:"states"`
 	StateEvents []models.StateEvent `json:"state_events"`
-	NextID      int64               `json:"next_id"`
+	// Groups is nil in files written before groups were stored,
+	// which then start with the default groups
+	Groups       []models.Group           `json:"groups"`
+	GroupMembers []models.GroupMembership `json:"group_members"`
+	Revisions    []models.Revision        `json:"revisions,omitempty"`
+	NextID       int64                    `json:"next_id"`
 }
 
 // NewFileDataStore creates a new file-based data store
@@ -35,6 +51,7 @@ func NewFileDataStore(filePath string) (*FileDataStore, error) {
 			Happenings:  []models.Happening{},
 			States:      []models.State{},
 			StateEvents: []models.StateEvent{},
+			Groups:      models.NewDefaultGroups(time.Now()),
 			NextID:      1,
 		},
 	}
@@ -51,12 +68,76 @@ func NewFileDataStore(filePath string) (*FileDataStore, error) {
 }
 
 func (fds *FileDataStore) load() error {
+	stat, err := os.Stat(fds.filePath)
+	if err != nil {
+		return err
+	}
 	data, err := os.ReadFile(fds.filePath)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, fds.data)
+	fileData := &FileData{NextID: 1}
+	if err := json.Unmarshal(data, fileData); err != nil {
+		return err
+	}
+	if fileData.Groups == nil {
+		fileData.Groups = models.NewDefaultGroups(time.Now())
+	}
+	fds.data = fileData
+	fds.modTime = stat.ModTime()
+	fds.size = stat.Size()
+	return nil
+}
+
+// Acquire locks the file against other processes and reloads it if it
+// was modified since this store last read or wrote it
+func (fds *FileDataStore) Acquire(exclusive bool) error {
+	if fds.lockFile == nil {
+		f, err := os.OpenFile(fds.filePath+".lock", os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open lock file: %w", err)
+		}
+		fds.lockFile = f
+	}
+	if err := lockFile(fds.lockFile, exclusive); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", fds.filePath, err)
+	}
+
+	changed, err := fds.Changed()
+	if err != nil {
+		unlockFile(fds.lockFile)
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	if err := fds.load(); err != nil {
+		unlockFile(fds.lockFile)
+		return fmt.Errorf("failed to reload file: %w", err)
+	}
+	return nil
+}
+
+// Changed tells whether another process modified the file since
+// this store last read or wrote it
+func (fds *FileDataStore) Changed() (bool, error) {
+	stat, err := os.Stat(fds.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !stat.ModTime().Equal(fds.modTime) || stat.Size() != fds.size, nil
+}
+
+// Release releases the lock taken by Acquire
+func (fds *FileDataStore) Release() error {
+	if fds.lockFile == nil {
+		return nil
+	}
+	return unlockFile(fds.lockFile)
 }
 
 // Entry operations
@@ -243,6 +324,78 @@ func (fds *FileDataStore) AddStateEvent(event models.StateEvent) error {
 	return nil
 }
 
+// Group operations
+func (fds *FileDataStore) GetAllGroups() []models.Group {
+	return fds.data.Groups
+}
+
+func (fds *FileDataStore) AddGroup(group models.Group) error {
+	fds.data.Groups = append(fds.data.Groups, group)
+	return nil
+}
+
+func (fds *FileDataStore) UpdateGroup(id int64, group models.Group) error {
+	for i, g := range fds.data.Groups {
+		if g.ID == id {
+			fds.data.Groups[i] = group
+			return nil
+		}
+	}
+	return fmt.Errorf("group with id %d not found", id)
+}
+
+func (fds *FileDataStore) DeleteGroup(id int64) error {
+	for i, g := range fds.data.Groups {
+		if g.ID == id {
+			fds.data.Groups = append(fds.data.Groups[:i], fds.data.Groups[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("group with id %d not found", id)
+}
+
+func (fds *FileDataStore) GetAllGroupMemberships() []models.GroupMembership {
+	return fds.data.GroupMembers
+}
+
+func (fds *FileDataStore) SetGroupMembership(membership models.GroupMembership) error {
+	for i, m := range fds.data.GroupMembers {
+		if m.EntryID == membership.EntryID {
+			fds.data.GroupMembers[i] = membership
+			return nil
+		}
+	}
+	fds.data.GroupMembers = append(fds.data.GroupMembers, membership)
+	return nil
+}
+
+func (fds *FileDataStore) DeleteGroupMembership(entryID int64) error {
+	for i, m := range fds.data.GroupMembers {
+		if m.EntryID == entryID {
+			fds.data.GroupMembers = append(fds.data.GroupMembers[:i], fds.data.GroupMembers[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// Revision operations
+func (fds *FileDataStore) GetAllRevisions() []models.Revision {
+	return fds.data.Revisions
+}
+
+func (fds *FileDataStore) AddRevision(revision models.Revision) error {
+	fds.data.Revisions = append(fds.data.Revisions, revision)
+	return nil
+}
+
+func (fds *FileDataStore) DeleteRevisions(entryID int64) error {
+	fds.data.Revisions = slices.DeleteFunc(fds.data.Revisions, func(r models.Revision) bool {
+		return r.EntryID == entryID
+	})
+	return nil
+}
+
 // ID generation
 func (fds *FileDataStore) NextID() int64 {
 	id := fds.data.NextID
@@ -250,45 +403,121 @@ func (fds *FileDataStore) NextID() int64 {
 	return id
 }
 
-// Persistence
+// Save writes to a temp file and renames it over the data file,
+// so readers never see a partially written file
 func (fds *FileDataStore) Save() error {
 	data, err := json.MarshalIndent(fds.data, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(fds.filePath, data, 0644)
+	dir, base := filepath.Split(fds.filePath)
+	tmp, err := os.CreateTemp(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, fds.filePath); err != nil {
+		return err
+	}
+
+	stat, err := os.Stat(fds.filePath)
+	if err != nil {
+		return err
+	}
+	fds.modTime = stat.ModTime()
+	fds.size = stat.Size()
+	return nil
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]*memory.BaseStore)
+)
+
+// Open returns the store of filePath, shared by every service of the
+// process so that they never overwrite each other's changes
+func Open(filePath string) (*memory.BaseStore, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if store, ok := stores[absPath]; ok {
+		return store, nil
+	}
+	dataStore, err := NewFileDataStore(absPath)
+	if err != nil {
+		return nil, err
+	}
+	store := memory.NewBaseStore(dataStore)
+	stores[absPath] = store
+	return store, nil
 }
 
-// Factory functions using the new base store
+// Factory functions using the shared base store
 func NewLogEntryService(filePath string) (storage.LogEntryService, error) {
-	dataStore, err := NewFileDataStore(filePath)
+	store, err := Open(filePath)
 	if err != nil {
 		return nil, err
 	}
-	return memory.NewLogEntryBaseService(dataStore), nil
+	return store.LogEntryService(), nil
 }
 
 func NewLogNoteService(filePath string) (storage.LogNoteService, error) {
-	dataStore, err := NewFileDataStore(filePath)
+	store, err := Open(filePath)
 	if err != nil {
 		return nil, err
 	}
-	return memory.NewLogNoteBaseService(dataStore), nil
+	return store.LogNoteService(), nil
 }
 
 func NewHappeningService(filePath string) (storage.HappeningService, error) {
-	dataStore, err := NewFileDataStore(filePath)
+	store, err := Open(filePath)
 	if err != nil {
 		return nil, err
 	}
-	return memory.NewHappeningBaseService(dataStore), nil
+	return store.HappeningService(), nil
 }
 
 func NewStateRecordingService(filePath string) (storage.StateRecordingService, error) {
-	dataStore, err := NewFileDataStore(filePath)
+	store, err := Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return store.StateRecordingService(), nil
+}
+
+func NewGroupService(filePath string) (storage.GroupService, error) {
+	store, err := Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return store.GroupService(), nil
+}
+
+func NewSearchService(filePath string) (storage.SearchService, error) {
+	store, err := Open(filePath)
 	if err != nil {
 		return nil, err
 	}
-	return memory.NewStateRecordingBaseService(dataStore), nil
+	return store.SearchService(), nil
 }
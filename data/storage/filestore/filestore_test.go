@@ -0,0 +1,133 @@
+package filestore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/data/storage/memory"
+	"github.com/xhd2015/todo/models"
+)
+
+// Before services shared one store, each held its own copy of the file
+// and every Save overwrote what the other services had written.
+func TestInterleavedWritesFromAllServices(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lifelog.json")
+	ctx := context.Background()
+
+	entries, err := NewLogEntryService(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := NewLogNoteService(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	happenings, err := NewHappeningService(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, err := NewStateRecordingService(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryID, err := entries.Add(ctx, models.LogEntry{Text: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := happenings.Add(ctx, &models.Happening{Content: "happened"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := notes.Add(ctx, entryID, models.Note{Text: "note"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := states.CreateState(ctx, &models.State{Name: "mood"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := states.RecordStateEvent(ctx, "mood", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entries.Add(ctx, models.LogEntry{Text: "second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileDataStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(reloaded.GetAllEntries()); n != 2 {
+		t.Errorf("expected 2 entries on disk, got %d", n)
+	}
+	if n := len(reloaded.GetAllNotes()); n != 1 {
+		t.Errorf("expected 1 note on disk, got %d", n)
+	}
+	if n := len(reloaded.GetAllHappenings()); n != 1 {
+		t.Errorf("expected 1 happening on disk, got %d", n)
+	}
+	if n := len(reloaded.GetAllStates()); n != 1 {
+		t.Errorf("expected 1 state on disk, got %d", n)
+	}
+	if n := len(reloaded.GetAllStateEvents()); n != 1 {
+		t.Errorf("expected 1 state event on disk, got %d", n)
+	}
+	assertNoTempFiles(t, file)
+}
+
+// Two stores on the same file stand in for two processes,
+// e.g. the TUI and `todo import`.
+func TestInterleavedWritesFromTwoStores(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "lifelog.json")
+
+	newStore := func() storage.LogEntryService {
+		dataStore, err := NewFileDataStore(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return memory.NewBaseStore(dataStore).LogEntryService()
+	}
+	a := newStore()
+	b := newStore()
+
+	ids := make(map[int64]bool)
+	for i := 0; i < 5; i++ {
+		for _, svc := range []storage.LogEntryService{a, b} {
+			id, err := svc.Add(ctx, models.LogEntry{Text: "entry", CreateTime: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids[id] {
+				t.Fatalf("duplicate id %d", id)
+			}
+			ids[id] = true
+		}
+	}
+
+	for _, svc := range []storage.LogEntryService{a, b} {
+		_, total, err := svc.List(ctx, storage.LogEntryListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 10 {
+			t.Errorf("expected 10 entries, got %d", total)
+		}
+	}
+}
+
+func assertNoTempFiles(t *testing.T, file string) {
+	t.Helper()
+	dirEntries, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range dirEntries {
+		if strings.Contains(e.Name(), ".tmp") {
+			t.Errorf("leftover temp file: %s", e.Name())
+		}
+	}
+}
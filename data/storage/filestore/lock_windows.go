@@ -0,0 +1,15 @@
+//go:build windows
+
+package filestore
+
+import "os"
+
+// advisory locking is not implemented on windows,
+// atomic saves still protect the file from torn writes
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
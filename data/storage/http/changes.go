@@ -0,0 +1,101 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"strings"
+	"time"
+
+	applog "github.com/xhd2015/todo/log"
+)
+
+// ChangesIdleTimeout is how long the /changes stream may stay silent
+// before it is taken for broken, the server sends a keep-alive every 30s
+var ChangesIdleTimeout = time.Minute
+
+// Watch implements storage.ChangeFeed with the /changes stream of the
+// server, reconnecting with backoff when it breaks. Each version the
+// server sends that differs from the last one seen is a change, so
+// changes made while disconnected are told after reconnecting.
+// It stops early only if the server has no /changes.
+func (c *Client) Watch(ctx context.Context, onChange func()) error {
+	var last string
+	attempt := 0
+	for {
+		connected, err := c.streamChanges(ctx, func(version string) {
+			if last != "" && version != last {
+				onChange()
+			}
+			last = version
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to watch changes: %w", err)
+		}
+		if connected {
+			attempt = 0
+		}
+		wait := c.backoff(attempt)
+		attempt++
+		applog.Infof(ctx, "HTTP changes stream broken, reconnecting in %v: %v", wait, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// streamChanges reads the /changes stream until it breaks, calling
+// onVersion with each version received. connected tells whether the
+// server accepted the stream.
+func (c *Client) streamChanges(ctx context.Context, onVersion func(version string)) (connected bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := nethttp.NewRequestWithContext(ctx, "GET", c.serverAddr+"/changes", nil)
+	if err != nil {
+		return false, fmt.Errorf("request failed: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if token := c.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return false, fmt.Errorf("%w: failed to read response: %w", ErrUnavailable, err)
+		}
+		var serverResp ServerResponse
+		if err := json.Unmarshal(body, &serverResp); err == nil && serverResp.Code != 0 {
+			return false, newServerError(serverResp.Code, serverResp.Msg, serverResp.Data)
+		}
+		return false, newServerError(resp.StatusCode, resp.Status, nil)
+	}
+
+	idle := time.AfterFunc(ChangesIdleTimeout, cancel)
+	defer idle.Stop()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		idle.Reset(ChangesIdleTimeout)
+		if version, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			onVersion(version)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return true, fmt.Errorf("%w: changes stream closed", ErrUnavailable)
+}
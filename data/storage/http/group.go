@@ -0,0 +1,112 @@
+package http
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// GroupHttpService implements storage.GroupService
+type GroupHttpService struct {
+	client *Client
+}
+
+func NewGroupService(client *Client) storage.GroupService {
+	return &GroupHttpService{client: client}
+}
+
+func (s *GroupHttpService) ListGroups(ctx context.Context) ([]models.Group, error) {
+	var response struct {
+		Groups []models.Group `json:"groups"`
+	}
+	if err := s.client.makeRequest(ctx, "/group/list", struct{}{}, &response); err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	return response.Groups, nil
+}
+
+func (s *GroupHttpService) AddGroup(ctx context.Context, group models.Group) (int64, error) {
+	if group.Name == "" {
+		return 0, fmt.Errorf("group name cannot be empty")
+	}
+	req := struct {
+		Group models.Group `json:"group"`
+	}{
+		Group: group,
+	}
+	var response struct {
+		ID int64 `json:"id"`
+	}
+	if err := s.client.makeRequest(ctx, "/group/add", req, &response); err != nil {
+		return 0, fmt.Errorf("failed to add group: %w", err)
+	}
+	return response.ID, nil
+}
+
+func (s *GroupHttpService) UpdateGroup(ctx context.Context, id int64, update models.GroupOptional) error {
+	req := struct {
+		ID     int64                `json:"id"`
+		Update models.GroupOptional `json:"update"`
+	}{
+		ID:     id,
+		Update: update,
+	}
+	var response struct {
+		Success bool `json:"success"`
+	}
+	if err := s.client.makeRequest(ctx, "/group/update", req, &response); err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
+	}
+	if !response.Success {
+		return fmt.Errorf("server reported failure to update group")
+	}
+	return nil
+}
+
+func (s *GroupHttpService) DeleteGroup(ctx context.Context, id int64) error {
+	req := struct {
+		ID int64 `json:"id"`
+	}{
+		ID: id,
+	}
+	var response struct {
+		Success bool `json:"success"`
+	}
+	if err := s.client.makeRequest(ctx, "/group/delete", req, &response); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	if !response.Success {
+		return fmt.Errorf("server reported failure to delete group")
+	}
+	return nil
+}
+
+func (s *GroupHttpService) ListMemberships(ctx context.Context) ([]models.GroupMembership, error) {
+	var response struct {
+		Memberships []models.GroupMembership `json:"memberships"`
+	}
+	if err := s.client.makeRequest(ctx, "/group/memberships", struct{}{}, &response); err != nil {
+		return nil, fmt.Errorf("failed to list group memberships: %w", err)
+	}
+	return response.Memberships, nil
+}
+
+func (s *GroupHttpService) SetMembership(ctx context.Context, membership models.GroupMembership) error {
+	req := struct {
+		Membership models.GroupMembership `json:"membership"`
+	}{
+		Membership: membership,
+	}
+	var response struct {
+		Success bool `json:"success"`
+	}
+	if err := s.client.makeRequest(ctx, "/group/setMembership", req, &response); err != nil {
+		return fmt.Errorf("failed to set group membership: %w", err)
+	}
+	if !response.Success {
+		return fmt.Errorf("server reported failure to set group membership")
+	}
+	return nil
+}
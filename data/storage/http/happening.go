@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/xhd2015/todo/data/storage"
 	"github.com/xhd2015/todo/models"
@@ -134,11 +135,15 @@ func (s *HappeningHttpService) Add(ctx context.Context, happening *models.Happen
 
 	// Create request payload for adding happening
 	req := struct {
-		Content string `json:"content"`
-		Scope   string `json:"scope"`
+		Content    string    `json:"content"`
+		Scope      string    `json:"scope"`
+		CreateTime time.Time `json:"create_time"`
+		UpdateTime time.Time `json:"update_time"`
 	}{
-		Content: happening.Content,
-		Scope:   "", // Use default scope
+		Content:    happening.Content,
+		Scope:      "", // Use default scope
+		CreateTime: happening.CreateTime,
+		UpdateTime: happening.UpdateTime,
 	}
 
 	var response struct {
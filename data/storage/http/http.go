@@ -1,11 +1,18 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	nethttp "net/http"
+	"sync"
+	"time"
 
-	http_request "github.com/xhd2015/go-http-request"
 	"github.com/xhd2015/todo/data/storage"
 	applog "github.com/xhd2015/todo/log"
 	"github.com/xhd2015/todo/models"
@@ -18,62 +25,260 @@ type ServerResponse struct {
 	Data json.RawMessage `json:"data"`
 }
 
-// makeRequest makes an HTTP request and unwraps the server response
+// ServerError is returned when the server answered a request with
+// a non-zero code, as opposed to the request not getting through
+type ServerError struct {
+	Code int
+	Msg  string
+	// Err is the error the code stands for, if the client knows it,
+	// like a *storage.ConflictError for CodeConflict
+	Err error
+}
+
+// CodeConflict is the code of a failed IfUpdateTime precondition,
+// the response data carries the *storage.ConflictError
+const CodeConflict = 409
+
+var (
+	// ErrUnauthorized matches requests refused for a missing or wrong token
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound matches requests for an entry, note or API the server does not have
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable matches requests that did not get through or timed
+	// out, and those a proxy in front of the server failed
+	ErrUnavailable = errors.New("server unavailable")
+)
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error (code %d): %s", e.Code, e.Msg)
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// newServerError returns the error of code, an HTTP status or the
+// code of a ServerResponse
+func newServerError(code int, msg string, data json.RawMessage) *ServerError {
+	serverErr := &ServerError{Code: code, Msg: msg}
+	switch code {
+	case nethttp.StatusUnauthorized:
+		serverErr.Err = ErrUnauthorized
+	case nethttp.StatusNotFound:
+		serverErr.Err = ErrNotFound
+	case CodeConflict:
+		var conflict storage.ConflictError
+		if err := json.Unmarshal(data, &conflict); err == nil {
+			serverErr.Err = &conflict
+		}
+	case nethttp.StatusBadGateway, nethttp.StatusServiceUnavailable, nethttp.StatusGatewayTimeout:
+		serverErr.Err = ErrUnavailable
+	}
+	return serverErr
+}
+
+// Options tunes how a Client sends requests
+type Options struct {
+	// Timeout bounds each attempt of a request, 0 for none
+	Timeout time.Duration
+	// Retries is how many times a request that did not get through is
+	// sent again. Requests that may have reached the server are only
+	// sent again if they are idempotent, see idempotentAPIs.
+	Retries int
+	// Backoff is the wait before the first retry, doubled for each
+	// next one up to MaxBackoff, and jittered
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultOptions = Options{
+	Timeout:    10 * time.Second,
+	Retries:    3,
+	Backoff:    200 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+}
+
+// idempotentAPIs can be sent again after a failure that may have
+// reached the server, sending them twice does what sending them once does
+var idempotentAPIs = map[string]bool{
+	"/entries/list":                    true,
+	"/entries/getTree":                 true,
+	"/entries/move":                    true,
+	"/notes/list":                      true,
+	"/notes/listForEntries":            true,
+	"/group/list":                      true,
+	"/group/memberships":               true,
+	"/group/setMembership":             true,
+	"/happening/list":                  true,
+	"/state/get":                       true,
+	"/state/list":                      true,
+	"/state/events":                    true,
+	"/state/history":                   true,
+	"/learning/list":                   true,
+	"/learning/content":                true,
+	"/learning/recording/get":          true,
+	"/learning/recording/updateOffset": true,
+	"/revisions/list":                  true,
+	"/search":                          true,
+}
+
+// makeRequest makes an HTTP request and unwraps the server response,
+// retrying as c.options allow
 // api is the API path that omits the prefix "/api/todo/termui", e.g. "/entries/list"
 func (c *Client) makeRequest(ctx context.Context, api string, reqData any, respData any) error {
-
-	// Log the request with full JSON
-	if reqJSON, err := json.Marshal(reqData); err == nil {
-		applog.Infof(ctx, "HTTP Request: %s %s, payload: %s", "POST", c.serverAddr+api, string(reqJSON))
-	} else {
-		applog.Infof(ctx, "HTTP Request: %s %s, payload marshal error: %v", "POST", c.serverAddr+api, err)
+	body, err := json.Marshal(reqData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
+	// Log the request with full JSON
+	applog.Infof(ctx, "HTTP Request: %s %s, payload: %s", "POST", c.serverAddr+api, string(body))
 
-	req := http_request.New()
-	if c.serverAuthToken != "" {
-		req = req.Header("Authorization", "Bearer "+c.serverAuthToken)
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, api, body, respData)
+		if err == nil || attempt >= c.options.Retries || !retryable(api, err) {
+			return err
+		}
+		wait := c.backoff(attempt)
+		applog.Infof(ctx, "HTTP Request retrying in %v: %s %s, error: %v", wait, "POST", c.serverAddr+api, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
 	}
+}
 
-	var serverResp ServerResponse
-	err := req.PostJSON(ctx, c.serverAddr+api, reqData, &serverResp)
+// send makes one attempt of a request
+func (c *Client) send(ctx context.Context, api string, body []byte, respData any) error {
+	url := c.serverAddr + api
+	attemptCtx := ctx
+	if c.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, c.options.Timeout)
+		defer cancel()
+	}
+	req, err := nethttp.NewRequestWithContext(attemptCtx, "POST", url, bytes.NewReader(body))
 	if err != nil {
-		applog.Errorf(ctx, "HTTP Request failed: %s %s, error: %v", "POST", c.serverAddr+api, err)
 		return fmt.Errorf("request failed: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := c.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		applog.Errorf(ctx, "HTTP Request failed: %s %s, error: %v", "POST", url, err)
+		if ctx.Err() != nil {
+			// given up by the caller, not the server's fault
+			return fmt.Errorf("request failed: %w", err)
+		}
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		return fmt.Errorf("%w: failed to read response: %w", ErrUnavailable, err)
+	}
+
+	var serverResp ServerResponse
+	if err := json.Unmarshal(respBody, &serverResp); err != nil {
+		if resp.StatusCode != nethttp.StatusOK {
+			// not from the server, e.g. from a proxy in front of it
+			applog.Errorf(ctx, "HTTP status error: %s %s, status: %s", "POST", url, resp.Status)
+			return newServerError(resp.StatusCode, resp.Status, nil)
+		}
+		return fmt.Errorf("invalid response: %w", err)
+	}
 
 	// Log the response with length only
-	responseLength := len(serverResp.Data)
-	applog.Infof(ctx, "HTTP Response: %s %s, code: %d, msg: %s, data_length: %d", "POST", c.serverAddr+api, serverResp.Code, serverResp.Msg, responseLength)
+	applog.Infof(ctx, "HTTP Response: %s %s, code: %d, msg: %s, data_length: %d", "POST", url, serverResp.Code, serverResp.Msg, len(serverResp.Data))
 
 	if serverResp.Code != 0 {
-		applog.Errorf(ctx, "HTTP Server error: %s %s, code: %d, msg: %s", "POST", c.serverAddr+api, serverResp.Code, serverResp.Msg)
-		return fmt.Errorf("server error (code %d): %s", serverResp.Code, serverResp.Msg)
+		applog.Errorf(ctx, "HTTP Server error: %s %s, code: %d, msg: %s", "POST", url, serverResp.Code, serverResp.Msg)
+		return newServerError(serverResp.Code, serverResp.Msg, serverResp.Data)
 	}
 
 	if respData != nil && len(serverResp.Data) > 0 {
 		// Directly unmarshal the raw JSON data
 		err = json.Unmarshal(serverResp.Data, respData)
 		if err != nil {
-			applog.Errorf(ctx, "HTTP Response unmarshal failed: %s %s, error: %v", "POST", c.serverAddr+api, err)
+			applog.Errorf(ctx, "HTTP Response unmarshal failed: %s %s, error: %v", "POST", url, err)
 			return fmt.Errorf("failed to unmarshal response data: %w", err)
 		}
 	}
-
 	return nil
 }
 
+// retryable tells whether a request of api that failed with err may
+// be sent again: the server was unavailable, and the request either
+// never left or is idempotent
+func retryable(api string, err error) bool {
+	if !errors.Is(err, ErrUnavailable) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return idempotentAPIs[api]
+}
+
+// backoff returns the wait before retry attempt+1, in [d/2, d) where d
+// doubles from Backoff for each attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.options.Backoff
+	for i := 0; i < attempt && d < c.options.MaxBackoff; i++ {
+		d *= 2
+	}
+	if c.options.MaxBackoff > 0 && d > c.options.MaxBackoff {
+		d = c.options.MaxBackoff
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
+
 type Client struct {
-	serverAddr      string
+	serverAddr string
+	options    Options
+	httpClient *nethttp.Client
+
+	mu              sync.Mutex
 	serverAuthToken string
 }
 
 func NewClient(serverAddr string, serverAuthToken string) *Client {
+	return NewClientWithOptions(serverAddr, serverAuthToken, DefaultOptions)
+}
+
+func NewClientWithOptions(serverAddr string, serverAuthToken string, options Options) *Client {
 	return &Client{
 		serverAddr:      serverAddr,
 		serverAuthToken: serverAuthToken,
+		options:         options,
+		httpClient:      &nethttp.Client{},
 	}
 }
 
+// SetToken replaces the token requests are sent with, e.g. after
+// one was refused with ErrUnauthorized
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.serverAuthToken = token
+}
+
+func (c *Client) token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.serverAuthToken
+}
+
 // LogEntryHttpService implements storage.LogEntryService
 type LogEntryHttpService struct {
 	client *Client
@@ -83,13 +288,13 @@ func NewLogEntryService(client *Client) storage.LogEntryService {
 	return &LogEntryHttpService{client: client}
 }
 
-func (s *LogEntryHttpService) List(options storage.LogEntryListOptions) ([]models.LogEntry, int64, error) {
+func (s *LogEntryHttpService) List(ctx context.Context, options storage.LogEntryListOptions) ([]models.LogEntry, int64, error) {
 	var response struct {
 		Entries []models.LogEntry `json:"entries"`
 		Total   int64             `json:"total"`
 	}
 
-	err := s.client.makeRequest(context.Background(), "/entries/list", options, &response)
+	err := s.client.makeRequest(ctx, "/entries/list", options, &response)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list entries: %w", err)
 	}
@@ -97,12 +302,12 @@ func (s *LogEntryHttpService) List(options storage.LogEntryListOptions) ([]model
 	return response.Entries, response.Total, nil
 }
 
-func (s *LogEntryHttpService) Add(entry models.LogEntry) (int64, error) {
+func (s *LogEntryHttpService) Add(ctx context.Context, entry models.LogEntry) (int64, error) {
 	var response struct {
 		ID int64 `json:"id"`
 	}
 
-	err := s.client.makeRequest(context.Background(), "/entries/add", entry, &response)
+	err := s.client.makeRequest(ctx, "/entries/add", entry, &response)
 	if err != nil {
 		return 0, fmt.Errorf("failed to add entry: %w", err)
 	}
@@ -110,12 +315,12 @@ func (s *LogEntryHttpService) Add(entry models.LogEntry) (int64, error) {
 	return response.ID, nil
 }
 
-func (s *LogEntryHttpService) Delete(id int64) error {
+func (s *LogEntryHttpService) Delete(ctx context.Context, id int64) error {
 	params := struct {
 		ID int64 `json:"id"`
 	}{ID: id}
 
-	err := s.client.makeRequest(context.Background(), "/entries/delete", params, nil)
+	err := s.client.makeRequest(ctx, "/entries/delete", params, nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete entry: %w", err)
 	}
@@ -123,13 +328,56 @@ func (s *LogEntryHttpService) Delete(id int64) error {
 	return nil
 }
 
-func (s *LogEntryHttpService) Update(id int64, update models.LogEntryOptional) error {
+func (s *LogEntryHttpService) Undelete(ctx context.Context, id int64) error {
+	params := struct {
+		ID int64 `json:"id"`
+	}{ID: id}
+
+	err := s.client.makeRequest(ctx, "/entries/undelete", params, nil)
+	if err != nil {
+		return fmt.Errorf("failed to undelete entry: %w", err)
+	}
+
+	return nil
+}
+
+func (s *LogEntryHttpService) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	params := struct {
+		DeletedBefore time.Time `json:"deleted_before"`
+	}{DeletedBefore: deletedBefore}
+
+	var response struct {
+		Purged int64 `json:"purged"`
+	}
+	err := s.client.makeRequest(ctx, "/entries/purge", params, &response)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge entries: %w", err)
+	}
+
+	return response.Purged, nil
+}
+
+func (s *LogEntryHttpService) Restore(ctx context.Context, entries []models.LogEntry, notes []models.Note) error {
+	params := struct {
+		Entries []models.LogEntry `json:"entries"`
+		Notes   []models.Note     `json:"notes"`
+	}{Entries: entries, Notes: notes}
+
+	err := s.client.makeRequest(ctx, "/entries/restore", params, nil)
+	if err != nil {
+		return fmt.Errorf("failed to restore entries: %w", err)
+	}
+
+	return nil
+}
+
+func (s *LogEntryHttpService) Update(ctx context.Context, id int64, update models.LogEntryOptional) error {
 	params := struct {
 		ID     int64                   `json:"id"`
 		Update models.LogEntryOptional `json:"update"`
 	}{ID: id, Update: update}
 
-	err := s.client.makeRequest(context.Background(), "/entries/update", params, nil)
+	err := s.client.makeRequest(ctx, "/entries/update", params, nil)
 	if err != nil {
 		return fmt.Errorf("failed to update entry: %w", err)
 	}
@@ -137,13 +385,13 @@ func (s *LogEntryHttpService) Update(id int64, update models.LogEntryOptional) e
 	return nil
 }
 
-func (s *LogEntryHttpService) Move(id int64, newParentID int64) error {
+func (s *LogEntryHttpService) Move(ctx context.Context, id int64, newParentID int64) error {
 	params := struct {
 		ID          int64 `json:"id"`
 		NewParentID int64 `json:"new_parent_id"`
 	}{ID: id, NewParentID: newParentID}
 
-	err := s.client.makeRequest(context.Background(), "/entries/move", params, nil)
+	err := s.client.makeRequest(ctx, "/entries/move", params, nil)
 	if err != nil {
 		return fmt.Errorf("failed to move entry: %w", err)
 	}
@@ -178,7 +426,7 @@ func NewLogNoteService(client *Client) storage.LogNoteService {
 	return &LogNoteHttpService{client: client}
 }
 
-func (s *LogNoteHttpService) List(entryID int64, options storage.LogNoteListOptions) ([]models.Note, int64, error) {
+func (s *LogNoteHttpService) List(ctx context.Context, entryID int64, options storage.LogNoteListOptions) ([]models.Note, int64, error) {
 	var response struct {
 		Notes []models.Note `json:"notes"`
 		Total int64         `json:"total"`
@@ -189,7 +437,7 @@ func (s *LogNoteHttpService) List(entryID int64, options storage.LogNoteListOpti
 		Options storage.LogNoteListOptions `json:"options"`
 	}{EntryID: entryID, Options: options}
 
-	err := s.client.makeRequest(context.Background(), "/notes/list", params, &response)
+	err := s.client.makeRequest(ctx, "/notes/list", params, &response)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list notes: %w", err)
 	}
@@ -197,7 +445,7 @@ func (s *LogNoteHttpService) List(entryID int64, options storage.LogNoteListOpti
 	return response.Notes, response.Total, nil
 }
 
-func (s *LogNoteHttpService) ListForEntries(entryIDs []int64) (map[int64][]models.Note, error) {
+func (s *LogNoteHttpService) ListForEntries(ctx context.Context, entryIDs []int64) (map[int64][]models.Note, error) {
 	var response struct {
 		NotesMap map[int64][]models.Note `json:"notes_map"`
 	}
@@ -206,7 +454,7 @@ func (s *LogNoteHttpService) ListForEntries(entryIDs []int64) (map[int64][]model
 		EntryIDs []int64 `json:"entry_ids"`
 	}{EntryIDs: entryIDs}
 
-	err := s.client.makeRequest(context.Background(), "/notes/listForEntries", params, &response)
+	err := s.client.makeRequest(ctx, "/notes/listForEntries", params, &response)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list notes for entries: %w", err)
 	}
@@ -214,7 +462,7 @@ func (s *LogNoteHttpService) ListForEntries(entryIDs []int64) (map[int64][]model
 	return response.NotesMap, nil
 }
 
-func (s *LogNoteHttpService) Add(entryID int64, note models.Note) (int64, error) {
+func (s *LogNoteHttpService) Add(ctx context.Context, entryID int64, note models.Note) (int64, error) {
 	var response struct {
 		ID int64 `json:"id"`
 	}
@@ -224,7 +472,7 @@ func (s *LogNoteHttpService) Add(entryID int64, note models.Note) (int64, error)
 		Note    models.Note `json:"note"`
 	}{EntryID: entryID, Note: note}
 
-	err := s.client.makeRequest(context.Background(), "/notes/add", params, &response)
+	err := s.client.makeRequest(ctx, "/notes/add", params, &response)
 	if err != nil {
 		return 0, fmt.Errorf("failed to add note: %w", err)
 	}
@@ -232,13 +480,13 @@ func (s *LogNoteHttpService) Add(entryID int64, note models.Note) (int64, error)
 	return response.ID, nil
 }
 
-func (s *LogNoteHttpService) Delete(entryID int64, noteID int64) error {
+func (s *LogNoteHttpService) Delete(ctx context.Context, entryID int64, noteID int64) error {
 	params := struct {
 		EntryID int64 `json:"entry_id"`
 		NoteID  int64 `json:"note_id"`
 	}{EntryID: entryID, NoteID: noteID}
 
-	err := s.client.makeRequest(context.Background(), "/notes/delete", params, nil)
+	err := s.client.makeRequest(ctx, "/notes/delete", params, nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete note: %w", err)
 	}
@@ -246,14 +494,14 @@ func (s *LogNoteHttpService) Delete(entryID int64, noteID int64) error {
 	return nil
 }
 
-func (s *LogNoteHttpService) Update(entryID int64, noteID int64, update models.NoteOptional) error {
+func (s *LogNoteHttpService) Update(ctx context.Context, entryID int64, noteID int64, update models.NoteOptional) error {
 	params := struct {
 		EntryID int64               `json:"entry_id"`
 		NoteID  int64               `json:"note_id"`
 		Update  models.NoteOptional `json:"update"`
 	}{EntryID: entryID, NoteID: noteID, Update: update}
 
-	err := s.client.makeRequest(context.Background(), "/notes/update", params, nil)
+	err := s.client.makeRequest(ctx, "/notes/update", params, nil)
 	if err != nil {
 		return fmt.Errorf("failed to update note: %w", err)
 	}
@@ -0,0 +1,193 @@
+package http
+
+import (
+	"context"
+	"errors"
+	nethttp "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+var testOptions = Options{
+	Timeout:    time.Second,
+	Retries:    2,
+	Backoff:    time.Millisecond,
+	MaxBackoff: 5 * time.Millisecond,
+}
+
+// newFaultyServer serves every request with fault while it returns
+// true, and with an empty successful response after
+func newFaultyServer(t *testing.T, fault func(w nethttp.ResponseWriter, attempt int) bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var attempts atomic.Int32
+	ts := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		attempt := int(attempts.Add(1))
+		if fault(w, attempt) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":0,"data":{"id":1}}`))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &attempts
+}
+
+func TestRetryIdempotentRequest(t *testing.T) {
+	ts, attempts := newFaultyServer(t, func(w nethttp.ResponseWriter, attempt int) bool {
+		if attempt == 1 {
+			w.WriteHeader(nethttp.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	})
+	client := NewClientWithOptions(ts.URL, "", testOptions)
+
+	if _, _, err := NewLogEntryService(client).List(context.Background(), storage.LogEntryListOptions{}); err != nil {
+		t.Fatalf("expected the list to succeed on retry, got %v", err)
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Fatalf("expected 2 attempts, got %d", n)
+	}
+}
+
+func TestNoRetryOfNonIdempotentRequest(t *testing.T) {
+	ts, attempts := newFaultyServer(t, func(w nethttp.ResponseWriter, attempt int) bool {
+		w.WriteHeader(nethttp.StatusBadGateway)
+		return true
+	})
+	client := NewClientWithOptions(ts.URL, "", testOptions)
+
+	_, err := NewLogEntryService(client).Add(context.Background(), models.LogEntry{Text: "once"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("expected the add sent once, got %d attempts", n)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	ts, attempts := newFaultyServer(t, func(w nethttp.ResponseWriter, attempt int) bool {
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+		return true
+	})
+	client := NewClientWithOptions(ts.URL, "", testOptions)
+
+	_, _, err := NewLogEntryService(client).List(context.Background(), storage.LogEntryListOptions{})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if n := attempts.Load(); n != int32(testOptions.Retries+1) {
+		t.Fatalf("expected %d attempts, got %d", testOptions.Retries+1, n)
+	}
+}
+
+func TestRetryUnreachableServer(t *testing.T) {
+	ts := httptest.NewServer(nethttp.NotFoundHandler())
+	addr := ts.URL
+	ts.Close()
+	client := NewClientWithOptions(addr, "", testOptions)
+
+	// an add that could not connect never reached the server, so it is retried too
+	_, err := NewLogEntryService(client).Add(context.Background(), models.LogEntry{Text: "offline"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if !retryable("/entries/add", err) {
+		t.Fatalf("expected a refused connection to be retryable, got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ts, attempts := newFaultyServer(t, func(w nethttp.ResponseWriter, attempt int) bool {
+		time.Sleep(200 * time.Millisecond)
+		return false
+	})
+	options := testOptions
+	options.Timeout = 20 * time.Millisecond
+	client := NewClientWithOptions(ts.URL, "", options)
+
+	_, _, err := NewLogEntryService(client).List(context.Background(), storage.LogEntryListOptions{})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if n := attempts.Load(); n != int32(options.Retries+1) {
+		t.Fatalf("expected %d attempts, got %d", options.Retries+1, n)
+	}
+}
+
+func TestCancelStopsRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ts, attempts := newFaultyServer(t, func(w nethttp.ResponseWriter, attempt int) bool {
+		cancel()
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+		return true
+	})
+	options := testOptions
+	options.Backoff = time.Second
+	options.MaxBackoff = time.Second
+	client := NewClientWithOptions(ts.URL, "", options)
+
+	if _, _, err := NewLogEntryService(client).List(ctx, storage.LogEntryListOptions{}); err == nil {
+		t.Fatal("expected the list to fail")
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("expected no retry after cancel, got %d attempts", n)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"unauthorized", `{"code":401,"msg":"invalid token"}`, ErrUnauthorized},
+		{"not found", `{"code":404,"msg":"entry not found"}`, ErrNotFound},
+		{"conflict", `{"code":409,"msg":"changed","data":{"id":1}}`, storage.ErrConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, attempts := newFaultyServer(t, func(w nethttp.ResponseWriter, attempt int) bool {
+				w.Write([]byte(tt.body))
+				return true
+			})
+			client := NewClientWithOptions(ts.URL, "", testOptions)
+
+			_, _, err := NewLogEntryService(client).List(context.Background(), storage.LogEntryListOptions{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if n := attempts.Load(); n != 1 {
+				t.Fatalf("expected no retry, got %d attempts", n)
+			}
+		})
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	ts := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.Header.Get("Authorization") != "Bearer new" {
+			w.WriteHeader(nethttp.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"msg":"invalid token"}`))
+			return
+		}
+		w.Write([]byte(`{"code":0}`))
+	}))
+	defer ts.Close()
+	client := NewClientWithOptions(ts.URL, "old", testOptions)
+	service := NewLogEntryService(client)
+
+	if err := service.Delete(context.Background(), 1); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+	client.SetToken("new")
+	if err := service.Delete(context.Background(), 1); err != nil {
+		t.Fatalf("expected the new token accepted, got %v", err)
+	}
+}
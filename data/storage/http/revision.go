@@ -0,0 +1,28 @@
+package http
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// RevisionHttpService implements storage.RevisionService
+type RevisionHttpService struct {
+	client *Client
+}
+
+func NewRevisionService(client *Client) storage.RevisionService {
+	return &RevisionHttpService{client: client}
+}
+
+func (s *RevisionHttpService) ListRevisions(ctx context.Context, options storage.RevisionListOptions) ([]models.Revision, error) {
+	var response struct {
+		Revisions []models.Revision `json:"revisions"`
+	}
+	if err := s.client.makeRequest(ctx, "/revisions/list", options, &response); err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	return response.Revisions, nil
+}
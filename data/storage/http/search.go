@@ -0,0 +1,35 @@
+package http
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// SearchHttpService implements storage.SearchService
+type SearchHttpService struct {
+	client *Client
+}
+
+func NewSearchService(client *Client) storage.SearchService {
+	return &SearchHttpService{client: client}
+}
+
+func (s *SearchHttpService) Search(ctx context.Context, options storage.SearchOptions) ([]models.SearchResult, error) {
+	req := struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}{
+		Query: options.Query,
+		Limit: options.Limit,
+	}
+	var response struct {
+		Results []models.SearchResult `json:"results"`
+	}
+	if err := s.client.makeRequest(ctx, "/search", req, &response); err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+	return response.Results, nil
+}
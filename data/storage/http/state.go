@@ -106,6 +106,33 @@ func (s *StateRecordingHttpService) CreateState(ctx context.Context, state *mode
 	return response.State, nil
 }
 
+func (s *StateRecordingHttpService) AddStateEvent(ctx context.Context, event *models.StateEvent) (*models.StateEvent, error) {
+	if event == nil {
+		return nil, fmt.Errorf("state event cannot be nil")
+	}
+
+	req := struct {
+		Event *models.StateEvent `json:"event"`
+	}{
+		Event: event,
+	}
+
+	var response struct {
+		Event *models.StateEvent `json:"event"`
+	}
+
+	err := s.client.makeRequest(ctx, "/state/addEvent", req, &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add state event: %w", err)
+	}
+
+	if response.Event == nil {
+		return nil, fmt.Errorf("server returned nil state event")
+	}
+
+	return response.Event, nil
+}
+
 func (s *StateRecordingHttpService) ListStates(ctx context.Context, scope string) ([]*models.State, error) {
 	// Create request payload for listing states
 	req := struct {
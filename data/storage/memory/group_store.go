@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// GroupBaseStore implements storage.GroupService using BaseStore
+type GroupBaseStore struct {
+	*BaseStore
+}
+
+func (gs *GroupBaseStore) ListGroups(ctx context.Context) ([]models.Group, error) {
+	unlock, err := gs.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	groups := append([]models.Group(nil), gs.data.GetAllGroups()...)
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Position != groups[j].Position {
+			return groups[i].Position < groups[j].Position
+		}
+		return groups[i].ID < groups[j].ID
+	})
+	return groups, nil
+}
+
+func (gs *GroupBaseStore) AddGroup(ctx context.Context, group models.Group) (int64, error) {
+	if group.Name == "" {
+		return 0, fmt.Errorf("group name cannot be empty")
+	}
+	unlock, err := gs.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	// group IDs are numbered on their own, as the default groups
+	// take 1 to 5 regardless of the store's shared ID sequence
+	var maxID int64
+	maxPosition := 0
+	for _, g := range gs.data.GetAllGroups() {
+		maxID = max(maxID, g.ID)
+		maxPosition = max(maxPosition, g.Position)
+	}
+	group.ID = maxID + 1
+	if group.Position == 0 {
+		group.Position = maxPosition + 1
+	}
+	now := time.Now()
+	group.CreateTime = now
+	group.UpdateTime = now
+	if err := gs.data.AddGroup(group); err != nil {
+		return 0, err
+	}
+	if err := gs.data.Save(); err != nil {
+		return 0, err
+	}
+	return group.ID, nil
+}
+
+func (gs *GroupBaseStore) UpdateGroup(ctx context.Context, id int64, update models.GroupOptional) error {
+	if update.Name != nil && *update.Name == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+	unlock, err := gs.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	group, ok := gs.findGroup(id)
+	if !ok {
+		return storage.NotFoundf("group with id %d not found", id)
+	}
+	group.Update(&update)
+	group.UpdateTime = time.Now()
+	if err := gs.data.UpdateGroup(id, group); err != nil {
+		return err
+	}
+	return gs.data.Save()
+}
+
+func (gs *GroupBaseStore) DeleteGroup(ctx context.Context, id int64) error {
+	unlock, err := gs.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := gs.findGroup(id); !ok {
+		return storage.NotFoundf("group with id %d not found", id)
+	}
+	if err := gs.data.DeleteGroup(id); err != nil {
+		return err
+	}
+	var entryIDs []int64
+	for _, m := range gs.data.GetAllGroupMemberships() {
+		if m.GroupID == id {
+			entryIDs = append(entryIDs, m.EntryID)
+		}
+	}
+	for _, entryID := range entryIDs {
+		if err := gs.data.DeleteGroupMembership(entryID); err != nil {
+			return err
+		}
+	}
+	return gs.data.Save()
+}
+
+func (gs *GroupBaseStore) findGroup(id int64) (models.Group, bool) {
+	for _, g := range gs.data.GetAllGroups() {
+		if g.ID == id {
+			return g, true
+		}
+	}
+	return models.Group{}, false
+}
+
+func (gs *GroupBaseStore) ListMemberships(ctx context.Context) ([]models.GroupMembership, error) {
+	unlock, err := gs.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	memberships := append([]models.GroupMembership(nil), gs.data.GetAllGroupMemberships()...)
+	sort.Slice(memberships, func(i, j int) bool {
+		return memberships[i].EntryID < memberships[j].EntryID
+	})
+	return memberships, nil
+}
+
+func (gs *GroupBaseStore) SetMembership(ctx context.Context, membership models.GroupMembership) error {
+	unlock, err := gs.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := gs.data.SetGroupMembership(membership); err != nil {
+		return err
+	}
+	return gs.data.Save()
+}
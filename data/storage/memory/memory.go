@@ -3,6 +3,7 @@ package memory
 import (
 	"context"
 	"errors"
+	"slices"
 	"strings"
 	"time"
 
@@ -18,20 +19,29 @@ type MemoryDataStore struct {
 	states       map[int64]models.State
 	stateEvents  map[int64]models.StateEvent
 	statesByName map[string]int64 // name -> state ID mapping
+	groups       map[int64]models.Group
+	memberships  map[int64]int64 // entry ID -> group ID
+	revisions    []models.Revision
 	nextID       int64
 }
 
 // NewMemoryDataStore creates a new in-memory data store
 func NewMemoryDataStore() *MemoryDataStore {
-	return &MemoryDataStore{
+	mds := &MemoryDataStore{
 		logEntries:   make(map[int64]models.LogEntry),
 		notes:        make(map[int64]models.Note),
 		happenings:   make(map[int64]models.Happening),
 		states:       make(map[int64]models.State),
 		stateEvents:  make(map[int64]models.StateEvent),
 		statesByName: make(map[string]int64),
+		groups:       make(map[int64]models.Group),
+		memberships:  make(map[int64]int64),
 		nextID:       1,
 	}
+	for _, group := range models.NewDefaultGroups(time.Now()) {
+		mds.groups[group.ID] = group
+	}
+	return mds
 }
 
 // Entry operations
@@ -128,6 +138,65 @@ func (mds *MemoryDataStore) DeleteHappening(id int64) error {
 	return nil
 }
 
+// Group operations
+func (mds *MemoryDataStore) GetAllGroups() []models.Group {
+	groups := make([]models.Group, 0, len(mds.groups))
+	for _, group := range mds.groups {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func (mds *MemoryDataStore) AddGroup(group models.Group) error {
+	mds.groups[group.ID] = group
+	return nil
+}
+
+func (mds *MemoryDataStore) UpdateGroup(id int64, group models.Group) error {
+	mds.groups[id] = group
+	return nil
+}
+
+func (mds *MemoryDataStore) DeleteGroup(id int64) error {
+	delete(mds.groups, id)
+	return nil
+}
+
+func (mds *MemoryDataStore) GetAllGroupMemberships() []models.GroupMembership {
+	memberships := make([]models.GroupMembership, 0, len(mds.memberships))
+	for entryID, groupID := range mds.memberships {
+		memberships = append(memberships, models.GroupMembership{EntryID: entryID, GroupID: groupID})
+	}
+	return memberships
+}
+
+func (mds *MemoryDataStore) SetGroupMembership(membership models.GroupMembership) error {
+	mds.memberships[membership.EntryID] = membership.GroupID
+	return nil
+}
+
+func (mds *MemoryDataStore) DeleteGroupMembership(entryID int64) error {
+	delete(mds.memberships, entryID)
+	return nil
+}
+
+// Revision operations
+func (mds *MemoryDataStore) GetAllRevisions() []models.Revision {
+	return mds.revisions
+}
+
+func (mds *MemoryDataStore) AddRevision(revision models.Revision) error {
+	mds.revisions = append(mds.revisions, revision)
+	return nil
+}
+
+func (mds *MemoryDataStore) DeleteRevisions(entryID int64) error {
+	mds.revisions = slices.DeleteFunc(mds.revisions, func(r models.Revision) bool {
+		return r.EntryID == entryID
+	})
+	return nil
+}
+
 // Persistence (no-op for memory store)
 func (mds *MemoryDataStore) Save() error {
 	return nil
@@ -149,6 +218,18 @@ func NewHappeningService() storage.HappeningService {
 	return NewHappeningBaseService(dataStore)
 }
 
+func NewGroupService() storage.GroupService {
+	return NewBaseStore(NewMemoryDataStore()).GroupService()
+}
+
+func NewSearchService() storage.SearchService {
+	return NewBaseStore(NewMemoryDataStore()).SearchService()
+}
+
+func NewRevisionService() storage.RevisionService {
+	return NewBaseStore(NewMemoryDataStore()).RevisionService()
+}
+
 // State operations
 func (mds *MemoryDataStore) GetAllStates() []models.State {
 	states := make([]models.State, 0, len(mds.states))
@@ -278,8 +359,12 @@ func (s *MemoryStateRecordingService) CreateState(ctx context.Context, state *mo
 
 	// Generate ID and set timestamps
 	state.ID = s.dataStore.NextID()
-	state.CreateTime = time.Now()
-	state.UpdateTime = time.Now()
+	if state.CreateTime.IsZero() {
+		state.CreateTime = time.Now()
+	}
+	if state.UpdateTime.IsZero() {
+		state.UpdateTime = time.Now()
+	}
 
 	err := s.dataStore.AddState(*state)
 	if err != nil {
@@ -289,6 +374,28 @@ func (s *MemoryStateRecordingService) CreateState(ctx context.Context, state *mo
 	return state, nil
 }
 
+func (s *MemoryStateRecordingService) AddStateEvent(ctx context.Context, event *models.StateEvent) (*models.StateEvent, error) {
+	if event == nil {
+		return nil, errors.New("state event cannot be nil")
+	}
+	if _, exists := s.dataStore.GetState(event.StateRecordID); !exists {
+		return nil, errors.New("state not found")
+	}
+
+	newEvent := *event
+	newEvent.ID = s.dataStore.NextID()
+	if newEvent.CreateTime.IsZero() {
+		newEvent.CreateTime = time.Now()
+	}
+	if newEvent.UpdateTime.IsZero() {
+		newEvent.UpdateTime = time.Now()
+	}
+	if err := s.dataStore.AddStateEvent(newEvent); err != nil {
+		return nil, err
+	}
+	return &newEvent, nil
+}
+
 func (s *MemoryStateRecordingService) ListStates(ctx context.Context, scope string) ([]*models.State, error) {
 	allStates := s.dataStore.GetAllStates()
 	var filteredStates []*models.State
@@ -48,6 +48,21 @@ type DataStore interface {
 	GetStateEvent(id int64) (models.StateEvent, bool)
 	AddStateEvent(event models.StateEvent) error
 
+	// Group operations
+	GetAllGroups() []models.Group
+	AddGroup(group models.Group) error
+	UpdateGroup(id int64, group models.Group) error
+	DeleteGroup(id int64) error
+	GetAllGroupMemberships() []models.GroupMembership
+	SetGroupMembership(membership models.GroupMembership) error
+	DeleteGroupMembership(entryID int64) error
+
+	// Revision operations, revisions are kept in the order added
+	GetAllRevisions() []models.Revision
+	AddRevision(revision models.Revision) error
+	// DeleteRevisions deletes the revisions of an entry and its notes
+	DeleteRevisions(entryID int64) error
+
 	// ID generation
 	NextID() int64
 
@@ -61,6 +76,24 @@ type BaseStore struct {
 	data DataStore
 }
 
+// Syncer is implemented by data stores shared with other processes.
+// BaseStore brackets every operation with Acquire and Release.
+type Syncer interface {
+	// Acquire takes the cross-process lock and reloads changes made by others
+	Acquire(exclusive bool) error
+	Release() error
+}
+
+// ChangeDetector is implemented by Syncers that can tell whether
+// others changed the data without reloading it
+type ChangeDetector interface {
+	// Changed tells whether the data changed since it was last loaded or saved
+	Changed() (bool, error)
+}
+
+// WatchInterval is how often Watch checks for changes
+var WatchInterval = time.Second
+
 // NewBaseStore creates a new BaseStore with the given DataStore
 func NewBaseStore(data DataStore) *BaseStore {
 	return &BaseStore{
@@ -68,6 +101,114 @@ func NewBaseStore(data DataStore) *BaseStore {
 	}
 }
 
+// LogEntryService returns a LogEntryService sharing this store
+func (bs *BaseStore) LogEntryService() storage.LogEntryService {
+	return &LogEntryBaseStore{BaseStore: bs}
+}
+
+// LogNoteService returns a LogNoteService sharing this store
+func (bs *BaseStore) LogNoteService() storage.LogNoteService {
+	return &LogNoteBaseStore{BaseStore: bs}
+}
+
+// HappeningService returns a HappeningService sharing this store
+func (bs *BaseStore) HappeningService() storage.HappeningService {
+	return &HappeningBaseStore{BaseStore: bs}
+}
+
+// StateRecordingService returns a StateRecordingService sharing this store
+func (bs *BaseStore) StateRecordingService() storage.StateRecordingService {
+	return &StateRecordingBaseStore{BaseStore: bs}
+}
+
+// GroupService returns a GroupService sharing this store
+func (bs *BaseStore) GroupService() storage.GroupService {
+	return &GroupBaseStore{BaseStore: bs}
+}
+
+// SearchService returns a SearchService sharing this store
+func (bs *BaseStore) SearchService() storage.SearchService {
+	return &SearchBaseStore{BaseStore: bs}
+}
+
+// RevisionService returns a RevisionService sharing this store
+func (bs *BaseStore) RevisionService() storage.RevisionService {
+	return &RevisionBaseStore{BaseStore: bs}
+}
+
+// Watch implements storage.ChangeFeed. Data no other process shares
+// never changes elsewhere, Watch then only waits for ctx to be done.
+func (bs *BaseStore) Watch(ctx context.Context, onChange func()) error {
+	detector, ok := bs.data.(ChangeDetector)
+	if !ok {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		changed, err := bs.reloadChanged(detector)
+		if err != nil {
+			return err
+		}
+		if changed {
+			onChange()
+		}
+	}
+}
+
+// reloadChanged reloads the data if it changed, so that the next
+// check does not tell the same change again
+func (bs *BaseStore) reloadChanged(detector ChangeDetector) (bool, error) {
+	bs.mu.Lock()
+	changed, err := detector.Changed()
+	bs.mu.Unlock()
+	if err != nil || !changed {
+		return false, err
+	}
+	unlock, err := bs.rlock()
+	if err != nil {
+		return false, err
+	}
+	unlock()
+	return true, nil
+}
+
+func (bs *BaseStore) lock() (func(), error) {
+	return bs.acquire(true)
+}
+
+func (bs *BaseStore) rlock() (func(), error) {
+	return bs.acquire(false)
+}
+
+func (bs *BaseStore) acquire(exclusive bool) (func(), error) {
+	syncer, ok := bs.data.(Syncer)
+	if !ok {
+		if exclusive {
+			bs.mu.Lock()
+			return bs.mu.Unlock, nil
+		}
+		bs.mu.RLock()
+		return bs.mu.RUnlock, nil
+	}
+	// Acquire may reload the data, so readers need the write lock too
+	bs.mu.Lock()
+	if err := syncer.Acquire(exclusive); err != nil {
+		bs.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		syncer.Release()
+		bs.mu.Unlock()
+	}, nil
+}
+
 // LogEntryBaseStore implements storage.LogEntryService using BaseStore
 type LogEntryBaseStore struct {
 	*BaseStore
@@ -90,32 +231,31 @@ type StateRecordingBaseStore struct {
 
 // NewLogEntryBaseService creates a LogEntryService using the given DataStore
 func NewLogEntryBaseService(data DataStore) storage.LogEntryService {
-	base := NewBaseStore(data)
-	return &LogEntryBaseStore{BaseStore: base}
+	return NewBaseStore(data).LogEntryService()
 }
 
 // NewLogNoteBaseService creates a LogNoteService using the given DataStore
 func NewLogNoteBaseService(data DataStore) storage.LogNoteService {
-	base := NewBaseStore(data)
-	return &LogNoteBaseStore{BaseStore: base}
+	return NewBaseStore(data).LogNoteService()
 }
 
 // NewHappeningBaseService creates a HappeningService using the given DataStore
 func NewHappeningBaseService(data DataStore) storage.HappeningService {
-	base := NewBaseStore(data)
-	return &HappeningBaseStore{BaseStore: base}
+	return NewBaseStore(data).HappeningService()
 }
 
 // NewStateRecordingBaseService creates a StateRecordingService using the given DataStore
 func NewStateRecordingBaseService(data DataStore) storage.StateRecordingService {
-	base := NewBaseStore(data)
-	return &StateRecordingBaseStore{BaseStore: base}
+	return NewBaseStore(data).StateRecordingService()
 }
 
 // LogEntry service methods
-func (les *LogEntryBaseStore) List(options storage.LogEntryListOptions) ([]models.LogEntry, int64, error) {
-	les.mu.RLock()
-	defer les.mu.RUnlock()
+func (les *LogEntryBaseStore) List(ctx context.Context, options storage.LogEntryListOptions) ([]models.LogEntry, int64, error) {
+	unlock, err := les.rlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer unlock()
 
 	allEntries := les.data.GetAllEntries()
 	var entries []models.LogEntry
@@ -128,8 +268,20 @@ func (les *LogEntryBaseStore) List(options storage.LogEntryListOptions) ([]model
 			}
 		}
 
-		// Handle history filtering
-		if !options.IncludeHistory {
+		if !entry.HasTags(options.Tags) {
+			continue
+		}
+
+		if (entry.DeletedTime != nil) != options.Deleted {
+			continue
+		}
+
+		if entry.UpdateTime.Before(options.UpdatedSince) {
+			continue
+		}
+
+		// Handle history filtering, trash shows everything
+		if !options.IncludeHistory && !options.Deleted {
 			// Filter out entries that are done and have done_time before today
 			if entry.Done && entry.DoneTime != nil {
 				today := time.Now().Truncate(24 * time.Hour)
@@ -190,9 +342,12 @@ func (les *LogEntryBaseStore) List(options storage.LogEntryListOptions) ([]model
 	return entries, total, nil
 }
 
-func (les *LogEntryBaseStore) Add(entry models.LogEntry) (int64, error) {
-	les.mu.Lock()
-	defer les.mu.Unlock()
+func (les *LogEntryBaseStore) Add(ctx context.Context, entry models.LogEntry) (int64, error) {
+	unlock, err := les.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
 
 	entry.ID = les.data.NextID()
 	if entry.CreateTime.IsZero() {
@@ -213,39 +368,181 @@ func (les *LogEntryBaseStore) Add(entry models.LogEntry) (int64, error) {
 	return entry.ID, nil
 }
 
-func (les *LogEntryBaseStore) Delete(id int64) error {
-	les.mu.Lock()
-	defer les.mu.Unlock()
+func (les *LogEntryBaseStore) Delete(ctx context.Context, id int64) error {
+	unlock, err := les.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	if _, exists := les.data.GetEntry(id); !exists {
-		return fmt.Errorf("log entry with id %d not found", id)
+	entry, exists := les.data.GetEntry(id)
+	if !exists || entry.DeletedTime != nil {
+		return storage.NotFoundf("log entry with id %d not found", id)
 	}
 
-	if err := les.data.DeleteEntry(id); err != nil {
+	// descendants already in trash keep their own deleted time
+	now := time.Now()
+	err = les.updateSubtree(id, func(entry models.LogEntry) bool {
+		return entry.DeletedTime == nil
+	}, func(entry *models.LogEntry) {
+		entry.DeletedTime = &now
+		entry.UpdateTime = now
+	})
+	if err != nil {
 		return err
 	}
+	return les.data.Save()
+}
 
-	// Also delete all notes for this entry
-	allNotes := les.data.GetAllNotes()
-	for _, note := range allNotes {
-		if note.EntryID == id {
-			if err := les.data.DeleteNote(note.ID); err != nil {
+func (les *LogEntryBaseStore) Undelete(ctx context.Context, id int64) error {
+	unlock, err := les.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	root, exists := les.data.GetEntry(id)
+	if !exists {
+		return storage.NotFoundf("log entry with id %d not found", id)
+	}
+	if root.DeletedTime == nil {
+		return fmt.Errorf("log entry with id %d is not in trash", id)
+	}
+	deletedTime := *root.DeletedTime
+
+	now := time.Now()
+	err = les.updateSubtree(id, func(entry models.LogEntry) bool {
+		return entry.DeletedTime != nil && entry.DeletedTime.Equal(deletedTime)
+	}, func(entry *models.LogEntry) {
+		entry.DeletedTime = nil
+		entry.UpdateTime = now
+	})
+	if err != nil {
+		return err
+	}
+	if root.ParentID != 0 {
+		if parent, exists := les.data.GetEntry(root.ParentID); !exists || parent.DeletedTime != nil {
+			root, _ = les.data.GetEntry(id)
+			root.ParentID = 0
+			if err := les.data.UpdateEntry(id, root); err != nil {
 				return err
 			}
 		}
 	}
+	return les.data.Save()
+}
 
+// updateSubtree applies update to entry id and to its descendants
+// that match, the subtree of a descendant that does not is skipped
+func (les *LogEntryBaseStore) updateSubtree(id int64, match func(entry models.LogEntry) bool, update func(entry *models.LogEntry)) error {
+	children := make(map[int64][]models.LogEntry)
+	for _, entry := range les.data.GetAllEntries() {
+		children[entry.ParentID] = append(children[entry.ParentID], entry)
+	}
+	root, _ := les.data.GetEntry(id)
+	pending := []models.LogEntry{root}
+	for len(pending) > 0 {
+		entry := pending[0]
+		pending = pending[1:]
+		update(&entry)
+		if err := les.data.UpdateEntry(entry.ID, entry); err != nil {
+			return err
+		}
+		for _, child := range children[entry.ID] {
+			if match(child) {
+				pending = append(pending, child)
+			}
+		}
+	}
+	return nil
+}
+
+func (les *LogEntryBaseStore) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	unlock, err := les.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	purged := make(map[int64]bool)
+	for _, entry := range les.data.GetAllEntries() {
+		if entry.DeletedTime != nil && entry.DeletedTime.Before(deletedBefore) {
+			purged[entry.ID] = true
+		}
+	}
+	if len(purged) == 0 {
+		return 0, nil
+	}
+	for id := range purged {
+		if err := les.data.DeleteEntry(id); err != nil {
+			return 0, err
+		}
+		if err := les.data.DeleteGroupMembership(id); err != nil {
+			return 0, err
+		}
+		if err := les.data.DeleteRevisions(id); err != nil {
+			return 0, err
+		}
+	}
+	for _, note := range les.data.GetAllNotes() {
+		if purged[note.EntryID] {
+			if err := les.data.DeleteNote(note.ID); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := les.data.Save(); err != nil {
+		return 0, err
+	}
+	return int64(len(purged)), nil
+}
+
+func (les *LogEntryBaseStore) Restore(ctx context.Context, entries []models.LogEntry, notes []models.Note) error {
+	unlock, err := les.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// IDs are shared by all records, check them all before adding any
+	for _, entry := range entries {
+		if _, exists := les.data.GetEntry(entry.ID); exists {
+			return fmt.Errorf("log entry with id %d already exists", entry.ID)
+		}
+	}
+	for _, note := range notes {
+		if _, exists := les.data.GetNote(note.ID); exists {
+			return fmt.Errorf("note with id %d already exists", note.ID)
+		}
+	}
+	for _, entry := range entries {
+		if err := les.data.AddEntry(entry); err != nil {
+			return err
+		}
+	}
+	for _, note := range notes {
+		if err := les.data.AddNote(note); err != nil {
+			return err
+		}
+	}
 	return les.data.Save()
 }
 
-func (les *LogEntryBaseStore) Update(id int64, update models.LogEntryOptional) error {
-	les.mu.Lock()
-	defer les.mu.Unlock()
+func (les *LogEntryBaseStore) Update(ctx context.Context, id int64, update models.LogEntryOptional) error {
+	unlock, err := les.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	entry, exists := les.data.GetEntry(id)
 	if !exists {
-		return fmt.Errorf("log entry with id %d not found", id)
+		return storage.NotFoundf("log entry with id %d not found", id)
 	}
+	if err := storage.CheckUpdateTime("entry", id, update.IfUpdateTime, entry.UpdateTime); err != nil {
+		return err
+	}
+	before := entry
 
 	if update.Text != nil {
 		entry.Text = *update.Text
@@ -276,36 +573,59 @@ func (les *LogEntryBaseStore) Update(id int64, update models.LogEntryOptional) e
 	if update.ParentID != nil {
 		entry.ParentID = *update.ParentID
 	}
+	if update.DueTime != nil {
+		entry.DueTime = *update.DueTime
+	}
+	if update.ScheduledTime != nil {
+		entry.ScheduledTime = *update.ScheduledTime
+	}
+	if update.Repeat != nil {
+		entry.Repeat = *update.Repeat
+	}
 
 	if err := les.data.UpdateEntry(id, entry); err != nil {
 		return err
 	}
+	now := time.Now()
+	if err := les.recordRevision(models.EntryRevision(before, now), models.EntryRevision(entry, now)); err != nil {
+		return err
+	}
 
 	return les.data.Save()
 }
 
-func (les *LogEntryBaseStore) Move(id int64, newParentID int64) error {
-	les.mu.Lock()
-	defer les.mu.Unlock()
+func (les *LogEntryBaseStore) Move(ctx context.Context, id int64, newParentID int64) error {
+	unlock, err := les.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	entry, exists := les.data.GetEntry(id)
 	if !exists {
-		return fmt.Errorf("log entry with id %d not found", id)
+		return storage.NotFoundf("log entry with id %d not found", id)
 	}
 
+	before := entry
 	entry.ParentID = newParentID
 	entry.UpdateTime = time.Now()
 
 	if err := les.data.UpdateEntry(id, entry); err != nil {
 		return err
 	}
+	if err := les.recordRevision(models.EntryRevision(before, entry.UpdateTime), models.EntryRevision(entry, entry.UpdateTime)); err != nil {
+		return err
+	}
 
 	return les.data.Save()
 }
 
 func (les *LogEntryBaseStore) GetTree(ctx context.Context, id int64, includeHistory bool) ([]models.LogEntry, error) {
-	les.mu.RLock()
-	defer les.mu.RUnlock()
+	unlock, err := les.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	// Find all descendants of the root entry using a recursive approach
 	var result []models.LogEntry
@@ -319,8 +639,8 @@ func (les *LogEntryBaseStore) GetTree(ctx context.Context, id int64, includeHist
 
 	// Find the root entry first
 	rootEntry, exists := entryMap[id]
-	if !exists {
-		return nil, fmt.Errorf("root entry with id %d not found", id)
+	if !exists || rootEntry.DeletedTime != nil {
+		return nil, storage.NotFoundf("root entry with id %d not found", id)
 	}
 
 	// Recursive function to collect all descendants
@@ -328,6 +648,9 @@ func (les *LogEntryBaseStore) GetTree(ctx context.Context, id int64, includeHist
 	collectDescendants = func(parentID int64) {
 		for _, entry := range allEntries {
 			if entry.ParentID == parentID {
+				if entry.DeletedTime != nil {
+					continue
+				}
 				// Apply history filter if needed
 				if !includeHistory && entry.Done && entry.DoneTime != nil {
 					// Skip done entries if not including history
@@ -349,9 +672,12 @@ func (les *LogEntryBaseStore) GetTree(ctx context.Context, id int64, includeHist
 }
 
 // LogNote service methods
-func (lns *LogNoteBaseStore) List(entryID int64, options storage.LogNoteListOptions) ([]models.Note, int64, error) {
-	lns.mu.RLock()
-	defer lns.mu.RUnlock()
+func (lns *LogNoteBaseStore) List(ctx context.Context, entryID int64, options storage.LogNoteListOptions) ([]models.Note, int64, error) {
+	unlock, err := lns.rlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer unlock()
 
 	allNotes := lns.data.GetAllNotes()
 	var notes []models.Note
@@ -410,9 +736,12 @@ func (lns *LogNoteBaseStore) List(entryID int64, options storage.LogNoteListOpti
 	return notes, total, nil
 }
 
-func (lns *LogNoteBaseStore) ListForEntries(entryIDs []int64) (map[int64][]models.Note, error) {
-	lns.mu.RLock()
-	defer lns.mu.RUnlock()
+func (lns *LogNoteBaseStore) ListForEntries(ctx context.Context, entryIDs []int64) (map[int64][]models.Note, error) {
+	unlock, err := lns.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	result := make(map[int64][]models.Note)
 
@@ -438,13 +767,16 @@ func (lns *LogNoteBaseStore) ListForEntries(entryIDs []int64) (map[int64][]model
 	return result, nil
 }
 
-func (lns *LogNoteBaseStore) Add(entryID int64, note models.Note) (int64, error) {
-	lns.mu.Lock()
-	defer lns.mu.Unlock()
+func (lns *LogNoteBaseStore) Add(ctx context.Context, entryID int64, note models.Note) (int64, error) {
+	unlock, err := lns.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
 
 	// Check if entry exists
 	if _, exists := lns.data.GetEntry(entryID); !exists {
-		return 0, fmt.Errorf("log entry with id %d not found", entryID)
+		return 0, storage.NotFoundf("log entry with id %d not found", entryID)
 	}
 
 	note.ID = lns.data.NextID()
@@ -467,13 +799,16 @@ func (lns *LogNoteBaseStore) Add(entryID int64, note models.Note) (int64, error)
 	return note.ID, nil
 }
 
-func (lns *LogNoteBaseStore) Delete(entryID int64, noteID int64) error {
-	lns.mu.Lock()
-	defer lns.mu.Unlock()
+func (lns *LogNoteBaseStore) Delete(ctx context.Context, entryID int64, noteID int64) error {
+	unlock, err := lns.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	note, exists := lns.data.GetNote(noteID)
 	if !exists || note.EntryID != entryID {
-		return fmt.Errorf("note with id %d not found for entry %d", noteID, entryID)
+		return storage.NotFoundf("note with id %d not found for entry %d", noteID, entryID)
 	}
 
 	if err := lns.data.DeleteNote(noteID); err != nil {
@@ -483,14 +818,21 @@ func (lns *LogNoteBaseStore) Delete(entryID int64, noteID int64) error {
 	return lns.data.Save()
 }
 
-func (lns *LogNoteBaseStore) Update(entryID int64, noteID int64, update models.NoteOptional) error {
-	lns.mu.Lock()
-	defer lns.mu.Unlock()
+func (lns *LogNoteBaseStore) Update(ctx context.Context, entryID int64, noteID int64, update models.NoteOptional) error {
+	unlock, err := lns.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	note, exists := lns.data.GetNote(noteID)
 	if !exists || note.EntryID != entryID {
-		return fmt.Errorf("note with id %d not found for entry %d", noteID, entryID)
+		return storage.NotFoundf("note with id %d not found for entry %d", noteID, entryID)
 	}
+	if err := storage.CheckUpdateTime("note", noteID, update.IfUpdateTime, note.UpdateTime); err != nil {
+		return err
+	}
+	before := note
 
 	if update.Text != nil {
 		note.Text = *update.Text
@@ -507,14 +849,21 @@ func (lns *LogNoteBaseStore) Update(entryID int64, noteID int64, update models.N
 	if err := lns.data.UpdateNote(noteID, note); err != nil {
 		return err
 	}
+	now := time.Now()
+	if err := lns.recordRevision(models.NoteRevision(before, now), models.NoteRevision(note, now)); err != nil {
+		return err
+	}
 
 	return lns.data.Save()
 }
 
 // Happening service methods
 func (hbs *HappeningBaseStore) List(options storage.HappeningListOptions) ([]*models.Happening, int64, error) {
-	hbs.mu.RLock()
-	defer hbs.mu.RUnlock()
+	unlock, err := hbs.rlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer unlock()
 
 	allHappenings := hbs.data.GetAllHappenings()
 	var happenings []*models.Happening
@@ -579,15 +928,21 @@ func (hbs *HappeningBaseStore) Add(ctx context.Context, happening *models.Happen
 		return nil, fmt.Errorf("happening content cannot be empty")
 	}
 
-	hbs.mu.Lock()
-	defer hbs.mu.Unlock()
+	unlock, err := hbs.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	// Generate new ID and set timestamps
 	newHappening := *happening
 	newHappening.ID = hbs.data.NextID()
-	now := time.Now()
-	newHappening.CreateTime = now
-	newHappening.UpdateTime = now
+	if newHappening.CreateTime.IsZero() {
+		newHappening.CreateTime = time.Now()
+	}
+	if newHappening.UpdateTime.IsZero() {
+		newHappening.UpdateTime = time.Now()
+	}
 
 	// Add to data store
 	if err := hbs.data.AddHappening(newHappening); err != nil {
@@ -607,13 +962,19 @@ func (hbs *HappeningBaseStore) Update(ctx context.Context, id int64, update *mod
 		return nil, fmt.Errorf("update cannot be nil")
 	}
 
-	hbs.mu.Lock()
-	defer hbs.mu.Unlock()
+	unlock, err := hbs.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	// Check if happening exists
 	existing, exists := hbs.data.GetHappening(id)
 	if !exists {
-		return nil, fmt.Errorf("happening with id %d not found", id)
+		return nil, storage.NotFoundf("happening with id %d not found", id)
+	}
+	if err := storage.CheckUpdateTime("happening", id, update.IfUpdateTime, existing.UpdateTime); err != nil {
+		return nil, err
 	}
 
 	// Apply the optional updates to the existing happening
@@ -634,12 +995,15 @@ func (hbs *HappeningBaseStore) Update(ctx context.Context, id int64, update *mod
 }
 
 func (hbs *HappeningBaseStore) Delete(ctx context.Context, id int64) error {
-	hbs.mu.Lock()
-	defer hbs.mu.Unlock()
+	unlock, err := hbs.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// Check if happening exists
 	if _, exists := hbs.data.GetHappening(id); !exists {
-		return fmt.Errorf("happening with id %d not found", id)
+		return storage.NotFoundf("happening with id %d not found", id)
 	}
 
 	// Delete from data store
@@ -657,8 +1021,11 @@ func (hbs *HappeningBaseStore) Delete(ctx context.Context, id int64) error {
 
 // StateRecordingService methods
 func (srs *StateRecordingBaseStore) GetState(ctx context.Context, name string) (*models.State, error) {
-	srs.mu.RLock()
-	defer srs.mu.RUnlock()
+	unlock, err := srs.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	if state, exists := srs.data.GetStateByName(name); exists {
 		return &state, nil
@@ -667,8 +1034,11 @@ func (srs *StateRecordingBaseStore) GetState(ctx context.Context, name string) (
 }
 
 func (srs *StateRecordingBaseStore) RecordStateEvent(ctx context.Context, name string, deltaScore float64) error {
-	srs.mu.Lock()
-	defer srs.mu.Unlock()
+	unlock, err := srs.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// Find the state by name
 	state, exists := srs.data.GetStateByName(name)
@@ -679,7 +1049,7 @@ func (srs *StateRecordingBaseStore) RecordStateEvent(ctx context.Context, name s
 	// Update the state score
 	state.Score += deltaScore
 	state.UpdateTime = time.Now()
-	err := srs.data.UpdateState(state.ID, state)
+	err = srs.data.UpdateState(state.ID, state)
 	if err != nil {
 		return err
 	}
@@ -710,8 +1080,11 @@ func (srs *StateRecordingBaseStore) CreateState(ctx context.Context, state *mode
 		return nil, fmt.Errorf("state cannot be nil")
 	}
 
-	srs.mu.Lock()
-	defer srs.mu.Unlock()
+	unlock, err := srs.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	// Check if state with same name already exists
 	if _, exists := srs.data.GetStateByName(state.Name); exists {
@@ -720,10 +1093,14 @@ func (srs *StateRecordingBaseStore) CreateState(ctx context.Context, state *mode
 
 	// Generate ID and set timestamps
 	state.ID = srs.data.NextID()
-	state.CreateTime = time.Now()
-	state.UpdateTime = time.Now()
+	if state.CreateTime.IsZero() {
+		state.CreateTime = time.Now()
+	}
+	if state.UpdateTime.IsZero() {
+		state.UpdateTime = time.Now()
+	}
 
-	err := srs.data.AddState(*state)
+	err = srs.data.AddState(*state)
 	if err != nil {
 		return nil, err
 	}
@@ -735,9 +1112,44 @@ func (srs *StateRecordingBaseStore) CreateState(ctx context.Context, state *mode
 	return state, nil
 }
 
+func (srs *StateRecordingBaseStore) AddStateEvent(ctx context.Context, event *models.StateEvent) (*models.StateEvent, error) {
+	if event == nil {
+		return nil, fmt.Errorf("state event cannot be nil")
+	}
+
+	unlock, err := srs.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, exists := srs.data.GetState(event.StateRecordID); !exists {
+		return nil, fmt.Errorf("state not found")
+	}
+
+	newEvent := *event
+	newEvent.ID = srs.data.NextID()
+	if newEvent.CreateTime.IsZero() {
+		newEvent.CreateTime = time.Now()
+	}
+	if newEvent.UpdateTime.IsZero() {
+		newEvent.UpdateTime = time.Now()
+	}
+	if err := srs.data.AddStateEvent(newEvent); err != nil {
+		return nil, err
+	}
+	if err := srs.data.Save(); err != nil {
+		return nil, err
+	}
+	return &newEvent, nil
+}
+
 func (srs *StateRecordingBaseStore) ListStates(ctx context.Context, scope string) ([]*models.State, error) {
-	srs.mu.RLock()
-	defer srs.mu.RUnlock()
+	unlock, err := srs.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	allStates := srs.data.GetAllStates()
 	var filteredStates []*models.State
@@ -754,8 +1166,11 @@ func (srs *StateRecordingBaseStore) ListStates(ctx context.Context, scope string
 }
 
 func (srs *StateRecordingBaseStore) GetStateEvents(ctx context.Context, stateID int64, limit int) ([]*models.StateEvent, error) {
-	srs.mu.RLock()
-	defer srs.mu.RUnlock()
+	unlock, err := srs.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	allEvents := srs.data.GetAllStateEvents()
 	var filteredEvents []*models.StateEvent
@@ -776,8 +1191,11 @@ func (srs *StateRecordingBaseStore) GetStateEvents(ctx context.Context, stateID
 }
 
 func (srs *StateRecordingBaseStore) GetStateHistory(ctx context.Context, options storage.GetStateHistoryOptions) ([]models.StateHistoryPoint, error) {
-	srs.mu.RLock()
-	defer srs.mu.RUnlock()
+	unlock, err := srs.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	// Set default days
 	days := options.Days
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// RevisionBaseStore implements storage.RevisionService using BaseStore
+type RevisionBaseStore struct {
+	*BaseStore
+}
+
+func (rs *RevisionBaseStore) ListRevisions(ctx context.Context, options storage.RevisionListOptions) ([]models.Revision, error) {
+	unlock, err := rs.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	all := rs.data.GetAllRevisions()
+	var revisions []models.Revision
+	for i := len(all) - 1; i >= 0; i-- {
+		revision := all[i]
+		if options.EntryID != 0 && revision.EntryID != options.EntryID {
+			continue
+		}
+		if !options.ChangedAfter.IsZero() && !revision.ChangeTime.After(options.ChangedAfter) {
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// recordRevision keeps before as a revision, unless the change to
+// after left the fields revisions keep as they were. Revisions are
+// numbered on their own, callers hold the lock.
+func (bs *BaseStore) recordRevision(before models.Revision, after models.Revision) error {
+	if !models.RevisionChanged(before, after) {
+		return nil
+	}
+	before.ID = 1
+	if revisions := bs.data.GetAllRevisions(); len(revisions) > 0 {
+		before.ID = revisions[len(revisions)-1].ID + 1
+	}
+	return bs.data.AddRevision(before)
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/internal/query"
+	"github.com/xhd2015/todo/models"
+)
+
+// SearchBaseStore implements storage.SearchService using BaseStore
+type SearchBaseStore struct {
+	*BaseStore
+}
+
+func (ss *SearchBaseStore) Search(ctx context.Context, options storage.SearchOptions) ([]models.SearchResult, error) {
+	q, err := query.Parse(options.Query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	limit := options.Limit
+	if limit <= 0 {
+		limit = storage.DefaultSearchLimit
+	}
+
+	unlock, err := ss.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries := ss.data.GetAllEntries()
+	candidates := make([]query.Candidate, 0, len(entries))
+	index := make(map[int64]int, len(entries))
+	for _, entry := range entries {
+		if entry.DeletedTime != nil {
+			continue
+		}
+		index[entry.ID] = len(candidates)
+		candidates = append(candidates, query.Candidate{
+			Kind:       models.SearchResultKind_Entry,
+			ID:         entry.ID,
+			Text:       entry.Text,
+			Done:       entry.Done,
+			CreateTime: entry.CreateTime,
+		})
+	}
+	notes := append([]models.Note(nil), ss.data.GetAllNotes()...)
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i].ID < notes[j].ID
+	})
+	for _, note := range notes {
+		if i, ok := index[note.EntryID]; ok {
+			candidates[i].Notes = append(candidates[i].Notes, note.Text)
+		}
+	}
+	for _, happening := range ss.data.GetAllHappenings() {
+		candidates = append(candidates, query.Candidate{
+			Kind:       models.SearchResultKind_Happening,
+			ID:         happening.ID,
+			Text:       happening.Content,
+			CreateTime: happening.CreateTime,
+		})
+	}
+	return q.Search(candidates, limit), nil
+}
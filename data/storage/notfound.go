@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound matches the errors of storage for entries, notes,
+// happenings and groups that do not exist, e.g. deleted meanwhile
+var ErrNotFound = errors.New("not found")
+
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// NotFoundf returns an error with the formatted message matching
+// ErrNotFound
+func NotFoundf(format string, args ...any) error {
+	return &notFoundError{msg: fmt.Sprintf(format, args...)}
+}
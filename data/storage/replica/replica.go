@@ -0,0 +1,654 @@
+// Package replica keeps a local SQLite copy of the entries and notes
+// of a server, so that reading and writing them never waits for the
+// network.
+//
+// Writes apply to the local copy and append an op to its outbox.
+// Sync pushes the outbox in order, then pulls the entries the server
+// updated since the last pull, by update_time, along with their notes.
+// Every FullSyncInterval it pulls everything instead, which also
+// catches entries purged and notes changed on the server.
+//
+// Conflicts are resolved as follows. Ops carry only the fields that
+// changed, so changes to different fields of an entry both apply. Of
+// changes to the same field the one pushed last wins, the server
+// stamps the update time when applying a push. Pulled entries and
+// notes with ops still in the outbox are skipped, the local change is
+// pushed next. An op the server rejects MaxAttempts times with a 4xx
+// code, e.g. one updating an entry deleted meanwhile, is dropped and
+// counted as a conflict. Dropping an add removes what it added from
+// the local copy, the ops on it are dropped in turn. Ops the server
+// did not get, failed on its side, e.g. with its database locked, or
+// refused for the token wait in the outbox however often they are
+// pushed.
+// The IfUpdateTime precondition of an update is checked against the
+// local copy only, pushes drop it so the op merges like the others.
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/data/storage/http"
+	"github.com/xhd2015/todo/data/storage/sqlite"
+	applog "github.com/xhd2015/todo/log"
+	"github.com/xhd2015/todo/models"
+)
+
+const (
+	// DefaultInterval is how often Run syncs without local writes
+	DefaultInterval = 30 * time.Second
+	// FullSyncInterval is how often Sync pulls everything
+	FullSyncInterval = 10 * time.Minute
+	// MaxAttempts is how many times an op is pushed before it is dropped
+	MaxAttempts = 3
+)
+
+// metaWatermark keeps the latest update time pulled
+const metaWatermark = "watermark"
+
+// outbox op kinds
+const (
+	opAddEntry       = "add_entry"
+	opUpdateEntry    = "update_entry"
+	opMoveEntry      = "move_entry"
+	opDeleteEntry    = "delete_entry"
+	opUndeleteEntry  = "undelete_entry"
+	opPurgeEntries   = "purge_entries"
+	opRestoreEntries = "restore_entries"
+	opAddNote        = "add_note"
+	opUpdateNote     = "update_note"
+	opDeleteNote     = "delete_note"
+)
+
+// errOrphaned marks ops referring to an entry or note whose add was dropped
+var errOrphaned = errors.New("refers to a change that was dropped")
+
+// Status describes the last sync
+type Status struct {
+	// Online is false while the server cannot be reached
+	Online bool
+	// Pending counts the ops not pushed yet
+	Pending int
+	// Conflicts counts the ops the server rejected, which were dropped
+	Conflicts int
+	// LastSync is when the last successful sync ended
+	LastSync time.Time
+	// Err is the error of the last sync
+	Err error
+}
+
+// String summarizes the status for the status bar, e.g. "offline, 3 pending"
+func (s Status) String() string {
+	var text string
+	switch {
+	case s.LastSync.IsZero() && s.Err == nil:
+		text = "connecting"
+	case !s.Online:
+		text = "offline"
+	case errors.Is(s.Err, http.ErrUnauthorized):
+		text = "token refused"
+	case s.Err != nil:
+		text = "sync failed"
+	case s.Pending > 0:
+		text = "syncing"
+	default:
+		text = "synced"
+	}
+	if s.Pending > 0 {
+		text += fmt.Sprintf(", %d pending", s.Pending)
+	}
+	if s.Conflicts == 1 {
+		text += ", 1 conflict"
+	} else if s.Conflicts > 1 {
+		text += fmt.Sprintf(", %d conflicts", s.Conflicts)
+	}
+	return text
+}
+
+// Replica serves entries and notes from a local store, keeping it in
+// sync with the remote services
+type Replica struct {
+	store         *sqlite.SQLiteStore
+	entries       *sqlite.LogEntrySQLiteStore
+	notes         *sqlite.LogNoteSQLiteStore
+	remoteEntries storage.LogEntryService
+	remoteNotes   storage.LogNoteService
+
+	// mu serializes local writes with applying pushes and pulls
+	mu sync.Mutex
+	// syncMu lets one Sync run at a time
+	syncMu   sync.Mutex
+	lastFull time.Time
+	wake     chan struct{}
+
+	statusMu sync.Mutex
+	status   Status
+	onSync   func(changed bool)
+}
+
+// New creates a replica of the remote services in store
+func New(store *sqlite.SQLiteStore, remoteEntries storage.LogEntryService, remoteNotes storage.LogNoteService) *Replica {
+	return &Replica{
+		store:         store,
+		entries:       &sqlite.LogEntrySQLiteStore{SQLiteStore: store},
+		notes:         &sqlite.LogNoteSQLiteStore{SQLiteStore: store},
+		remoteEntries: remoteEntries,
+		remoteNotes:   remoteNotes,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// LogEntryService serves entries from the local store
+func (r *Replica) LogEntryService() storage.LogEntryService {
+	return &logEntryService{r: r}
+}
+
+// LogNoteService serves notes from the local store
+func (r *Replica) LogNoteService() storage.LogNoteService {
+	return &logNoteService{r: r}
+}
+
+// OnSync sets a callback run when the status changes, changed tells
+// whether the local entries or notes changed too, e.g. by a pull
+func (r *Replica) OnSync(fn func(changed bool)) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	r.onSync = fn
+}
+
+func (r *Replica) Status() Status {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	return r.status
+}
+
+func (r *Replica) updateStatus(changed bool, update func(status *Status)) {
+	r.statusMu.Lock()
+	update(&r.status)
+	onSync := r.onSync
+	r.statusMu.Unlock()
+	if onSync != nil {
+		onSync(changed)
+	}
+}
+
+// Run syncs every interval, and after local writes, until ctx is done.
+// While the server cannot be reached it only retries every interval.
+func (r *Replica) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := r.Sync(ctx)
+		if err != nil {
+			applog.Errorf(ctx, "sync: %v", err)
+		}
+		wake := r.wake
+		if err != nil && !r.Status().Online {
+			wake = nil
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// Sync pushes the outbox, then pulls the changes of the server
+func (r *Replica) Sync(ctx context.Context) error {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	pushed, conflicts, err := r.push(ctx)
+	if conflicts > 0 {
+		// pull what the dropped ops left behind
+		r.lastFull = time.Time{}
+	}
+	var pulled bool
+	if err == nil {
+		full := time.Since(r.lastFull) >= FullSyncInterval
+		pulled, err = r.pull(ctx, full)
+		if err == nil && full {
+			r.lastFull = time.Now()
+		}
+	}
+
+	ops, listErr := r.store.ListOutboxOps()
+	r.updateStatus(pushed || pulled, func(status *Status) {
+		status.Online = err == nil || reachedServer(err)
+		if listErr == nil {
+			status.Pending = len(ops)
+		}
+		status.Conflicts += conflicts
+		status.Err = err
+		if err == nil {
+			status.LastSync = time.Now()
+		}
+	})
+	return err
+}
+
+// record appends an op to the outbox and wakes Run, r.mu must be held
+func (r *Replica) record(kind string, entryID int64, noteID int64, payload any) error {
+	var data []byte
+	if payload != nil {
+		var err error
+		data, err = json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", kind, err)
+		}
+	}
+	_, err := r.store.AddOutboxOp(sqlite.OutboxOp{Kind: kind, EntryID: entryID, NoteID: noteID, Payload: string(data)})
+	if err != nil {
+		return fmt.Errorf("failed to record %s: %w", kind, err)
+	}
+	r.updateStatus(false, func(status *Status) {
+		status.Pending++
+	})
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// push pushes the outbox in order. It stops at the first op that does
+// not get through, or that the server rejects fewer than MaxAttempts
+// times, so later ops never overtake it. changed tells whether local
+// IDs were remapped or entries and notes removed.
+func (r *Replica) push(ctx context.Context) (changed bool, conflicts int, err error) {
+	r.mu.Lock()
+	ops, err := r.store.ListOutboxOps()
+	r.mu.Unlock()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to list outbox: %w", err)
+	}
+	for _, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return changed, conflicts, err
+		}
+		remapped, err := r.pushOp(ctx, op)
+		changed = changed || remapped
+		if err == nil {
+			if err := r.store.DeleteOutboxOp(op.ID); err != nil {
+				return changed, conflicts, err
+			}
+			continue
+		}
+		orphaned := errors.Is(err, errOrphaned)
+		if !orphaned && !rejected(err) {
+			return changed, conflicts, err
+		}
+		if !orphaned && op.Attempts+1 < MaxAttempts {
+			applog.Errorf(ctx, "sync: server rejected %s of entry %d, will retry: %v", op.Kind, op.EntryID, err)
+			return changed, conflicts, r.store.FailOutboxOp(op.ID)
+		}
+		applog.Errorf(ctx, "sync: dropped %s of entry %d: %v", op.Kind, op.EntryID, err)
+		removed, err := r.drop(op)
+		if err != nil {
+			return changed, conflicts, err
+		}
+		changed = changed || removed
+		conflicts++
+	}
+	return changed, conflicts, nil
+}
+
+// reachedServer tells whether err is the answer of the server, as
+// opposed to the request not getting through or a proxy failing it
+func reachedServer(err error) bool {
+	var serverErr *http.ServerError
+	return errors.As(err, &serverErr) && !errors.Is(err, http.ErrUnavailable)
+}
+
+// rejected tells whether the server refused the op itself, with a 4xx
+// code other than for the token. Pushing it again may still succeed
+// after other ops, unlike after a failure of the server.
+func rejected(err error) bool {
+	var serverErr *http.ServerError
+	return errors.As(err, &serverErr) && serverErr.Code >= 400 && serverErr.Code < 500 &&
+		!errors.Is(err, http.ErrUnauthorized)
+}
+
+// drop deletes op from the outbox. What an add added locally is
+// removed, as it will never be on the server: removed tells whether
+// there was something to remove.
+func (r *Replica) drop(op sqlite.OutboxOp) (removed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch op.Kind {
+	case opAddEntry:
+		removed, err = r.entries.Remove([]int64{op.EntryID})
+	case opAddNote:
+		removed, err = r.notes.Remove([]int64{op.NoteID})
+	}
+	if err != nil {
+		return false, err
+	}
+	return removed, r.store.DeleteOutboxOp(op.ID)
+}
+
+// pushOp applies op to the server. Temporary IDs of ops recorded
+// before an add got pushed are resolved here.
+func (r *Replica) pushOp(ctx context.Context, op sqlite.OutboxOp) (remapped bool, err error) {
+	entryID, err := r.resolveEntry(op.EntryID)
+	if err != nil {
+		return false, err
+	}
+	noteID, err := r.resolveNote(op.NoteID)
+	if err != nil {
+		return false, err
+	}
+	if op.Kind != opAddEntry && entryID < 0 || op.Kind != opAddNote && noteID < 0 {
+		return false, errOrphaned
+	}
+	payload := []byte(op.Payload)
+
+	switch op.Kind {
+	case opAddEntry:
+		var entry models.LogEntry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return false, err
+		}
+		if entry.ParentID, err = r.resolveEntry(entry.ParentID); err != nil {
+			return false, err
+		}
+		if entry.ParentID < 0 {
+			return false, errOrphaned
+		}
+		if entry.PreviousID, err = r.resolveEntry(entry.PreviousID); err != nil {
+			return false, err
+		}
+		if entry.PreviousID < 0 {
+			entry.PreviousID = 0
+		}
+		entry.ID = 0
+		// the server stamps it, so that other replicas pull the entry
+		entry.UpdateTime = time.Time{}
+		id, err := r.remoteEntries.Add(ctx, entry)
+		if err != nil {
+			return false, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return true, r.entries.RemapID(op.EntryID, id)
+	case opUpdateEntry:
+		update, err := models.DecodeLogEntryOptional(payload)
+		if err != nil {
+			return false, err
+		}
+		if update.ParentID != nil {
+			parentID, err := r.resolveEntry(*update.ParentID)
+			if err != nil {
+				return false, err
+			}
+			if parentID < 0 {
+				return false, errOrphaned
+			}
+			update.ParentID = &parentID
+		}
+		update.UpdateTime = nil
+		update.IfUpdateTime = nil
+		return false, r.remoteEntries.Update(ctx, entryID, update)
+	case opMoveEntry:
+		var move moveEntry
+		if err := json.Unmarshal(payload, &move); err != nil {
+			return false, err
+		}
+		parentID, err := r.resolveEntry(move.ParentID)
+		if err != nil {
+			return false, err
+		}
+		if parentID < 0 {
+			return false, errOrphaned
+		}
+		return false, r.remoteEntries.Move(ctx, entryID, parentID)
+	case opDeleteEntry:
+		return false, r.remoteEntries.Delete(ctx, entryID)
+	case opUndeleteEntry:
+		return false, r.remoteEntries.Undelete(ctx, entryID)
+	case opPurgeEntries:
+		var purge purgeEntries
+		if err := json.Unmarshal(payload, &purge); err != nil {
+			return false, err
+		}
+		_, err := r.remoteEntries.Purge(ctx, purge.DeletedBefore)
+		return false, err
+	case opRestoreEntries:
+		var restore restoreEntries
+		if err := json.Unmarshal(payload, &restore); err != nil {
+			return false, err
+		}
+		restorer, ok := r.remoteEntries.(storage.LogEntryRestorer)
+		if !ok {
+			return false, fmt.Errorf("restoring entries is not supported by the server: %w", errOrphaned)
+		}
+		return false, restorer.Restore(ctx, restore.Entries, restore.Notes)
+	case opAddNote:
+		var note models.Note
+		if err := json.Unmarshal(payload, &note); err != nil {
+			return false, err
+		}
+		note.ID = 0
+		note.EntryID = entryID
+		note.UpdateTime = time.Time{}
+		id, err := r.remoteNotes.Add(ctx, entryID, note)
+		if err != nil {
+			return false, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return true, r.notes.RemapID(op.NoteID, id)
+	case opUpdateNote:
+		var update models.NoteOptional
+		if err := json.Unmarshal(payload, &update); err != nil {
+			return false, err
+		}
+		update.UpdateTime = nil
+		update.IfUpdateTime = nil
+		return false, r.remoteNotes.Update(ctx, entryID, noteID, update)
+	case opDeleteNote:
+		return false, r.remoteNotes.Delete(ctx, entryID, noteID)
+	}
+	return false, fmt.Errorf("unknown op %q: %w", op.Kind, errOrphaned)
+}
+
+func (r *Replica) resolveEntry(id int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.entries.ResolveID(id)
+}
+
+func (r *Replica) resolveNote(id int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.notes.ResolveID(id)
+}
+
+// pull applies the entries the server updated since the watermark,
+// or all of them if full, with their notes. changed tells whether
+// anything local changed.
+func (r *Replica) pull(ctx context.Context, full bool) (changed bool, err error) {
+	var since time.Time
+	if !full {
+		watermark, err := r.store.GetMeta(metaWatermark)
+		if err != nil {
+			return false, err
+		}
+		if watermark != "" {
+			if since, err = time.Parse(time.RFC3339Nano, watermark); err != nil {
+				return false, fmt.Errorf("invalid watermark %q: %w", watermark, err)
+			}
+		}
+	}
+	live, _, err := r.remoteEntries.List(ctx, storage.LogEntryListOptions{IncludeHistory: true, UpdatedSince: since})
+	if err != nil {
+		return false, err
+	}
+	trashed, _, err := r.remoteEntries.List(ctx, storage.LogEntryListOptions{Deleted: true, UpdatedSince: since})
+	if err != nil {
+		return false, err
+	}
+	remote := append(live, trashed...)
+	ids := make([]int64, 0, len(remote))
+	for _, entry := range remote {
+		ids = append(ids, entry.ID)
+	}
+	remoteNotes := map[int64][]models.Note{}
+	if len(ids) > 0 {
+		if remoteNotes, err = r.remoteNotes.ListForEntries(ctx, ids); err != nil {
+			return false, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ops, err := r.store.ListOutboxOps()
+	if err != nil {
+		return false, err
+	}
+	pendingEntries := make(map[int64]bool)
+	pendingNotes := make(map[int64]bool)
+	for _, op := range ops {
+		pendingEntries[op.EntryID] = true
+		if op.NoteID != 0 {
+			pendingNotes[op.NoteID] = true
+		}
+	}
+
+	local, err := r.localEntries(ctx)
+	if err != nil {
+		return false, err
+	}
+	var puts []models.LogEntry
+	var pulledIDs []int64
+	remoteIDs := make(map[int64]bool, len(remote))
+	var watermark time.Time
+	for _, entry := range remote {
+		remoteIDs[entry.ID] = true
+		if entry.UpdateTime.After(watermark) {
+			watermark = entry.UpdateTime
+		}
+		if pendingEntries[entry.ID] {
+			continue
+		}
+		pulledIDs = append(pulledIDs, entry.ID)
+		if existing, ok := local[entry.ID]; !ok || !sameJSON(existing, entry) {
+			puts = append(puts, entry)
+		}
+	}
+	if err := r.entries.Put(puts...); err != nil {
+		return false, err
+	}
+	changed = len(puts) > 0
+
+	if full {
+		var removed []int64
+		for id := range local {
+			// entries added locally wait for their add to be pushed,
+			// those left of dropped adds go too
+			if !remoteIDs[id] && !pendingEntries[id] {
+				removed = append(removed, id)
+			}
+		}
+		anyRemoved, err := r.entries.Remove(removed)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || anyRemoved
+	}
+
+	notesChanged, err := r.applyNotes(ctx, pulledIDs, remoteNotes, pendingNotes)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || notesChanged
+
+	if !watermark.IsZero() {
+		if err := r.store.SetMeta(metaWatermark, watermark.Format(time.RFC3339Nano)); err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
+
+// localEntries maps the IDs of all local entries, trash included,
+// to the entries
+func (r *Replica) localEntries(ctx context.Context) (map[int64]models.LogEntry, error) {
+	live, _, err := r.entries.List(ctx, storage.LogEntryListOptions{IncludeHistory: true})
+	if err != nil {
+		return nil, err
+	}
+	trashed, _, err := r.entries.List(ctx, storage.LogEntryListOptions{Deleted: true})
+	if err != nil {
+		return nil, err
+	}
+	local := make(map[int64]models.LogEntry, len(live)+len(trashed))
+	for _, entry := range append(live, trashed...) {
+		local[entry.ID] = entry
+	}
+	return local, nil
+}
+
+// applyNotes makes the local notes of the entries those of the server,
+// except for notes with pending ops and notes added locally
+func (r *Replica) applyNotes(ctx context.Context, entryIDs []int64, remote map[int64][]models.Note, pending map[int64]bool) (changed bool, err error) {
+	if len(entryIDs) == 0 {
+		return false, nil
+	}
+	local, err := r.notes.ListForEntries(ctx, entryIDs)
+	if err != nil {
+		return false, err
+	}
+	var puts []models.Note
+	for _, entryID := range entryIDs {
+		existing := make(map[int64]models.Note, len(local[entryID]))
+		for _, note := range local[entryID] {
+			existing[note.ID] = note
+		}
+		for _, note := range remote[entryID] {
+			if pending[note.ID] {
+				delete(existing, note.ID)
+				continue
+			}
+			if old, ok := existing[note.ID]; !ok || !sameJSON(old, note) {
+				puts = append(puts, note)
+			}
+			delete(existing, note.ID)
+		}
+		for id := range existing {
+			if pending[id] {
+				continue
+			}
+			if err := r.notes.Delete(ctx, entryID, id); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	if err := r.notes.Put(puts...); err != nil {
+		return false, err
+	}
+	return changed || len(puts) > 0, nil
+}
+
+// sameJSON compares values by their JSON, which ignores how times
+// came by their zones
+func sameJSON(a any, b any) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(x) == string(y)
+}
@@ -0,0 +1,368 @@
+package replica_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
+	storagehttp "github.com/xhd2015/todo/data/storage/http"
+	"github.com/xhd2015/todo/data/storage/replica"
+	"github.com/xhd2015/todo/data/storage/sqlite"
+	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/server"
+)
+
+type testServer struct {
+	entries *sqlite.LogEntrySQLiteStore
+	notes   *sqlite.LogNoteSQLiteStore
+	client  *storagehttp.Client
+	// down makes every request fail as if the network was gone
+	down atomic.Bool
+	// failAdd makes every add of an entry fail with this code from
+	// the server, unless 0
+	failAdd atomic.Int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store, err := sqlite.New(filepath.Join(t.TempDir(), "server.db"))
+	if err != nil {
+		t.Fatalf("open server store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	ts := &testServer{
+		entries: &sqlite.LogEntrySQLiteStore{SQLiteStore: store},
+		notes:   &sqlite.LogNoteSQLiteStore{SQLiteStore: store},
+	}
+	handler := server.New(&data.Services{LogEntry: ts.entries, LogNote: ts.notes}, "")
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ts.down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if code := ts.failAdd.Load(); code != 0 && r.URL.Path == server.APIPrefix+"/entries/add" {
+			json.NewEncoder(w).Encode(server.Response{Code: int(code), Msg: "failed"})
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(httpServer.Close)
+	ts.client = storagehttp.NewClient(httpServer.URL+server.APIPrefix, "")
+	return ts
+}
+
+func (ts *testServer) newReplica(t *testing.T) *replica.Replica {
+	t.Helper()
+	store, err := sqlite.New(filepath.Join(t.TempDir(), "replica.db"))
+	if err != nil {
+		t.Fatalf("open replica store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return replica.New(store, storagehttp.NewLogEntryService(ts.client), storagehttp.NewLogNoteService(ts.client))
+}
+
+func sync(t *testing.T, r *replica.Replica) {
+	t.Helper()
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+}
+
+// texts maps the IDs of the entries, trash included, to their text
+func texts(t *testing.T, entries storage.LogEntryService) map[int64]string {
+	ctx := context.Background()
+	t.Helper()
+	result := make(map[int64]string)
+	for _, deleted := range []bool{false, true} {
+		list, _, err := entries.List(ctx, storage.LogEntryListOptions{IncludeHistory: true, Deleted: deleted})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		for _, entry := range list {
+			text := entry.Text
+			if entry.DeletedTime != nil {
+				text += " (deleted)"
+			}
+			result[entry.ID] = text
+		}
+	}
+	return result
+}
+
+func getEntry(t *testing.T, entries storage.LogEntryService, id int64) models.LogEntry {
+	ctx := context.Background()
+	t.Helper()
+	list, _, err := entries.List(ctx, storage.LogEntryListOptions{IncludeHistory: true})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	for _, entry := range list {
+		if entry.ID == id {
+			return entry
+		}
+	}
+	t.Fatalf("entry %d not found", id)
+	return models.LogEntry{}
+}
+
+func equalTexts(a map[int64]string, b map[int64]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, text := range a {
+		if b[id] != text {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSyncPushesAndPulls(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t)
+	a := ts.newReplica(t)
+	b := ts.newReplica(t)
+	aEntries, aNotes := a.LogEntryService(), a.LogNoteService()
+	bEntries, bNotes := b.LogEntryService(), b.LogNoteService()
+
+	rootID, err := aEntries.Add(ctx, models.LogEntry{Text: "root"})
+	if err != nil {
+		t.Fatalf("add root: %v", err)
+	}
+	childID, err := aEntries.Add(ctx, models.LogEntry{Text: "child", ParentID: rootID})
+	if err != nil {
+		t.Fatalf("add child: %v", err)
+	}
+	if rootID >= 0 || childID >= 0 {
+		t.Fatalf("expected temporary IDs before sync, got %d and %d", rootID, childID)
+	}
+	if _, err := aNotes.Add(ctx, childID, models.Note{Text: "a note"}); err != nil {
+		t.Fatalf("add note: %v", err)
+	}
+	if status := a.Status(); status.Pending != 3 {
+		t.Fatalf("expected 3 pending ops, got %+v", status)
+	}
+	sync(t, a)
+
+	if status := a.Status(); status.String() != "synced" {
+		t.Fatalf("expected synced, got %q", status.String())
+	}
+	onServer := texts(t, ts.entries)
+	if len(onServer) != 2 {
+		t.Fatalf("expected 2 entries on the server, got %v", onServer)
+	}
+	if local := texts(t, aEntries); !equalTexts(local, onServer) {
+		t.Fatalf("expected local IDs to be remapped to the server's %v, got %v", onServer, local)
+	}
+	// temporary IDs still resolve
+	if err := aEntries.Update(ctx, childID, models.LogEntryOptional{HighlightLevel: ptr(2)}); err != nil {
+		t.Fatalf("update by temporary ID: %v", err)
+	}
+	sync(t, a)
+
+	sync(t, b)
+	if local := texts(t, bEntries); !equalTexts(local, onServer) {
+		t.Fatalf("expected the other replica to pull %v, got %v", onServer, local)
+	}
+	var serverChildID int64
+	for id, text := range onServer {
+		if text == "child" {
+			serverChildID = id
+		}
+	}
+	child := getEntry(t, bEntries, serverChildID)
+	if child.HighlightLevel != 2 || child.ParentID == 0 {
+		t.Fatalf("expected the pulled child under root with level 2, got %+v", child)
+	}
+	notes, _, err := bNotes.List(ctx, serverChildID, storage.LogNoteListOptions{})
+	if err != nil || len(notes) != 1 || notes[0].Text != "a note" {
+		t.Fatalf("expected the note to be pulled, got %v, %v", notes, err)
+	}
+
+	// changes of different fields merge
+	if err := bEntries.Update(ctx, serverChildID, models.LogEntryOptional{Text: ptr("child renamed")}); err != nil {
+		t.Fatalf("update text: %v", err)
+	}
+	if err := aEntries.Update(ctx, serverChildID, models.LogEntryOptional{Done: ptr(true)}); err != nil {
+		t.Fatalf("update done: %v", err)
+	}
+	sync(t, b)
+	sync(t, a)
+	sync(t, b)
+	for name, entries := range map[string]storage.LogEntryService{"a": aEntries, "b": bEntries, "server": ts.entries} {
+		child := getEntry(t, entries, serverChildID)
+		if child.Text != "child renamed" || !child.Done {
+			t.Fatalf("%s: expected both changes, got %+v", name, child)
+		}
+	}
+
+	// of changes to the same field the one pushed last wins
+	if err := aEntries.Update(ctx, serverChildID, models.LogEntryOptional{Text: ptr("from a")}); err != nil {
+		t.Fatalf("update a: %v", err)
+	}
+	if err := bEntries.Update(ctx, serverChildID, models.LogEntryOptional{Text: ptr("from b")}); err != nil {
+		t.Fatalf("update b: %v", err)
+	}
+	sync(t, a)
+	sync(t, b)
+	sync(t, a)
+	for name, entries := range map[string]storage.LogEntryService{"a": aEntries, "b": bEntries} {
+		if text := getEntry(t, entries, serverChildID).Text; text != "from b" {
+			t.Fatalf("%s: expected the last push to win, got %q", name, text)
+		}
+	}
+
+	// deletes and note changes travel too
+	if err := bNotes.Update(ctx, serverChildID, notes[0].ID, models.NoteOptional{Text: ptr("edited")}); err != nil {
+		t.Fatalf("update note: %v", err)
+	}
+	if err := bEntries.Delete(ctx, serverChildID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	sync(t, b)
+	sync(t, a)
+	if text := texts(t, aEntries)[serverChildID]; text != "from b (deleted)" {
+		t.Fatalf("expected the delete to be pulled, got %q", text)
+	}
+	notes, _, err = aNotes.List(ctx, serverChildID, storage.LogNoteListOptions{})
+	if err != nil || len(notes) != 1 || notes[0].Text != "edited" {
+		t.Fatalf("expected the note edit to be pulled, got %v, %v", notes, err)
+	}
+}
+
+func TestSyncOffline(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t)
+	r := ts.newReplica(t)
+	entries := r.LogEntryService()
+
+	ts.down.Store(true)
+	id, err := entries.Add(ctx, models.LogEntry{Text: "offline"})
+	if err != nil {
+		t.Fatalf("add while offline: %v", err)
+	}
+	if err := r.Sync(context.Background()); err == nil {
+		t.Fatalf("expected sync to fail while offline")
+	}
+	if status := r.Status(); status.Online || status.String() != "offline, 1 pending" {
+		t.Fatalf("expected offline with 1 pending, got %q", status.String())
+	}
+	if text := texts(t, entries)[id]; text != "offline" {
+		t.Fatalf("expected the entry to be readable offline, got %q", text)
+	}
+
+	ts.down.Store(false)
+	sync(t, r)
+	if status := r.Status(); !status.Online || status.Pending != 0 {
+		t.Fatalf("expected everything pushed, got %+v", status)
+	}
+	if onServer := texts(t, ts.entries); len(onServer) != 1 {
+		t.Fatalf("expected the entry on the server, got %v", onServer)
+	}
+}
+
+func TestSyncDropsRejectedOps(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t)
+	r := ts.newReplica(t)
+	entries := r.LogEntryService()
+
+	id, err := ts.entries.Add(ctx, models.LogEntry{Text: "shared"})
+	if err != nil {
+		t.Fatalf("add on server: %v", err)
+	}
+	sync(t, r)
+
+	// the entry is purged elsewhere while a local update is pending
+	if _, err := ts.entries.Remove([]int64{id}); err != nil {
+		t.Fatalf("remove on server: %v", err)
+	}
+	if err := entries.Update(ctx, id, models.LogEntryOptional{Text: ptr("edited")}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	for i := 0; i < replica.MaxAttempts; i++ {
+		sync(t, r)
+	}
+	status := r.Status()
+	if status.Pending != 0 || status.Conflicts != 1 || status.String() != "synced, 1 conflict" {
+		t.Fatalf("expected the update dropped as a conflict, got %q", status.String())
+	}
+	if local := texts(t, entries); len(local) != 0 {
+		t.Fatalf("expected the purged entry to be removed locally, got %v", local)
+	}
+}
+
+func TestSyncRetriesServerFailures(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t)
+	r := ts.newReplica(t)
+	entries := r.LogEntryService()
+
+	// e.g. the database of the server is locked
+	ts.failAdd.Store(server.CodeInternal)
+	if _, err := entries.Add(ctx, models.LogEntry{Text: "kept"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	for i := 0; i < replica.MaxAttempts+1; i++ {
+		if err := r.Sync(ctx); err == nil {
+			t.Fatalf("expected sync to fail while the server fails")
+		}
+	}
+	if status := r.Status(); status.Pending != 1 || status.Conflicts != 0 {
+		t.Fatalf("expected the add to wait, got %+v", status)
+	}
+
+	ts.failAdd.Store(0)
+	sync(t, r)
+	if onServer := texts(t, ts.entries); len(onServer) != 1 {
+		t.Fatalf("expected the entry on the server, got %v", onServer)
+	}
+	if local := texts(t, entries); len(local) != 1 {
+		t.Fatalf("expected the entry kept locally, got %v", local)
+	}
+}
+
+func TestSyncDropsRejectedAdd(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t)
+	r := ts.newReplica(t)
+	entries := r.LogEntryService()
+
+	ts.failAdd.Store(server.CodeBadRequest)
+	parentID, err := entries.Add(ctx, models.LogEntry{Text: "refused"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := entries.Add(ctx, models.LogEntry{Text: "child", ParentID: parentID}); err != nil {
+		t.Fatalf("add child: %v", err)
+	}
+	if _, err := r.LogNoteService().Add(ctx, parentID, models.Note{Text: "note"}); err != nil {
+		t.Fatalf("add note: %v", err)
+	}
+	for i := 0; i < replica.MaxAttempts; i++ {
+		sync(t, r)
+	}
+	if status := r.Status(); status.Pending != 0 || status.Conflicts == 0 {
+		t.Fatalf("expected the ops dropped as conflicts, got %+v", status)
+	}
+	if local := texts(t, entries); len(local) != 0 {
+		t.Fatalf("expected what the add added removed locally, got %v", local)
+	}
+
+	ts.failAdd.Store(0)
+	sync(t, r)
+	if onServer := texts(t, ts.entries); len(onServer) != 0 {
+		t.Fatalf("expected nothing on the server, got %v", onServer)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
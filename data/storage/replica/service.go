@@ -0,0 +1,234 @@
+package replica
+
+import (
+	"context"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// payloads of outbox ops without a model of their own
+type moveEntry struct {
+	ParentID int64 `json:"parent_id"`
+}
+
+type purgeEntries struct {
+	DeletedBefore time.Time `json:"deleted_before"`
+}
+
+type restoreEntries struct {
+	Entries []models.LogEntry `json:"entries"`
+	Notes   []models.Note     `json:"notes"`
+}
+
+// logEntryService implements storage.LogEntryService and
+// storage.LogEntryRestorer on the local store. IDs of entries added
+// locally stay valid after the server assigned theirs.
+type logEntryService struct {
+	r *Replica
+}
+
+func (s *logEntryService) List(ctx context.Context, options storage.LogEntryListOptions) ([]models.LogEntry, int64, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	return s.r.entries.List(ctx, options)
+}
+
+func (s *logEntryService) Add(ctx context.Context, entry models.LogEntry) (int64, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, err := r.entries.NextTempID()
+	if err != nil {
+		return 0, err
+	}
+	if entry.ParentID, err = r.entries.ResolveID(entry.ParentID); err != nil {
+		return 0, err
+	}
+	if entry.PreviousID, err = r.entries.ResolveID(entry.PreviousID); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if entry.CreateTime.IsZero() {
+		entry.CreateTime = now
+	}
+	if entry.UpdateTime.IsZero() {
+		entry.UpdateTime = now
+	}
+	entry.ID = id
+	if err := r.entries.Put(entry); err != nil {
+		return 0, err
+	}
+	return id, r.record(opAddEntry, id, 0, entry)
+}
+
+func (s *logEntryService) Delete(ctx context.Context, id int64) error {
+	return s.write(id, opDeleteEntry, nil, func(id int64) error {
+		return s.r.entries.Delete(ctx, id)
+	})
+}
+
+func (s *logEntryService) Undelete(ctx context.Context, id int64) error {
+	return s.write(id, opUndeleteEntry, nil, func(id int64) error {
+		return s.r.entries.Undelete(ctx, id)
+	})
+}
+
+func (s *logEntryService) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, err := r.entries.Purge(ctx, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return n, r.record(opPurgeEntries, 0, 0, purgeEntries{DeletedBefore: deletedBefore})
+}
+
+func (s *logEntryService) Restore(ctx context.Context, entries []models.LogEntry, notes []models.Note) error {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.entries.Restore(ctx, entries, notes); err != nil {
+		return err
+	}
+	return r.record(opRestoreEntries, 0, 0, restoreEntries{Entries: entries, Notes: notes})
+}
+
+func (s *logEntryService) Update(ctx context.Context, id int64, update models.LogEntryOptional) error {
+	if update.ParentID != nil {
+		parentID, err := s.r.resolveEntry(*update.ParentID)
+		if err != nil {
+			return err
+		}
+		update.ParentID = &parentID
+	}
+	return s.write(id, opUpdateEntry, &update, func(id int64) error {
+		return s.r.entries.Update(ctx, id, update)
+	})
+}
+
+func (s *logEntryService) Move(ctx context.Context, id int64, newParentID int64) error {
+	parentID, err := s.r.resolveEntry(newParentID)
+	if err != nil {
+		return err
+	}
+	return s.write(id, opMoveEntry, moveEntry{ParentID: parentID}, func(id int64) error {
+		return s.r.entries.Move(ctx, id, parentID)
+	})
+}
+
+func (s *logEntryService) GetTree(ctx context.Context, id int64, includeHistory bool) ([]models.LogEntry, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, err := r.entries.ResolveID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.entries.GetTree(ctx, id, includeHistory)
+}
+
+// write applies a change of entry id locally and records it
+func (s *logEntryService) write(id int64, kind string, payload any, apply func(id int64) error) error {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, err := r.entries.ResolveID(id)
+	if err != nil {
+		return err
+	}
+	if err := apply(id); err != nil {
+		return err
+	}
+	return r.record(kind, id, 0, payload)
+}
+
+// logNoteService implements storage.LogNoteService on the local store
+type logNoteService struct {
+	r *Replica
+}
+
+func (s *logNoteService) List(ctx context.Context, entryID int64, options storage.LogNoteListOptions) ([]models.Note, int64, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entryID, err := r.entries.ResolveID(entryID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r.notes.List(ctx, entryID, options)
+}
+
+func (s *logNoteService) ListForEntries(ctx context.Context, entryIDs []int64) (map[int64][]models.Note, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	return s.r.notes.ListForEntries(ctx, entryIDs)
+}
+
+func (s *logNoteService) Add(ctx context.Context, entryID int64, note models.Note) (int64, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entryID, err := r.entries.ResolveID(entryID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := r.notes.NextTempID()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if note.CreateTime.IsZero() {
+		note.CreateTime = now
+	}
+	if note.UpdateTime.IsZero() {
+		note.UpdateTime = now
+	}
+	note.ID = id
+	note.EntryID = entryID
+	if err := r.notes.Put(note); err != nil {
+		return 0, err
+	}
+	return id, r.record(opAddNote, entryID, id, note)
+}
+
+func (s *logNoteService) Delete(ctx context.Context, entryID int64, noteID int64) error {
+	return s.write(entryID, noteID, opDeleteNote, nil, func(entryID int64, noteID int64) error {
+		return s.r.notes.Delete(ctx, entryID, noteID)
+	})
+}
+
+func (s *logNoteService) Update(ctx context.Context, entryID int64, noteID int64, update models.NoteOptional) error {
+	return s.write(entryID, noteID, opUpdateNote, update, func(entryID int64, noteID int64) error {
+		return s.r.notes.Update(ctx, entryID, noteID, update)
+	})
+}
+
+// write applies a change of a note locally and records it
+func (s *logNoteService) write(entryID int64, noteID int64, kind string, payload any, apply func(entryID int64, noteID int64) error) error {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entryID, err := r.entries.ResolveID(entryID)
+	if err != nil {
+		return err
+	}
+	noteID, err = r.notes.ResolveID(noteID)
+	if err != nil {
+		return err
+	}
+	if err := apply(entryID, noteID); err != nil {
+		return err
+	}
+	return r.record(kind, entryID, noteID, payload)
+}
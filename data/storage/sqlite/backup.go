@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup copies the database at filePath to dest with the online
+// backup API, so the copy is consistent even while other connections
+// write to the database
+func Backup(ctx context.Context, filePath string, dest string) error {
+	if _, err := os.Stat(filePath); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite3", "file:"+filePath+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer src.Close()
+	dst, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer dst.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer srcConn.Close()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dstDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			b, err := dstDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return fmt.Errorf("failed to copy database: %w", err)
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// Check verifies that the database at filePath is intact and of a
+// schema version New can open, without changing it
+func Check(filePath string) error {
+	if _, err := os.Stat(filePath); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", "file:"+filePath+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("failed to check integrity: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than supported version %d, please upgrade todo", version, LatestSchemaVersion())
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'log_entries'`).Scan(&n); err != nil {
+		return fmt.Errorf("failed to check tables: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("not a todo database: log_entries is missing")
+	}
+	return nil
+}
+
+// Replace swaps the database at filePath for src, dropping the
+// journal of the old one so it is not rolled back into the new one.
+// No connection to filePath should be open.
+func Replace(filePath string, src string) error {
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Remove(filePath + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(src, filePath)
+}
@@ -0,0 +1,39 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+)
+
+// ifUpdateTime extends the WHERE clause of an update with the
+// IfUpdateTime precondition. Update times are compared as the text
+// formatTime writes, to the nanosecond the caller read back: datetime()
+// would drop what is below the second.
+func ifUpdateTime(where string, args []interface{}, updateTime *time.Time) (string, []interface{}) {
+	if updateTime == nil {
+		return where, args
+	}
+	return where + " AND update_time = ?", append(args, formatTime(*updateTime))
+}
+
+// conflictOrNotFound tells why an update of the row of table matching
+// where changed nothing: a *storage.ConflictError if the row exists,
+// notFound otherwise
+func conflictOrNotFound(q queryer, kind string, id int64, table string, where string, args []interface{}, notFound error) error {
+	var updateTime string
+	err := q.QueryRow(fmt.Sprintf("SELECT update_time FROM %s WHERE %s", table, where), args...).Scan(&updateTime)
+	if err == sql.ErrNoRows {
+		return notFound
+	}
+	if err != nil {
+		return err
+	}
+	t, err := tryParseTime(updateTime)
+	if err != nil {
+		return fmt.Errorf("failed to parse update time: %w", err)
+	}
+	return &storage.ConflictError{Kind: kind, ID: id, UpdateTime: t}
+}
@@ -0,0 +1,26 @@
+//go:build sqlite_fts5
+
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchIndexWithFTS5(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if !store.fts {
+		t.Fatal("expected the full-text index with the sqlite_fts5 tag")
+	}
+	triggers, err := store.searchTriggerNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(triggers) != len(searchTriggers) {
+		t.Fatalf("expected %d triggers keeping the index, got %v", len(searchTriggers), triggers)
+	}
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+type GroupSQLiteStore struct {
+	*SQLiteStore
+}
+
+func NewGroupService(filePath string) (storage.GroupService, error) {
+	store, err := New(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &GroupSQLiteStore{SQLiteStore: store}, nil
+}
+
+func (gs *GroupSQLiteStore) ListGroups(ctx context.Context) ([]models.Group, error) {
+	rows, err := gs.db.QueryContext(ctx, `SELECT id, name, position, create_time, update_time FROM log_groups ORDER BY position ASC, id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		var group models.Group
+		var createTime, updateTime string
+		if err := rows.Scan(&group.ID, &group.Name, &group.Position, &createTime, &updateTime); err != nil {
+			return nil, err
+		}
+		if group.CreateTime, err = tryParseTime(createTime); err != nil {
+			return nil, err
+		}
+		if group.UpdateTime, err = tryParseTime(updateTime); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func (gs *GroupSQLiteStore) AddGroup(ctx context.Context, group models.Group) (int64, error) {
+	if group.Name == "" {
+		return 0, fmt.Errorf("group name cannot be empty")
+	}
+	now := time.Now()
+	// new groups go last unless placed explicitly
+	result, err := gs.db.ExecContext(ctx, `INSERT INTO log_groups (name, position, create_time, update_time)
+		VALUES (?, CASE WHEN ? != 0 THEN ? ELSE (SELECT COALESCE(MAX(position), 0) + 1 FROM log_groups) END, ?, ?)`,
+		group.Name, group.Position, group.Position, formatTime(now), formatTime(now))
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert group: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+func (gs *GroupSQLiteStore) UpdateGroup(ctx context.Context, id int64, update models.GroupOptional) error {
+	if update.Name != nil && *update.Name == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+	result, err := gs.db.ExecContext(ctx, `UPDATE log_groups SET name = COALESCE(?, name), position = COALESCE(?, position), update_time = ? WHERE id = ?`,
+		update.Name, update.Position, formatTime(time.Now()), id)
+	if err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return storage.NotFoundf("group with id %d not found", id)
+	}
+	return nil
+}
+
+func (gs *GroupSQLiteStore) DeleteGroup(ctx context.Context, id int64) error {
+	tx, err := gs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM log_groups WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return storage.NotFoundf("group with id %d not found", id)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM log_group_members WHERE group_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete group members: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (gs *GroupSQLiteStore) ListMemberships(ctx context.Context) ([]models.GroupMembership, error) {
+	rows, err := gs.db.QueryContext(ctx, `SELECT entry_id, group_id FROM log_group_members ORDER BY entry_id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []models.GroupMembership
+	for rows.Next() {
+		var m models.GroupMembership
+		if err := rows.Scan(&m.EntryID, &m.GroupID); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+func (gs *GroupSQLiteStore) SetMembership(ctx context.Context, membership models.GroupMembership) error {
+	_, err := gs.db.ExecContext(ctx, `INSERT INTO log_group_members (entry_id, group_id) VALUES (?, ?)
+		ON CONFLICT(entry_id) DO UPDATE SET group_id = excluded.group_id`, membership.EntryID, membership.GroupID)
+	if err != nil {
+		return fmt.Errorf("failed to set group member: %w", err)
+	}
+	return nil
+}
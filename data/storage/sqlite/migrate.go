@@ -0,0 +1,343 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Migration upgrades the schema from Version-1 to Version.
+// Migrations are append-only: never edit one that has been released,
+// add a new one instead.
+type Migration struct {
+	Version int
+	Name    string
+	up      func(tx *sql.Tx) error
+}
+
+var migrations = []Migration{
+	{Version: 1, Name: "initial schema", up: execAll(
+		`CREATE TABLE IF NOT EXISTS log_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			text TEXT NOT NULL,
+			done BOOLEAN NOT NULL DEFAULT 0,
+			done_time DATETIME,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL,
+			adjusted_top_time INTEGER NOT NULL DEFAULT 0,
+			highlight_level INTEGER NOT NULL DEFAULT 0,
+			collapsed BOOLEAN NOT NULL DEFAULT 0,
+			parent_id INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS notes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entry_id INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL,
+			FOREIGN KEY (entry_id) REFERENCES log_entries(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS happenings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			content TEXT NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS states (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT NOT NULL DEFAULT '',
+			parent_state_record_id INTEGER NOT NULL DEFAULT 0,
+			score REAL NOT NULL DEFAULT 0.0,
+			scope TEXT NOT NULL DEFAULT '',
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS state_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			state_record_id INTEGER NOT NULL,
+			record_data TEXT NOT NULL DEFAULT '',
+			delta_score REAL NOT NULL DEFAULT 0.0,
+			description TEXT NOT NULL DEFAULT '',
+			details TEXT NOT NULL DEFAULT '',
+			scope TEXT NOT NULL DEFAULT '',
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL,
+			FOREIGN KEY (state_record_id) REFERENCES states(id) ON DELETE CASCADE
+		)`,
+	)},
+	{Version: 2, Name: "due and scheduled time", up: execAll(
+		`ALTER TABLE log_entries ADD COLUMN due_time DATETIME`,
+		`ALTER TABLE log_entries ADD COLUMN scheduled_time DATETIME`,
+	)},
+	{Version: 3, Name: "recurring entries", up: execAll(
+		`ALTER TABLE log_entries ADD COLUMN repeat TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE log_entries ADD COLUMN previous_id INTEGER NOT NULL DEFAULT 0`,
+	)},
+	{Version: 4, Name: "entry tags", up: func(tx *sql.Tx) error {
+		err := execAll(
+			`CREATE TABLE entry_tags (
+				entry_id INTEGER NOT NULL,
+				tag TEXT NOT NULL,
+				PRIMARY KEY (entry_id, tag)
+			)`,
+			`CREATE INDEX idx_entry_tags_tag ON entry_tags(tag)`,
+		)(tx)
+		if err != nil {
+			return err
+		}
+		return backfillTags(tx)
+	}},
+	{Version: 5, Name: "groups", up: func(tx *sql.Tx) error {
+		err := execAll(
+			`CREATE TABLE log_groups (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				position INTEGER NOT NULL DEFAULT 0,
+				create_time DATETIME NOT NULL,
+				update_time DATETIME NOT NULL
+			)`,
+			`CREATE TABLE log_group_members (
+				entry_id INTEGER PRIMARY KEY,
+				group_id INTEGER NOT NULL
+			)`,
+		)(tx)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Format(migration5TimeLayout)
+		for i, name := range migration5Groups {
+			_, err := tx.Exec(`INSERT INTO log_groups (id, name, position, create_time, update_time) VALUES (?, ?, ?, ?, ?)`,
+				i+1, name, i+1, now, now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{Version: 6, Name: "trash", up: execAll(
+		`ALTER TABLE log_entries ADD COLUMN deleted_time DATETIME`,
+		`CREATE INDEX idx_log_entries_deleted_time ON log_entries(deleted_time)`,
+	)},
+	{Version: 7, Name: "replica", up: execAll(
+		`CREATE TABLE replica_outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			entry_id INTEGER NOT NULL,
+			note_id INTEGER NOT NULL DEFAULT 0,
+			payload TEXT NOT NULL DEFAULT '',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			create_time DATETIME NOT NULL
+		)`,
+		`CREATE TABLE replica_ids (
+			kind TEXT NOT NULL,
+			temp_id INTEGER NOT NULL,
+			id INTEGER NOT NULL,
+			PRIMARY KEY (kind, temp_id)
+		)`,
+		`CREATE TABLE replica_meta (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)`,
+	)},
+	{Version: 8, Name: "revisions", up: execAll(
+		`CREATE TABLE revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entry_id INTEGER NOT NULL,
+			note_id INTEGER NOT NULL DEFAULT 0,
+			text TEXT NOT NULL,
+			done BOOLEAN NOT NULL DEFAULT 0,
+			done_time DATETIME,
+			parent_id INTEGER NOT NULL DEFAULT 0,
+			highlight_level INTEGER NOT NULL DEFAULT 0,
+			change_time DATETIME NOT NULL
+		)`,
+		`CREATE INDEX idx_revisions_entry_id ON revisions(entry_id)`,
+		`CREATE INDEX idx_revisions_change_time ON revisions(change_time)`,
+	)},
+}
+
+// What released migrations depend on is copied here, as it was when
+// they were released, so that changing the live code does not change
+// what they do.
+var (
+	// migration4TagPattern is models.ParseTags as of migration 4
+	migration4TagPattern = regexp.MustCompile(`(?:^|\s)#([\p{L}_][\p{L}\p{N}_\-/]*)`)
+	// migration5Groups are models.DefaultGroups as of migration 5
+	migration5Groups = []string{"Deadline", "WorkPerf", "LifeEnhance", "WorkHack", "LifeHack"}
+	// migration5TimeLayout is the layout of formatTime as of migration 5
+	migration5TimeLayout = "2006-01-02 15:04:05"
+)
+
+// backfillTags indexes the tags of entries written before entry_tags existed
+func backfillTags(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, text FROM log_entries`)
+	if err != nil {
+		return err
+	}
+	texts := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		texts[id] = text
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, text := range texts {
+		seen := make(map[string]bool)
+		for _, m := range migration4TagPattern.FindAllStringSubmatch(text, -1) {
+			tag := strings.ToLower(m[1])
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			if _, err := tx.Exec(`INSERT INTO entry_tags (entry_id, tag) VALUES (?, ?)`, id, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func execAll(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// LatestSchemaVersion is the version New migrates databases to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// PendingMigrations reports the schema version of the database at filePath
+// and the migrations New would apply to it, without changing the file.
+// Databases created before versioning have no schema_version table and
+// report version 0.
+func PendingMigrations(filePath string) (int, []Migration, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return 0, migrations, nil
+		}
+		return 0, nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+filePath+"?mode=ro")
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, nil, err
+	}
+	return version, pendingAfter(version), nil
+}
+
+func pendingAfter(version int) []Migration {
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func schemaVersion(db queryer) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check schema version: %w", err)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	var version int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrate applies pending migrations in order, each in its own
+// transaction together with the version bump
+func (s *SQLiteStore) migrate() ([]Migration, error) {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return nil, fmt.Errorf("failed to create schema_version: %w", err)
+	}
+	version, err := schemaVersion(s.db)
+	if err != nil {
+		return nil, err
+	}
+	if version > LatestSchemaVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than supported version %d, please upgrade todo", version, LatestSchemaVersion())
+	}
+
+	var applied []Migration
+	for _, m := range pendingAfter(version) {
+		if err := s.applyMigration(m); err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func (s *SQLiteStore) applyMigration(m Migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// another process may have migrated in the meantime
+	version, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if version >= m.Version {
+		return nil
+	}
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM schema_version`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, m.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Migrate opens the database at filePath, applies pending migrations
+// and returns the ones applied
+func Migrate(filePath string) ([]Migration, error) {
+	db, err := sql.Open("sqlite3", filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	store := &SQLiteStore{db: db}
+	defer store.Close()
+	return store.migrate()
+}
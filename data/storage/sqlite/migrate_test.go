@@ -0,0 +1,173 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+// createFixture builds a database as an older release would have left it.
+// Version 0 is a database created before schema_version existed.
+func createFixture(t *testing.T, file string, version int) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	upTo := version
+	if version == 0 {
+		upTo = 1
+	}
+	for _, m := range migrations[:upTo] {
+		if err := m.up(tx); err != nil {
+			t.Fatalf("fixture migration %d: %v", m.Version, err)
+		}
+	}
+	if version > 0 {
+		if _, err := tx.Exec(`CREATE TABLE schema_version (version INTEGER NOT NULL)`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// columns present since version 1
+	seed := []string{
+		`INSERT INTO log_entries (id, text, create_time, update_time) VALUES (1, 'parent', '2025-01-01 10:00:00', '2025-01-01 10:00:00')`,
+		`INSERT INTO log_entries (id, text, create_time, update_time, parent_id) VALUES (2, 'child #work', '2025-01-02 10:00:00', '2025-01-02 10:00:00', 1)`,
+		`INSERT INTO notes (entry_id, text, create_time, update_time) VALUES (2, 'a note', '2025-01-02 11:00:00', '2025-01-02 11:00:00')`,
+		`INSERT INTO happenings (content, create_time, update_time) VALUES ('happened', '2025-01-03 10:00:00', '2025-01-03 10:00:00')`,
+	}
+	// releases with entry_tags indexed tags on write
+	if version >= 4 {
+		seed = append(seed, `INSERT INTO entry_tags (entry_id, tag) VALUES (2, 'work')`)
+	}
+	for _, stmt := range seed {
+		if _, err := tx.Exec(stmt); err != nil {
+			t.Fatalf("seed fixture: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgradeFromEveryVersion(t *testing.T) {
+	for version := 0; version <= LatestSchemaVersion(); version++ {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "todo.db")
+			createFixture(t, file, version)
+
+			current, pending, err := PendingMigrations(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current != version {
+				t.Fatalf("expected version %d, got %d", version, current)
+			}
+			if len(pending) != LatestSchemaVersion()-version {
+				t.Fatalf("expected %d pending migrations, got %d", LatestSchemaVersion()-version, len(pending))
+			}
+
+			// dry run must not touch the file
+			current, _, err = PendingMigrations(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current != version {
+				t.Fatalf("dry run changed version to %d", current)
+			}
+
+			store, err := New(file)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer store.Close()
+
+			upgraded, err := schemaVersion(store.db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if upgraded != LatestSchemaVersion() {
+				t.Fatalf("expected version %d after upgrade, got %d", LatestSchemaVersion(), upgraded)
+			}
+
+			entries, total, err := (&LogEntrySQLiteStore{SQLiteStore: store}).List(context.Background(), storage.LogEntryListOptions{IncludeHistory: true})
+			if err != nil {
+				t.Fatalf("list entries: %v", err)
+			}
+			if total != 2 || len(entries) != 2 {
+				t.Fatalf("expected 2 entries to survive the upgrade, got %d", total)
+			}
+			tagged, _, err := (&LogEntrySQLiteStore{SQLiteStore: store}).List(context.Background(), storage.LogEntryListOptions{IncludeHistory: true, Tags: []string{"#Work"}})
+			if err != nil {
+				t.Fatalf("list tagged entries: %v", err)
+			}
+			if len(tagged) != 1 || tagged[0].ID != 2 {
+				t.Fatalf("expected the child to be indexed under #work, got %+v", tagged)
+			}
+			notes, err := (&LogNoteSQLiteStore{SQLiteStore: store}).ListForEntries(context.Background(), []int64{2})
+			if err != nil {
+				t.Fatalf("list notes: %v", err)
+			}
+			if len(notes[2]) != 1 {
+				t.Fatalf("expected the note to survive the upgrade, got %v", notes)
+			}
+			groups, err := (&GroupSQLiteStore{SQLiteStore: store}).ListGroups(context.Background())
+			if err != nil {
+				t.Fatalf("list groups: %v", err)
+			}
+			if len(groups) != len(models.DefaultGroups) || groups[0].ID != 1 || groups[0].Name != "Deadline" {
+				t.Fatalf("expected the default groups after the upgrade, got %+v", groups)
+			}
+			_, total, err = (&HappeningSQLiteStore{SQLiteStore: store}).List(storage.HappeningListOptions{})
+			if err != nil {
+				t.Fatalf("list happenings: %v", err)
+			}
+			if total != 1 {
+				t.Fatalf("expected the happening to survive the upgrade, got %d", total)
+			}
+
+			// reopening is a no-op
+			applied, err := store.migrate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(applied) != 0 {
+				t.Fatalf("expected no migrations on reopen, got %d", len(applied))
+			}
+		})
+	}
+}
+
+func TestRefuseNewerSchema(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todo.db")
+	createFixture(t, file, LatestSchemaVersion())
+
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE schema_version SET version = ?`, LatestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, err := New(file); err == nil {
+		t.Fatalf("expected opening a newer schema to fail")
+	}
+}
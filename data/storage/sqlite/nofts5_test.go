@@ -0,0 +1,26 @@
+//go:build !sqlite_fts5
+
+package sqlite
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// TestSearchWithFTS5 runs the search tests again built with FTS5, so
+// a plain go test covers the ranked search as well as the scan
+func TestSearchWithFTS5(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds sqlite with FTS5")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	cmd := exec.Command(goBin, "test", "-tags", "sqlite_fts5", "-run", "^(TestSearch|TestSearchIndexWithFTS5)$",
+		"github.com/xhd2015/todo/data/storage/sqlite", "github.com/xhd2015/todo/data")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go test -tags sqlite_fts5: %v\n%s", err, out)
+	}
+}
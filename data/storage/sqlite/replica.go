@@ -0,0 +1,311 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/todo/models"
+)
+
+// The tables of migration 7 keep the bookkeeping of a local replica
+// of a server, see package replica. Entries and notes added locally
+// get negative temporary IDs until the server assigns theirs.
+
+// OutboxOp is a local change of an entry or note not pushed yet
+type OutboxOp struct {
+	ID   int64
+	Kind string
+	// EntryID and NoteID are the changed entry and note,
+	// NoteID is 0 for entry changes
+	EntryID int64
+	NoteID  int64
+	// Payload is the JSON of the change
+	Payload string
+	// Attempts counts the pushes the server rejected
+	Attempts   int
+	CreateTime time.Time
+}
+
+const (
+	tempIDKindEntry = "entry"
+	tempIDKindNote  = "note"
+)
+
+// AddOutboxOp appends op to the outbox
+func (s *SQLiteStore) AddOutboxOp(op OutboxOp) (int64, error) {
+	if op.CreateTime.IsZero() {
+		op.CreateTime = time.Now()
+	}
+	result, err := s.db.Exec(`INSERT INTO replica_outbox (kind, entry_id, note_id, payload, create_time) VALUES (?, ?, ?, ?, ?)`,
+		op.Kind, op.EntryID, op.NoteID, op.Payload, formatTime(op.CreateTime))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ListOutboxOps lists the outbox, oldest first
+func (s *SQLiteStore) ListOutboxOps() ([]OutboxOp, error) {
+	rows, err := s.db.Query(`SELECT id, kind, entry_id, note_id, payload, attempts, create_time FROM replica_outbox ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ops []OutboxOp
+	for rows.Next() {
+		var op OutboxOp
+		var createTime string
+		if err := rows.Scan(&op.ID, &op.Kind, &op.EntryID, &op.NoteID, &op.Payload, &op.Attempts, &createTime); err != nil {
+			return nil, err
+		}
+		if op.CreateTime, err = tryParseTime(createTime); err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, rows.Err()
+}
+
+// DeleteOutboxOp removes a pushed or dropped op
+func (s *SQLiteStore) DeleteOutboxOp(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM replica_outbox WHERE id = ?`, id)
+	return err
+}
+
+// FailOutboxOp counts a rejected push of op id
+func (s *SQLiteStore) FailOutboxOp(id int64) error {
+	_, err := s.db.Exec(`UPDATE replica_outbox SET attempts = attempts + 1 WHERE id = ?`, id)
+	return err
+}
+
+// GetMeta returns the value of key, empty if unset
+func (s *SQLiteStore) GetMeta(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM replica_meta WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func (s *SQLiteStore) SetMeta(key string, value string) error {
+	_, err := s.db.Exec(`INSERT INTO replica_meta (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+// nextTempID returns a negative ID of table never used before,
+// remapped temporary IDs included
+func (s *SQLiteStore) nextTempID(table string, kind string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT MIN(0,
+			COALESCE((SELECT MIN(id) FROM `+table+`), 0),
+			COALESCE((SELECT MIN(temp_id) FROM replica_ids WHERE kind = ?), 0)) - 1`, kind).Scan(&id)
+	return id, err
+}
+
+// resolveTempID returns the ID the server assigned to tempID,
+// or id itself if it is not a remapped temporary ID
+func (s *SQLiteStore) resolveTempID(kind string, id int64) (int64, error) {
+	if id >= 0 {
+		return id, nil
+	}
+	var remote int64
+	err := s.db.QueryRow(`SELECT id FROM replica_ids WHERE kind = ? AND temp_id = ?`, kind, id).Scan(&remote)
+	if err == sql.ErrNoRows {
+		return id, nil
+	}
+	return remote, err
+}
+
+// NextTempID returns a temporary ID for an entry added locally
+func (les *LogEntrySQLiteStore) NextTempID() (int64, error) {
+	return les.nextTempID("log_entries", tempIDKindEntry)
+}
+
+// ResolveID returns the ID the server assigned to a temporary ID
+// remapped by RemapID, other IDs are returned as they are
+func (les *LogEntrySQLiteStore) ResolveID(id int64) (int64, error) {
+	return les.resolveTempID(tempIDKindEntry, id)
+}
+
+// Put inserts the entries under their IDs, replacing existing ones
+func (les *LogEntrySQLiteStore) Put(entries ...models.LogEntry) error {
+	tx, err := les.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO log_entries (id, text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id, due_time, scheduled_time, repeat, previous_id, deleted_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.ID, entry.Text, entry.Done, formatOptionalTime(entry.DoneTime),
+			formatTime(entry.CreateTime),
+			formatTime(entry.UpdateTime),
+			entry.AdjustedTopTime,
+			entry.HighlightLevel,
+			entry.Collapsed,
+			entry.ParentID,
+			formatOptionalTime(entry.DueTime),
+			formatOptionalTime(entry.ScheduledTime),
+			entry.Repeat,
+			entry.PreviousID,
+			formatOptionalTime(entry.DeletedTime))
+		if err != nil {
+			return fmt.Errorf("failed to put entry %d: %w", entry.ID, err)
+		}
+		if err := setEntryTags(tx, entry.ID, entry.Text); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Remove permanently deletes the entries with their notes, unlike
+// Purge regardless of whether they are in trash, and tells whether
+// any of them was there
+func (les *LogEntrySQLiteStore) Remove(ids []int64) (bool, error) {
+	if len(ids) == 0 {
+		return false, nil
+	}
+	in, args := inIDs(ids)
+
+	tx, err := les.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"notes", "entry_tags", "log_group_members"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE entry_id IN `+in, args...); err != nil {
+			return false, err
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM log_entries WHERE id IN `+in, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, tx.Commit()
+}
+
+func inIDs(ids []int64) (string, []any) {
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// RemapID moves the entry added locally under tempID to the ID the
+// server assigned, along with everything referring to it
+func (les *LogEntrySQLiteStore) RemapID(tempID int64, id int64) error {
+	tx, err := les.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// a copy pulled meanwhile is replaced
+	if _, err := tx.Exec(`DELETE FROM log_entries WHERE id = ?`, id); err != nil {
+		return err
+	}
+	statements := []string{
+		`UPDATE log_entries SET id = ? WHERE id = ?`,
+		`UPDATE log_entries SET parent_id = ? WHERE parent_id = ?`,
+		`UPDATE log_entries SET previous_id = ? WHERE previous_id = ?`,
+		`UPDATE notes SET entry_id = ? WHERE entry_id = ?`,
+		`UPDATE entry_tags SET entry_id = ? WHERE entry_id = ?`,
+		`UPDATE log_group_members SET entry_id = ? WHERE entry_id = ?`,
+		`UPDATE replica_outbox SET entry_id = ? WHERE entry_id = ?`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, id, tempID); err != nil {
+			return fmt.Errorf("failed to remap entry %d to %d: %w", tempID, id, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO replica_ids (kind, temp_id, id) VALUES (?, ?, ?)`, tempIDKindEntry, tempID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NextTempID returns a temporary ID for a note added locally
+func (lns *LogNoteSQLiteStore) NextTempID() (int64, error) {
+	return lns.nextTempID("notes", tempIDKindNote)
+}
+
+// ResolveID returns the ID the server assigned to a temporary ID
+// remapped by RemapID, other IDs are returned as they are
+func (lns *LogNoteSQLiteStore) ResolveID(id int64) (int64, error) {
+	return lns.resolveTempID(tempIDKindNote, id)
+}
+
+// Put inserts the notes under their IDs, replacing existing ones
+func (lns *LogNoteSQLiteStore) Put(notes ...models.Note) error {
+	tx, err := lns.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, note := range notes {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO notes (id, entry_id, text, create_time, update_time) VALUES (?, ?, ?, ?, ?)`,
+			note.ID, note.EntryID, note.Text, formatTime(note.CreateTime), formatTime(note.UpdateTime))
+		if err != nil {
+			return fmt.Errorf("failed to put note %d: %w", note.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Remove permanently deletes the notes, and tells whether any of them
+// was there
+func (lns *LogNoteSQLiteStore) Remove(ids []int64) (bool, error) {
+	if len(ids) == 0 {
+		return false, nil
+	}
+	in, args := inIDs(ids)
+	result, err := lns.db.Exec(`DELETE FROM notes WHERE id IN `+in, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RemapID moves the note added locally under tempID to the ID the
+// server assigned
+func (lns *LogNoteSQLiteStore) RemapID(tempID int64, id int64) error {
+	tx, err := lns.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM notes WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE notes SET id = ? WHERE id = ?`, id, tempID); err != nil {
+		return fmt.Errorf("failed to remap note %d to %d: %w", tempID, id, err)
+	}
+	if _, err := tx.Exec(`UPDATE replica_outbox SET note_id = ? WHERE note_id = ?`, id, tempID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO replica_ids (kind, temp_id, id) VALUES (?, ?, ?)`, tempIDKindNote, tempID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
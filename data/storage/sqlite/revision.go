@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+type RevisionSQLiteStore struct {
+	*SQLiteStore
+}
+
+func NewRevisionService(filePath string) (storage.RevisionService, error) {
+	store, err := New(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &RevisionSQLiteStore{SQLiteStore: store}, nil
+}
+
+func (rs *RevisionSQLiteStore) ListRevisions(ctx context.Context, options storage.RevisionListOptions) ([]models.Revision, error) {
+	var whereClause []string
+	var args []any
+	if options.EntryID != 0 {
+		whereClause = append(whereClause, "entry_id = ?")
+		args = append(args, options.EntryID)
+	}
+	if !options.ChangedAfter.IsZero() {
+		whereClause = append(whereClause, "datetime(change_time) > datetime(?)")
+		args = append(args, formatTime(options.ChangedAfter))
+	}
+	where := ""
+	if len(whereClause) > 0 {
+		where = "WHERE " + strings.Join(whereClause, " AND ")
+	}
+
+	rows, err := rs.db.QueryContext(ctx, `SELECT id, entry_id, note_id, text, done, done_time, parent_id, highlight_level, change_time
+		FROM revisions `+where+` ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.Revision
+	for rows.Next() {
+		var revision models.Revision
+		var doneTime *string
+		var changeTime string
+		err := rows.Scan(&revision.ID, &revision.EntryID, &revision.NoteID, &revision.Text, &revision.Done, &doneTime,
+			&revision.ParentID, &revision.HighlightLevel, &changeTime)
+		if err != nil {
+			return nil, err
+		}
+		if revision.DoneTime, err = tryParseOptionalTime(doneTime); err != nil {
+			return nil, err
+		}
+		if revision.ChangeTime, err = tryParseTime(changeTime); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// recordRevision keeps before as a revision, unless the change to
+// after left the fields revisions keep as they were
+func recordRevision(db execer, before models.Revision, after models.Revision) error {
+	if !models.RevisionChanged(before, after) {
+		return nil
+	}
+	_, err := db.Exec(`INSERT INTO revisions (entry_id, note_id, text, done, done_time, parent_id, highlight_level, change_time)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		before.EntryID, before.NoteID, before.Text, before.Done, formatOptionalTime(before.DoneTime),
+		before.ParentID, before.HighlightLevel, formatTime(before.ChangeTime))
+	if err != nil {
+		return fmt.Errorf("failed to record revision: %w", err)
+	}
+	return nil
+}
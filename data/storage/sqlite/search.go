@@ -0,0 +1,275 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/internal/query"
+	"github.com/xhd2015/todo/models"
+)
+
+// The full-text index needs SQLite built with FTS5, which go-sqlite3
+// only does with the sqlite_fts5 build tag. Since that depends on the
+// binary rather than the database, the index is set up on open instead
+// of by a migration, and searching falls back to a scan without it.
+//
+// search_index holds a row per entry at rowid 2*id, with its notes
+// joined, and a row per happening at rowid 2*id+1.
+var searchTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS search_index_entry_insert AFTER INSERT ON log_entries BEGIN
+		INSERT INTO search_index (rowid, text, notes) VALUES (new.id * 2, new.text, '');
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_index_entry_update AFTER UPDATE OF text ON log_entries BEGIN
+		UPDATE search_index SET text = new.text WHERE rowid = new.id * 2;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_index_entry_delete AFTER DELETE ON log_entries BEGIN
+		DELETE FROM search_index WHERE rowid = old.id * 2;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_index_note_insert AFTER INSERT ON notes BEGIN
+		UPDATE search_index SET notes = ` + entryNotesSQL("new.entry_id") + ` WHERE rowid = new.entry_id * 2;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_index_note_update AFTER UPDATE ON notes BEGIN
+		UPDATE search_index SET notes = ` + entryNotesSQL("old.entry_id") + ` WHERE rowid = old.entry_id * 2;
+		UPDATE search_index SET notes = ` + entryNotesSQL("new.entry_id") + ` WHERE rowid = new.entry_id * 2;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_index_note_delete AFTER DELETE ON notes BEGIN
+		UPDATE search_index SET notes = ` + entryNotesSQL("old.entry_id") + ` WHERE rowid = old.entry_id * 2;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_index_happening_insert AFTER INSERT ON happenings BEGIN
+		INSERT INTO search_index (rowid, text, notes) VALUES (new.id * 2 + 1, new.content, '');
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_index_happening_update AFTER UPDATE OF content ON happenings BEGIN
+		UPDATE search_index SET text = new.content WHERE rowid = new.id * 2 + 1;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS search_index_happening_delete AFTER DELETE ON happenings BEGIN
+		DELETE FROM search_index WHERE rowid = old.id * 2 + 1;
+	END`,
+}
+
+func entryNotesSQL(entryID string) string {
+	return `(SELECT COALESCE(group_concat(text, char(10)), '') FROM notes WHERE entry_id = ` + entryID + `)`
+}
+
+// ensureSearchIndex creates and fills search_index when FTS5 is
+// available. Without it, the triggers of an earlier FTS5 build are
+// dropped as every write would fail on them, and the index is rebuilt
+// once FTS5 is back.
+func (s *SQLiteStore) ensureSearchIndex() error {
+	var available bool
+	if err := s.db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available); err != nil {
+		return err
+	}
+
+	triggers, err := s.searchTriggerNames()
+	if err != nil {
+		return err
+	}
+	if !available {
+		for _, name := range triggers {
+			if _, err := s.db.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	s.fts = true
+	if len(triggers) == len(searchTriggers) {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = execAll(
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(text, notes, tokenize = 'unicode61 remove_diacritics 0')`,
+		`DELETE FROM search_index`,
+		`INSERT INTO search_index (rowid, text, notes) SELECT id * 2, text, `+entryNotesSQL("log_entries.id")+` FROM log_entries`,
+		`INSERT INTO search_index (rowid, text, notes) SELECT id * 2 + 1, content, '' FROM happenings`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+	if err := execAll(searchTriggers...)(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) searchTriggerNames() ([]string, error) {
+	rows, err := s.db.Query(`SELECT name FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'search_index_%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+type SearchSQLiteStore struct {
+	*SQLiteStore
+}
+
+func NewSearchService(filePath string) (storage.SearchService, error) {
+	store, err := New(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchSQLiteStore{SQLiteStore: store}, nil
+}
+
+func (ss *SearchSQLiteStore) Search(ctx context.Context, options storage.SearchOptions) ([]models.SearchResult, error) {
+	q, err := query.Parse(options.Query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	limit := options.Limit
+	if limit <= 0 {
+		limit = storage.DefaultSearchLimit
+	}
+	// a query of qualifiers only has nothing to MATCH
+	if !ss.fts || q.Expr == nil {
+		return ss.scan(ctx, q, limit)
+	}
+
+	rows, err := ss.db.QueryContext(ctx, `SELECT s.id, s.rank, s.snippet, s.note_snippet,
+			e.text, e.done, e.create_time, h.content, h.create_time
+		FROM (
+			SELECT rowid AS id, -bm25(search_index, 2.0, 1.0) AS rank,
+				snippet(search_index, 0, ?, ?, '…', ?) AS snippet,
+				snippet(search_index, 1, ?, ?, '…', ?) AS note_snippet
+			FROM search_index WHERE search_index MATCH ?
+		) s
+		LEFT JOIN log_entries e ON s.id % 2 = 0 AND e.id = s.id / 2 AND e.deleted_time IS NULL
+		LEFT JOIN happenings h ON s.id % 2 = 1 AND h.id = s.id / 2
+		ORDER BY s.rank DESC`,
+		models.HighlightStart, models.HighlightEnd, query.SnippetWords,
+		models.HighlightStart, models.HighlightEnd, query.SnippetWords,
+		q.FTS())
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		var rowID int64
+		var result models.SearchResult
+		var entryText, entryCreateTime, content, happeningCreateTime *string
+		var done *bool
+		err := rows.Scan(&rowID, &result.Score, &result.Snippet, &result.NoteSnippet,
+			&entryText, &done, &entryCreateTime, &content, &happeningCreateTime)
+		if err != nil {
+			return nil, err
+		}
+		createTime := happeningCreateTime
+		result.ID = rowID / 2
+		switch {
+		case rowID%2 == 0 && entryText != nil:
+			result.Kind = models.SearchResultKind_Entry
+			result.Text = *entryText
+			result.Done = *done
+			createTime = entryCreateTime
+		case rowID%2 == 1 && content != nil:
+			result.Kind = models.SearchResultKind_Happening
+			result.Text = *content
+		default:
+			continue
+		}
+		if result.CreateTime, err = tryParseTime(*createTime); err != nil {
+			return nil, err
+		}
+		if !q.Keep(result.Kind, result.Done, result.CreateTime) {
+			continue
+		}
+		// snippet returns the column's text even without a match there
+		if result.Snippet == models.StripHighlights(result.Snippet) {
+			result.Snippet = ""
+		}
+		if result.NoteSnippet == models.StripHighlights(result.NoteSnippet) {
+			result.NoteSnippet = ""
+		}
+		results = append(results, result)
+		if len(results) == limit {
+			break
+		}
+	}
+	return results, rows.Err()
+}
+
+// scan matches every entry and happening without the index
+func (ss *SearchSQLiteStore) scan(ctx context.Context, q *query.Query, limit int) ([]models.SearchResult, error) {
+	var candidates []query.Candidate
+	index := make(map[int64]int)
+
+	rows, err := ss.db.QueryContext(ctx, `SELECT id, text, done, create_time FROM log_entries WHERE deleted_time IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search entries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := query.Candidate{Kind: models.SearchResultKind_Entry}
+		var createTime string
+		if err := rows.Scan(&c.ID, &c.Text, &c.Done, &createTime); err != nil {
+			return nil, err
+		}
+		if c.CreateTime, err = tryParseTime(createTime); err != nil {
+			return nil, err
+		}
+		index[c.ID] = len(candidates)
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	noteRows, err := ss.db.QueryContext(ctx, `SELECT entry_id, text FROM notes ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search notes: %w", err)
+	}
+	defer noteRows.Close()
+	for noteRows.Next() {
+		var entryID int64
+		var text string
+		if err := noteRows.Scan(&entryID, &text); err != nil {
+			return nil, err
+		}
+		if i, ok := index[entryID]; ok {
+			candidates[i].Notes = append(candidates[i].Notes, text)
+		}
+	}
+	if err := noteRows.Err(); err != nil {
+		return nil, err
+	}
+
+	happeningRows, err := ss.db.QueryContext(ctx, `SELECT id, content, create_time FROM happenings`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search happenings: %w", err)
+	}
+	defer happeningRows.Close()
+	for happeningRows.Next() {
+		c := query.Candidate{Kind: models.SearchResultKind_Happening}
+		var createTime string
+		if err := happeningRows.Scan(&c.ID, &c.Text, &createTime); err != nil {
+			return nil, err
+		}
+		if c.CreateTime, err = tryParseTime(createTime); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	if err := happeningRows.Err(); err != nil {
+		return nil, err
+	}
+	return q.Search(candidates, limit), nil
+}
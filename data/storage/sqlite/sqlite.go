@@ -14,6 +14,8 @@ import (
 
 type SQLiteStore struct {
 	db *sql.DB
+	// fts tells whether search_index is available, see ensureSearchIndex
+	fts bool
 }
 
 type LogEntrySQLiteStore struct {
@@ -40,98 +42,72 @@ func New(filePath string) (*SQLiteStore, error) {
 
 	store := &SQLiteStore{db: db}
 
-	if err := store.createTables(); err != nil {
+	if _, err := store.migrate(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err := store.ensureSearchIndex(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set up search index: %w", err)
 	}
 
 	return store, nil
 }
 
-func (s *SQLiteStore) createTables() error {
-	createLogEntriesTable := `
-	CREATE TABLE IF NOT EXISTS log_entries (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		text TEXT NOT NULL,
-		done BOOLEAN NOT NULL DEFAULT 0,
-		done_time DATETIME,
-		create_time DATETIME NOT NULL,
-		update_time DATETIME NOT NULL,
-		adjusted_top_time INTEGER NOT NULL DEFAULT 0,
-		highlight_level INTEGER NOT NULL DEFAULT 0,
-		collapsed BOOLEAN NOT NULL DEFAULT 0,
-		parent_id INTEGER NOT NULL DEFAULT 0
-	);`
-
-	createNotesTable := `
-	CREATE TABLE IF NOT EXISTS notes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		entry_id INTEGER NOT NULL,
-		text TEXT NOT NULL,
-		create_time DATETIME NOT NULL,
-		update_time DATETIME NOT NULL,
-		FOREIGN KEY (entry_id) REFERENCES log_entries(id) ON DELETE CASCADE
-	);`
-
-	createHappeningsTable := `
-	CREATE TABLE IF NOT EXISTS happenings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		content TEXT NOT NULL,
-		create_time DATETIME NOT NULL,
-		update_time DATETIME NOT NULL
-	);`
-
-	createStatesTable := `
-	CREATE TABLE IF NOT EXISTS states (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		description TEXT NOT NULL DEFAULT '',
-		parent_state_record_id INTEGER NOT NULL DEFAULT 0,
-		score REAL NOT NULL DEFAULT 0.0,
-		scope TEXT NOT NULL DEFAULT '',
-		create_time DATETIME NOT NULL,
-		update_time DATETIME NOT NULL
-	);`
-
-	createStateEventsTable := `
-	CREATE TABLE IF NOT EXISTS state_events (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		state_record_id INTEGER NOT NULL,
-		record_data TEXT NOT NULL DEFAULT '',
-		delta_score REAL NOT NULL DEFAULT 0.0,
-		description TEXT NOT NULL DEFAULT '',
-		details TEXT NOT NULL DEFAULT '',
-		scope TEXT NOT NULL DEFAULT '',
-		create_time DATETIME NOT NULL,
-		update_time DATETIME NOT NULL,
-		FOREIGN KEY (state_record_id) REFERENCES states(id) ON DELETE CASCADE
-	);`
-
-	if _, err := s.db.Exec(createLogEntriesTable); err != nil {
-		return err
-	}
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
 
-	if _, err := s.db.Exec(createNotesTable); err != nil {
-		return err
-	}
+var logEntryColumnNames = []string{
+	"id", "text", "done", "done_time", "create_time", "update_time",
+	"adjusted_top_time", "highlight_level", "collapsed", "parent_id",
+	"due_time", "scheduled_time", "repeat", "previous_id", "deleted_time",
+}
 
-	if _, err := s.db.Exec(createHappeningsTable); err != nil {
-		return err
+// logEntryColumns lists the columns read by scanLogEntry, each prefixed with prefix
+func logEntryColumns(prefix string) string {
+	cols := make([]string, len(logEntryColumnNames))
+	for i, name := range logEntryColumnNames {
+		cols[i] = prefix + name
 	}
+	return strings.Join(cols, ", ")
+}
 
-	if _, err := s.db.Exec(createStatesTable); err != nil {
-		return err
-	}
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	if _, err := s.db.Exec(createStateEventsTable); err != nil {
-		return err
-	}
+func scanLogEntry(row rowScanner) (models.LogEntry, error) {
+	var entry models.LogEntry
+	var createTime, updateTime string
+	var doneTime, dueTime, scheduledTime, deletedTime *string
 
-	return nil
-}
+	err := row.Scan(&entry.ID, &entry.Text, &entry.Done, &doneTime, &createTime, &updateTime,
+		&entry.AdjustedTopTime, &entry.HighlightLevel, &entry.Collapsed, &entry.ParentID,
+		&dueTime, &scheduledTime, &entry.Repeat, &entry.PreviousID, &deletedTime)
+	if err != nil {
+		return entry, err
+	}
 
-func (s *SQLiteStore) Close() error {
-	return s.db.Close()
+	if entry.CreateTime, err = tryParseTime(createTime); err != nil {
+		return entry, err
+	}
+	if entry.UpdateTime, err = tryParseTime(updateTime); err != nil {
+		return entry, err
+	}
+	if entry.DoneTime, err = tryParseOptionalTime(doneTime); err != nil {
+		return entry, err
+	}
+	if entry.DueTime, err = tryParseOptionalTime(dueTime); err != nil {
+		return entry, err
+	}
+	if entry.ScheduledTime, err = tryParseOptionalTime(scheduledTime); err != nil {
+		return entry, err
+	}
+	if entry.DeletedTime, err = tryParseOptionalTime(deletedTime); err != nil {
+		return entry, err
+	}
+	return entry, nil
 }
 
 func NewLogEntryService(filePath string) (storage.LogEntryService, error) {
@@ -167,7 +143,7 @@ func NewStateRecordingService(filePath string) (storage.StateRecordingService, e
 }
 
 // LogEntry service methods
-func (les *LogEntrySQLiteStore) List(options storage.LogEntryListOptions) ([]models.LogEntry, int64, error) {
+func (les *LogEntrySQLiteStore) List(ctx context.Context, options storage.LogEntryListOptions) ([]models.LogEntry, int64, error) {
 	var whereClause []string
 	var args []interface{}
 
@@ -176,10 +152,31 @@ func (les *LogEntrySQLiteStore) List(options storage.LogEntryListOptions) ([]mod
 		args = append(args, "%"+options.Filter+"%")
 	}
 
-	// Handle history filtering
-	if !options.IncludeHistory {
+	if tags := models.NormalizeTags(options.Tags); len(tags) > 0 {
+		placeholders := make([]string, len(tags))
+		for i, tag := range tags {
+			placeholders[i] = "?"
+			args = append(args, tag)
+		}
+		whereClause = append(whereClause, fmt.Sprintf("id IN (SELECT entry_id FROM entry_tags WHERE tag IN (%s) GROUP BY entry_id HAVING COUNT(*) = ?)", strings.Join(placeholders, ", ")))
+		args = append(args, len(tags))
+	}
+
+	if !options.UpdatedSince.IsZero() {
+		whereClause = append(whereClause, "datetime(update_time) >= datetime(?)")
+		args = append(args, formatTime(options.UpdatedSince))
+	}
+
+	if options.Deleted {
+		whereClause = append(whereClause, "deleted_time IS NOT NULL")
+	} else {
+		whereClause = append(whereClause, "deleted_time IS NULL")
+	}
+
+	// Handle history filtering, trash shows everything
+	if !options.IncludeHistory && !options.Deleted {
 		// Filter out entries that are done and have done_time before today
-		whereClause = append(whereClause, "(done = 0 OR done_time IS NULL OR date(done_time) >= date('now'))")
+		whereClause = append(whereClause, "(done = 0 OR done_time IS NULL OR date(done_time) >= date('now', 'localtime'))")
 	}
 
 	where := ""
@@ -190,7 +187,7 @@ func (les *LogEntrySQLiteStore) List(options storage.LogEntryListOptions) ([]mod
 	// Count total
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM log_entries %s", where)
 	var total int64
-	if err := les.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+	if err := les.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
@@ -217,10 +214,10 @@ func (les *LogEntrySQLiteStore) List(options storage.LogEntryListOptions) ([]mod
 		}
 	}
 
-	query := fmt.Sprintf("SELECT id, text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id FROM log_entries %s %s %s",
-		where, orderBy, limit)
+	query := fmt.Sprintf("SELECT %s FROM log_entries %s %s %s",
+		logEntryColumns(""), where, orderBy, limit)
 
-	rows, err := les.db.Query(query, args...)
+	rows, err := les.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -228,28 +225,10 @@ func (les *LogEntrySQLiteStore) List(options storage.LogEntryListOptions) ([]mod
 
 	var entries []models.LogEntry
 	for rows.Next() {
-		var entry models.LogEntry
-		var createTime, updateTime string
-		var doneTime *string
-
-		if err := rows.Scan(&entry.ID, &entry.Text, &entry.Done, &doneTime, &createTime, &updateTime, &entry.AdjustedTopTime, &entry.HighlightLevel, &entry.Collapsed, &entry.ParentID); err != nil {
-			return nil, 0, err
-		}
-
-		if entry.CreateTime, err = tryParseTime(createTime); err != nil {
-			return nil, 0, err
-		}
-		if entry.UpdateTime, err = tryParseTime(updateTime); err != nil {
+		entry, err := scanLogEntry(rows)
+		if err != nil {
 			return nil, 0, err
 		}
-		if doneTime != nil {
-			if parsedDoneTime, err := tryParseTime(*doneTime); err != nil {
-				return nil, 0, err
-			} else {
-				entry.DoneTime = &parsedDoneTime
-			}
-		}
-
 		entries = append(entries, entry)
 	}
 
@@ -260,7 +239,7 @@ func (les *LogEntrySQLiteStore) List(options storage.LogEntryListOptions) ([]mod
 	return entries, total, nil
 }
 
-func (les *LogEntrySQLiteStore) Add(entry models.LogEntry) (int64, error) {
+func (les *LogEntrySQLiteStore) Add(ctx context.Context, entry models.LogEntry) (int64, error) {
 	if entry.CreateTime.IsZero() {
 		entry.CreateTime = time.Now()
 	}
@@ -268,35 +247,76 @@ func (les *LogEntrySQLiteStore) Add(entry models.LogEntry) (int64, error) {
 		entry.UpdateTime = time.Now()
 	}
 
-	query := `INSERT INTO log_entries (text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id) 
-		  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO log_entries (text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id, due_time, scheduled_time, repeat, previous_id) 
+		  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	var doneTimeStr interface{}
-	if entry.DoneTime != nil {
-		doneTimeStr = entry.DoneTime.Format("2006-01-02 15:04:05")
+	tx, err := les.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	result, err := les.db.Exec(query, entry.Text, entry.Done, doneTimeStr,
-		entry.CreateTime.Format("2006-01-02 15:04:05"),
-		entry.UpdateTime.Format("2006-01-02 15:04:05"),
+	result, err := tx.ExecContext(ctx, query, entry.Text, entry.Done, formatOptionalTime(entry.DoneTime),
+		formatTime(entry.CreateTime),
+		formatTime(entry.UpdateTime),
 		entry.AdjustedTopTime,
 		entry.HighlightLevel,
 		entry.Collapsed,
-		entry.ParentID)
+		entry.ParentID,
+		formatOptionalTime(entry.DueTime),
+		formatOptionalTime(entry.ScheduledTime),
+		entry.Repeat,
+		entry.PreviousID)
 	if err != nil {
 		return 0, err
 	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := setEntryTags(tx, id, entry.Text); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
 
-	return result.LastInsertId()
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
 }
 
-func (les *LogEntrySQLiteStore) Delete(id int64) error {
-	// Delete notes first (cascade should handle this, but being explicit)
-	if _, err := les.db.Exec("DELETE FROM notes WHERE entry_id = ?", id); err != nil {
+// setEntryTags replaces the indexed tags of entry id with those in text
+func setEntryTags(db execer, id int64, text string) error {
+	if _, err := db.Exec(`DELETE FROM entry_tags WHERE entry_id = ?`, id); err != nil {
 		return err
 	}
+	for _, tag := range models.ParseTags(text) {
+		if _, err := db.Exec(`INSERT INTO entry_tags (entry_id, tag) VALUES (?, ?)`, id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subtreeSQL selects the IDs of entry ? and its descendants matching cond,
+// which can refer to a descendant as e
+func subtreeSQL(cond string) string {
+	return `WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM log_entries WHERE id = ?
+			UNION ALL
+			SELECT e.id FROM log_entries e INNER JOIN subtree s ON e.parent_id = s.id WHERE ` + cond + `
+		)
+		SELECT id FROM subtree`
+}
 
-	result, err := les.db.Exec("DELETE FROM log_entries WHERE id = ?", id)
+func (les *LogEntrySQLiteStore) Delete(ctx context.Context, id int64) error {
+	// descendants already in trash keep their own deleted_time
+	now := formatTime(time.Now())
+	result, err := les.db.ExecContext(ctx, `UPDATE log_entries SET deleted_time = ?, update_time = ?
+		WHERE deleted_time IS NULL AND id IN (`+subtreeSQL("e.deleted_time IS NULL")+`)`,
+		now, now, id)
 	if err != nil {
 		return err
 	}
@@ -307,13 +327,112 @@ func (les *LogEntrySQLiteStore) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("log entry with id %d not found", id)
+		return storage.NotFoundf("log entry with id %d not found", id)
 	}
 
 	return nil
 }
 
-func (les *LogEntrySQLiteStore) Update(id int64, update models.LogEntryOptional) error {
+func (les *LogEntrySQLiteStore) Undelete(ctx context.Context, id int64) error {
+	tx, err := les.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deleted bool
+	var parentDeleted bool
+	err = tx.QueryRowContext(ctx, `SELECT e.deleted_time IS NOT NULL, p.id IS NULL OR p.deleted_time IS NOT NULL
+		FROM log_entries e LEFT JOIN log_entries p ON p.id = e.parent_id
+		WHERE e.id = ?`, id).Scan(&deleted, &parentDeleted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.NotFoundf("log entry with id %d not found", id)
+		}
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("log entry with id %d is not in trash", id)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE log_entries SET deleted_time = NULL, update_time = ?
+		WHERE id IN (`+subtreeSQL("e.deleted_time = (SELECT deleted_time FROM log_entries WHERE id = ?)")+`)`, formatTime(time.Now()), id, id)
+	if err != nil {
+		return err
+	}
+	if parentDeleted {
+		if _, err := tx.ExecContext(ctx, `UPDATE log_entries SET parent_id = 0 WHERE id = ? AND parent_id != 0`, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (les *LogEntrySQLiteStore) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	tx, err := les.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const purged = `SELECT id FROM log_entries WHERE deleted_time < ?`
+	before := formatTime(deletedBefore)
+	for _, table := range []string{"notes", "entry_tags", "log_group_members", "revisions"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE entry_id IN (`+purged+`)`, before); err != nil {
+			return 0, err
+		}
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM log_entries WHERE id IN (`+purged+`)`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func (les *LogEntrySQLiteStore) Restore(ctx context.Context, entries []models.LogEntry, notes []models.Note) error {
+	tx, err := les.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		_, err := tx.ExecContext(ctx, `INSERT INTO log_entries (id, text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id, due_time, scheduled_time, repeat, previous_id, deleted_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.ID, entry.Text, entry.Done, formatOptionalTime(entry.DoneTime),
+			formatTime(entry.CreateTime),
+			formatTime(entry.UpdateTime),
+			entry.AdjustedTopTime,
+			entry.HighlightLevel,
+			entry.Collapsed,
+			entry.ParentID,
+			formatOptionalTime(entry.DueTime),
+			formatOptionalTime(entry.ScheduledTime),
+			entry.Repeat,
+			entry.PreviousID,
+			formatOptionalTime(entry.DeletedTime))
+		if err != nil {
+			return fmt.Errorf("failed to restore entry %d: %w", entry.ID, err)
+		}
+		if err := setEntryTags(tx, entry.ID, entry.Text); err != nil {
+			return err
+		}
+	}
+	for _, note := range notes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO notes (id, entry_id, text, create_time, update_time) VALUES (?, ?, ?, ?, ?)`,
+			note.ID, note.EntryID, note.Text, formatTime(note.CreateTime), formatTime(note.UpdateTime))
+		if err != nil {
+			return fmt.Errorf("failed to restore note %d: %w", note.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (les *LogEntrySQLiteStore) Update(ctx context.Context, id int64, update models.LogEntryOptional) error {
 	var setParts []string
 	var args []interface{}
 
@@ -360,15 +479,40 @@ func (les *LogEntrySQLiteStore) Update(id int64, update models.LogEntryOptional)
 		setParts = append(setParts, "parent_id = ?")
 		args = append(args, *update.ParentID)
 	}
+	if update.DueTime != nil {
+		setParts = append(setParts, "due_time = ?")
+		args = append(args, formatOptionalTime(*update.DueTime))
+	}
+	if update.ScheduledTime != nil {
+		setParts = append(setParts, "scheduled_time = ?")
+		args = append(args, formatOptionalTime(*update.ScheduledTime))
+	}
+	if update.Repeat != nil {
+		setParts = append(setParts, "repeat = ?")
+		args = append(args, *update.Repeat)
+	}
 
 	if len(setParts) == 0 {
 		return nil // Nothing to update
 	}
 
-	args = append(args, id)
-	query := fmt.Sprintf("UPDATE log_entries SET %s WHERE id = ?", strings.Join(setParts, ", "))
+	where, whereArgs := ifUpdateTime("id = ?", []interface{}{id}, update.IfUpdateTime)
+	args = append(args, whereArgs...)
+	query := fmt.Sprintf("UPDATE log_entries SET %s WHERE %s", strings.Join(setParts, ", "), where)
 
-	result, err := les.db.Exec(query, args...)
+	tx, err := les.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// read before the update, for its revision
+	before, err := scanLogEntry(tx.QueryRowContext(ctx, `SELECT `+logEntryColumns("")+` FROM log_entries WHERE id = ?`, id))
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -379,75 +523,79 @@ func (les *LogEntrySQLiteStore) Update(id int64, update models.LogEntryOptional)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("log entry with id %d not found", id)
+		return conflictOrNotFound(tx, "entry", id, "log_entries", "id = ?", []interface{}{id}, storage.NotFoundf("log entry with id %d not found", id))
+	}
+	after := before
+	after.Update(&update)
+	now := time.Now()
+	if err := recordRevision(tx, models.EntryRevision(before, now), models.EntryRevision(after, now)); err != nil {
+		return err
+	}
+	if update.Text != nil {
+		if err := setEntryTags(tx, id, *update.Text); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (les *LogEntrySQLiteStore) Move(id int64, newParentID int64) error {
-	result, err := les.db.Exec("UPDATE log_entries SET parent_id = ?, update_time = ? WHERE id = ?", newParentID, formatTime(time.Now()), id)
+func (les *LogEntrySQLiteStore) Move(ctx context.Context, id int64, newParentID int64) error {
+	tx, err := les.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	before, err := scanLogEntry(tx.QueryRowContext(ctx, `SELECT `+logEntryColumns("")+` FROM log_entries WHERE id = ?`, id))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return storage.NotFoundf("log entry with id %d not found", id)
+		}
 		return err
 	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("log entry with id %d not found", id)
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, "UPDATE log_entries SET parent_id = ?, update_time = ? WHERE id = ?", newParentID, formatTime(now), id); err != nil {
+		return err
 	}
-
-	return nil
+	after := before
+	after.ParentID = newParentID
+	if err := recordRevision(tx, models.EntryRevision(before, now), models.EntryRevision(after, now)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (les *LogEntrySQLiteStore) GetTree(ctx context.Context, id int64, includeHistory bool) ([]models.LogEntry, error) {
+	// Without history, done children (and their subtrees) are excluded.
+	// Entries in trash are always excluded.
+	childFilter := "WHERE e.deleted_time IS NULL"
+	if !includeHistory {
+		childFilter += " AND NOT (e.done = 1 AND e.done_time IS NOT NULL)"
+	}
+
 	// Use recursive CTE to get all descendants of the root entry
-	var query string
-	if includeHistory {
-		query = `
-			WITH RECURSIVE descendants AS (
-				-- Base case: the root entry
-				SELECT id, text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id
-				FROM log_entries 
-				WHERE id = ?
-				
-				UNION ALL
-				
-				-- Recursive case: children of entries already in the result
-				SELECT e.id, e.text, e.done, e.done_time, e.create_time, e.update_time, e.adjusted_top_time, e.highlight_level, e.collapsed, e.parent_id
-				FROM log_entries e
-				INNER JOIN descendants d ON e.parent_id = d.id
-			)
-			SELECT id, text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id
-			FROM descendants
-			ORDER BY parent_id, id
-		`
-	} else {
-		query = `
-			WITH RECURSIVE descendants AS (
-				-- Base case: the root entry
-				SELECT id, text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id
-				FROM log_entries 
-				WHERE id = ?
-				
-				UNION ALL
-				
-				-- Recursive case: children of entries already in the result (excluding done entries)
-				SELECT e.id, e.text, e.done, e.done_time, e.create_time, e.update_time, e.adjusted_top_time, e.highlight_level, e.collapsed, e.parent_id
-				FROM log_entries e
-				INNER JOIN descendants d ON e.parent_id = d.id
-				WHERE NOT (e.done = 1 AND e.done_time IS NOT NULL)
-			)
-			SELECT id, text, done, done_time, create_time, update_time, adjusted_top_time, highlight_level, collapsed, parent_id
-			FROM descendants
-			ORDER BY parent_id, id
-		`
-	}
-
-	rows, err := les.db.Query(query, id)
+	query := fmt.Sprintf(`
+		WITH RECURSIVE descendants AS (
+			-- Base case: the root entry
+			SELECT %[1]s
+			FROM log_entries
+			WHERE id = ? AND deleted_time IS NULL
+
+			UNION ALL
+
+			-- Recursive case: children of entries already in the result
+			SELECT %[2]s
+			FROM log_entries e
+			INNER JOIN descendants d ON e.parent_id = d.id
+			%[3]s
+		)
+		SELECT %[1]s
+		FROM descendants
+		ORDER BY parent_id, id
+	`, logEntryColumns(""), logEntryColumns("e."), childFilter)
+
+	rows, err := les.db.QueryContext(ctx, query, id)
 	if err != nil {
 		return nil, err
 	}
@@ -455,28 +603,10 @@ func (les *LogEntrySQLiteStore) GetTree(ctx context.Context, id int64, includeHi
 
 	var entries []models.LogEntry
 	for rows.Next() {
-		var entry models.LogEntry
-		var createTime, updateTime string
-		var doneTime *string
-
-		if err := rows.Scan(&entry.ID, &entry.Text, &entry.Done, &doneTime, &createTime, &updateTime, &entry.AdjustedTopTime, &entry.HighlightLevel, &entry.Collapsed, &entry.ParentID); err != nil {
-			return nil, err
-		}
-
-		if entry.CreateTime, err = tryParseTime(createTime); err != nil {
-			return nil, err
-		}
-		if entry.UpdateTime, err = tryParseTime(updateTime); err != nil {
+		entry, err := scanLogEntry(rows)
+		if err != nil {
 			return nil, err
 		}
-		if doneTime != nil {
-			if parsedDoneTime, err := tryParseTime(*doneTime); err != nil {
-				return nil, err
-			} else {
-				entry.DoneTime = &parsedDoneTime
-			}
-		}
-
 		entries = append(entries, entry)
 	}
 
@@ -488,7 +618,7 @@ func (les *LogEntrySQLiteStore) GetTree(ctx context.Context, id int64, includeHi
 }
 
 // LogNote service methods
-func (lns *LogNoteSQLiteStore) List(entryID int64, options storage.LogNoteListOptions) ([]models.Note, int64, error) {
+func (lns *LogNoteSQLiteStore) List(ctx context.Context, entryID int64, options storage.LogNoteListOptions) ([]models.Note, int64, error) {
 	var whereClause []string
 	var args []interface{}
 
@@ -505,7 +635,7 @@ func (lns *LogNoteSQLiteStore) List(entryID int64, options storage.LogNoteListOp
 	// Count total
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM notes %s", where)
 	var total int64
-	if err := lns.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+	if err := lns.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
@@ -530,7 +660,7 @@ func (lns *LogNoteSQLiteStore) List(entryID int64, options storage.LogNoteListOp
 	query := fmt.Sprintf("SELECT id, entry_id, text, create_time, update_time FROM notes %s %s %s",
 		where, orderBy, limit)
 
-	rows, err := lns.db.Query(query, args...)
+	rows, err := lns.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -562,7 +692,7 @@ func (lns *LogNoteSQLiteStore) List(entryID int64, options storage.LogNoteListOp
 	return notes, total, nil
 }
 
-func (lns *LogNoteSQLiteStore) ListForEntries(entryIDs []int64) (map[int64][]models.Note, error) {
+func (lns *LogNoteSQLiteStore) ListForEntries(ctx context.Context, entryIDs []int64) (map[int64][]models.Note, error) {
 	if len(entryIDs) == 0 {
 		return make(map[int64][]models.Note), nil
 	}
@@ -585,7 +715,7 @@ func (lns *LogNoteSQLiteStore) ListForEntries(entryIDs []int64) (map[int64][]mod
 	query := fmt.Sprintf("SELECT id, entry_id, text, create_time, update_time FROM notes WHERE entry_id IN (%s) ORDER BY entry_id, id",
 		strings.Join(placeholders, ", "))
 
-	rows, err := lns.db.Query(query, args...)
+	rows, err := lns.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -616,14 +746,14 @@ func (lns *LogNoteSQLiteStore) ListForEntries(entryIDs []int64) (map[int64][]mod
 	return result, nil
 }
 
-func (lns *LogNoteSQLiteStore) Add(entryID int64, note models.Note) (int64, error) {
+func (lns *LogNoteSQLiteStore) Add(ctx context.Context, entryID int64, note models.Note) (int64, error) {
 	// Check if entry exists
 	var exists bool
-	if err := lns.db.QueryRow("SELECT EXISTS(SELECT 1 FROM log_entries WHERE id = ?)", entryID).Scan(&exists); err != nil {
+	if err := lns.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM log_entries WHERE id = ?)", entryID).Scan(&exists); err != nil {
 		return 0, err
 	}
 	if !exists {
-		return 0, fmt.Errorf("log entry with id %d not found", entryID)
+		return 0, storage.NotFoundf("log entry with id %d not found", entryID)
 	}
 
 	if note.CreateTime.IsZero() {
@@ -636,7 +766,7 @@ func (lns *LogNoteSQLiteStore) Add(entryID int64, note models.Note) (int64, erro
 	query := `INSERT INTO notes (entry_id, text, create_time, update_time) 
 			  VALUES (?, ?, ?, ?)`
 
-	result, err := lns.db.Exec(query, entryID, note.Text,
+	result, err := lns.db.ExecContext(ctx, query, entryID, note.Text,
 		formatTime(note.CreateTime),
 		formatTime(note.UpdateTime))
 	if err != nil {
@@ -646,8 +776,8 @@ func (lns *LogNoteSQLiteStore) Add(entryID int64, note models.Note) (int64, erro
 	return result.LastInsertId()
 }
 
-func (lns *LogNoteSQLiteStore) Delete(entryID int64, noteID int64) error {
-	result, err := lns.db.Exec("DELETE FROM notes WHERE id = ? AND entry_id = ?", noteID, entryID)
+func (lns *LogNoteSQLiteStore) Delete(ctx context.Context, entryID int64, noteID int64) error {
+	result, err := lns.db.ExecContext(ctx, "DELETE FROM notes WHERE id = ? AND entry_id = ?", noteID, entryID)
 	if err != nil {
 		return err
 	}
@@ -658,13 +788,13 @@ func (lns *LogNoteSQLiteStore) Delete(entryID int64, noteID int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("note with id %d not found for entry %d", noteID, entryID)
+		return storage.NotFoundf("note with id %d not found for entry %d", noteID, entryID)
 	}
 
 	return nil
 }
 
-func (lns *LogNoteSQLiteStore) Update(entryID int64, noteID int64, update models.NoteOptional) error {
+func (lns *LogNoteSQLiteStore) Update(ctx context.Context, entryID int64, noteID int64, update models.NoteOptional) error {
 	var setParts []string
 	var args []interface{}
 
@@ -688,10 +818,24 @@ func (lns *LogNoteSQLiteStore) Update(entryID int64, noteID int64, update models
 		return nil // Nothing to update
 	}
 
-	args = append(args, noteID, entryID)
-	query := fmt.Sprintf("UPDATE notes SET %s WHERE id = ? AND entry_id = ?", strings.Join(setParts, ", "))
+	where, whereArgs := ifUpdateTime("id = ? AND entry_id = ?", []interface{}{noteID, entryID}, update.IfUpdateTime)
+	args = append(args, whereArgs...)
+	query := fmt.Sprintf("UPDATE notes SET %s WHERE %s", strings.Join(setParts, ", "), where)
 
-	result, err := lns.db.Exec(query, args...)
+	tx, err := lns.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// read before the update, for its revision
+	var before string
+	err = tx.QueryRowContext(ctx, `SELECT text FROM notes WHERE id = ? AND entry_id = ?`, noteID, entryID).Scan(&before)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -702,10 +846,19 @@ func (lns *LogNoteSQLiteStore) Update(entryID int64, noteID int64, update models
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("note with id %d not found for entry %d", noteID, entryID)
+		return conflictOrNotFound(tx, "note", noteID, "notes", "id = ? AND entry_id = ?", []interface{}{noteID, entryID}, storage.NotFoundf("note with id %d not found for entry %d", noteID, entryID))
+	}
+	if update.Text != nil {
+		now := time.Now()
+		revision := models.NoteRevision(models.Note{ID: noteID, EntryID: entryID, Text: before}, now)
+		changed := revision
+		changed.Text = *update.Text
+		if err := recordRevision(tx, revision, changed); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 // Happening service methods
@@ -791,11 +944,17 @@ func (hss *HappeningSQLiteStore) Add(ctx context.Context, happening *models.Happ
 		return nil, fmt.Errorf("happening content cannot be empty")
 	}
 
-	now := time.Now()
+	createTime, updateTime := happening.CreateTime, happening.UpdateTime
+	if createTime.IsZero() {
+		createTime = time.Now()
+	}
+	if updateTime.IsZero() {
+		updateTime = time.Now()
+	}
 
 	// Insert the happening
 	query := `INSERT INTO happenings (content, create_time, update_time) VALUES (?, ?, ?)`
-	result, err := hss.db.ExecContext(ctx, query, happening.Content, formatTime(now), formatTime(now))
+	result, err := hss.db.ExecContext(ctx, query, happening.Content, formatTime(createTime), formatTime(updateTime))
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert happening: %w", err)
 	}
@@ -810,8 +969,8 @@ func (hss *HappeningSQLiteStore) Add(ctx context.Context, happening *models.Happ
 	newHappening := &models.Happening{
 		ID:         id,
 		Content:    happening.Content,
-		CreateTime: now,
-		UpdateTime: now,
+		CreateTime: createTime,
+		UpdateTime: updateTime,
 	}
 
 	return newHappening, nil
@@ -829,7 +988,7 @@ func (hss *HappeningSQLiteStore) Update(ctx context.Context, id int64, update *m
 		&existing.ID, &existing.Content, &createTime, &updateTime)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("happening with id %d not found", id)
+			return nil, storage.NotFoundf("happening with id %d not found", id)
 		}
 		return nil, fmt.Errorf("failed to get existing happening: %w", err)
 	}
@@ -847,8 +1006,9 @@ func (hss *HappeningSQLiteStore) Update(ctx context.Context, id int64, update *m
 	existing.Update(update)
 
 	// Update the happening in database
-	query := `UPDATE happenings SET content = ?, update_time = ? WHERE id = ?`
-	result, err := hss.db.ExecContext(ctx, query, existing.Content, formatTime(existing.UpdateTime), id)
+	where, whereArgs := ifUpdateTime("id = ?", []interface{}{id}, update.IfUpdateTime)
+	query := `UPDATE happenings SET content = ?, update_time = ? WHERE ` + where
+	result, err := hss.db.ExecContext(ctx, query, append([]interface{}{existing.Content, formatTime(existing.UpdateTime)}, whereArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update happening: %w", err)
 	}
@@ -859,7 +1019,7 @@ func (hss *HappeningSQLiteStore) Update(ctx context.Context, id int64, update *m
 	}
 
 	if rowsAffected == 0 {
-		return nil, fmt.Errorf("happening with id %d not found", id)
+		return nil, conflictOrNotFound(hss.db, "happening", id, "happenings", "id = ?", []interface{}{id}, storage.NotFoundf("happening with id %d not found", id))
 	}
 
 	return &existing, nil
@@ -877,7 +1037,7 @@ func (hss *HappeningSQLiteStore) Delete(ctx context.Context, id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("happening with id %d not found", id)
+		return storage.NotFoundf("happening with id %d not found", id)
 	}
 
 	return nil
@@ -987,7 +1147,13 @@ func (srs *StateRecordingSQLiteStore) CreateState(ctx context.Context, state *mo
 		return nil, fmt.Errorf("state with this name already exists")
 	}
 
-	now := time.Now()
+	createTime, updateTime := state.CreateTime, state.UpdateTime
+	if createTime.IsZero() {
+		createTime = time.Now()
+	}
+	if updateTime.IsZero() {
+		updateTime = time.Now()
+	}
 
 	// Insert the state
 	query := `INSERT INTO states (name, description, parent_state_record_id, score, scope, create_time, update_time) 
@@ -995,7 +1161,7 @@ func (srs *StateRecordingSQLiteStore) CreateState(ctx context.Context, state *mo
 
 	result, err := srs.db.ExecContext(ctx, query,
 		state.Name, state.Description, state.ParentStateRecordID,
-		state.Score, state.Scope, formatTime(now), formatTime(now))
+		state.Score, state.Scope, formatTime(createTime), formatTime(updateTime))
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert state: %w", err)
 	}
@@ -1014,13 +1180,48 @@ func (srs *StateRecordingSQLiteStore) CreateState(ctx context.Context, state *mo
 		ParentStateRecordID: state.ParentStateRecordID,
 		Score:               state.Score,
 		Scope:               state.Scope,
-		CreateTime:          now,
-		UpdateTime:          now,
+		CreateTime:          createTime,
+		UpdateTime:          updateTime,
 	}
 
 	return newState, nil
 }
 
+func (srs *StateRecordingSQLiteStore) AddStateEvent(ctx context.Context, event *models.StateEvent) (*models.StateEvent, error) {
+	if event == nil {
+		return nil, fmt.Errorf("state event cannot be nil")
+	}
+	var exists bool
+	err := srs.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM states WHERE id = ?)", event.StateRecordID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if state exists: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("state not found")
+	}
+
+	newEvent := *event
+	if newEvent.CreateTime.IsZero() {
+		newEvent.CreateTime = time.Now()
+	}
+	if newEvent.UpdateTime.IsZero() {
+		newEvent.UpdateTime = time.Now()
+	}
+
+	query := `INSERT INTO state_events (state_record_id, record_data, delta_score, description, details, scope, create_time, update_time) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := srs.db.ExecContext(ctx, query, newEvent.StateRecordID, newEvent.RecordData, newEvent.DeltaScore,
+		newEvent.Description, newEvent.Details, newEvent.Scope, formatTime(newEvent.CreateTime), formatTime(newEvent.UpdateTime))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert state event: %w", err)
+	}
+	newEvent.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inserted ID: %w", err)
+	}
+	return &newEvent, nil
+}
+
 func (srs *StateRecordingSQLiteStore) ListStates(ctx context.Context, scope string) ([]*models.State, error) {
 	var whereClause string
 	var args []interface{}
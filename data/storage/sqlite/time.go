@@ -5,18 +5,50 @@ import (
 	"time"
 )
 
+// timeLayout keeps the nanoseconds, so two updates within a second
+// have different update times. Rows written before keep whole
+// seconds, which format the same when read back.
+const timeLayout = "2006-01-02 15:04:05.999999999"
+
+// formatTime stores the local wall clock of t, what sqlite compares
+// with date('now', 'localtime'), whatever offset t comes with. Rows
+// are read back as local times too. Releases before wrote the wall
+// clock of t's own offset and read rows as UTC: rows the app wrote
+// now read right, rows todo serve wrote for a client in another zone
+// keep that zone's wall clock and read as local.
 func formatTime(t time.Time) string {
-	return t.Format("2006-01-02 15:04:05")
+	return t.In(time.Local).Format(timeLayout)
 }
 
-// parsing time "2025-08-05T10:15:43Z" as "2006-01-02 15:04:05": cannot parse "T10:15:43Z" as " "
+// tryParseTime reads back a time written by formatTime. The driver
+// returns DATETIME columns like "2025-08-05T10:15:43.5Z", but the Z is
+// the driver's, the wall clock is local all the same.
 func tryParseTime(s string) (time.Time, error) {
 	if strings.Contains(s, "T") {
 		return tryParseStdTime(s)
 	}
-	return time.Parse("2006-01-02 15:04:05", s)
+	return time.ParseInLocation(timeLayout, s, time.Local)
 }
 
 func tryParseStdTime(s string) (time.Time, error) {
-	return time.Parse("2006-01-02T15:04:05Z", s)
+	return time.ParseInLocation("2006-01-02T15:04:05.999999999Z", s, time.Local)
+}
+
+// formatOptionalTime maps nil to NULL
+func formatOptionalTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return formatTime(*t)
+}
+
+func tryParseOptionalTime(s *string) (*time.Time, error) {
+	if s == nil {
+		return nil, nil
+	}
+	t, err := tryParseTime(*s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
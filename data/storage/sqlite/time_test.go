@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+)
+
+// Rows hold the local wall clock without an offset. Older releases
+// wrote the wall clock of whatever offset a time came with, e.g. UTC
+// from a client of todo serve; those rows read as local times now.
+func TestRowsWrittenBefore(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("CST", 8*60*60)
+	defer func() { time.Local = local }()
+
+	store, err := New(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, stmt := range []string{
+		// written by the app, in local time
+		`INSERT INTO log_entries (id, text, create_time, update_time) VALUES (1, 'local', '2026-10-17 10:00:00', '2026-10-17 10:00:00')`,
+		// written by todo serve for a client sending UTC
+		`INSERT INTO log_entries (id, text, create_time, update_time) VALUES (2, 'utc', '2026-10-17 02:00:00', '2026-10-17 02:00:00')`,
+	} {
+		if _, err := store.db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _, err := (&LogEntrySQLiteStore{SQLiteStore: store}).List(context.Background(), storage.LogEntryListOptions{IncludeHistory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]time.Time{
+		"local": time.Date(2026, 10, 17, 10, 0, 0, 0, time.Local),
+		"utc":   time.Date(2026, 10, 17, 2, 0, 0, 0, time.Local),
+	}
+	for _, entry := range entries {
+		if !entry.CreateTime.Equal(want[entry.Text]) {
+			t.Errorf("%s: expected %v, got %v", entry.Text, want[entry.Text], entry.CreateTime)
+		}
+	}
+
+	// times with any offset are written as the local wall clock
+	utc := time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)
+	if got := formatTime(utc); got != "2026-10-17 10:00:00" {
+		t.Fatalf("expected the local wall clock, got %s", got)
+	}
+}
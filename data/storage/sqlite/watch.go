@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// WatchInterval is how often Watch checks the database for changes
+var WatchInterval = time.Second
+
+// Watch implements storage.ChangeFeed by polling PRAGMA data_version on
+// a connection of its own. The version changes whenever another
+// connection commits, including those of this store's pool.
+func (s *SQLiteStore) Watch(ctx context.Context, onChange func()) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open watch connection: %w", err)
+	}
+	defer conn.Close()
+
+	version, err := dataVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		next, err := dataVersion(ctx, conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if next != version {
+			version = next
+			onChange()
+		}
+	}
+}
+
+func dataVersion(ctx context.Context, conn *sql.Conn) (int64, error) {
+	var version int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA data_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read data version: %w", err)
+	}
+	return version, nil
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/xhd2015/todo/models"
 )
@@ -14,18 +15,68 @@ type LogEntryListOptions struct {
 	Offset         int
 	Status         string
 	IncludeHistory bool
+	// Tags keeps entries carrying all of the tags, see models.ParseTags
+	Tags []string
+	// Deleted lists the entries in trash instead of the others
+	Deleted bool
+	// UpdatedSince keeps entries updated, moved, deleted or restored
+	// at or after it, zero for all
+	UpdatedSince time.Time
 }
 
 type LogEntryService interface {
-	List(options LogEntryListOptions) ([]models.LogEntry, int64, error)
-	Add(entry models.LogEntry) (int64, error)
-	Delete(id int64) error
-	Update(id int64, update models.LogEntryOptional) error
-	Move(id int64, newParentID int64) error
+	List(ctx context.Context, options LogEntryListOptions) ([]models.LogEntry, int64, error)
+	Add(ctx context.Context, entry models.LogEntry) (int64, error)
+	// Delete moves the entry and its descendants to trash
+	Delete(ctx context.Context, id int64) error
+	// Undelete restores the entry and the descendants deleted with it
+	// from trash. If its parent is still in trash, it becomes top-level.
+	Undelete(ctx context.Context, id int64) error
+	// Purge permanently deletes the entries moved to trash before
+	// deletedBefore, with their notes, and returns how many there were
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	Update(ctx context.Context, id int64, update models.LogEntryOptional) error
+	Move(ctx context.Context, id int64, newParentID int64) error
 	// GetTree loads all descendants of a given root ID, with optional history entries
 	GetTree(ctx context.Context, id int64, includeHistory bool) ([]models.LogEntry, error)
 }
 
+// LogEntryRestorer is implemented by LogEntryServices that can add
+// deleted entries and notes back under their original IDs
+type LogEntryRestorer interface {
+	// Restore adds the entries, parents first, and the notes as they
+	// were. It fails without changes if any of the IDs is taken.
+	Restore(ctx context.Context, entries []models.LogEntry, notes []models.Note) error
+}
+
+type GroupService interface {
+	// ListGroups lists groups ordered by position
+	ListGroups(ctx context.Context) ([]models.Group, error)
+	AddGroup(ctx context.Context, group models.Group) (int64, error)
+	UpdateGroup(ctx context.Context, id int64, update models.GroupOptional) error
+	// DeleteGroup deletes a group and the memberships of its entries
+	DeleteGroup(ctx context.Context, id int64) error
+	// ListMemberships lists the entries put into a group or detached explicitly
+	ListMemberships(ctx context.Context) ([]models.GroupMembership, error)
+	// SetMembership puts an entry into a group, replacing its previous one
+	SetMembership(ctx context.Context, membership models.GroupMembership) error
+}
+
+type SearchOptions struct {
+	// Query is parsed by query.Parse
+	Query string
+	// Limit caps the number of results, 0 for DefaultSearchLimit
+	Limit int
+}
+
+const DefaultSearchLimit = 50
+
+// SearchService searches entries with their notes, and happenings
+type SearchService interface {
+	// Search returns the results matching the query, best first
+	Search(ctx context.Context, options SearchOptions) ([]models.SearchResult, error)
+}
+
 type LogNoteListOptions struct {
 	Filter    string
 	SortBy    string
@@ -35,11 +86,35 @@ type LogNoteListOptions struct {
 }
 
 type LogNoteService interface {
-	List(entryID int64, options LogNoteListOptions) ([]models.Note, int64, error)
-	ListForEntries(entryIDs []int64) (map[int64][]models.Note, error)
-	Add(entryID int64, note models.Note) (int64, error)
-	Delete(entryID int64, noteID int64) error
-	Update(entryID int64, noteID int64, update models.NoteOptional) error
+	List(ctx context.Context, entryID int64, options LogNoteListOptions) ([]models.Note, int64, error)
+	ListForEntries(ctx context.Context, entryIDs []int64) (map[int64][]models.Note, error)
+	Add(ctx context.Context, entryID int64, note models.Note) (int64, error)
+	Delete(ctx context.Context, entryID int64, noteID int64) error
+	Update(ctx context.Context, entryID int64, noteID int64, update models.NoteOptional) error
+}
+
+type RevisionListOptions struct {
+	// EntryID keeps the revisions of the entry and its notes, 0 for all
+	EntryID int64 `json:"entry_id,omitempty"`
+	// ChangedAfter keeps the revisions replaced after it, zero for all
+	ChangedAfter time.Time `json:"changed_after,omitempty"`
+}
+
+// RevisionService lists the revisions entries and notes record when
+// their text, done state, parent or highlight level changes. Purging
+// an entry drops its revisions and those of its notes.
+type RevisionService interface {
+	// ListRevisions lists revisions, latest change first
+	ListRevisions(ctx context.Context, options RevisionListOptions) ([]models.Revision, error)
+}
+
+// ChangeFeed tells when the stored data was changed, notably by
+// another process or client
+type ChangeFeed interface {
+	// Watch calls onChange after data changed until ctx is done,
+	// changes close together may be told once. It returns ctx.Err(),
+	// or the error that stopped watching early.
+	Watch(ctx context.Context, onChange func()) error
 }
 
 type HappeningListOptions struct {
@@ -52,6 +127,7 @@ type HappeningListOptions struct {
 
 type HappeningService interface {
 	List(options HappeningListOptions) ([]*models.Happening, int64, error)
+	// Add adds a happening, keeping its create and update time if set
 	Add(ctx context.Context, happening *models.Happening) (*models.Happening, error)
 	Update(ctx context.Context, id int64, update *models.HappeningOptional) (*models.Happening, error)
 	Delete(ctx context.Context, id int64) error
@@ -67,8 +143,12 @@ type StateRecordingService interface {
 	GetState(ctx context.Context, name string) (*models.State, error)
 	// RecordStateEvent records a state event with delta score, updates the state score, and logs the event
 	RecordStateEvent(ctx context.Context, name string, deltaScore float64) error
-	// CreateState creates a new state record
+	// CreateState creates a new state record, keeping its create and
+	// update time if set
 	CreateState(ctx context.Context, state *models.State) (*models.State, error)
+	// AddStateEvent adds an event as it was, e.g. when importing,
+	// without changing the score of its state
+	AddStateEvent(ctx context.Context, event *models.StateEvent) (*models.StateEvent, error)
 	// ListStates lists all state records with optional filtering
 	ListStates(ctx context.Context, scope string) ([]*models.State, error)
 	// GetStateEvents retrieves events for a specific state
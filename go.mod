@@ -11,7 +11,6 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.30
 	github.com/shirou/gopsutil/v3 v3.24.5
 	github.com/xhd2015/go-dom-tui v0.0.22
-	github.com/xhd2015/go-http-request v0.0.3
 	github.com/xhd2015/less-gen v0.0.19
 	github.com/xhd2015/xgo v1.0.49-0.20240916074001-40aa40fc7623
 	golang.org/x/term v0.33.0
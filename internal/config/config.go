@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/sha1"
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -33,3 +35,19 @@ func GetConfigJSONFile() (string, error) {
 func GetSqliteFile() (string, error) {
 	return GetConfigFile("lifelog.db")
 }
+
+// GetReplicaFile returns the local replica of the server at serverAddr
+func GetReplicaFile(serverAddr string) (string, error) {
+	sum := sha1.Sum([]byte(serverAddr))
+	return GetConfigFile(fmt.Sprintf("replica-%x.db", sum[:4]))
+}
+
+// GetBackupDir returns the directory of the backups of storageType
+func GetBackupDir(storageType string) (string, error) {
+	return GetConfigFile(filepath.Join("backups", storageType))
+}
+
+// GetControlSocket returns the socket a running instance takes commands on
+func GetControlSocket() (string, error) {
+	return GetConfigFile("todo.sock")
+}
@@ -0,0 +1,642 @@
+// Package query parses search queries like
+//
+//	deploy OR release "staging db" migr* note:rollback done:no before:2025-09-01
+//
+// and evaluates them against entries and happenings. Words are ANDed
+// unless joined by OR, AND binds tighter than OR and parentheses group.
+// Storage backends with a full-text index translate a Query with FTS,
+// the others match with Match.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xhd2015/todo/models"
+)
+
+// Expr is a *Term, And or Or
+type Expr interface {
+	expr()
+}
+
+// Term matches a word, or a phrase of consecutive words
+type Term struct {
+	// Words are lower-cased, see Words
+	Words []string
+	// Prefix matches the last word as a prefix, from "migr*"
+	Prefix bool
+	// NotesOnly matches only in notes, from "note:"
+	NotesOnly bool
+}
+
+type And []Expr
+
+type Or []Expr
+
+func (*Term) expr() {}
+func (And) expr()   {}
+func (Or) expr()    {}
+
+type Query struct {
+	// Expr is nil when the query only has qualifiers,
+	// then everything matches
+	Expr Expr
+	// Done keeps only entries done or not done, from "done:yes" and "done:no".
+	// Happenings are never done, so they are dropped.
+	Done *bool
+	// Before keeps only results created before it, from "before:<date>"
+	Before *time.Time
+}
+
+// Document is the searchable content of an entry or a happening
+type Document struct {
+	Text string
+	// Notes are the entry's notes joined by newlines
+	Notes string
+}
+
+// Parse parses s, relative dates of "before:" count from now.
+// Incomplete input such as a missing closing quote or parenthesis,
+// or a dangling OR, is accepted as far as it goes.
+func Parse(s string, now time.Time) (*Query, error) {
+	p := &parser{tokens: lex(s), now: now, query: &Query{}}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.query.Expr = expr
+	return p.query, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// qualifier is the lower-cased "key" of "key:value"
+	qualifier string
+}
+
+var qualifiers = map[string]bool{
+	"done":   true,
+	"note":   true,
+	"notes":  true,
+	"before": true,
+}
+
+func lex(s string) []token {
+	var tokens []token
+	runes := []rune(s)
+	readQuoted := func(i int) (string, int) {
+		end := i
+		for end < len(runes) && runes[end] != '"' {
+			end++
+		}
+		text := string(runes[i:end])
+		if end < len(runes) {
+			end++
+		}
+		return text, end
+	}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			i++
+		case r == '"':
+			var text string
+			text, i = readQuoted(i + 1)
+			tokens = append(tokens, token{kind: tokenPhrase, text: text})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				if runes[i] == ':' && i+1 < len(runes) && runes[i+1] == '"' {
+					key := strings.ToLower(string(runes[start:i]))
+					if qualifiers[key] {
+						var text string
+						text, i = readQuoted(i + 2)
+						tokens = append(tokens, token{kind: tokenPhrase, text: text, qualifier: key})
+						start = -1
+						break
+					}
+				}
+				i++
+			}
+			if start < 0 {
+				continue
+			}
+			word := string(runes[start:i])
+			tok := token{kind: tokenWord, text: word}
+			if key, value, ok := strings.Cut(word, ":"); ok && qualifiers[strings.ToLower(key)] {
+				tok.qualifier = strings.ToLower(key)
+				tok.text = value
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	now    time.Time
+	query  *Query
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func isKeyword(tok token, keyword string) bool {
+	return tok.kind == tokenWord && tok.qualifier == "" && tok.text == keyword
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	var or Or
+	for {
+		expr, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			or = append(or, expr)
+		}
+		tok, ok := p.peek()
+		if !ok || !isKeyword(tok, "OR") {
+			break
+		}
+		p.pos++
+	}
+	switch len(or) {
+	case 0:
+		return nil, nil
+	case 1:
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	var and And
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokenClose || isKeyword(tok, "OR") {
+			break
+		}
+		if isKeyword(tok, "AND") {
+			p.pos++
+			continue
+		}
+		expr, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			and = append(and, expr)
+		}
+	}
+	switch len(and) {
+	case 0:
+		return nil, nil
+	case 1:
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokenOpen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); ok && next.kind == tokenClose {
+			p.pos++
+		}
+		return expr, nil
+	case tokenClose:
+		return nil, nil
+	}
+
+	switch tok.qualifier {
+	case "done":
+		done, err := parseDone(tok.text)
+		if err != nil {
+			return nil, err
+		}
+		p.query.Done = &done
+		return nil, nil
+	case "before":
+		before, err := parseBefore(tok.text, p.now)
+		if err != nil {
+			return nil, err
+		}
+		p.query.Before = &before
+		return nil, nil
+	}
+
+	text := tok.text
+	prefix := false
+	if tok.kind == tokenWord && strings.HasSuffix(text, "*") {
+		text = strings.TrimRight(text, "*")
+		prefix = true
+	}
+	words := Words(text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	return &Term{
+		Words:     words,
+		Prefix:    prefix,
+		NotesOnly: tok.qualifier == "note" || tok.qualifier == "notes",
+	}, nil
+}
+
+func parseDone(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y", "true", "1":
+		return true, nil
+	case "no", "n", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid done:%s, expecting done:yes or done:no", value)
+}
+
+var relativeDaysPattern = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// parseBefore accepts 2025-09-01, today, yesterday, 3d and 2w,
+// the latter two counting back from today
+func parseBefore(value string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	value = strings.ToLower(value)
+	switch value {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+	if m := relativeDaysPattern.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if m[2] == "w" {
+			n *= 7
+		}
+		return today.AddDate(0, 0, -n), nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid before:%s, expecting a date like 2025-09-01, today, yesterday or 3d", value)
+	}
+	return date, nil
+}
+
+// Terms lists the terms of the query, used for highlighting
+func (q *Query) Terms() []*Term {
+	var terms []*Term
+	var walk func(expr Expr)
+	walk = func(expr Expr) {
+		switch e := expr.(type) {
+		case *Term:
+			terms = append(terms, e)
+		case And:
+			for _, child := range e {
+				walk(child)
+			}
+		case Or:
+			for _, child := range e {
+				walk(child)
+			}
+		}
+	}
+	walk(q.Expr)
+	return terms
+}
+
+// MatchPrefixes makes single words match as prefixes,
+// for searching while the query is typed
+func (q *Query) MatchPrefixes() {
+	for _, term := range q.Terms() {
+		if len(term.Words) == 1 {
+			term.Prefix = true
+		}
+	}
+}
+
+// FTS returns the expression for an FTS5 MATCH over the columns
+// text and notes, "" when Expr is nil
+func (q *Query) FTS() string {
+	var format func(expr Expr) string
+	join := func(exprs []Expr, op string) string {
+		parts := make([]string, 0, len(exprs))
+		for _, expr := range exprs {
+			parts = append(parts, format(expr))
+		}
+		return "(" + strings.Join(parts, " "+op+" ") + ")"
+	}
+	format = func(expr Expr) string {
+		switch e := expr.(type) {
+		case *Term:
+			// words only hold letters and digits, so quoting is safe
+			s := `"` + strings.Join(e.Words, " ") + `"`
+			if e.Prefix {
+				s += " *"
+			}
+			if e.NotesOnly {
+				s = "notes : " + s
+			}
+			return s
+		case And:
+			return join(e, "AND")
+		case Or:
+			return join(e, "OR")
+		}
+		return ""
+	}
+	if q.Expr == nil {
+		return ""
+	}
+	return format(q.Expr)
+}
+
+// Keep applies the done: and before: qualifiers
+func (q *Query) Keep(kind models.SearchResultKind, done bool, createTime time.Time) bool {
+	if q.Done != nil && (kind != models.SearchResultKind_Entry || done != *q.Done) {
+		return false
+	}
+	if q.Before != nil && !createTime.Before(*q.Before) {
+		return false
+	}
+	return true
+}
+
+// Match evaluates the query against doc. The score counts the
+// matches, those in the text twice as much as those in notes.
+func (q *Query) Match(doc Document) (float64, bool) {
+	if q.Expr == nil {
+		return 0, true
+	}
+	text := Words(doc.Text)
+	notes := Words(doc.Notes)
+	var eval func(expr Expr) (float64, bool)
+	eval = func(expr Expr) (float64, bool) {
+		switch e := expr.(type) {
+		case *Term:
+			score := float64(len(e.find(notes)))
+			if !e.NotesOnly {
+				score += 2 * float64(len(e.find(text)))
+			}
+			return score, score > 0
+		case And:
+			var total float64
+			for _, child := range e {
+				score, ok := eval(child)
+				if !ok {
+					return 0, false
+				}
+				total += score
+			}
+			return total, true
+		case Or:
+			var total float64
+			matched := false
+			for _, child := range e {
+				if score, ok := eval(child); ok {
+					total += score
+					matched = true
+				}
+			}
+			return total, matched
+		}
+		return 0, false
+	}
+	return eval(q.Expr)
+}
+
+// find returns the indexes of words where the term starts
+func (t *Term) find(words []string) []int {
+	var found []int
+	n := len(t.Words)
+	for i := 0; i+n <= len(words); i++ {
+		if t.matchAt(words, i) {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+func (t *Term) matchAt(words []string, i int) bool {
+	n := len(t.Words)
+	for j, word := range t.Words {
+		if j == n-1 && t.Prefix {
+			if !strings.HasPrefix(words[i+j], word) {
+				return false
+			}
+		} else if words[i+j] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// Words splits s into lower-cased runs of letters and digits,
+// the same way the FTS5 unicode61 tokenizer does
+func Words(s string) []string {
+	spans := wordSpans(s)
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = span.word
+	}
+	return words
+}
+
+type span struct {
+	start int
+	end   int
+	word  string
+}
+
+func wordSpans(s string) []span {
+	var spans []span
+	start := -1
+	for i, r := range s {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			spans = append(spans, span{start: start, end: i, word: strings.ToLower(s[start:i])})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start: start, end: len(s), word: strings.ToLower(s[start:])})
+	}
+	return spans
+}
+
+// Highlight wraps the matches of the query's terms in text with
+// models.HighlightStart and models.HighlightEnd. notes tells whether
+// text is a note, where terms restricted to notes apply too.
+func (q *Query) Highlight(text string, notes bool) string {
+	spans := wordSpans(text)
+	marked := q.mark(spans, notes)
+	var b strings.Builder
+	last := 0
+	for i, span := range spans {
+		if !marked[i] {
+			continue
+		}
+		b.WriteString(text[last:span.start])
+		// adjacent matches, e.g. a phrase, share one highlight
+		if i == 0 || !marked[i-1] {
+			b.WriteString(models.HighlightStart)
+		}
+		b.WriteString(text[span.start:span.end])
+		last = span.end
+		if i+1 == len(spans) || !marked[i+1] {
+			b.WriteString(models.HighlightEnd)
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Snippet is Highlight cut down to about maxWords words around the
+// first match, "" when nothing matches
+func (q *Query) Snippet(text string, notes bool, maxWords int) string {
+	spans := wordSpans(text)
+	marked := q.mark(spans, notes)
+	first := -1
+	for i := range spans {
+		if marked[i] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+	start := max(0, first-maxWords/4)
+	end := min(len(spans), start+maxWords)
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if i > start {
+			b.WriteString(text[spans[i-1].end:spans[i].start])
+		}
+		if marked[i] && (i == start || !marked[i-1]) {
+			b.WriteString(models.HighlightStart)
+		}
+		b.WriteString(text[spans[i].start:spans[i].end])
+		if marked[i] && (i+1 == end || !marked[i+1]) {
+			b.WriteString(models.HighlightEnd)
+		}
+	}
+	if end < len(spans) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func (q *Query) mark(spans []span, notes bool) []bool {
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = span.word
+	}
+	marked := make([]bool, len(spans))
+	for _, term := range q.Terms() {
+		if term.NotesOnly && !notes {
+			continue
+		}
+		for _, i := range term.find(words) {
+			for j := range term.Words {
+				marked[i+j] = true
+			}
+		}
+	}
+	return marked
+}
+
+// SnippetWords is the length of search snippets in words
+const SnippetWords = 12
+
+// Candidate is an entry or a happening for Search
+type Candidate struct {
+	Kind       models.SearchResultKind
+	ID         int64
+	Text       string
+	Notes      []string
+	Done       bool
+	CreateTime time.Time
+}
+
+// Search matches the candidates, for backends without a full-text
+// index. It returns at most limit results, best and then newest first.
+func (q *Query) Search(candidates []Candidate, limit int) []models.SearchResult {
+	var results []models.SearchResult
+	for _, c := range candidates {
+		if !q.Keep(c.Kind, c.Done, c.CreateTime) {
+			continue
+		}
+		notes := strings.Join(c.Notes, "\n")
+		score, ok := q.Match(Document{Text: c.Text, Notes: notes})
+		if !ok {
+			continue
+		}
+		results = append(results, models.SearchResult{
+			Kind:        c.Kind,
+			ID:          c.ID,
+			Text:        c.Text,
+			Done:        c.Done,
+			CreateTime:  c.CreateTime,
+			Score:       score,
+			Snippet:     q.Snippet(c.Text, false, SnippetWords),
+			NoteSnippet: q.Snippet(notes, true, SnippetWords),
+		})
+	}
+	SortResults(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// SortResults sorts by score, then newest first
+func SortResults(results []models.SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.CreateTime.Equal(b.CreateTime) {
+			return a.CreateTime.After(b.CreateTime)
+		}
+		return a.ID > b.ID
+	})
+}
@@ -0,0 +1,172 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/models"
+)
+
+var now = time.Date(2025, 9, 10, 15, 0, 0, 0, time.Local)
+
+func TestParseFTS(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   bool
+	}{
+		{input: "deploy", want: `"deploy"`},
+		{input: "Deploy staging", want: `("deploy" AND "staging")`},
+		{input: "deploy AND staging", want: `("deploy" AND "staging")`},
+		{input: "deploy OR release staging", want: `("deploy" OR ("release" AND "staging"))`},
+		{input: "(deploy OR release) staging", want: `(("deploy" OR "release") AND "staging")`},
+		{input: `"staging db" migr*`, want: `("staging db" AND "migr" *)`},
+		{input: `note:rollback note:"root cause"`, want: `(notes : "rollback" AND notes : "root cause")`},
+		{input: "fix-login", want: `"fix login"`},
+		{input: "deploy done:no before:2025-09-01", want: `"deploy"`},
+		{input: "done:yes", want: ""},
+		// incomplete input while typing
+		{input: `deploy OR`, want: `"deploy"`},
+		{input: `"staging db`, want: `"staging db"`},
+		{input: `(deploy OR release`, want: `("deploy" OR "release")`},
+		{input: "done:maybe", err: true},
+		{input: "before:someday", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q, err := Parse(tt.input, now)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got %s", q.FTS())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.FTS(); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestQualifiers(t *testing.T) {
+	q, err := Parse("done:no before:3d", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Done == nil || *q.Done {
+		t.Fatalf("expected done:no, got %v", q.Done)
+	}
+	wantBefore := time.Date(2025, 9, 7, 0, 0, 0, 0, time.Local)
+	if q.Before == nil || !q.Before.Equal(wantBefore) {
+		t.Fatalf("expected before %v, got %v", wantBefore, q.Before)
+	}
+	old := time.Date(2025, 9, 1, 0, 0, 0, 0, time.Local)
+	if !q.Keep(models.SearchResultKind_Entry, false, old) {
+		t.Errorf("expected an old open entry to be kept")
+	}
+	if q.Keep(models.SearchResultKind_Entry, true, old) {
+		t.Errorf("expected a done entry to be dropped")
+	}
+	if q.Keep(models.SearchResultKind_Happening, false, old) {
+		t.Errorf("expected happenings to be dropped by done:")
+	}
+	if q.Keep(models.SearchResultKind_Entry, false, now) {
+		t.Errorf("expected a new entry to be dropped")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	doc := Document{
+		Text:  "Deploy the staging DB",
+		Notes: "rollback plan\nroot cause: missing index",
+	}
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{query: "deploy", match: true},
+		{query: "deploy production", match: false},
+		{query: "production OR staging", match: true},
+		{query: `"staging db"`, match: true},
+		{query: `"db staging"`, match: false},
+		{query: "stag*", match: true},
+		{query: "stag", match: false},
+		{query: "rollback", match: true},
+		{query: "note:rollback", match: true},
+		{query: "note:deploy", match: false},
+		{query: `note:"root cause"`, match: true},
+		{query: "done:no", match: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := q.Match(doc); ok != tt.match {
+				t.Errorf("expected match %v, got %v", tt.match, ok)
+			}
+		})
+	}
+
+	// text matches weigh more than note matches
+	q, _ := Parse("index", now)
+	inNotes, _ := q.Match(Document{Text: "tune db", Notes: "add an index"})
+	inText, _ := q.Match(Document{Text: "add an index"})
+	if inText <= inNotes {
+		t.Errorf("expected text match to score higher, got %v <= %v", inText, inNotes)
+	}
+}
+
+func TestHighlightAndSnippet(t *testing.T) {
+	q, err := Parse(`"staging db" note:plan`, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const s, e = models.HighlightStart, models.HighlightEnd
+
+	if got, want := q.Highlight("Deploy the Staging-DB plan", false), "Deploy the "+s+"Staging-DB"+e+" plan"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := q.Highlight("the plan", true), "the "+s+"plan"+e; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	text := "one two three four five six seven eight nine ten plan eleven twelve thirteen fourteen fifteen"
+	if got, want := q.Snippet(text, true, 6), "…ten "+s+"plan"+e+" eleven twelve thirteen fourteen…"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := q.Snippet(text, false, 6); got != "" {
+		t.Errorf("expected no snippet without a match, got %q", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	q, err := Parse("deploy", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(d int) time.Time {
+		return time.Date(2025, 9, d, 0, 0, 0, 0, time.Local)
+	}
+	results := q.Search([]Candidate{
+		{Kind: models.SearchResultKind_Entry, ID: 1, Text: "write docs", Notes: []string{"deploy after review"}, CreateTime: day(1)},
+		{Kind: models.SearchResultKind_Entry, ID: 2, Text: "deploy api", CreateTime: day(2)},
+		{Kind: models.SearchResultKind_Happening, ID: 3, Text: "deploy went fine", CreateTime: day(3)},
+		{Kind: models.SearchResultKind_Entry, ID: 4, Text: "unrelated", CreateTime: day(4)},
+	}, 10)
+	var ids []int64
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	// text matches first, newest first among equal scores
+	if len(ids) != 3 || ids[0] != 3 || ids[1] != 2 || ids[2] != 1 {
+		t.Fatalf("unexpected ranking: %v", ids)
+	}
+	if results[2].Snippet != "" || results[2].NoteSnippet == "" {
+		t.Errorf("expected a note snippet only, got %+v", results[2])
+	}
+}
@@ -0,0 +1,281 @@
+// Package quickadd parses the inline markers of the add input,
+// e.g. "fix build @tomorrow 5pm ^today *daily"
+package quickadd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/todo/internal/recur"
+)
+
+// Result is an input line with its markers taken out
+type Result struct {
+	// Text is the input without the markers, spaced as typed
+	Text          string
+	DueTime       *time.Time
+	ScheduledTime *time.Time
+	// Repeat is the canonical repeat rule, "" for "*never"
+	Repeat *string
+}
+
+// HasMarkers reports whether any marker was recognized
+func (r Result) HasMarkers() bool {
+	return r.DueTime != nil || r.ScheduledTime != nil || r.Repeat != nil
+}
+
+// Parse extracts "@<when>" (due time) and "^<when>" (scheduled time).
+// <when> is a date, a time of day or both, spread over one or more words:
+//
+//	today, tonight, tomorrow (tmr), mon..sun, +3d, +2w, 2025-09-01, 09-01, 9/1
+//	5pm, 5:30pm, 17:00, noon
+//
+// A date without time is due at the end of the day and scheduled at its start.
+// A time without date is the next such time from now.
+//
+// "*<rule>" sets the repeat rule, see recur.Parse, and "*never" clears it.
+// Markers that do not parse, e.g. "@alice", are kept as text.
+func Parse(text string, now time.Time) Result {
+	spans := wordPattern.FindAllStringIndex(text, -1)
+	wordAt := func(i int) string {
+		return text[spans[i][0]:spans[i][1]]
+	}
+	var result Result
+	removed := make([]bool, len(spans))
+	for i := 0; i < len(spans); i++ {
+		word := wordAt(i)
+		if len(word) >= 2 && word[0] == '*' {
+			if repeat, ok := parseRepeat(word[1:]); ok {
+				result.Repeat = &repeat
+				removed[i] = true
+				continue
+			}
+		}
+		if len(word) < 2 || (word[0] != '@' && word[0] != '^') {
+			continue
+		}
+		due := word[0] == '@'
+		var w when
+		if !w.add(word[1:], now) {
+			continue
+		}
+		removed[i] = true
+		for i+1 < len(spans) && w.add(wordAt(i+1), now) {
+			i++
+			removed[i] = true
+		}
+		t := w.resolve(now, due)
+		if due {
+			result.DueTime = &t
+		} else {
+			result.ScheduledTime = &t
+		}
+	}
+	result.Text = removeWords(text, spans, removed)
+	return result
+}
+
+var wordPattern = regexp.MustCompile(`\S+`)
+
+// removeWords cuts the removed words out of text, each run of them
+// with the space before it, or after it at the start. The rest keeps
+// its spacing and line breaks as typed.
+func removeWords(text string, spans [][]int, removed []bool) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(spans); i++ {
+		if !removed[i] {
+			continue
+		}
+		j := i
+		for j+1 < len(spans) && removed[j+1] {
+			j++
+		}
+		start, end := spans[i][0], spans[j][1]
+		switch {
+		case i > 0:
+			start = spans[i-1][1]
+		case j+1 < len(spans):
+			start, end = 0, spans[j+1][0]
+		default:
+			start, end = 0, len(text)
+		}
+		b.WriteString(text[last:start])
+		last = end
+		i = j
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func parseRepeat(word string) (string, bool) {
+	if strings.EqualFold(word, "never") {
+		return "", true
+	}
+	rule, err := recur.Parse(word)
+	if err != nil {
+		return "", false
+	}
+	return rule.String(), true
+}
+
+// when accumulates the date and time parts of a marker
+type when struct {
+	date    *time.Time
+	hasTime bool
+	hour    int
+	minute  int
+	// tonight implies a default time
+	defaultHour int
+}
+
+var (
+	relativePattern = regexp.MustCompile(`^\+?(\d+)([dw])$`)
+	isoDatePattern  = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	monthDayPattern = regexp.MustCompile(`^(\d{1,2})[-/](\d{1,2})$`)
+	clockPattern    = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	ampmPattern     = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// add consumes word if it is a date or time part not seen yet
+func (w *when) add(word string, now time.Time) bool {
+	word = strings.ToLower(word)
+	if w.date == nil {
+		if date, defaultHour, ok := parseDate(word, now); ok {
+			w.date = &date
+			w.defaultHour = defaultHour
+			return true
+		}
+	}
+	if !w.hasTime {
+		if hour, minute, ok := parseClock(word); ok {
+			w.hasTime = true
+			w.hour = hour
+			w.minute = minute
+			return true
+		}
+	}
+	return false
+}
+
+func (w *when) resolve(now time.Time, due bool) time.Time {
+	if w.date == nil {
+		t := time.Date(now.Year(), now.Month(), now.Day(), w.hour, w.minute, 0, 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t
+	}
+	d := *w.date
+	switch {
+	case w.hasTime:
+		return time.Date(d.Year(), d.Month(), d.Day(), w.hour, w.minute, 0, 0, d.Location())
+	case w.defaultHour > 0:
+		return time.Date(d.Year(), d.Month(), d.Day(), w.defaultHour, 0, 0, 0, d.Location())
+	case due:
+		return time.Date(d.Year(), d.Month(), d.Day(), 23, 59, 59, 0, d.Location())
+	default:
+		return d
+	}
+}
+
+// parseDate returns the start of the day word refers to
+func parseDate(word string, now time.Time) (time.Time, int, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch word {
+	case "today", "tod":
+		return today, 0, true
+	case "tonight":
+		return today, 20, true
+	case "tomorrow", "tmr", "tmrw":
+		return today.AddDate(0, 0, 1), 0, true
+	}
+	if wd, ok := weekdays[word]; ok {
+		days := (int(wd) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return today.AddDate(0, 0, days), 0, true
+	}
+	if m := relativePattern.FindStringSubmatch(word); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if m[2] == "w" {
+			n *= 7
+		}
+		return today.AddDate(0, 0, n), 0, true
+	}
+	if m := isoDatePattern.FindStringSubmatch(word); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		return makeDate(year, month, day, now.Location())
+	}
+	if m := monthDayPattern.FindStringSubmatch(word); m != nil {
+		month, _ := strconv.Atoi(m[1])
+		day, _ := strconv.Atoi(m[2])
+		date, _, ok := makeDate(today.Year(), month, day, now.Location())
+		if !ok {
+			return time.Time{}, 0, false
+		}
+		// a month-day already passed this year means next year
+		if date.Before(today) {
+			date = date.AddDate(1, 0, 0)
+		}
+		return date, 0, true
+	}
+	return time.Time{}, 0, false
+}
+
+func makeDate(year int, month int, day int, loc *time.Location) (time.Time, int, bool) {
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, 0, false
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+	// reject dates that normalize into another month, e.g. 02-30
+	if date.Month() != time.Month(month) {
+		return time.Time{}, 0, false
+	}
+	return date, 0, true
+}
+
+func parseClock(word string) (int, int, bool) {
+	if word == "noon" {
+		return 12, 0, true
+	}
+	if m := clockPattern.FindStringSubmatch(word); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour > 23 || minute > 59 {
+			return 0, 0, false
+		}
+		return hour, minute, true
+	}
+	if m := ampmPattern.FindStringSubmatch(word); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute := 0
+		if m[2] != "" {
+			minute, _ = strconv.Atoi(m[2])
+		}
+		if hour < 1 || hour > 12 || minute > 59 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+		return hour, minute, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,81 @@
+package quickadd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// Wednesday
+	now := time.Date(2025, 9, 3, 14, 30, 0, 0, time.Local)
+	at := func(month time.Month, day int, hour int, minute int, sec int) *time.Time {
+		t := time.Date(2025, month, day, hour, minute, sec, 0, time.Local)
+		return &t
+	}
+
+	tests := []struct {
+		input     string
+		text      string
+		due       *time.Time
+		scheduled *time.Time
+		repeat    *string
+	}{
+		{input: "plain text", text: "plain text"},
+		{input: "fix build @tomorrow 5pm", text: "fix build", due: at(9, 4, 17, 0, 0)},
+		{input: "fix build @tomorrow", text: "fix build", due: at(9, 4, 23, 59, 59)},
+		{input: "@5pm call bob", text: "call bob", due: at(9, 3, 17, 0, 0)},
+		{input: "call bob @9am", text: "call bob", due: at(9, 4, 9, 0, 0)},
+		{input: "standup @mon 10:15", text: "standup", due: at(9, 8, 10, 15, 0)},
+		{input: "weekly @wed", text: "weekly", due: at(9, 10, 23, 59, 59)},
+		{input: "report @+3d noon", text: "report", due: at(9, 6, 12, 0, 0)},
+		{input: "report @2w", text: "report", due: at(9, 17, 23, 59, 59)},
+		{input: "taxes @2025-09-30 5:30pm", text: "taxes", due: at(9, 30, 17, 30, 0)},
+		{input: "party @9/1", text: "party", due: func() *time.Time {
+			t := time.Date(2026, 9, 1, 23, 59, 59, 0, time.Local)
+			return &t
+		}()},
+		{input: "movie @tonight", text: "movie", due: at(9, 3, 20, 0, 0)},
+		{input: "design ^today @fri", text: "design", due: at(9, 5, 23, 59, 59), scheduled: at(9, 3, 0, 0, 0)},
+		{input: "ping @alice about it", text: "ping @alice about it"},
+		{input: "bad date @02-30", text: "bad date @02-30"},
+		{input: "keep @ alone", text: "keep @ alone"},
+		{input: "water plants *daily", text: "water plants", repeat: str("daily")},
+		{input: "standup *weekdays @9am", text: "standup", due: at(9, 4, 9, 0, 0), repeat: str("weekdays")},
+		{input: "backup *3d", text: "backup", repeat: str("3d")},
+		{input: "rent *monthly:1 @10/1", text: "rent", due: at(10, 1, 23, 59, 59), repeat: str("monthly:1")},
+		{input: "chore *never", text: "chore", repeat: str("")},
+		{input: "2 * 3 *bold*", text: "2 * 3 *bold*"},
+		{input: "keep  two spaces\nand a line", text: "keep  two spaces\nand a line"},
+		{input: "call @9am  bob\nabout it", text: "call  bob\nabout it", due: at(9, 4, 9, 0, 0)},
+		{input: "@tomorrow 5pm\tcall  bob", text: "call  bob", due: at(9, 4, 17, 0, 0)},
+		{input: "@tomorrow *daily", text: "", due: at(9, 4, 23, 59, 59), repeat: str("daily")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := Parse(tt.input, now)
+			if got.Text != tt.text {
+				t.Errorf("text: expected %q, got %q", tt.text, got.Text)
+			}
+			if !sameTime(got.DueTime, tt.due) {
+				t.Errorf("due: expected %v, got %v", tt.due, got.DueTime)
+			}
+			if !sameTime(got.ScheduledTime, tt.scheduled) {
+				t.Errorf("scheduled: expected %v, got %v", tt.scheduled, got.ScheduledTime)
+			}
+			if (got.Repeat == nil) != (tt.repeat == nil) || (got.Repeat != nil && *got.Repeat != *tt.repeat) {
+				t.Errorf("repeat: expected %v, got %v", tt.repeat, got.Repeat)
+			}
+		})
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func str(s string) *string {
+	return &s
+}
@@ -0,0 +1,177 @@
+// Package recur implements the repeat rules of recurring entries,
+// e.g. "daily", "weekdays", "3d" or "monthly:15"
+package recur
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/todo/models"
+)
+
+type Kind int
+
+const (
+	Kind_Daily Kind = iota + 1
+	Kind_Weekdays
+	// Kind_EveryDays repeats every N days
+	Kind_EveryDays
+	// Kind_Monthly repeats on day N of every month,
+	// or the last day of shorter months
+	Kind_Monthly
+)
+
+type Rule struct {
+	Kind Kind
+	N    int
+}
+
+var (
+	everyPattern   = regexp.MustCompile(`^(\d+)([dw])$`)
+	monthlyPattern = regexp.MustCompile(`^monthly:(\d+)$`)
+)
+
+// Parse parses a rule as written after "*" in the add input:
+//
+//	daily, weekdays, weekly, 3d, 2w, monthly:15
+func Parse(s string) (Rule, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "daily", "everyday":
+		return Rule{Kind: Kind_Daily}, nil
+	case "weekdays":
+		return Rule{Kind: Kind_Weekdays}, nil
+	case "weekly":
+		return Rule{Kind: Kind_EveryDays, N: 7}, nil
+	}
+	if m := everyPattern.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 {
+			return Rule{}, fmt.Errorf("invalid repeat interval: %s", s)
+		}
+		if m[2] == "w" {
+			n *= 7
+		}
+		if n == 1 {
+			return Rule{Kind: Kind_Daily}, nil
+		}
+		return Rule{Kind: Kind_EveryDays, N: n}, nil
+	}
+	if m := monthlyPattern.FindStringSubmatch(s); m != nil {
+		day, err := strconv.Atoi(m[1])
+		if err != nil || day < 1 || day > 31 {
+			return Rule{}, fmt.Errorf("invalid day of month: %s", s)
+		}
+		return Rule{Kind: Kind_Monthly, N: day}, nil
+	}
+	return Rule{}, fmt.Errorf("unrecognized repeat rule: %q", s)
+}
+
+// String is the canonical form stored in LogEntry.Repeat
+func (r Rule) String() string {
+	switch r.Kind {
+	case Kind_Daily:
+		return "daily"
+	case Kind_Weekdays:
+		return "weekdays"
+	case Kind_EveryDays:
+		if r.N == 7 {
+			return "weekly"
+		}
+		return fmt.Sprintf("%dd", r.N)
+	case Kind_Monthly:
+		return fmt.Sprintf("monthly:%d", r.N)
+	}
+	return ""
+}
+
+// Next returns the first occurrence on a day after t's day,
+// at the same time of day as t
+func (r Rule) Next(t time.Time) time.Time {
+	switch r.Kind {
+	case Kind_Weekdays:
+		next := t.AddDate(0, 0, 1)
+		for next.Weekday() == time.Saturday || next.Weekday() == time.Sunday {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	case Kind_EveryDays:
+		return t.AddDate(0, 0, r.N)
+	case Kind_Monthly:
+		year, month, day := t.Date()
+		if d := dayInMonth(year, month, r.N); d > day {
+			return withDate(t, year, month, d)
+		}
+		// the first of next month never overflows
+		next := time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+		return withDate(t, next.Year(), next.Month(), dayInMonth(next.Year(), next.Month(), r.N))
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+func dayInMonth(year int, month time.Month, day int) int {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > last {
+		return last
+	}
+	return day
+}
+
+func withDate(t time.Time, year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// NextOccurrence builds the entry that follows entry once it is done at
+// doneTime. The due time, or the scheduled time if there is no due time,
+// moves to the first occurrence not before the day of doneTime, and the
+// other one keeps its distance to it. Entries with neither are scheduled
+// at the start of the next occurrence after doneTime.
+func NextOccurrence(entry models.LogEntry, doneTime time.Time) (models.LogEntry, error) {
+	rule, err := Parse(entry.Repeat)
+	if err != nil {
+		return models.LogEntry{}, err
+	}
+	next := models.LogEntry{
+		Text:           entry.Text,
+		HighlightLevel: entry.HighlightLevel,
+		ParentID:       entry.ParentID,
+		Repeat:         rule.String(),
+		PreviousID:     entry.ID,
+	}
+
+	anchor := entry.DueTime
+	if anchor == nil {
+		anchor = entry.ScheduledTime
+	}
+	if anchor == nil {
+		day := rule.Next(doneTime)
+		scheduled := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+		next.ScheduledTime = &scheduled
+		return next, nil
+	}
+
+	t := rule.Next(*anchor)
+	for beforeDay(t, doneTime) {
+		t = rule.Next(t)
+	}
+	shift := func(old *time.Time) *time.Time {
+		if old == nil {
+			return nil
+		}
+		moved := t.Add(old.Sub(*anchor))
+		return &moved
+	}
+	next.DueTime = shift(entry.DueTime)
+	next.ScheduledTime = shift(entry.ScheduledTime)
+	return next, nil
+}
+
+// beforeDay reports whether t falls on a day before ref's day
+func beforeDay(t time.Time, ref time.Time) bool {
+	y, m, d := ref.In(t.Location()).Date()
+	return t.Before(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+}
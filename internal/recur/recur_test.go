@@ -0,0 +1,164 @@
+package recur
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   bool
+	}{
+		{input: "daily", want: "daily"},
+		{input: "Everyday", want: "daily"},
+		{input: "1d", want: "daily"},
+		{input: "weekdays", want: "weekdays"},
+		{input: "weekly", want: "weekly"},
+		{input: "1w", want: "weekly"},
+		{input: "3d", want: "3d"},
+		{input: "2w", want: "14d"},
+		{input: "monthly:15", want: "monthly:15"},
+		{input: "monthly:0", err: true},
+		{input: "monthly:32", err: true},
+		{input: "0d", err: true},
+		{input: "monthly", err: true},
+		{input: "hourly", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			rule, err := Parse(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, rule.String())
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.Local)
+	}
+	tests := []struct {
+		rule string
+		from time.Time
+		want time.Time
+	}{
+		{rule: "daily", from: date(2025, 9, 3), want: date(2025, 9, 4)},
+		{rule: "daily", from: date(2025, 12, 31), want: date(2026, 1, 1)},
+		// Wednesday, Friday, Saturday
+		{rule: "weekdays", from: date(2025, 9, 3), want: date(2025, 9, 4)},
+		{rule: "weekdays", from: date(2025, 9, 5), want: date(2025, 9, 8)},
+		{rule: "weekdays", from: date(2025, 9, 6), want: date(2025, 9, 8)},
+		{rule: "3d", from: date(2025, 9, 30), want: date(2025, 10, 3)},
+		{rule: "weekly", from: date(2025, 9, 3), want: date(2025, 9, 10)},
+		{rule: "monthly:15", from: date(2025, 9, 3), want: date(2025, 9, 15)},
+		{rule: "monthly:15", from: date(2025, 9, 15), want: date(2025, 10, 15)},
+		{rule: "monthly:15", from: date(2025, 12, 20), want: date(2026, 1, 15)},
+		{rule: "monthly:31", from: date(2025, 1, 31), want: date(2025, 2, 28)},
+		{rule: "monthly:31", from: date(2025, 2, 28), want: date(2025, 3, 31)},
+		{rule: "monthly:30", from: date(2024, 2, 10), want: date(2024, 2, 29)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+" "+tt.from.Format("2006-01-02"), func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	at := func(month time.Month, day int, hour int, minute int) *time.Time {
+		t := time.Date(2025, month, day, hour, minute, 0, 0, time.Local)
+		return &t
+	}
+	tests := []struct {
+		name          string
+		entry         models.LogEntry
+		doneTime      time.Time
+		wantDue       *time.Time
+		wantScheduled *time.Time
+	}{
+		{
+			name:          "no dates is scheduled next day",
+			entry:         models.LogEntry{Repeat: "daily"},
+			doneTime:      *at(9, 3, 14, 0),
+			wantScheduled: at(9, 4, 0, 0),
+		},
+		{
+			name:     "done on time",
+			entry:    models.LogEntry{Repeat: "daily", DueTime: at(9, 3, 17, 0)},
+			doneTime: *at(9, 3, 16, 0),
+			wantDue:  at(9, 4, 17, 0),
+		},
+		{
+			name:     "done late skips missed occurrences",
+			entry:    models.LogEntry{Repeat: "daily", DueTime: at(9, 1, 17, 0)},
+			doneTime: *at(9, 3, 20, 0),
+			wantDue:  at(9, 3, 17, 0),
+		},
+		{
+			name:     "done early keeps the cadence",
+			entry:    models.LogEntry{Repeat: "weekly", DueTime: at(9, 10, 12, 0)},
+			doneTime: *at(9, 3, 8, 0),
+			wantDue:  at(9, 17, 12, 0),
+		},
+		{
+			name:          "scheduled keeps its distance to due",
+			entry:         models.LogEntry{Repeat: "monthly:15", DueTime: at(9, 15, 18, 0), ScheduledTime: at(9, 13, 9, 0)},
+			doneTime:      *at(9, 14, 10, 0),
+			wantDue:       at(10, 15, 18, 0),
+			wantScheduled: at(10, 13, 9, 0),
+		},
+		{
+			name:          "scheduled only",
+			entry:         models.LogEntry{Repeat: "weekdays", ScheduledTime: at(9, 5, 9, 0)},
+			doneTime:      *at(9, 5, 11, 0),
+			wantScheduled: at(9, 8, 9, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.ID = 7
+			tt.entry.Text = "chore"
+			tt.entry.ParentID = 3
+			next, err := NextOccurrence(tt.entry, tt.doneTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next.Text != "chore" || next.ParentID != 3 || next.PreviousID != 7 || next.Done {
+				t.Errorf("unexpected occurrence: %+v", next)
+			}
+			if !sameTime(next.DueTime, tt.wantDue) {
+				t.Errorf("due: expected %v, got %v", tt.wantDue, next.DueTime)
+			}
+			if !sameTime(next.ScheduledTime, tt.wantScheduled) {
+				t.Errorf("scheduled: expected %v, got %v", tt.wantScheduled, next.ScheduledTime)
+			}
+		})
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -10,7 +10,7 @@ import (
 func main() {
 	err := run.Main(os.Args[1:])
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(run.ExitCode(err))
 	}
 }
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+type DueStatus int
+
+const (
+	DueStatus_None DueStatus = iota
+	DueStatus_Upcoming
+	DueStatus_Today
+	DueStatus_Overdue
+)
+
+// DueStatus classifies the entry's due time relative to now,
+// done entries are never overdue
+func (c *LogEntry) DueStatus(now time.Time) DueStatus {
+	if c.DueTime == nil || c.Done {
+		return DueStatus_None
+	}
+	due := *c.DueTime
+	if due.Before(now) {
+		return DueStatus_Overdue
+	}
+	y, m, d := now.Date()
+	dy, dm, dd := due.Date()
+	if y == dy && m == dm && d == dd {
+		return DueStatus_Today
+	}
+	return DueStatus_Upcoming
+}
+
+// FormatDueTime renders t compactly relative to now, e.g. "17:00",
+// "tomorrow", "Mon 09-08 10:15" or "2026-01-02".
+// Times at the start or end of a day are shown as dates only.
+func FormatDueTime(t time.Time, now time.Time) string {
+	clock := ""
+	if !isDayBoundary(t) {
+		clock = t.Format("15:04")
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, t.Location())
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	days := int(day.Sub(today).Hours() / 24)
+
+	var date string
+	switch {
+	case days == 0:
+		if clock != "" {
+			return clock
+		}
+		date = "today"
+	case days == 1:
+		date = "tomorrow"
+	case days == -1:
+		date = "yesterday"
+	case t.Year() == now.Year():
+		date = t.Format("Mon 01-02")
+	default:
+		date = t.Format("2006-01-02")
+	}
+	if clock == "" {
+		return date
+	}
+	return date + " " + clock
+}
+
+func isDayBoundary(t time.Time) bool {
+	h, m, s := t.Clock()
+	return (h == 0 && m == 0 && s == 0) || (h == 23 && m == 59 && s == 59)
+}
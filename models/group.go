@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Group is a user-defined group of entries in group view
+type Group struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Position orders groups in group view, ascending
+	Position   int       `json:"position"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+type GroupOptional struct {
+	Name     *string `json:"name,omitempty"`
+	Position *int    `json:"position,omitempty"`
+}
+
+func (c *Group) Update(optional *GroupOptional) {
+	if optional == nil {
+		return
+	}
+	if optional.Name != nil {
+		c.Name = *optional.Name
+	}
+	if optional.Position != nil {
+		c.Position = *optional.Position
+	}
+}
+
+// GroupMembership puts an entry into a group. GroupID 0 detaches the
+// entry, so it follows its parent or falls into the Other group.
+type GroupMembership struct {
+	EntryID int64 `json:"entry_id"`
+	GroupID int64 `json:"group_id"`
+}
+
+// DefaultGroups are the groups of a new store, with IDs 1 to 5
+// as used by the former hardcoded group list
+var DefaultGroups = []string{"Deadline", "WorkPerf", "LifeEnhance", "WorkHack", "LifeHack"}
+
+// NewDefaultGroups returns DefaultGroups with their IDs and positions
+func NewDefaultGroups(now time.Time) []Group {
+	groups := make([]Group, len(DefaultGroups))
+	for i, name := range DefaultGroups {
+		groups[i] = Group{
+			ID:         int64(i + 1),
+			Name:       name,
+			Position:   i + 1,
+			CreateTime: now,
+			UpdateTime: now,
+		}
+	}
+	return groups
+}
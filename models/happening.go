@@ -14,6 +14,9 @@ type HappeningOptional struct {
 	Content    *string    `json:"content"`
 	CreateTime *time.Time `json:"create_time"`
 	UpdateTime *time.Time `json:"update_time"`
+	// IfUpdateTime makes the update apply only if the happening is
+	// unchanged since it was read, like LogEntryOptional.IfUpdateTime
+	IfUpdateTime *time.Time `json:"if_update_time,omitempty"`
 }
 
 func (c *Happening) Update(optional *HappeningOptional) {
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -15,19 +16,67 @@ type LogEntry struct {
 	HighlightLevel  int        `json:"highlight_level"`
 	Collapsed       bool       `json:"collapsed"`
 	ParentID        int64      `json:"parent_id"`
+	// DueTime is when the entry must be done by
+	DueTime *time.Time `json:"due_time,omitempty"`
+	// ScheduledTime is when work on the entry is planned to start
+	ScheduledTime *time.Time `json:"scheduled_time,omitempty"`
+	// Repeat is the recurrence rule, e.g. "daily" or "monthly:15",
+	// completing the entry adds its next occurrence as a sibling
+	Repeat string `json:"repeat,omitempty"`
+	// PreviousID links an occurrence to the one it was generated from
+	PreviousID int64 `json:"previous_id,omitempty"`
+	// DeletedTime is when the entry was moved to trash, entries
+	// deleted together share it
+	DeletedTime *time.Time `json:"deleted_time,omitempty"`
 }
 
+// LogEntryOptional omits unset fields in JSON, so an explicit null
+// in a double pointer field (e.g. done_time) means clearing it
 type LogEntryOptional struct {
-	ID              *int64      `json:"id"`
-	Text            *string     `json:"text"`
-	Done            *bool       `json:"done"`
-	DoneTime        **time.Time `json:"done_time"`
-	CreateTime      *time.Time  `json:"create_time"`
-	UpdateTime      *time.Time  `json:"update_time"`
-	AdjustedTopTime *int64      `json:"adjusted_top_time"`
-	HighlightLevel  *int        `json:"highlight_level"`
-	Collapsed       *bool       `json:"collapsed"`
-	ParentID        *int64      `json:"parent_id"`
+	ID              *int64      `json:"id,omitempty"`
+	Text            *string     `json:"text,omitempty"`
+	Done            *bool       `json:"done,omitempty"`
+	DoneTime        **time.Time `json:"done_time,omitempty"`
+	CreateTime      *time.Time  `json:"create_time,omitempty"`
+	UpdateTime      *time.Time  `json:"update_time,omitempty"`
+	AdjustedTopTime *int64      `json:"adjusted_top_time,omitempty"`
+	HighlightLevel  *int        `json:"highlight_level,omitempty"`
+	Collapsed       *bool       `json:"collapsed,omitempty"`
+	ParentID        *int64      `json:"parent_id,omitempty"`
+	DueTime         **time.Time `json:"due_time,omitempty"`
+	ScheduledTime   **time.Time `json:"scheduled_time,omitempty"`
+	Repeat          *string     `json:"repeat,omitempty"`
+	// IfUpdateTime makes the update apply only if the entry's update
+	// time is still the same instant as this one, to the nanosecond,
+	// see storage.CheckUpdateTime
+	IfUpdateTime *time.Time `json:"if_update_time,omitempty"`
+}
+
+// DecodeLogEntryOptional keeps explicit nulls of double pointer
+// fields, which encoding/json would otherwise treat as absent
+func DecodeLogEntryOptional(data []byte) (LogEntryOptional, error) {
+	var update LogEntryOptional
+	if len(data) == 0 {
+		return update, nil
+	}
+	if err := json.Unmarshal(data, &update); err != nil {
+		return update, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return update, err
+	}
+	for key, field := range map[string]***time.Time{
+		"done_time":      &update.DoneTime,
+		"due_time":       &update.DueTime,
+		"scheduled_time": &update.ScheduledTime,
+	} {
+		if v, ok := fields[key]; ok && string(v) == "null" {
+			var t *time.Time
+			*field = &t
+		}
+	}
+	return update, nil
 }
 
 func (c *LogEntry) Update(optional *LogEntryOptional) {
@@ -64,6 +113,15 @@ func (c *LogEntry) Update(optional *LogEntryOptional) {
 	if optional.ParentID != nil {
 		c.ParentID = *optional.ParentID
 	}
+	if optional.DueTime != nil {
+		c.DueTime = *optional.DueTime
+	}
+	if optional.ScheduledTime != nil {
+		c.ScheduledTime = *optional.ScheduledTime
+	}
+	if optional.Repeat != nil {
+		c.Repeat = *optional.Repeat
+	}
 }
 
 // GetID returns the ID of the log entry
@@ -79,12 +137,40 @@ func (le *LogEntry) SetID(id int64) {
 type Config struct {
 	LastInput  string `json:"last_input"`
 	RunningPID int    `json:"running_pid"`
+	// ServingPID is the PID of todo serve
+	ServingPID int `json:"serving_pid,omitempty"`
 	// value: sqlite(default), file, server
 	StorageType string `json:"storage_type,omitempty"`
 
 	// server_addr and server_token are only used when storage_type is server
 	ServerAddr  string `json:"server_addr,omitempty"`
 	ServerToken string `json:"server_token,omitempty"`
+
+	Backup *BackupConfig `json:"backup,omitempty"`
+
+	ServerClient *ServerClientConfig `json:"server_client,omitempty"`
+}
+
+// ServerClientConfig configures the requests of storage_type server
+type ServerClientConfig struct {
+	// Timeout of each attempt of a request like "30s", default 10s
+	Timeout string `json:"timeout,omitempty"`
+	// Retries is how many times a request failing on the way is sent
+	// again, default 3
+	Retries *int `json:"retries,omitempty"`
+}
+
+// BackupConfig configures the backups of file and sqlite storage
+type BackupConfig struct {
+	// Disabled turns off the backups taken on startup and every interval
+	Disabled bool `json:"disabled,omitempty"`
+	// Interval like "30m", default 1h
+	Interval string `json:"interval,omitempty"`
+	// KeepHourly, KeepDaily and KeepWeekly are how many hours, days
+	// and weeks to keep a backup of, default 24, 7 and 4
+	KeepHourly *int `json:"keep_hourly,omitempty"`
+	KeepDaily  *int `json:"keep_daily,omitempty"`
+	KeepWeekly *int `json:"keep_weekly,omitempty"`
 }
 
 type LogEntryLegacy struct {
@@ -108,6 +194,9 @@ type NoteOptional struct {
 	Text       *string    `json:"text"`
 	CreateTime *time.Time `json:"create_time"`
 	UpdateTime *time.Time `json:"update_time"`
+	// IfUpdateTime makes the update apply only if the note is unchanged
+	// since it was read, like LogEntryOptional.IfUpdateTime
+	IfUpdateTime *time.Time `json:"if_update_time,omitempty"`
 }
 
 func (c *Note) Update(optional *NoteOptional) {
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Revision records an entry or a note as it was before a change, so
+// the earliest revision of it changed after a time tells how it was
+// at that time
+type Revision struct {
+	ID      int64 `json:"id"`
+	EntryID int64 `json:"entry_id"`
+	// NoteID is set for revisions of notes, which keep only Text
+	NoteID         int64      `json:"note_id,omitempty"`
+	Text           string     `json:"text"`
+	Done           bool       `json:"done,omitempty"`
+	DoneTime       *time.Time `json:"done_time,omitempty"`
+	ParentID       int64      `json:"parent_id,omitempty"`
+	HighlightLevel int        `json:"highlight_level,omitempty"`
+	// ChangeTime is when the change replaced this content
+	ChangeTime time.Time `json:"change_time"`
+}
+
+// EntryRevision returns the revision of entry, replaced by a change at changeTime
+func EntryRevision(entry LogEntry, changeTime time.Time) Revision {
+	return Revision{
+		EntryID:        entry.ID,
+		Text:           entry.Text,
+		Done:           entry.Done,
+		DoneTime:       entry.DoneTime,
+		ParentID:       entry.ParentID,
+		HighlightLevel: entry.HighlightLevel,
+		ChangeTime:     changeTime,
+	}
+}
+
+// NoteRevision returns the revision of note, replaced by a change at changeTime
+func NoteRevision(note Note, changeTime time.Time) Revision {
+	return Revision{
+		EntryID:    note.EntryID,
+		NoteID:     note.ID,
+		Text:       note.Text,
+		ChangeTime: changeTime,
+	}
+}
+
+// RevisionChanged tells whether a change from before to after touched
+// the fields revisions keep. Done times are compared to the second.
+func RevisionChanged(before Revision, after Revision) bool {
+	if before.Text != after.Text || before.Done != after.Done ||
+		before.ParentID != after.ParentID || before.HighlightLevel != after.HighlightLevel {
+		return true
+	}
+	if (before.DoneTime == nil) != (after.DoneTime == nil) {
+		return true
+	}
+	return before.DoneTime != nil && before.DoneTime.Unix() != after.DoneTime.Unix()
+}
+
+// ApplyTo sets the fields of entry the revision keeps
+func (r Revision) ApplyTo(entry *LogEntry) {
+	entry.Text = r.Text
+	entry.Done = r.Done
+	entry.DoneTime = r.DoneTime
+	entry.ParentID = r.ParentID
+	entry.HighlightLevel = r.HighlightLevel
+}
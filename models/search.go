@@ -0,0 +1,61 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// HighlightStart and HighlightEnd enclose the matches in search snippets
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+type SearchResultKind string
+
+const (
+	SearchResultKind_Entry     SearchResultKind = "entry"
+	SearchResultKind_Happening SearchResultKind = "happening"
+)
+
+// SearchResult is an entry or a happening matching a search query
+type SearchResult struct {
+	Kind SearchResultKind `json:"kind"`
+	ID   int64            `json:"id"`
+	// Text is the entry text or the happening content
+	Text       string    `json:"text"`
+	Done       bool      `json:"done,omitempty"`
+	CreateTime time.Time `json:"create_time"`
+	// Score ranks the results, higher is better. Scores
+	// are only comparable within one search.
+	Score float64 `json:"score"`
+	// Snippet is the matching part of Text, NoteSnippet that of the
+	// entry's notes, both empty when nothing matched there
+	Snippet     string `json:"snippet,omitempty"`
+	NoteSnippet string `json:"note_snippet,omitempty"`
+}
+
+// SplitHighlights splits a snippet into its matched and unmatched parts
+func SplitHighlights(snippet string) []MatchText {
+	var parts []MatchText
+	for snippet != "" {
+		before, rest, found := strings.Cut(snippet, HighlightStart)
+		if before != "" {
+			parts = append(parts, MatchText{Text: before})
+		}
+		if !found {
+			break
+		}
+		match, after, _ := strings.Cut(rest, HighlightEnd)
+		if match != "" {
+			parts = append(parts, MatchText{Text: match, Match: true})
+		}
+		snippet = after
+	}
+	return parts
+}
+
+// StripHighlights removes the highlight markers from a snippet
+func StripHighlights(snippet string) string {
+	return strings.NewReplacer(HighlightStart, "", HighlightEnd, "").Replace(snippet)
+}
@@ -1,11 +1,5 @@
 package states
 
-// Group IDs for organizing entries in group mode
-const (
-	GROUP_DEADLINE_ID    = 1
-	GROUP_WORKPERF_ID    = 2
-	GROUP_LIFEENHANCE_ID = 3
-	GROUP_WORKHACK_ID    = 4
-	GROUP_LIFEHACK_ID    = 5
-	GROUP_OTHER_ID       = 6
-)
+// GROUP_OTHER_ID is the ID of the virtual Other group in group mode,
+// holding entries that are not in any stored group
+const GROUP_OTHER_ID = -1
@@ -2,6 +2,7 @@ package states
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -10,7 +11,9 @@ import (
 	"github.com/xhd2015/todo/app/help"
 	"github.com/xhd2015/todo/app/human_state"
 	"github.com/xhd2015/todo/app/learning"
+	"github.com/xhd2015/todo/app/trash"
 	"github.com/xhd2015/todo/component/text"
+	"github.com/xhd2015/todo/data/storage"
 	"github.com/xhd2015/todo/log"
 	"github.com/xhd2015/todo/models"
 )
@@ -26,6 +29,7 @@ const (
 	RouteType_Help
 	RouteType_Learning
 	RouteType_Reading
+	RouteType_Trash
 )
 
 type Routes []Route
@@ -40,13 +44,23 @@ type Route struct {
 	HelpPage          *HelpPageState
 	LearningPage      *LearningPageState
 	ReadingPage       *ReadingPageState
+	TrashPage         *TrashPageState
+
+	// ctx is cancelled when the route is popped, stopping the
+	// actions of its page, see State.EnqueuePage
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func (routes *Routes) Push(route Route) {
+	route.ctx, route.cancel = context.WithCancel(context.Background())
 	*routes = append(*routes, route)
 }
 
 func (routes *Routes) Pop() {
+	if cancel := routes.Last().cancel; cancel != nil {
+		cancel()
+	}
 	*routes = (*routes)[:len(*routes)-1]
 }
 
@@ -87,7 +101,13 @@ type ConfigPageState struct {
 	ServerAuthToken models.InputState
 
 	ConfirmButtonFocused bool
+	MigrateButtonFocused bool
 	CancelButtonFocused  bool
+
+	// Migrating is set while the data is copied to the selected
+	// storage, MigrateStatus tells how far it got
+	Migrating     bool
+	MigrateStatus string
 }
 
 type HappeningListPageState struct {
@@ -110,6 +130,10 @@ type ReadingPageState struct {
 	MaterialID int64
 }
 
+type TrashPageState struct {
+	// This can be empty since trash state is now in main State
+}
+
 func DetailRoute(entryID int64) Route {
 	return Route{
 		Type: RouteType_Detail,
@@ -163,6 +187,13 @@ func ReadingRoute(materialID int64) Route {
 	}
 }
 
+func TrashRoute() Route {
+	return Route{
+		Type:      RouteType_Trash,
+		TrashPage: &TrashPageState{},
+	}
+}
+
 // HappeningListPage renders the happening list page
 func HappeningListPage(state *State, height int) *dom.Node {
 	happeningState := &state.Happening
@@ -238,7 +269,7 @@ func HappeningListPage(state *State, height int) *dom.Node {
 			}
 			happeningState.Error = ""
 
-			state.Enqueue(func(ctx context.Context) error {
+			state.EnqueuePage(func(ctx context.Context) error {
 				log.Infof(ctx, "Reload happenings")
 				if happeningState.LoadHappenings == nil {
 					happeningState.Error = "LoadHappenings is not set"
@@ -283,14 +314,28 @@ func HappeningListPage(state *State, height int) *dom.Node {
 					return fmt.Errorf("UpdateHappening function not available")
 				}
 
-				// Create update with only the content field
+				// Create update with only the content field, refused
+				// if the happening changed since it was loaded
 				update := &models.HappeningOptional{
 					Content: &content,
 				}
+				for _, happening := range happeningState.Happenings {
+					if happening.ID == id {
+						update.IfUpdateTime = &happening.UpdateTime
+						break
+					}
+				}
 
 				// Update via backend service
 				updatedHappening, err := happeningState.UpdateHappening(ctx, id, update)
 				if err != nil {
+					if errors.Is(err, storage.ErrConflict) && happeningState.LoadHappenings != nil {
+						// the edit stays open, saving again overwrites the reloaded happening
+						if happenings, loadErr := happeningState.LoadHappenings(ctx); loadErr == nil {
+							happeningState.Happenings = happenings
+							return fmt.Errorf("update: %v, reloaded it, save again to overwrite", err)
+						}
+					}
 					return fmt.Errorf("update: %w", err)
 				}
 
@@ -404,7 +449,7 @@ func LearningPage(state *State, width int, height int) *dom.Node {
 			}
 			learningState.Error = ""
 
-			state.Enqueue(func(ctx context.Context) error {
+			state.EnqueuePage(func(ctx context.Context) error {
 				log.Infof(ctx, "Reload learning materials")
 				if learningState.LoadMaterials == nil {
 					learningState.Error = "LoadMaterials is not set"
@@ -445,18 +490,135 @@ func LearningPage(state *State, width int, height int) *dom.Node {
 			state.Routes.Push(ReadingRoute(materialID))
 
 			// Load first page
-			state.Enqueue(func(ctx context.Context) error {
+			state.EnqueuePage(func(ctx context.Context) error {
 				return loadPage(ctx, state, 0)
 			})
 
 			// Pre-fetch next page
-			state.Enqueue(func(ctx context.Context) error {
+			state.EnqueuePage(func(ctx context.Context) error {
 				return loadPage(ctx, state, 1)
 			})
 		},
 	})
 }
 
+// LoadRevisions reloads the revisions of the entry in the background,
+// keeping the ones shown while they are of the same entry
+func LoadRevisions(state *State, entryID int64) {
+	revisionsState := &state.Revisions
+	if revisionsState.EntryID != entryID {
+		revisionsState.EntryID = entryID
+		revisionsState.Revisions = nil
+		revisionsState.SelectedID = 0
+		revisionsState.Loading = true
+	}
+	revisionsState.Error = ""
+
+	state.EnqueuePage(func(ctx context.Context) error {
+		if revisionsState.LoadRevisions == nil {
+			revisionsState.Error = "LoadRevisions is not set"
+			return nil
+		}
+		revisions, err := revisionsState.LoadRevisions(ctx, entryID)
+		if revisionsState.EntryID != entryID {
+			// another entry was opened meanwhile
+			return nil
+		}
+		revisionsState.Loading = false
+		if err != nil {
+			revisionsState.Error = err.Error()
+			return nil
+		}
+		revisionsState.Revisions = revisions
+		return nil
+	})
+}
+
+// LoadTrash reloads the trash in the background, call it on the trash page
+func LoadTrash(state *State) {
+	trashState := &state.Trash
+	if len(trashState.Entries) == 0 {
+		trashState.Loading = true
+	}
+	trashState.Error = ""
+
+	state.EnqueuePage(func(ctx context.Context) error {
+		return reloadTrash(ctx, trashState)
+	})
+}
+
+// reloadTrash loads the trash, keeping the selection in range
+func reloadTrash(ctx context.Context, trashState *TrashState) error {
+	if trashState.LoadTrash == nil {
+		trashState.Error = "LoadTrash is not set"
+		return nil
+	}
+	entries, err := trashState.LoadTrash(ctx)
+	if err != nil {
+		trashState.Error = err.Error()
+		return err
+	}
+	trashState.Loading = false
+	trashState.Entries = entries
+	if trashState.SelectedIndex >= len(entries) {
+		trashState.SelectedIndex = len(entries) - 1
+	}
+	if trashState.SelectedIndex < 0 {
+		trashState.SelectedIndex = 0
+	}
+	return nil
+}
+
+// TrashPage renders the entries in trash
+func TrashPage(state *State, height int) *dom.Node {
+	trashState := &state.Trash
+
+	if trashState.Loading {
+		return dom.Div(dom.DivProps{},
+			dom.Text("Loading trash..."),
+		)
+	}
+
+	if trashState.Error != "" {
+		return dom.Div(dom.DivProps{},
+			dom.Text("Error loading trash: "+trashState.Error),
+		)
+	}
+
+	return trash.TrashList(trash.TrashListProps{
+		Entries:         trashState.Entries,
+		SelectedIndex:   trashState.SelectedIndex,
+		ContainerHeight: height,
+		OnNavigateBack: func() {
+			state.Routes.Pop()
+		},
+		OnReload: func() {
+			LoadTrash(state)
+		},
+		OnNavigateUp: func() {
+			if trashState.SelectedIndex > 0 {
+				trashState.SelectedIndex--
+			}
+		},
+		OnNavigateDown: func() {
+			if trashState.SelectedIndex < len(trashState.Entries)-1 {
+				trashState.SelectedIndex++
+			}
+		},
+		OnRestore: func(id int64) {
+			state.Enqueue(func(ctx context.Context) error {
+				if trashState.Restore == nil {
+					return fmt.Errorf("Restore is not set")
+				}
+				if err := trashState.Restore(ctx, id); err != nil {
+					return err
+				}
+				return reloadTrash(ctx, trashState)
+			})
+		},
+	})
+}
+
 // ReadingPage renders the reading page for a material
 func ReadingPage(state *State, materialID int64, width int, height int) *dom.Node {
 	readingState := &state.Reading
@@ -839,7 +1001,7 @@ func updatePageWordPositions(state *State) {
 // loadPageIfNeeded loads a page if it's not in cache
 func loadPageIfNeeded(state *State, pageNum int) {
 	if _, exists := state.Reading.ContentCache[pageNum]; !exists {
-		state.Enqueue(func(ctx context.Context) error {
+		state.EnqueuePage(func(ctx context.Context) error {
 			return loadPage(ctx, state, pageNum)
 		})
 	}
@@ -2,14 +2,16 @@ package states
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime/debug"
 	"sync"
 	"time"
 
-	"github.com/xhd2015/todo/app/exp"
 	"github.com/xhd2015/todo/app/human_state"
 	"github.com/xhd2015/todo/app/submit"
+	"github.com/xhd2015/todo/data/storage"
+	storagehttp "github.com/xhd2015/todo/data/storage/http"
 	"github.com/xhd2015/todo/models"
 )
 
@@ -43,6 +45,10 @@ type State struct {
 	// unfinished entries
 	ZenMode bool
 
+	// TagFilter only shows entries tagged #TagFilter
+	// and their ancestors, set by /tag <name>
+	TagFilter string
+
 	SelectedActionIndex int
 
 	Routes Routes
@@ -59,6 +65,12 @@ type State struct {
 	// Reading functionality
 	Reading ReadingState
 
+	// Trash functionality
+	Trash TrashState
+
+	// Revisions of the entry on the detail page
+	Revisions RevisionsState
+
 	ShowHistory bool // Whether to show historical (done) todos from before today
 	ShowNotes   bool // Whether to show all notes globally
 	ExpandAll   bool // Whether to expand all entries, ignoring individual collapse flags
@@ -80,6 +92,11 @@ type State struct {
 	// View mode functionality
 	ViewMode ViewMode // Current view mode (default or group)
 
+	// Groups shown in group mode, ordered by position, and the
+	// entry ID to group ID mapping, 0 for a detached entry
+	Groups       []models.Group
+	GroupMapping map[int64]int64
+
 	// Group collapse state (for group mode entries that don't exist in DB)
 	GroupCollapseState *MutexMap // Thread-safe map for group collapse states
 
@@ -92,29 +109,53 @@ type State struct {
 
 	OnAdd             func(ctx context.Context, viewType models.LogEntryViewType, text string) error
 	OnAddChild        func(ctx context.Context, viewType models.LogEntryViewType, parentID int64, text string) (models.LogEntryViewType, int64, error)
-	OnUpdate          func(viewType models.LogEntryViewType, id int64, text string) error
-	OnDelete          func(viewType models.LogEntryViewType, id int64) error
-	OnRemoveFromGroup func(viewType models.LogEntryViewType, id int64) error
-	OnToggle          func(viewType models.LogEntryViewType, id int64) error
-	OnPromote         func(viewType models.LogEntryViewType, id int64) error
-	OnUpdateHighlight func(viewType models.LogEntryViewType, id int64, highlightLevel int)
-	OnMove            func(id models.EntryIdentity, newParentID models.EntryIdentity) error
-
-	OnAddNote    func(id int64, text string) error
-	OnUpdateNote func(entryID int64, noteID int64, text string)
-	OnDeleteNote func(entryID int64, noteID int64)
+	OnUpdate          func(ctx context.Context, viewType models.LogEntryViewType, id int64, text string) error
+	OnDelete          func(ctx context.Context, viewType models.LogEntryViewType, id int64) error
+	OnRemoveFromGroup func(ctx context.Context, viewType models.LogEntryViewType, id int64) error
+	OnToggle          func(ctx context.Context, viewType models.LogEntryViewType, id int64) error
+	OnPromote         func(ctx context.Context, viewType models.LogEntryViewType, id int64) error
+	OnUpdateHighlight func(ctx context.Context, viewType models.LogEntryViewType, id int64, highlightLevel int)
+	OnMove            func(ctx context.Context, id models.EntryIdentity, newParentID models.EntryIdentity) error
+	OnAddGroup        func(ctx context.Context, name string) error
+	OnReorderGroup    func(ctx context.Context, id int64, delta int) error
+
+	OnAddNote    func(ctx context.Context, id int64, text string) error
+	OnUpdateNote func(ctx context.Context, entryID int64, noteID int64, text string)
+	OnDeleteNote func(ctx context.Context, entryID int64, noteID int64)
+
+	// OnUndo and OnRedo revert and replay the last change to entries and notes
+	OnUndo func(ctx context.Context) error
+	OnRedo func(ctx context.Context) error
+
+	// OnRetry reloads the entries and applies again the last change
+	// refused because the entry or note was changed elsewhere
+	OnRetry func(ctx context.Context) error
+
+	// OnSetToken makes the server client use token from now on, after
+	// the server refused the previous one
+	OnSetToken func(ctx context.Context, token string) error
 
 	RefreshEntries       func(ctx context.Context) error                                              // Callback to refresh entries when ShowHistory changes
-	OnShowTop            func(id int64, text string, duration time.Duration)                          // Callback to show todo in macOS floating bar
-	OnToggleVisibility   func(id int64) error                                                         // Callback to toggle visibility of all children including history
-	OnToggleNotesDisplay func(id int64) error                                                         // Callback to toggle notes display for entry and its subtree
+	OnShowTop            func(ctx context.Context, id int64, text string, duration time.Duration)     // Callback to show todo in macOS floating bar
+	OnToggleVisibility   func(ctx context.Context, id int64) error                                    // Callback to toggle visibility of all children including history
+	OnToggleNotesDisplay func(ctx context.Context, id int64) error                                    // Callback to toggle notes display for entry and its subtree
 	OnToggleCollapsed    func(ctx context.Context, entryType models.LogEntryViewType, id int64) error // Callback to toggle collapsed state for entry
 
+	// OnMigrateStorage copies all data of the running storage to the
+	// given one, reporting progress as it goes
+	OnMigrateStorage func(ctx context.Context, storageType string, serverAddr string, serverToken string, progress func(msg string)) error
+
 	LastCtrlC time.Time
 
 	// Action queue for tracking ongoing operations
 	actionQueueMutex sync.RWMutex
 	activeActions    int
+	// actionMutex makes actions run one at a time, as they change
+	// the same entries
+	actionMutex sync.Mutex
+	// ctx is the parent of the contexts actions run with, see Cancel
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	StatusBar StatusBar
 }
@@ -152,6 +193,55 @@ type HappeningState struct {
 	DeleteHappening func(ctx context.Context, id int64) error
 }
 
+// SetHappenings replaces the happenings shown, keeping the selected
+// one selected if it is still there
+func (h *HappeningState) SetHappenings(happenings []*models.Happening) {
+	switch {
+	case h.SelectedItemIndex >= len(h.Happenings):
+		// the input is selected
+		h.SelectedItemIndex = len(happenings)
+	case h.SelectedItemIndex >= 0:
+		selectedID := h.Happenings[h.SelectedItemIndex].ID
+		h.SelectedItemIndex = min(h.SelectedItemIndex, len(happenings)-1)
+		for i, happening := range happenings {
+			if happening.ID == selectedID {
+				h.SelectedItemIndex = i
+				break
+			}
+		}
+	}
+	h.Happenings = happenings
+}
+
+type TrashState struct {
+	Loading bool
+	// Entries are the deleted entries, each with the descendants
+	// deleted along with it
+	Entries []*models.LogEntryView
+	Error   string
+
+	SelectedIndex int
+
+	LoadTrash func(ctx context.Context) ([]*models.LogEntryView, error)
+	// Restore moves the entry with its descendants back out of trash
+	Restore func(ctx context.Context, id int64) error
+}
+
+type RevisionsState struct {
+	// EntryID is the entry the revisions are of, with those of its notes
+	EntryID   int64
+	Loading   bool
+	Revisions []models.Revision
+	Error     string
+
+	// SelectedID is the focused revision, 0 for none
+	SelectedID int64
+
+	LoadRevisions func(ctx context.Context, entryID int64) ([]models.Revision, error)
+	// Restore changes the entry or note back to the revision
+	Restore func(ctx context.Context, revision models.Revision) error
+}
+
 type LearningState struct {
 	Loading   bool
 	Materials []*models.LearningMaterial
@@ -201,6 +291,8 @@ type ReadingState struct {
 type StatusBar struct {
 	Error   string
 	Storage string
+	// Sync is the replica status with server storage, e.g. "synced"
+	Sync string
 }
 
 func (state *State) ClearSearch() {
@@ -309,78 +401,73 @@ func (state *State) FindEntryByID(entryID int64) *models.LogEntryView {
 	return findEntry(state.Entries, entryID)
 }
 
-// findGroupForEntry finds which group an entry belongs to in group mode
+// FindGroupForEntry finds which group an entry belongs to in group mode,
+// following its parent chain and defaulting to the Other group
 func (state *State) FindGroupForEntry(entryID int64) int64 {
-	// Get the group mapping from exp package
-	mapping := exp.GetMapping()
-
-	// Check if this entry has a direct group mapping
-	if groupID, exists := mapping[entryID]; exists {
-		return groupID
-	}
-
-	// If no direct mapping, find the entry and check its parent chain
-	var findEntryAndCheckParents func(entries models.LogEntryViews, targetID int64) int64
-	findEntryAndCheckParents = func(entries models.LogEntryViews, targetID int64) int64 {
-		for _, entry := range entries {
-			if entry.Data.ID == targetID {
-				// Check parent chain for group mapping
-				currentID := targetID
-				for currentID != 0 {
-					if groupID, exists := mapping[currentID]; exists {
-						return groupID
-					}
-					// Find parent
-					parentEntry := findEntryAndCheckParents(state.Entries, entry.Data.ParentID)
-					if parentEntry != 0 {
-						return parentEntry
-					}
-					// Move up the chain
-					if entry.Data.ParentID == 0 {
-						break
-					}
-					currentID = entry.Data.ParentID
-					// Find the parent entry to continue the chain
-					var findParent func(entries models.LogEntryViews, parentID int64) *models.LogEntryView
-					findParent = func(entries models.LogEntryViews, parentID int64) *models.LogEntryView {
-						for _, e := range entries {
-							if e.Data.ID == parentID {
-								return e
-							}
-							if found := findParent(e.Children, parentID); found != nil {
-								return found
-							}
-						}
-						return nil
-					}
-					parentEntryObj := findParent(state.Entries, currentID)
-					if parentEntryObj == nil {
-						break
-					}
-					entry = parentEntryObj
-				}
-				// If no mapping found in parent chain, default to "Other" group
-				return 6 // GROUP_OTHER_ID
-			}
-			if found := findEntryAndCheckParents(entry.Children, targetID); found != 0 {
-				return found
-			}
+	for id := entryID; id != 0; {
+		if groupID := state.GroupMapping[id]; groupID != 0 && state.hasGroup(groupID) {
+			return groupID
 		}
-		return 0
+		entry := state.FindEntryByID(id)
+		if entry == nil {
+			break
+		}
+		id = entry.Data.ParentID
 	}
+	return GROUP_OTHER_ID
+}
 
-	result := findEntryAndCheckParents(state.Entries, entryID)
-	if result == 0 {
-		// Default to "Other" group if no mapping found
-		return 6 // GROUP_OTHER_ID
+func (state *State) hasGroup(groupID int64) bool {
+	for _, group := range state.Groups {
+		if group.ID == groupID {
+			return true
+		}
 	}
-	return result
+	return false
 }
 
 const _REFRESH_DELAY = 200 * time.Millisecond
 
-// Enqueue schedules an action to run in a goroutine and tracks its status
+// Enqueue schedules an action to run in a goroutine and tracks its
+// status. Actions run one at a time, their context is cancelled
+// by Cancel.
 func (state *State) Enqueue(action func(ctx context.Context) error) {
+	state.enqueue(state.context(), action)
+}
+
+// EnqueuePage is like Enqueue for actions of the current page, such
+// as loading what it shows: they are cancelled once the page is left
+func (state *State) EnqueuePage(action func(ctx context.Context) error) {
+	ctx := state.context()
+	if len(state.Routes) == 0 || state.Routes.Last().ctx == nil {
+		state.enqueue(ctx, action)
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(state.Routes.Last().ctx, cancel)
+	state.enqueue(ctx, func(ctx context.Context) error {
+		defer cancel()
+		defer stop()
+		return action(ctx)
+	})
+}
+
+// Cancel cancels the context of the actions still running, on quitting
+func (state *State) Cancel() {
+	state.context()
+	state.cancel()
+}
+
+func (state *State) context() context.Context {
+	state.actionQueueMutex.Lock()
+	defer state.actionQueueMutex.Unlock()
+	if state.ctx == nil {
+		state.ctx, state.cancel = context.WithCancel(context.Background())
+	}
+	return state.ctx
+}
+
+func (state *State) enqueue(ctx context.Context, action func(ctx context.Context) error) {
 	state.actionQueueMutex.Lock()
 	state.activeActions++
 	state.actionQueueMutex.Unlock()
@@ -408,16 +495,41 @@ func (state *State) Enqueue(action func(ctx context.Context) error) {
 			}
 		}()
 
-		ctx := context.Background()
-		if err := action(ctx); err != nil {
+		err := state.runAction(ctx, action)
+		// a cancelled action was left behind on purpose
+		if err != nil && ctx.Err() == nil {
 			// Set error in status bar
 			state.actionQueueMutex.Lock()
-			state.StatusBar.Error = err.Error()
+			state.StatusBar.Error = state.ErrorMessage(err)
 			state.actionQueueMutex.Unlock()
 		}
 	}()
 }
 
+// runAction runs action once no other action runs
+func (state *State) runAction(ctx context.Context, action func(ctx context.Context) error) error {
+	state.actionMutex.Lock()
+	defer state.actionMutex.Unlock()
+	// a page left while the action waited needs it no more
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return action(ctx)
+}
+
+// ErrorMessage is how err shows in the status bar, a conflict
+// tells how to apply the refused change anyway and a refused token
+// how to set another
+func (state *State) ErrorMessage(err error) string {
+	if errors.Is(err, storage.ErrConflict) && state.OnRetry != nil {
+		return err.Error() + ", /retry to reload and apply your change again"
+	}
+	if errors.Is(err, storagehttp.ErrUnauthorized) && state.OnSetToken != nil {
+		return err.Error() + ", /token <token> to set a new one"
+	}
+	return err.Error()
+}
+
 // Requesting returns true if there are ongoing actions
 func (state *State) Requesting() bool {
 	state.actionQueueMutex.RLock()
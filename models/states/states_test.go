@@ -0,0 +1,31 @@
+package states
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestActionsRunOneAtATime(t *testing.T) {
+	state := &State{}
+	var running, overlapped atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		state.Enqueue(func(ctx context.Context) error {
+			defer wg.Done()
+			if running.Add(1) > 1 {
+				overlapped.Add(1)
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+			return nil
+		})
+	}
+	wg.Wait()
+	if n := overlapped.Load(); n > 0 {
+		t.Fatalf("expect actions not to overlap, %d did", n)
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// a tag starts with a letter or underscore so that "#123" stays text
+var tagPattern = regexp.MustCompile(`(?:^|\s)#([\p{L}_][\p{L}\p{N}_\-/]*)`)
+
+// ParseTags returns the distinct "#tag" tokens of text, lower-cased
+// and without "#", in order of appearance
+func ParseTags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, m := range tagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(m[1])
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// NormalizeTag converts user input like "#Work" to the stored form "work"
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// NormalizeTags normalizes tags and drops empty and duplicate ones
+func NormalizeTags(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// Tags returns the tags in the entry's text
+func (c *LogEntry) Tags() []string {
+	return ParseTags(c.Text)
+}
+
+// HasTags reports whether the entry carries all of tags
+func (c *LogEntry) HasTags(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	own := make(map[string]bool)
+	for _, tag := range c.Tags() {
+		own[tag] = true
+	}
+	for _, tag := range NormalizeTags(tags) {
+		if !own[tag] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,16 +2,21 @@ package run
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/xhd2015/todo/app"
 	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/internal/macos"
+	"github.com/xhd2015/todo/internal/quickadd"
 	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/models/states"
 )
 
 func HandleToggleCollapsed(ctx context.Context, appState *app.State, logManager *data.LogManager, entryType models.LogEntryViewType, id int64) error {
 	// clear search selected entry
 	if entryType == models.LogEntryViewType_Log {
-		err := logManager.ToggleCollapsed(id)
+		err := logManager.ToggleCollapsed(ctx, id)
 		if err != nil {
 			return err
 		}
@@ -25,3 +30,114 @@ func HandleToggleCollapsed(ctx context.Context, appState *app.State, logManager
 	}
 	return nil
 }
+
+// toggleDone marks the entry done, adding its next occurrence if it
+// repeats, or not done if it was
+func toggleDone(ctx context.Context, logManager *data.LogManager, id int64) error {
+	foundEntry, err := logManager.Get(id)
+	if err != nil {
+		return err
+	}
+	_, err = setDone(ctx, logManager, id, !foundEntry.Data.Done)
+	return err
+}
+
+// setDone marks the entry done or not. Done, it adds the next
+// occurrence of a repeating entry and returns its ID, 0 if none.
+func setDone(ctx context.Context, logManager *data.LogManager, id int64, done bool) (int64, error) {
+	var doneTime *time.Time
+	if done {
+		now := time.Now()
+		doneTime = &now
+	}
+	var nextID int64
+	// the next occurrence is undone along with the toggle
+	err := logManager.Batch(func() error {
+		err := logManager.Update(ctx, id, models.LogEntryOptional{
+			Done:     &done,
+			DoneTime: &doneTime,
+		})
+		if err != nil {
+			return err
+		}
+		if done {
+			nextID, err = logManager.AddNextOccurrence(ctx, id, *doneTime)
+			if err != nil {
+				return fmt.Errorf("failed to add next occurrence: %w", err)
+			}
+		}
+		return nil
+	})
+	return nextID, err
+}
+
+// showTop highlights the entry and shows it in the macOS floating bar
+// for duration
+func showTop(ctx context.Context, logManager *data.LogManager, id int64, text string, duration time.Duration) error {
+	// first make highlight level 5
+	highlightLevel := 5
+	err := logManager.Update(ctx, id, models.LogEntryOptional{
+		HighlightLevel: &highlightLevel,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Send command to macOS app to show floating progress bar
+	if err := macos.SendTopCommand(id, text, duration); err != nil {
+		return fmt.Errorf("failed to show top: %w", err)
+	}
+	return nil
+}
+
+// newEntryFromInput builds an entry from the add input, taking out
+// quick-add markers such as "@tomorrow 5pm"
+func newEntryFromInput(text string) models.LogEntry {
+	parsed := quickadd.Parse(text, time.Now())
+	if !parsed.HasMarkers() || parsed.Text == "" {
+		// a line made only of markers stays as typed
+		return models.LogEntry{Text: text}
+	}
+	entry := models.LogEntry{
+		Text:          parsed.Text,
+		DueTime:       parsed.DueTime,
+		ScheduledTime: parsed.ScheduledTime,
+	}
+	if parsed.Repeat != nil {
+		entry.Repeat = *parsed.Repeat
+	}
+	return entry
+}
+
+// updateFromInput is newEntryFromInput for edits: markers present
+// in the edited text replace the entry's fields, others are kept
+func updateFromInput(text string) models.LogEntryOptional {
+	parsed := quickadd.Parse(text, time.Now())
+	if !parsed.HasMarkers() || parsed.Text == "" {
+		return models.LogEntryOptional{Text: &text}
+	}
+	update := models.LogEntryOptional{
+		Text:   &parsed.Text,
+		Repeat: parsed.Repeat,
+	}
+	if parsed.DueTime != nil {
+		update.DueTime = &parsed.DueTime
+	}
+	if parsed.ScheduledTime != nil {
+		update.ScheduledTime = &parsed.ScheduledTime
+	}
+	return update
+}
+
+// legacyGroupMappingFile is where group mode kept its mapping before
+// groups were stored, it is imported once on startup
+const legacyGroupMappingFile = "log_group.json"
+
+// storedGroupID converts a group ID of group mode to the one stored in an
+// entry's membership, the virtual Other group is stored as no group
+func storedGroupID(groupID int64) int64 {
+	if groupID == states.GROUP_OTHER_ID {
+		return 0
+	}
+	return groupID
+}
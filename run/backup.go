@@ -0,0 +1,231 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/backup"
+	"github.com/xhd2015/todo/internal/config"
+	"github.com/xhd2015/todo/internal/process"
+)
+
+const backupHelp = `
+todo backup - Manage backups of file and sqlite storage
+
+Usage: todo backup <cmd> [OPTIONS]
+
+Available sub commands:
+  list                             list the backups, latest first
+  create                           take a backup now
+  restore <id>                     replace the storage with a backup, after
+                                   checking it and backing up the storage as it is,
+                                   refused while todo or todo serve is running
+
+Options:
+  --storage <type>                 storage backend: file (default) or sqlite
+  -h,--help                        show this help message
+
+todo and todo serve take a backup on startup and every hour, kept in
+backups/ of the config directory. Of the older ones, the latest of each
+of the last 24 hours, 7 days and 4 weeks are kept. Both can be changed
+in config.json:
+
+  "backup": {"interval": "30m", "keep_hourly": 12, "keep_daily": 14, "keep_weekly": 8}
+
+Set "disabled": true to only take backups with todo backup create.
+
+Examples:
+  todo backup list
+  todo backup restore 20250901-093000
+`
+
+func handleBackup(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("requires sub command: list, create, restore")
+	}
+	cmd := args[0]
+	args = args[1:]
+	if cmd == "--help" || cmd == "-h" || cmd == "help" {
+		fmt.Print(strings.TrimPrefix(backupHelp, "\n"))
+		return nil
+	}
+
+	var storageType string
+	args, err := flags.String("--storage", &storageType).
+		Help("-h,--help", backupHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	var id string
+	switch cmd {
+	case "list", "create":
+	case "restore":
+		if len(args) != 1 {
+			return fmt.Errorf("restore requires exactly one argument: <id>")
+		}
+		id = args[0]
+		args = args[1:]
+	default:
+		return fmt.Errorf("unrecognized backup sub command: %s", cmd)
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra arguments: %s", strings.Join(args, " "))
+	}
+
+	storageConfig, err := ApplyConfigDefaults(storageType, "", "")
+	if err != nil {
+		return err
+	}
+	manager, _, err := openBackups(storageConfig.StorageType)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch cmd {
+	case "create":
+		b, err := manager.Create(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created backup %s (%s)\n", b.ID, formatSize(b.Size))
+	case "restore":
+		if err := checkNotRunning(); err != nil {
+			return err
+		}
+		current, err := manager.Restore(ctx, id)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			fmt.Printf("backed up the storage as %s\n", current.ID)
+		}
+		fmt.Printf("restored backup %s\n", id)
+	default:
+		backups, err := manager.List()
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			fmt.Println("no backups")
+			return nil
+		}
+		for _, b := range backups {
+			fmt.Printf("%s  %s  %s\n", b.ID, b.Time.Format("2006-01-02 15:04:05"), formatSize(b.Size))
+		}
+	}
+	return nil
+}
+
+// openBackups returns the backups of storageType with the interval
+// configured for them, 0 if automatic backups are disabled
+func openBackups(storageType string) (*backup.Manager, time.Duration, error) {
+	var store backup.Store
+	var ext string
+	switch storageType {
+	case "sqlite":
+		file, err := config.GetSqliteFile()
+		if err != nil {
+			return nil, 0, err
+		}
+		store, ext = backup.NewSQLiteStore(file), ".db"
+	case "file":
+		file, err := config.GetRecordJSONFile()
+		if err != nil {
+			return nil, 0, err
+		}
+		store, ext = backup.NewFileStore(file), ".json"
+	case "server":
+		return nil, 0, fmt.Errorf("server storage is backed up where it is served, by todo serve")
+	default:
+		return nil, 0, fmt.Errorf("unsupported storage type: %s, available: sqlite, file", storageType)
+	}
+	dir, err := config.GetBackupDir(storageType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	savedConfig, err := data.LoadConfig()
+	if err != nil {
+		return nil, 0, err
+	}
+	retention := backup.DefaultRetention
+	interval := backup.DefaultInterval
+	if savedConfig != nil && savedConfig.Backup != nil {
+		conf := savedConfig.Backup
+		if conf.KeepHourly != nil {
+			retention.Hourly = *conf.KeepHourly
+		}
+		if conf.KeepDaily != nil {
+			retention.Daily = *conf.KeepDaily
+		}
+		if conf.KeepWeekly != nil {
+			retention.Weekly = *conf.KeepWeekly
+		}
+		if conf.Interval != "" {
+			interval, err = time.ParseDuration(conf.Interval)
+			if err != nil || interval <= 0 {
+				return nil, 0, fmt.Errorf("invalid backup interval %q in config", conf.Interval)
+			}
+		}
+		if conf.Disabled {
+			interval = 0
+		}
+	}
+	return backup.New(dir, ext, store, retention), interval, nil
+}
+
+// startBackups takes backups of storageType in the background until
+// ctx is done, unless disabled in the config
+func startBackups(ctx context.Context, storageType string, onError func(err error)) error {
+	manager, interval, err := openBackups(storageType)
+	if err != nil {
+		return err
+	}
+	if interval > 0 {
+		go manager.Run(ctx, interval, onError)
+	}
+	return nil
+}
+
+// checkNotRunning refuses to go on while the app or todo serve is
+// running
+func checkNotRunning() error {
+	savedConfig, err := data.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if savedConfig == nil {
+		return nil
+	}
+	if processAlive(savedConfig.RunningPID) {
+		return fmt.Errorf("todo is running with PID %d, quit it first", savedConfig.RunningPID)
+	}
+	if processAlive(savedConfig.ServingPID) {
+		return fmt.Errorf("todo serve is running with PID %d, stop it first", savedConfig.ServingPID)
+	}
+	return nil
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	exists, _ := process.ProcessExists(pid)
+	return exists
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
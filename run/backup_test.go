@@ -0,0 +1,31 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/models"
+)
+
+func TestRestoreRefusedWhileServing(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "lifelog"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkNotRunning(); err != nil {
+		t.Fatalf("expect no error without config, got %v", err)
+	}
+	if err := data.SaveConfig(&models.Config{ServingPID: os.Getpid()}); err != nil {
+		t.Fatal(err)
+	}
+	err := checkNotRunning()
+	if err == nil || !strings.Contains(err.Error(), "todo serve is running") {
+		t.Fatalf("expect restore refused while todo serve runs, got %v", err)
+	}
+}
@@ -0,0 +1,429 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/todo/control"
+	"github.com/xhd2015/todo/internal/config"
+	"github.com/xhd2015/todo/models"
+	"golang.org/x/term"
+)
+
+const commandsOptions = `
+  --json                       print the todos affected as JSON
+  --storage <type>             storage backend: file (default), sqlite, or server
+  --server-addr <addr>         server address (required when --storage=server)
+  --server-token <token>       server authentication token (optional when --storage=server)
+  -h,--help                    show this help message
+
+Todos are selected by ID, like 12, or by a path of texts from the top
+level, like Work/Release/*, where each part may use the wildcards *, ?
+and [...], which match / in texts too. \/ is a / of a text, like
+Work/CI\/CD, and \ takes any other character literally. A leading /
+makes digits a path, like /2025. Selectors match the todos the app
+shows, not those done on previous days.
+
+While todo runs, commands go to it through its control socket, so it
+shows them at once. Given --storage or --server-addr, they go to that
+storage instead.
+
+Exit codes: 0 done, 2 bad usage, 3 no todo matched, 4 a selector that
+must match one todo matched more, 1 anything else.
+`
+
+const addHelp = `
+todo add - Add todos and print their IDs
+
+Usage: todo add [OPTIONS] <text>
+       todo add [OPTIONS] < lines
+
+Without text, each line of stdin is added as a todo.
+
+Options:
+  --parent <selector>          add under this todo` + commandsOptions + `
+Examples:
+  todo add "write release notes @friday"
+  todo add --parent Work/Release "update changelog"
+  git log --format=%s v1.2.0.. | todo add --parent Work/Release
+`
+
+const doneHelp = `
+todo done - Mark todos done
+
+Usage: todo done [OPTIONS] <selector>...
+
+Options:
+  --undo                       mark them not done instead` + commandsOptions + `
+Examples:
+  todo done 12 13
+  todo done "Work/Release/*"
+`
+
+const toggleHelp = `
+todo toggle - Mark todos done, or not done if they were
+
+Usage: todo toggle [OPTIONS] <selector>...
+
+Options:` + commandsOptions
+
+const editHelp = `
+todo edit - Change the text of a todo
+
+Usage: todo edit [OPTIONS] <selector> <text>
+       todo edit [OPTIONS] <selector> < text
+
+Markers like @friday in the text replace the todo's due date and the
+like, as when editing in the app.
+
+Options:` + commandsOptions
+
+const rmHelp = `
+todo rm - Move todos to trash with their children
+
+Usage: todo rm [OPTIONS] <selector>...
+
+Restore them in the app with /trash.
+
+Options:` + commandsOptions
+
+const mvHelp = `
+todo mv - Move todos under another
+
+Usage: todo mv [OPTIONS] --parent <selector> <selector>...
+
+Options:
+  --parent <selector>          the new parent, / for the top level` + commandsOptions + `
+Examples:
+  todo mv --parent Work/Release 12 13
+  todo mv --parent / "Inbox/*"
+`
+
+const noteHelp = `
+todo note - Add a note to a todo
+
+Usage: todo note [OPTIONS] <selector> <text>
+       todo note [OPTIONS] <selector> < text
+
+Options:` + commandsOptions
+
+const focusHelp = `
+todo focus - Select a todo in the running todo
+
+Usage: todo focus <selector>
+
+Options:
+  -h,--help                    show this help message
+`
+
+const showTopHelp = `
+todo show-top - Highlight a todo and show it in the macOS floating bar
+
+Usage: todo show-top [OPTIONS] <selector>
+
+Options:
+  --duration <duration>        how long to show it, like 45m (default: 30m)` + commandsOptions
+
+// exit codes of the commands, besides 0 and 1 for other failures
+const (
+	ExitUsage     = 2
+	ExitNotFound  = 3
+	ExitAmbiguous = 4
+)
+
+// usageError is a mistake in the arguments of a command
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{err: fmt.Errorf(format, args...)}
+}
+
+// ExitCode returns the exit code for the error Main returned
+func ExitCode(err error) int {
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usageErr), errors.Is(err, control.ErrInvalid):
+		return ExitUsage
+	case errors.Is(err, control.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, control.ErrAmbiguous):
+		return ExitAmbiguous
+	default:
+		return 1
+	}
+}
+
+// commandFlags are the flags every command takes
+type commandFlags struct {
+	json        bool
+	storageType string
+	serverAddr  string
+	serverToken string
+}
+
+func (f *commandFlags) parse(builder *flags.Builder, help string, args []string) ([]string, error) {
+	args, err := builder.Bool("--json", &f.json).
+		String("--storage", &f.storageType).
+		String("--server-addr", &f.serverAddr).
+		String("--server-token", &f.serverToken).
+		Help("-h,--help", help).
+		Parse(args)
+	if err != nil {
+		return nil, &usageError{err: err}
+	}
+	return args, nil
+}
+
+// runCommand runs fn with where the commands go, see openCommands,
+// and prints the entries it returns if asked to
+func (f *commandFlags) runCommand(fn func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error)) error {
+	ctx := context.Background()
+	handler, closeHandler, err := openCommands(ctx, f.storageType, f.serverAddr, f.serverToken)
+	if err != nil {
+		return err
+	}
+	defer closeHandler()
+	entries, err := fn(ctx, handler)
+	if err != nil {
+		return err
+	}
+	if f.json {
+		return printEntriesJSON(os.Stdout, entries)
+	}
+	return nil
+}
+
+func printEntriesJSON(w io.Writer, entries []models.LogEntry) error {
+	if entries == nil {
+		entries = []models.LogEntry{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+func handleAdd(args []string) error {
+	var cmdFlags commandFlags
+	var parent string
+	args, err := cmdFlags.parse(flags.String("--parent", &parent), addHelp, args)
+	if err != nil {
+		return err
+	}
+	var texts []string
+	if len(args) > 0 {
+		if text := strings.TrimSpace(strings.Join(args, " ")); text != "" {
+			texts = append(texts, text)
+		}
+	} else {
+		input, err := readStdin()
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(input, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				texts = append(texts, line)
+			}
+		}
+	}
+	if len(texts) == 0 {
+		return usageErrorf("requires text, as arguments or lines on stdin")
+	}
+	return cmdFlags.runCommand(func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error) {
+		entries, err := handler.Add(ctx, texts, parent)
+		if err != nil {
+			return nil, err
+		}
+		if !cmdFlags.json {
+			for _, entry := range entries {
+				fmt.Println(entry.ID)
+			}
+		}
+		return entries, nil
+	})
+}
+
+func handleDone(args []string) error {
+	var cmdFlags commandFlags
+	var undo bool
+	args, err := cmdFlags.parse(flags.Bool("--undo", &undo), doneHelp, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageErrorf("requires todos, e.g. todo done 12")
+	}
+	return cmdFlags.runCommand(func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error) {
+		return handler.Done(ctx, args, !undo)
+	})
+}
+
+func handleToggle(args []string) error {
+	var cmdFlags commandFlags
+	args, err := cmdFlags.parse(flags.New(), toggleHelp, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageErrorf("requires todos, e.g. todo toggle 12")
+	}
+	return cmdFlags.runCommand(func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error) {
+		return handler.Toggle(ctx, args)
+	})
+}
+
+func handleEdit(args []string) error {
+	var cmdFlags commandFlags
+	args, err := cmdFlags.parse(flags.New(), editHelp, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageErrorf("requires a todo and text, e.g. todo edit 12 \"write release notes\"")
+	}
+	text, err := textOf(args[1:])
+	if err != nil {
+		return err
+	}
+	if strings.Contains(text, "\n") {
+		return usageErrorf("the text of a todo is one line")
+	}
+	return cmdFlags.runCommand(func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error) {
+		return handler.Edit(ctx, args[0], text)
+	})
+}
+
+func handleRm(args []string) error {
+	var cmdFlags commandFlags
+	args, err := cmdFlags.parse(flags.New(), rmHelp, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageErrorf("requires todos, e.g. todo rm 12")
+	}
+	return cmdFlags.runCommand(func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error) {
+		return handler.Remove(ctx, args)
+	})
+}
+
+func handleMv(args []string) error {
+	var cmdFlags commandFlags
+	var parent string
+	args, err := cmdFlags.parse(flags.String("--parent", &parent), mvHelp, args)
+	if err != nil {
+		return err
+	}
+	if parent == "" {
+		return usageErrorf("requires --parent, / for the top level")
+	}
+	if len(args) == 0 {
+		return usageErrorf("requires todos, e.g. todo mv --parent 3 12")
+	}
+	return cmdFlags.runCommand(func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error) {
+		return handler.Move(ctx, args, parent)
+	})
+}
+
+func handleNote(args []string) error {
+	var cmdFlags commandFlags
+	args, err := cmdFlags.parse(flags.New(), noteHelp, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageErrorf("requires a todo and text, e.g. todo note 12 \"waiting for review\"")
+	}
+	text, err := textOf(args[1:])
+	if err != nil {
+		return err
+	}
+	return cmdFlags.runCommand(func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error) {
+		return handler.AddNote(ctx, args[0], text)
+	})
+}
+
+func handleFocus(args []string) error {
+	args, err := flags.Help("-h,--help", focusHelp).Parse(args)
+	if err != nil {
+		return &usageError{err: err}
+	}
+	if len(args) != 1 {
+		return usageErrorf("requires one todo, e.g. todo focus 12")
+	}
+	socket, err := config.GetControlSocket()
+	if err != nil {
+		return err
+	}
+	client, err := control.Dial(socket)
+	if err != nil {
+		return fmt.Errorf("focus requires a running todo")
+	}
+	defer client.Close()
+	return client.Focus(context.Background(), args[0])
+}
+
+func handleShowTop(args []string) error {
+	var cmdFlags commandFlags
+	var durationFlag string
+	args, err := cmdFlags.parse(flags.String("--duration", &durationFlag), showTopHelp, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageErrorf("requires one todo, e.g. todo show-top 12")
+	}
+	var duration time.Duration
+	if durationFlag != "" {
+		duration, err = time.ParseDuration(durationFlag)
+		if err != nil || duration <= 0 {
+			return usageErrorf("invalid duration %q, expecting e.g. 45m", durationFlag)
+		}
+	}
+	return cmdFlags.runCommand(func(ctx context.Context, handler control.Handler) ([]models.LogEntry, error) {
+		return nil, handler.ShowTop(ctx, args[0], duration)
+	})
+}
+
+// textOf returns the text given as args, or else on stdin
+func textOf(args []string) (string, error) {
+	text := strings.Join(args, " ")
+	if len(args) == 0 {
+		input, err := readStdin()
+		if err != nil {
+			return "", err
+		}
+		text = input
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", usageErrorf("requires text, as arguments or on stdin")
+	}
+	return text, nil
+}
+
+// readStdin reads stdin unless it is a terminal, which would wait for
+// typing that was not meant
+func readStdin() (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", nil
+	}
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return string(input), nil
+}
@@ -0,0 +1,169 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/xhd2015/todo/control"
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage/memory"
+)
+
+func newTestCommandHandler(t *testing.T) *commandHandler {
+	store := memory.NewBaseStore(memory.NewMemoryDataStore())
+	logManager := data.NewLogManager(&data.Services{
+		LogEntry:       store.LogEntryService(),
+		LogNote:        store.LogNoteService(),
+		Happening:      store.HappeningService(),
+		StateRecording: store.StateRecordingService(),
+		Group:          store.GroupService(),
+		Search:         store.SearchService(),
+		Revision:       store.RevisionService(),
+	})
+	if err := logManager.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return &commandHandler{logManager: logManager}
+}
+
+func addEntry(t *testing.T, h *commandHandler, parent string, text string) int64 {
+	entries, err := h.Add(context.Background(), []string{text}, parent)
+	if err != nil {
+		t.Fatalf("add %s: %v", text, err)
+	}
+	return entries[0].ID
+}
+
+func TestSelectors(t *testing.T) {
+	h := newTestCommandHandler(t)
+	work := addEntry(t, h, "", "Work")
+	release := addEntry(t, h, "Work", "Release")
+	changelog := addEntry(t, h, "Work/Release", "changelog")
+	notes := addEntry(t, h, "Work/Release", "notes")
+	addEntry(t, h, "", "2025")
+	slashed := addEntry(t, h, "", "a/b testing")
+
+	entries := h.logManager.Entries
+	for _, c := range []struct {
+		selectors []string
+		want      []int64
+	}{
+		{[]string{"Work/Release/*"}, []int64{changelog, notes}},
+		{[]string{"/Work/Rel*/notes"}, []int64{notes}},
+		{[]string{"*/*"}, []int64{release}},
+		{[]string{"Work", "1", "Work/Release"}, []int64{work, release}},
+		{[]string{`a\/b*`}, []int64{slashed}},
+		{[]string{"*b test*", "a?b testing"}, []int64{slashed}},
+		{[]string{`/[a-c]\/[b]*/`}, []int64{slashed}},
+	} {
+		selected, err := selectEntries(entries, c.selectors)
+		if err != nil {
+			t.Fatalf("%v: %v", c.selectors, err)
+		}
+		var got []int64
+		for _, entry := range selected {
+			got = append(got, entry.Data.ID)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Fatalf("%v: expect %v, got %v", c.selectors, c.want, got)
+		}
+	}
+
+	if entry, err := selectEntry(entries, "/2025"); err != nil || entry.Data.Text != "2025" {
+		t.Fatalf("expect /2025 to select the text, got %v, %v", entry, err)
+	}
+	if _, err := selectEntry(entries, "2025"); !errors.Is(err, control.ErrNotFound) {
+		t.Fatalf("expect 2025 to be an ID, got %v", err)
+	}
+	if _, err := selectEntry(entries, "Work/Release/*"); !errors.Is(err, control.ErrAmbiguous) {
+		t.Fatalf("expect ErrAmbiguous, got %v", err)
+	}
+	if _, err := selectEntries(entries, []string{"Work/[Rel"}); !errors.Is(err, control.ErrInvalid) {
+		t.Fatalf("expect ErrInvalid, got %v", err)
+	}
+	if _, err := selectEntries(entries, []string{"Work/Nope"}); !errors.Is(err, control.ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if _, err := selectEntries(entries, []string{"Work/[a"}); !errors.Is(err, control.ErrInvalid) {
+		t.Fatalf("expect ErrInvalid, got %v", err)
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	ctx := context.Background()
+	h := newTestCommandHandler(t)
+	addEntry(t, h, "", "Work")
+	addEntry(t, h, "", "Inbox")
+	addEntry(t, h, "Work", "Release")
+	a := addEntry(t, h, "Inbox", "tag v1.2.0")
+	b := addEntry(t, h, "Inbox", "announce")
+
+	done, err := h.Done(ctx, []string{"Inbox/*"}, true)
+	if err != nil {
+		t.Fatalf("done: %v", err)
+	}
+	if len(done) != 2 || !done[0].Done || !done[1].Done {
+		t.Fatalf("expect 2 entries done, got %+v", done)
+	}
+
+	edited, err := h.Edit(ctx, "Inbox/announce", "announce  on the blog @tomorrow")
+	if err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	if edited[0].ID != b || edited[0].Text != "announce  on the blog" || edited[0].DueTime == nil {
+		t.Fatalf("expect entry %d edited, got %+v", b, edited)
+	}
+
+	if _, err := h.Move(ctx, []string{"Work"}, "Work/Release"); !errors.Is(err, control.ErrInvalid) {
+		t.Fatalf("expect moving under itself to fail, got %v", err)
+	}
+	moved, err := h.Move(ctx, []string{"Inbox/*"}, "Work/Release")
+	if err != nil {
+		t.Fatalf("mv: %v", err)
+	}
+	release, _ := selectEntry(h.logManager.Entries, "Work/Release")
+	if len(moved) != 2 || moved[0].ID != a || moved[0].ParentID != release.Data.ID || len(release.Children) != 2 {
+		t.Fatalf("expect 2 entries moved under Release, got %+v", moved)
+	}
+
+	if _, err := h.AddNote(ctx, "Work/Release/*", "shipped"); !errors.Is(err, control.ErrAmbiguous) {
+		t.Fatalf("expect note on many entries to fail, got %v", err)
+	}
+	if _, err := h.AddNote(ctx, "Work/Release", "shipped"); err != nil {
+		t.Fatalf("note: %v", err)
+	}
+	if len(release.Notes) != 1 {
+		t.Fatalf("expect 1 note, got %d", len(release.Notes))
+	}
+
+	removed, err := h.Remove(ctx, []string{"Work", "Work/Release/*"})
+	if err != nil {
+		t.Fatalf("rm: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Text != "Work" {
+		t.Fatalf("expect Work removed along with its descendants, got %+v", removed)
+	}
+	if _, err := selectEntry(h.logManager.Entries, "1"); !errors.Is(err, control.ErrNotFound) {
+		t.Fatalf("expect Work gone, got %v", err)
+	}
+	_, err = h.Toggle(ctx, []string{"1"})
+	if !errors.Is(err, control.ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if ExitCode(err) != ExitNotFound {
+		t.Fatalf("expect exit code %d, got %d", ExitNotFound, ExitCode(err))
+	}
+
+	// one command is one undo
+	if _, err := h.logManager.Undo(ctx); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	if _, err := selectEntries(h.logManager.Entries, []string{"Work", "Work/Release"}); err != nil {
+		t.Fatalf("expect Work back after undo: %v", err)
+	}
+	if _, err := selectEntry(h.logManager.Entries, "Inbox"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -41,3 +41,16 @@ func ApplyConfigDefaults(storageType, serverAddr, serverToken string) (StorageCo
 		ServerToken: serverToken,
 	}, nil
 }
+
+// saveServerToken replaces the saved token of the server at serverAddr
+func saveServerToken(serverAddr string, token string) error {
+	savedConfig, err := data.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if savedConfig == nil || savedConfig.ServerAddr != serverAddr {
+		return nil
+	}
+	savedConfig.ServerToken = token
+	return data.SaveConfig(savedConfig)
+}
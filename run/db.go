@@ -0,0 +1,95 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/todo/data/storage/sqlite"
+	"github.com/xhd2015/todo/internal/config"
+)
+
+const dbHelp = `
+todo db - Manage the SQLite database
+
+Usage: todo db <cmd> [OPTIONS]
+
+Available sub commands:
+  migrate                          apply pending schema migrations
+  version                          show the schema version
+
+Options:
+  --file <file>                    database file, defaults to the sqlite storage file
+  --dry-run                        (migrate) list pending migrations without applying them
+  -h,--help                        show this help message
+`
+
+func handleDB(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("requires sub command: migrate, version")
+	}
+	cmd := args[0]
+	args = args[1:]
+	if cmd == "--help" || cmd == "-h" || cmd == "help" {
+		fmt.Print(strings.TrimPrefix(dbHelp, "\n"))
+		return nil
+	}
+
+	var file string
+	var dryRun bool
+	args, err := flags.String("--file", &file).
+		Bool("--dry-run", &dryRun).
+		Help("-h,--help", dbHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra arguments: %s", strings.Join(args, " "))
+	}
+	if file == "" {
+		file, err = config.GetSqliteFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	switch cmd {
+	case "migrate":
+		if dryRun {
+			version, pending, err := sqlite.PendingMigrations(file)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: schema version %d, latest %d\n", file, version, sqlite.LatestSchemaVersion())
+			if len(pending) == 0 {
+				fmt.Println("no pending migrations")
+				return nil
+			}
+			for _, m := range pending {
+				fmt.Printf("would apply %d: %s\n", m.Version, m.Name)
+			}
+			return nil
+		}
+		applied, err := sqlite.Migrate(file)
+		for _, m := range applied {
+			fmt.Printf("applied %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("already up to date")
+		}
+		return nil
+	case "version":
+		version, pending, err := sqlite.PendingMigrations(file)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: schema version %d, latest %d, %d pending\n", file, version, sqlite.LatestSchemaVersion(), len(pending))
+		return nil
+	default:
+		return fmt.Errorf("unrecognized: %s", cmd)
+	}
+}
@@ -1,48 +1,99 @@
 package run
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/exchange"
 	"github.com/xhd2015/todo/internal/config"
 	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/ui/tree"
 )
 
 const exportHelp = `
-export <json_file>
+export <file>
 
-Export all todos and their notes to a JSON file.
-`
+Export all todos at every depth with their notes, happenings,
+states with their events, and groups to a JSON file.
 
-const importHelp = `
-import <json_file>
+With --format=md, only todos are exported, as nested Markdown task
+lists with notes as blockquotes and done times after the text:
 
-Import todos and their notes from a JSON file.
-Entries with the same text content will be skipped.
-`
+  - [ ] write design
+    > draft in docs
+    - [x] review (done 2025-09-01 11:00)
 
-type ExportData struct {
-	Entries []ExportEntry `json:"entries"`
-}
+With --format=todotxt, todos are written as todo.txt lines, priorities
+(A) to (E) from highlight levels, due:, t: for the scheduled time and
+rec: for repeats, and the hierarchy as id: and p: keys. Notes are
+left out.
 
-type ExportEntry struct {
-	Data  *models.LogEntry `json:"data"`
-	Notes []ExportNote     `json:"notes"`
-}
+With --format=taskwarrior, todos are written as the JSON of
+'task export': parents depend on their children, notes are
+annotations and #tags are tags.
 
-type ExportNote struct {
-	Data *models.Note `json:"data"`
-}
+With --format=ics, todos are written as iCalendar VTODOs linked to
+their parents by RELATED-TO, and happenings as VEVENTs, or VJOURNALs
+with --happenings=journal. Times are written in UTC.
+
+Options:
+  --format <format>                json (default), md, todotxt, taskwarrior or ics
+  --happenings <component>         with --format=ics: event (default) or journal
+  --storage <type>                 storage backend: file (default), sqlite, or server
+  --server-addr <addr>             server address (required when --storage=server)
+  --server-token <token>           server authentication token (optional when --storage=server)
+`
+
+const importHelp = `
+import <file>
+
+Import a file written by todo export, keeping the hierarchy of todos.
+With --format=md, any Markdown outline is read, list items becoming
+todos and blockquotes under them notes. With --format=todotxt, a
+todo.txt file is read, projects and contexts staying in the text.
+With --format=taskwarrior, the JSON of 'task export' is read, tasks
+going under the task depending on them, or else under todos made for
+their project. Markdown and todo.txt have no update times, so merging
+only adds what the store is missing.
+Happenings with the same content and time, and states with the same
+name, are skipped. Groups are matched by name. What happens to the
+todos the store already has depends on the strategy:
+
+  skip (default)   skip todos with the same text under the same parent
+  overwrite        replace todos matched by text with those of the
+                   file, notes included
+  merge-by-id      match todos by ID, for files exported from the same
+                   store, and keep the more recently updated ones
+  merge-by-path    match todos by text like skip, and keep the more
+                   recently updated ones
+
+Merging adds the notes missing in the store and never deletes any.
+
+Options:
+  --format <format>                json (default), md, todotxt or taskwarrior
+  --strategy <name>                skip, overwrite, merge-by-id or merge-by-path
+  --dry-run                        print what would be added, changed or skipped
+                                   as a tree, without changing the store
+  --storage <type>                 storage backend: file (default), sqlite, or server
+  --server-addr <addr>             server address (required when --storage=server)
+  --server-token <token>           server authentication token (optional when --storage=server)
+`
 
 func handleExport(args []string) error {
+	var format string
+	var happenings string
 	var storageType string
 	var serverAddr string
 	var serverToken string
 
-	args, err := flags.String("--storage", &storageType).
+	args, err := flags.String("--format", &format).
+		String("--happenings", &happenings).
+		String("--storage", &storageType).
 		String("--server-addr", &serverAddr).
 		String("--server-token", &serverToken).
 		Help("-h,--help", exportHelp).
@@ -52,75 +103,100 @@ func handleExport(args []string) error {
 	}
 
 	if len(args) != 1 {
-		return fmt.Errorf("export requires exactly one argument: <json_file>")
+		return fmt.Errorf("export requires exactly one argument: <file>")
 	}
-
-	// Apply config defaults
-	storageConfig, err := ApplyConfigDefaults(storageType, serverAddr, serverToken)
+	file := args[0]
+	icsHappenings, err := exchange.ParseICSHappening(happenings)
 	if err != nil {
 		return err
 	}
-	storageType = storageConfig.StorageType
-	serverAddr = storageConfig.ServerAddr
-	serverToken = storageConfig.ServerToken
-
-	// Validate server-addr is provided when storage type is server
-	if storageType == "server" && serverAddr == "" {
-		return fmt.Errorf("--server-addr is required when --storage=server")
+	write, err := exchangeWriter(format, exchange.ICSOptions{Happenings: icsHappenings})
+	if err != nil {
+		return err
 	}
 
-	jsonFile := args[0]
-
-	logManager, _, err := CreateLogManager(storageType, serverAddr, serverToken)
+	services, err := exchangeServices(storageType, serverAddr, serverToken)
 	if err != nil {
 		return err
 	}
 
-	// Initialize with history to export all data including completed todos
-	err = logManager.InitWithHistory(true)
+	doc, err := exchange.Export(context.Background(), services)
 	if err != nil {
 		return err
 	}
 
-	exportData := ExportData{
-		Entries: make([]ExportEntry, 0, len(logManager.Entries)),
+	out, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
 	}
-
-	for _, entry := range logManager.Entries {
-		exportEntry := ExportEntry{
-			Data:  entry.Data,
-			Notes: make([]ExportNote, 0, len(entry.Notes)),
-		}
-
-		for _, note := range entry.Notes {
-			exportEntry.Notes = append(exportEntry.Notes, ExportNote{
-				Data: note.Data,
-			})
-		}
-
-		exportData.Entries = append(exportData.Entries, exportEntry)
+	defer out.Close()
+	if err := write(out, doc); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
 	}
 
-	data, err := json.MarshalIndent(exportData, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
+	switch format {
+	case "", "json":
+	case "ics":
+		fmt.Printf("Exported %d entries and %d happenings to %s\n", len(doc.Entries), len(doc.Happenings), file)
+		return nil
+	default:
+		fmt.Printf("Exported %d entries to %s\n", len(doc.Entries), file)
+		return nil
 	}
+	fmt.Printf("Exported %d entries, %d happenings and %d states to %s\n", len(doc.Entries), len(doc.Happenings), len(doc.States), file)
+	return nil
+}
 
-	err = os.WriteFile(jsonFile, data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+// exchangeWriter and exchangeReader return the codec of a --format
+func exchangeWriter(format string, icsOpts exchange.ICSOptions) (func(w io.Writer, doc *exchange.Document) error, error) {
+	switch format {
+	case "", "json":
+		return exchange.Write, nil
+	case "md":
+		return exchange.WriteMarkdown, nil
+	case "todotxt":
+		return exchange.WriteTodoTxt, nil
+	case "taskwarrior":
+		return exchange.WriteTaskwarrior, nil
+	case "ics":
+		return func(w io.Writer, doc *exchange.Document) error {
+			return exchange.WriteICS(w, doc, icsOpts)
+		}, nil
 	}
+	return nil, fmt.Errorf("unknown format %q, available: json, md, todotxt, taskwarrior, ics", format)
+}
 
-	fmt.Printf("Exported %d entries to %s\n", len(exportData.Entries), jsonFile)
-	return nil
+func exchangeReader(format string) (func(r io.Reader) (*exchange.Document, error), error) {
+	switch format {
+	case "", "json":
+		return exchange.Read, nil
+	case "md":
+		return exchange.ReadMarkdown, nil
+	case "todotxt":
+		return exchange.ReadTodoTxt, nil
+	case "taskwarrior":
+		return exchange.ReadTaskwarrior, nil
+	case "ics":
+		return nil, fmt.Errorf("format ics can only be exported")
+	}
+	return nil, fmt.Errorf("unknown format %q, available: json, md, todotxt, taskwarrior", format)
 }
 
 func handleImport(args []string) error {
+	var format string
+	var strategyName string
+	var dryRun bool
 	var storageType string
 	var serverAddr string
 	var serverToken string
 
-	args, err := flags.String("--storage", &storageType).
+	args, err := flags.String("--format", &format).
+		String("--strategy", &strategyName).
+		Bool("--dry-run", &dryRun).
+		String("--storage", &storageType).
 		String("--server-addr", &serverAddr).
 		String("--server-token", &serverToken).
 		Help("-h,--help", importHelp).
@@ -130,146 +206,136 @@ func handleImport(args []string) error {
 	}
 
 	if len(args) != 1 {
-		return fmt.Errorf("import requires exactly one argument: <json_file>")
+		return fmt.Errorf("import requires exactly one argument: <file>")
 	}
-
-	// Apply config defaults
-	storageConfig, err := ApplyConfigDefaults(storageType, serverAddr, serverToken)
+	file := args[0]
+	read, err := exchangeReader(format)
 	if err != nil {
 		return err
 	}
-	storageType = storageConfig.StorageType
-	serverAddr = storageConfig.ServerAddr
-	serverToken = storageConfig.ServerToken
-
-	// Validate server-addr is provided when storage type is server
-	if storageType == "server" && serverAddr == "" {
-		return fmt.Errorf("--server-addr is required when --storage=server")
+	strategy, err := exchange.ParseStrategy(strategyName)
+	if err != nil {
+		return err
 	}
 
-	jsonFile := args[0]
-
-	data, err := os.ReadFile(jsonFile)
+	in, err := os.Open(file)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
-
-	var importData ExportData
-	err = json.Unmarshal(data, &importData)
+	defer in.Close()
+	doc, err := read(in)
 	if err != nil {
-		return fmt.Errorf("failed to parse JSON: %w", err)
+		return err
 	}
 
-	logManager, _, err := CreateLogManager(storageType, serverAddr, serverToken)
+	services, err := exchangeServices(storageType, serverAddr, serverToken)
 	if err != nil {
 		return err
 	}
 
-	err = logManager.Init()
+	ctx := context.Background()
+	plan, err := exchange.NewPlan(ctx, services, doc, strategy)
 	if err != nil {
 		return err
 	}
-
-	// Create a set of existing entry texts for deduplication
-	existingTexts := make(map[string]bool)
-	for _, entry := range logManager.Entries {
-		existingTexts[strings.TrimSpace(entry.Data.Text)] = true
+	if dryRun {
+		renderPlan(os.Stdout, plan)
+		fmt.Println()
+		printImportResult(plan.Summary(), file, true)
+		return nil
 	}
+	result, err := plan.Apply(ctx, services)
+	if err != nil {
+		return err
+	}
+	printImportResult(result, file, false)
+	return nil
+}
 
-	// Map old entry IDs to new entry IDs for parent-child relationships
-	oldToNewIDMap := make(map[int64]int64)
-
-	// Sort entries to ensure parents are imported before children
-	sortedEntries := make([]ExportEntry, 0, len(importData.Entries))
-	entryMap := make(map[int64]ExportEntry)
-
-	// Build entry map and identify root entries (no parent)
-	var rootEntries []ExportEntry
-	for _, entry := range importData.Entries {
-		entryMap[entry.Data.ID] = entry
-		if entry.Data.ParentID == 0 {
-			rootEntries = append(rootEntries, entry)
+func printImportResult(result *exchange.ImportResult, file string, dryRun bool) {
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d entries with %d notes, skipped %d existing from %s\n", verb, result.Entries, result.Notes, result.SkippedEntries, file)
+	if result.ChangedEntries > 0 {
+		if dryRun {
+			fmt.Printf("Would change %d entries and %d notes, delete %d notes\n", result.ChangedEntries, result.ChangedNotes, result.DeletedNotes)
+		} else {
+			fmt.Printf("Changed %d entries and %d notes, deleted %d notes\n", result.ChangedEntries, result.ChangedNotes, result.DeletedNotes)
 		}
 	}
+	if result.Happenings > 0 || result.SkippedHappenings > 0 {
+		fmt.Printf("%s %d happenings, skipped %d existing\n", verb, result.Happenings, result.SkippedHappenings)
+	}
+	if result.States > 0 || result.SkippedStates > 0 {
+		fmt.Printf("%s %d states with %d events, skipped %d existing\n", verb, result.States, result.StateEvents, result.SkippedStates)
+	}
+	if dryRun && result.Groups > 0 {
+		fmt.Printf("Would add %d groups\n", result.Groups)
+	} else if result.Groups > 0 || result.GroupMemberships > 0 {
+		fmt.Printf("Added %d groups, imported %d group memberships\n", result.Groups, result.GroupMemberships)
+	}
+}
 
-	// Recursively add entries in parent-first order
-	var addEntriesRecursively func(entries []ExportEntry)
-	addEntriesRecursively = func(entries []ExportEntry) {
-		for _, entry := range entries {
-			sortedEntries = append(sortedEntries, entry)
-			// Find children of this entry
-			var children []ExportEntry
-			for _, candidate := range importData.Entries {
-				if candidate.Data.ParentID == entry.Data.ID {
-					children = append(children, candidate)
-				}
-			}
-			if len(children) > 0 {
-				addEntriesRecursively(children)
+// renderPlan prints the entries of the plan as a tree, marked +
+// when added, ~ when changed and = when skipped
+func renderPlan(out io.Writer, plan *exchange.Plan) {
+	plans := make(map[*models.LogEntryView]*exchange.EntryPlan)
+	var views func(entries []*exchange.EntryPlan) []*models.LogEntryView
+	views = func(entries []*exchange.EntryPlan) []*models.LogEntryView {
+		result := make([]*models.LogEntryView, 0, len(entries))
+		for _, ep := range entries {
+			view := &models.LogEntryView{
+				Data:     ep.Entry.Data,
+				Children: views(ep.Children),
 			}
+			plans[view] = ep
+			result = append(result, view)
 		}
+		return result
 	}
-
-	addEntriesRecursively(rootEntries)
-
-	imported := 0
-	skipped := 0
-
-	// Import entries in sorted order
-	for _, importEntry := range sortedEntries {
-		trimmedText := strings.TrimSpace(importEntry.Data.Text)
-		if existingTexts[trimmedText] {
-			skipped++
-			continue
-		}
-
-		// Determine the new parent ID
-		var newParentID int64
-		if importEntry.Data.ParentID != 0 {
-			if mappedParentID, exists := oldToNewIDMap[importEntry.Data.ParentID]; exists {
-				newParentID = mappedParentID
-			} else {
-				// Parent not found, skip this entry or make it root
-				newParentID = 0
+	tree.RenderEntries(views(plan.Entries), func(prefix string, connector string, entry *models.LogEntryView) {
+		ep := plans[entry]
+		var line string
+		switch ep.Action {
+		case exchange.Action_Add:
+			line = "+ " + entry.Data.Text
+			if len(ep.Entry.Notes) > 0 {
+				line += fmt.Sprintf(" (%d notes)", len(ep.Entry.Notes))
 			}
-		}
-
-		// Add the entry with all original fields preserved
-		entryID, err := logManager.LogEntryService.Add(models.LogEntry{
-			Text:            importEntry.Data.Text,
-			Done:            importEntry.Data.Done,
-			DoneTime:        importEntry.Data.DoneTime,
-			CreateTime:      importEntry.Data.CreateTime,
-			UpdateTime:      importEntry.Data.UpdateTime,
-			AdjustedTopTime: importEntry.Data.AdjustedTopTime,
-			HighlightLevel:  importEntry.Data.HighlightLevel,
-			ParentID:        newParentID,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to add entry: %w", err)
-		}
-
-		// Map old ID to new ID
-		oldToNewIDMap[importEntry.Data.ID] = entryID
-
-		// Add notes with all original fields preserved
-		for _, note := range importEntry.Notes {
-			_, err := logManager.LogNoteService.Add(entryID, models.Note{
-				Text:       note.Data.Text,
-				CreateTime: note.Data.CreateTime,
-				UpdateTime: note.Data.UpdateTime,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to add note: %w", err)
+		case exchange.Action_Change:
+			changes := append([]string(nil), ep.Changes...)
+			if len(ep.AddNotes) > 0 {
+				changes = append(changes, fmt.Sprintf("+%d notes", len(ep.AddNotes)))
 			}
+			if len(ep.UpdateNotes) > 0 {
+				changes = append(changes, fmt.Sprintf("~%d notes", len(ep.UpdateNotes)))
+			}
+			if len(ep.DeleteNotes) > 0 {
+				changes = append(changes, fmt.Sprintf("-%d notes", len(ep.DeleteNotes)))
+			}
+			line = "~ " + entry.Data.Text + " (" + strings.Join(changes, ", ") + ")"
+		default:
+			line = "= " + entry.Data.Text
 		}
+		io.WriteString(out, prefix+connector+line+"\n")
+	})
+}
 
-		imported++
-		existingTexts[trimmedText] = true
+// exchangeServices opens the storage for export and import
+func exchangeServices(storageType string, serverAddr string, serverToken string) (*data.Services, error) {
+	// Apply config defaults
+	storageConfig, err := ApplyConfigDefaults(storageType, serverAddr, serverToken)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("Imported %d entries, skipped %d duplicates from %s\n", imported, skipped, jsonFile)
-	return nil
+	// Validate server-addr is provided when storage type is server
+	if storageConfig.StorageType == "server" && storageConfig.ServerAddr == "" {
+		return nil, fmt.Errorf("--server-addr is required when --storage=server")
+	}
+	return createLogServices(storageConfig.StorageType, storageConfig.ServerAddr, storageConfig.ServerToken)
 }
 
 func handleConfig(args []string) error {
@@ -0,0 +1,317 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xhd2015/todo/app"
+	"github.com/xhd2015/todo/control"
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/internal/config"
+	"github.com/xhd2015/todo/models"
+)
+
+// commandHandler implements control.Handler on a LogManager
+type commandHandler struct {
+	logManager *data.LogManager
+	// state is the app's when the commands come through the control
+	// socket, nil when the command line applies them to storage
+	state *app.State
+}
+
+// run runs action as an action of the app, if there is one, and
+// waits for it
+func (h *commandHandler) run(ctx context.Context, action func(ctx context.Context) error) error {
+	if h.state == nil {
+		return action(ctx)
+	}
+	result := make(chan error, 1)
+	h.state.Enqueue(func(ctx context.Context) error {
+		err := action(ctx)
+		h.state.Entries = h.logManager.Entries
+		result <- err
+		return err
+	})
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// apply runs fn as one action, undone together in the app, and
+// returns the entries with the IDs fn returns
+func (h *commandHandler) apply(ctx context.Context, fn func(ctx context.Context) ([]int64, error)) ([]models.LogEntry, error) {
+	var affected []models.LogEntry
+	err := h.run(ctx, func(ctx context.Context) error {
+		return h.logManager.Batch(func() error {
+			ids, err := fn(ctx)
+			if err != nil {
+				return err
+			}
+			affected = h.entriesOf(ids)
+			return nil
+		})
+	})
+	return affected, err
+}
+
+// entriesOf copies the entries with ids, to be encoded while the app
+// goes on changing them
+func (h *commandHandler) entriesOf(ids []int64) []models.LogEntry {
+	entries := make([]models.LogEntry, 0, len(ids))
+	for _, id := range ids {
+		if entry := findEntry(h.logManager.Entries, id); entry != nil {
+			entries = append(entries, *entry.Data)
+		}
+	}
+	return entries
+}
+
+func (h *commandHandler) Add(ctx context.Context, texts []string, parent string) ([]models.LogEntry, error) {
+	return h.apply(ctx, func(ctx context.Context) ([]int64, error) {
+		parentID, err := selectParent(h.logManager.Entries, parent)
+		if err != nil {
+			return nil, err
+		}
+		var ids []int64
+		for _, text := range texts {
+			entry := newEntryFromInput(text)
+			entry.ParentID = parentID
+			id, err := h.logManager.Add(ctx, entry)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	})
+}
+
+// Done marks the entries done or not, those done already are left as
+// they are. The next occurrences added are among the entries returned.
+func (h *commandHandler) Done(ctx context.Context, selectors []string, done bool) ([]models.LogEntry, error) {
+	return h.apply(ctx, func(ctx context.Context) ([]int64, error) {
+		return h.setDone(ctx, selectors, func(entry *models.LogEntryView) bool {
+			return done
+		})
+	})
+}
+
+func (h *commandHandler) Toggle(ctx context.Context, selectors []string) ([]models.LogEntry, error) {
+	return h.apply(ctx, func(ctx context.Context) ([]int64, error) {
+		return h.setDone(ctx, selectors, func(entry *models.LogEntryView) bool {
+			return !entry.Data.Done
+		})
+	})
+}
+
+func (h *commandHandler) setDone(ctx context.Context, selectors []string, done func(entry *models.LogEntryView) bool) ([]int64, error) {
+	selected, err := selectEntries(h.logManager.Entries, selectors)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, entry := range selected {
+		id := entry.Data.ID
+		ids = append(ids, id)
+		entryDone := done(entry)
+		if entry.Data.Done == entryDone {
+			continue
+		}
+		nextID, err := setDone(ctx, h.logManager, id, entryDone)
+		if err != nil {
+			return nil, err
+		}
+		if nextID != 0 {
+			ids = append(ids, nextID)
+		}
+	}
+	return ids, nil
+}
+
+func (h *commandHandler) Edit(ctx context.Context, selector string, text string) ([]models.LogEntry, error) {
+	return h.apply(ctx, func(ctx context.Context) ([]int64, error) {
+		entry, err := selectEntry(h.logManager.Entries, selector)
+		if err != nil {
+			return nil, err
+		}
+		id := entry.Data.ID
+		if err := h.logManager.Update(ctx, id, updateFromInput(text)); err != nil {
+			return nil, err
+		}
+		return []int64{id}, nil
+	})
+}
+
+// Remove moves the entries to trash with their descendants. It
+// returns them as they were.
+func (h *commandHandler) Remove(ctx context.Context, selectors []string) ([]models.LogEntry, error) {
+	var removed []models.LogEntry
+	err := h.run(ctx, func(ctx context.Context) error {
+		selected, err := selectEntries(h.logManager.Entries, selectors)
+		if err != nil {
+			return err
+		}
+		ids := make(map[int64]bool, len(selected))
+		for _, entry := range selected {
+			ids[entry.Data.ID] = true
+		}
+		for _, entry := range selected {
+			// those under another are deleted along with it
+			if !h.hasAncestorIn(entry, ids) {
+				removed = append(removed, *entry.Data)
+			}
+		}
+		return h.logManager.Batch(func() error {
+			for _, entry := range removed {
+				if err := h.logManager.Delete(ctx, entry.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return removed, err
+}
+
+func (h *commandHandler) hasAncestorIn(entry *models.LogEntryView, ids map[int64]bool) bool {
+	for parentID := entry.Data.ParentID; parentID != 0; {
+		if ids[parentID] {
+			return true
+		}
+		parent := findEntry(h.logManager.Entries, parentID)
+		if parent == nil {
+			return false
+		}
+		parentID = parent.Data.ParentID
+	}
+	return false
+}
+
+func (h *commandHandler) Move(ctx context.Context, selectors []string, parent string) ([]models.LogEntry, error) {
+	return h.apply(ctx, func(ctx context.Context) ([]int64, error) {
+		parentID, err := selectParent(h.logManager.Entries, parent)
+		if err != nil {
+			return nil, err
+		}
+		selected, err := selectEntries(h.logManager.Entries, selectors)
+		if err != nil {
+			return nil, err
+		}
+		var ids []int64
+		for _, entry := range selected {
+			id := entry.Data.ID
+			if parentID != 0 && (id == parentID || findEntry(entry.Children, parentID) != nil) {
+				return nil, fmt.Errorf("%w: cannot move todo %d under itself", control.ErrInvalid, id)
+			}
+			ids = append(ids, id)
+			if entry.Data.ParentID == parentID {
+				continue
+			}
+			if err := h.logManager.Move(ctx, id, parentID); err != nil {
+				return nil, err
+			}
+		}
+		return ids, nil
+	})
+}
+
+func (h *commandHandler) AddNote(ctx context.Context, selector string, text string) ([]models.LogEntry, error) {
+	return h.apply(ctx, func(ctx context.Context) ([]int64, error) {
+		entry, err := selectEntry(h.logManager.Entries, selector)
+		if err != nil {
+			return nil, err
+		}
+		id := entry.Data.ID
+		if err := h.logManager.AddNote(ctx, id, models.Note{Text: text}); err != nil {
+			return nil, err
+		}
+		return []int64{id}, nil
+	})
+}
+
+// Focus goes back to the main page and selects the entry
+func (h *commandHandler) Focus(ctx context.Context, selector string) error {
+	if h.state == nil {
+		return errors.New("focus requires a running todo")
+	}
+	return h.run(ctx, func(ctx context.Context) error {
+		entry, err := selectEntry(h.logManager.Entries, selector)
+		if err != nil {
+			return err
+		}
+		for len(h.state.Routes) > 0 {
+			h.state.Routes.Pop()
+		}
+		h.state.Select(models.LogEntryViewType_Log, entry.Data.ID)
+		return nil
+	})
+}
+
+func (h *commandHandler) ShowTop(ctx context.Context, selector string, duration time.Duration) error {
+	if duration <= 0 {
+		duration = control.DefaultShowTopDuration
+	}
+	return h.run(ctx, func(ctx context.Context) error {
+		entry, err := selectEntry(h.logManager.Entries, selector)
+		if err != nil {
+			return err
+		}
+		return showTop(ctx, h.logManager, entry.Data.ID, entry.Data.Text, duration)
+	})
+}
+
+// listenControl lets the todo command drive the app through the
+// control socket until ctx is done
+func listenControl(ctx context.Context, appState *app.State, logManager *data.LogManager) error {
+	socket, err := config.GetControlSocket()
+	if err != nil {
+		return err
+	}
+	listener, err := control.Listen(socket, &commandHandler{logManager: logManager, state: appState})
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := listener.Serve(ctx); err != nil {
+			appState.StatusBar.Error = fmt.Sprintf("control socket: %v", err)
+			appState.Refresh()
+		}
+	}()
+	return nil
+}
+
+// openCommands returns what carries out the commands of the command
+// line: the running todo, so that it shows them at once, unless a
+// storage is given, or else the storage
+func openCommands(ctx context.Context, storageType string, serverAddr string, serverToken string) (control.Handler, func() error, error) {
+	if storageType == "" && serverAddr == "" {
+		socket, err := config.GetControlSocket()
+		if err != nil {
+			return nil, nil, err
+		}
+		if client, err := control.Dial(socket); err == nil {
+			return client, client.Close, nil
+		}
+	}
+
+	storageConfig, err := ApplyConfigDefaults(storageType, serverAddr, serverToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if storageConfig.StorageType == "server" && storageConfig.ServerAddr == "" {
+		return nil, nil, fmt.Errorf("--server-addr is required when --storage=server")
+	}
+	logManager, _, err := CreateLogManager(storageConfig.StorageType, storageConfig.ServerAddr, storageConfig.ServerToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := logManager.Init(ctx); err != nil {
+		return nil, nil, err
+	}
+	return &commandHandler{logManager: logManager}, func() error { return nil }, nil
+}
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/xhd2015/less-gen/flags"
 	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
 	"github.com/xhd2015/todo/models"
 	"github.com/xhd2015/todo/ui/tree"
 	"golang.org/x/term"
@@ -22,7 +25,9 @@ list - Display todo entries in tree format
 Options:
   --json                       Output raw JSON data instead of formatted tree
   --include <pattern>          Only include sub-trees containing the pattern (case-insensitive)
+  --tag <name>                 Only include sub-trees containing entries tagged #name, repeatable
   --toggle <id>                Toggle visibility of all children (including history) for the specified entry ID
+  --as-of <date>               Show the todos as they were at the end of the date, or at a time like "2026-09-01 18:00"
   --storage <type>             Storage backend: sqlite (default), file, or server
   --server-addr <addr>         Server address (required when --storage=server)
   --server-token <token>       Server authentication token (optional when --storage=server)
@@ -32,8 +37,10 @@ Examples:
   todo list                    Show all todos in tree format
   todo list --json            Output raw JSON data
   todo list --include "bug"    Show only sub-trees containing "bug"
+  todo list --tag work --tag urgent  Show only sub-trees with entries tagged both #work and #urgent
   todo list --toggle 123      Show all children including history for entry ID 123
   todo list --json --include "feature"  Output JSON for entries containing "feature"
+  todo list --as-of 2026-09-01  Show the todos as they were on September 1st
 `
 
 func handleList(args []string) error {
@@ -42,16 +49,20 @@ func handleList(args []string) error {
 	var serverToken string
 	var jsonOutput bool
 	var includePattern string
+	var tags []string
 	var showID bool
 	var toggleID int64
+	var asOfFlag string
 
 	args, err := flags.String("--storage", &storageType).
 		String("--server-addr", &serverAddr).
 		String("--server-token", &serverToken).
 		Bool("--json", &jsonOutput).
 		String("--include", &includePattern).
+		StringSlice("--tag", &tags).
 		Bool("--show-id", &showID).
 		Int("--toggle", &toggleID).
+		String("--as-of", &asOfFlag).
 		Help("-h,--help", listHelp).
 		Parse(args)
 	if err != nil {
@@ -61,6 +72,16 @@ func handleList(args []string) error {
 	if len(args) > 0 {
 		return fmt.Errorf("unrecognized extra argument: %s", strings.Join(args, " "))
 	}
+	var asOf time.Time
+	if asOfFlag != "" {
+		if toggleID != 0 {
+			return fmt.Errorf("--toggle cannot be combined with --as-of")
+		}
+		asOf, err = parseAsOf(asOfFlag)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Apply config defaults
 	storageConfig, err := ApplyConfigDefaults(storageType, serverAddr, serverToken)
@@ -81,7 +102,12 @@ func handleList(args []string) error {
 		return err
 	}
 
-	err = logManager.Init()
+	ctx := context.Background()
+	if asOf.IsZero() {
+		err = logManager.Init(ctx)
+	} else {
+		err = logManager.InitAsOf(ctx, asOf, false)
+	}
 	if err != nil {
 		return err
 	}
@@ -102,6 +128,16 @@ func handleList(args []string) error {
 		filteredEntries = logManager.Entries
 	}
 
+	if len(tags) > 0 && !asOf.IsZero() {
+		// the tag index is of today, the texts are of then
+		filteredEntries = filterEntriesByTagsInText(filteredEntries, tags)
+	} else if len(tags) > 0 {
+		filteredEntries, err = filterEntriesByTags(ctx, logManager, filteredEntries, tags)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Handle JSON output
 	if jsonOutput {
 		return outputJSON(filteredEntries)
@@ -131,33 +167,77 @@ func RenderToString(entries []*models.LogEntryView, showID bool, simulateTTY boo
 // A sub-tree is included if the entry itself or any of its descendants contain the pattern
 func filterEntriesByPattern(entries []*models.LogEntryView, pattern string) []*models.LogEntryView {
 	pattern = strings.ToLower(pattern)
+	return filterSubTrees(entries, func(entry *models.LogEntryView) bool {
+		return strings.Contains(strings.ToLower(entry.Data.Text), pattern)
+	})
+}
 
-	// Helper function to check if an entry or any of its descendants contains the pattern
-	var containsPattern func(entry *models.LogEntryView) bool
-	containsPattern = func(entry *models.LogEntryView) bool {
-		// Check if current entry contains the pattern
-		if strings.Contains(strings.ToLower(entry.Data.Text), pattern) {
-			return true
+// filterEntriesByTags includes only sub-trees containing an entry that
+// carries all of tags, as indexed by the storage
+func filterEntriesByTags(ctx context.Context, logManager *data.LogManager, entries []*models.LogEntryView, tags []string) ([]*models.LogEntryView, error) {
+	tagged, _, err := logManager.LogEntryService.List(ctx, storage.LogEntryListOptions{
+		Tags: tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int64]bool, len(tagged))
+	for _, entry := range tagged {
+		ids[entry.ID] = true
+	}
+	return filterSubTrees(entries, func(entry *models.LogEntryView) bool {
+		return ids[entry.Data.ID]
+	}), nil
+}
+
+// filterEntriesByTagsInText is filterEntriesByTags for entries
+// that are not as stored, e.g. with --as-of
+func filterEntriesByTagsInText(entries []*models.LogEntryView, tags []string) []*models.LogEntryView {
+	tags = models.NormalizeTags(tags)
+	return filterSubTrees(entries, func(entry *models.LogEntryView) bool {
+		has := models.ParseTags(entry.Data.Text)
+		for _, tag := range tags {
+			if !slices.Contains(has, tag) {
+				return false
+			}
 		}
+		return true
+	})
+}
+
+// parseAsOf parses the --as-of time, a date stands for its end
+func parseAsOf(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --as-of %q, expects a date like 2026-09-01 or a time like \"2026-09-01 18:00\"", s)
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Second), nil
+}
 
-		// Check if any child contains the pattern
+// filterSubTrees keeps the entries that match, or have a descendant that matches
+func filterSubTrees(entries []*models.LogEntryView, match func(entry *models.LogEntryView) bool) []*models.LogEntryView {
+	var contains func(entry *models.LogEntryView) bool
+	contains = func(entry *models.LogEntryView) bool {
+		if match(entry) {
+			return true
+		}
 		for _, child := range entry.Children {
-			if containsPattern(child) {
+			if contains(child) {
 				return true
 			}
 		}
-
 		return false
 	}
 
-	// Filter entries that contain the pattern
 	var filtered []*models.LogEntryView
 	for _, entry := range entries {
-		if containsPattern(entry) {
+		if contains(entry) {
 			filtered = append(filtered, entry)
 		}
 	}
-
 	return filtered
 }
 
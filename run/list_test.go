@@ -2,7 +2,6 @@ package run
 
 import (
 	"bytes"
-	"io"
 	"strings"
 	"testing"
 
@@ -185,12 +184,10 @@ func TestRenderTreeConnectors_Level1_Single(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+// customTenderEntries renders entries as todo list prints them
 func customTenderEntries(entries []*models.LogEntryView, isTTY bool, showID bool) string {
 	var b bytes.Buffer
-	customTenderEntriesOut(&b, entries, isTTY, showID)
+	renderEntries(&b, isTTY, entries, showID)
 	return b.String()
 }
-
-func customTenderEntriesOut(out io.Writer, entries []*models.LogEntryView, isTTY bool, showID bool) {
-	// TODO
-}
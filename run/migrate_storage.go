@@ -0,0 +1,138 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/exchange"
+	"github.com/xhd2015/todo/models"
+)
+
+const migrateStorageHelp = `
+todo migrate-storage --to <type>
+
+Copy all todos at every depth with their notes, happenings, states
+with their events, and group memberships from one storage backend to
+another, then verify the copy by comparing counts and the shape of
+the todo tree. Todos in trash stay behind, their count is reported.
+
+The target must be empty, anything else in it is refused before
+copying. If a migration was interrupted, running it again skips the
+todos copied already and adds their missing notes.
+
+Options:
+  --from <type>                    storage to copy from: file, sqlite or server,
+                                   defaults to the configured storage
+  --to <type>                      storage to copy to: file, sqlite or server
+  --server-addr <addr>             server address, for server on either side
+  --server-token <token>           server authentication token
+  --switch                         make the target the configured storage afterwards
+  -h,--help                        show this help message
+
+Examples:
+  todo migrate-storage --from file --to sqlite --switch
+  todo migrate-storage --to server --server-addr http://localhost:8080 --server-token abc123
+`
+
+// migrateProgressStep is how many items are copied between two
+// progress lines
+const migrateProgressStep = 100
+
+func handleMigrateStorage(args []string) error {
+	var from string
+	var to string
+	var serverAddr string
+	var serverToken string
+	var switchStorage bool
+	args, err := flags.String("--from", &from).
+		String("--to", &to).
+		String("--server-addr", &serverAddr).
+		String("--server-token", &serverToken).
+		Bool("--switch", &switchStorage).
+		Help("-h,--help", migrateStorageHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra arguments: %s", strings.Join(args, " "))
+	}
+	if to == "" {
+		return fmt.Errorf("requires --to: file, sqlite or server")
+	}
+
+	storageConfig, err := ApplyConfigDefaults(from, serverAddr, serverToken)
+	if err != nil {
+		return err
+	}
+	from = storageConfig.StorageType
+	if from == to {
+		return fmt.Errorf("--from and --to are both %s", to)
+	}
+	source, err := createLogServices(from, storageConfig.ServerAddr, storageConfig.ServerToken)
+	if err != nil {
+		return fmt.Errorf("failed to open %s storage: %w", from, err)
+	}
+	target, err := createLogServices(to, storageConfig.ServerAddr, storageConfig.ServerToken)
+	if err != nil {
+		return fmt.Errorf("failed to open %s storage: %w", to, err)
+	}
+
+	fmt.Printf("Migrating from %s to %s\n", from, to)
+	result, err := exchange.Migrate(context.Background(), source, target, migrateProgress(func(msg string) {
+		fmt.Println("  " + msg)
+	}))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Copied %d entries with %d notes, %d happenings, %d states with %d events and %d group memberships, verified\n",
+		result.Entries, result.Notes, result.Happenings, result.States, result.StateEvents, result.GroupMemberships)
+	if result.SkippedEntries > 0 {
+		fmt.Printf("Skipped %d entries copied before\n", result.SkippedEntries)
+	}
+	if result.TrashedEntries > 0 {
+		fmt.Printf("Left behind %d entries in trash, restore them first to copy them\n", result.TrashedEntries)
+	}
+
+	if !switchStorage {
+		fmt.Printf("Run with --switch, or pick %s in the config page, to use it\n", to)
+		return nil
+	}
+	if err := saveStorageConfig(StorageConfig{StorageType: to, ServerAddr: storageConfig.ServerAddr, ServerToken: storageConfig.ServerToken}); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Printf("Switched to %s storage\n", to)
+	return nil
+}
+
+// migrateProgress reports every migrateProgressStep items and the end
+// of each stage to report
+func migrateProgress(report func(msg string)) func(stage string, done int, total int) {
+	return func(stage string, done int, total int) {
+		if done%migrateProgressStep != 0 && done != total {
+			return
+		}
+		report(fmt.Sprintf("%s: %d/%d", stage, done, total))
+	}
+}
+
+// saveStorageConfig makes storageConfig the configured storage,
+// keeping the other settings
+func saveStorageConfig(storageConfig StorageConfig) error {
+	savedConfig, err := data.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if savedConfig == nil {
+		savedConfig = &models.Config{}
+	}
+	savedConfig.StorageType = storageConfig.StorageType
+	if storageConfig.StorageType == "server" {
+		savedConfig.ServerAddr = storageConfig.ServerAddr
+		savedConfig.ServerToken = storageConfig.ServerToken
+	}
+	return data.SaveConfig(savedConfig)
+}
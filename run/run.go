@@ -2,6 +2,7 @@ package run
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -14,12 +15,13 @@ import (
 	"github.com/xhd2015/go-dom-tui/log"
 	"github.com/xhd2015/less-gen/flags"
 	"github.com/xhd2015/todo/app"
-	"github.com/xhd2015/todo/app/exp"
 	"github.com/xhd2015/todo/app/human_state"
 	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/exchange"
 	"github.com/xhd2015/todo/data/storage"
+	storagehttp "github.com/xhd2015/todo/data/storage/http"
+	"github.com/xhd2015/todo/data/storage/replica"
 	"github.com/xhd2015/todo/internal/config"
-	"github.com/xhd2015/todo/internal/macos"
 	"github.com/xhd2015/todo/internal/process"
 	applog "github.com/xhd2015/todo/log"
 	"github.com/xhd2015/todo/models"
@@ -34,16 +36,33 @@ Usage: todo [OPTIONS]
        todo <cmd> [OPTIONS]
 
 Available sub commands:
+  add <text> [--parent <selector>]
+  done <selector>... [--undo]
+  toggle <selector>...
+  edit <selector> <text>
+  rm <selector>...
+  mv <selector>... --parent <selector>
+  note <selector> <text>
+  focus <selector>
+  show-top <selector> [--duration <duration>]
   list
-  export <file.json>
-  import <file.json>
+  search <query>
+  export <file> [--format=md|todotxt|taskwarrior|ics]
+  import <file> [--format=md|todotxt|taskwarrior]
   config
+  db migrate [--dry-run]
+  trash purge --older-than <age>
+  migrate-storage --to <type> [--from <type>] [--switch]
+  backup list|create|restore <id>
+  serve
   tool
 
 Options:
   --storage <type>                 storage backend: file (default), sqlite, or server
   --server-addr <addr>             server address (required when --storage=server)
   --server-token <token>           server authentication token (optional when --storage=server)
+                                   with server storage, entries and notes are kept in a local replica
+                                   synced in the background, see the status bar
   --debug-log <file>               enable debug logging to specified file
   --show-path                      show config path
   -h,--help                        show this help message
@@ -60,14 +79,44 @@ func Main(args []string) error {
 	if len(args) > 0 {
 		arg0 := args[0]
 		switch arg0 {
+		case "add":
+			return handleAdd(args[1:])
+		case "done":
+			return handleDone(args[1:])
+		case "toggle":
+			return handleToggle(args[1:])
+		case "edit":
+			return handleEdit(args[1:])
+		case "rm":
+			return handleRm(args[1:])
+		case "mv":
+			return handleMv(args[1:])
+		case "note":
+			return handleNote(args[1:])
+		case "focus":
+			return handleFocus(args[1:])
+		case "show-top":
+			return handleShowTop(args[1:])
 		case "list":
 			return handleList(args[1:])
+		case "search":
+			return handleSearch(args[1:])
 		case "export":
 			return handleExport(args[1:])
 		case "import":
 			return handleImport(args[1:])
 		case "config":
 			return handleConfig(args[1:])
+		case "db":
+			return handleDB(args[1:])
+		case "trash":
+			return handleTrash(args[1:])
+		case "backup":
+			return handleBackup(args[1:])
+		case "migrate-storage":
+			return handleMigrateStorage(args[1:])
+		case "serve":
+			return handleServe(args[1:])
 		case "tool":
 			return handleTool(args[1:])
 		}
@@ -137,10 +186,19 @@ func Main(args []string) error {
 		return fmt.Errorf("failed to create config dir: %w", err)
 	}
 
-	logManager, services, err := CreateLogManager(storageType, serverAddr, serverToken)
+	services, err := createLogServices(storageType, serverAddr, serverToken)
 	if err != nil {
 		return err
 	}
+	// with a server, entries and notes are read and written locally
+	var syncer *replica.Replica
+	if storageType == "server" {
+		syncer, err = openReplica(services, serverAddr)
+		if err != nil {
+			return err
+		}
+	}
+	logManager := data.NewLogManager(services)
 
 	// Load config again to handle running PID (separate from storage config)
 	config, err := data.LoadConfig()
@@ -151,7 +209,7 @@ func Main(args []string) error {
 	if config != nil && config.RunningPID > 0 {
 		exists, _ := process.ProcessExists(config.RunningPID)
 		if exists {
-			return fmt.Errorf("todo is already running with PID %d", config.RunningPID)
+			return fmt.Errorf("todo is already running with PID %d, use todo add, done, edit, rm, mv or note to change its todos", config.RunningPID)
 		}
 	}
 	if config == nil {
@@ -173,14 +231,24 @@ func Main(args []string) error {
 		log.SetLogger(log.NewFileLogger(file))
 	}
 
-	err = logManager.Init()
+	// group mapping used to live in ./log_group.json
+	if logManager.GroupService != nil {
+		_, err = data.ImportLegacyGroupMapping(context.Background(), logManager.GroupService, legacyGroupMappingFile)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", legacyGroupMappingFile, err)
+		}
+	}
+
+	err = logManager.Init(context.Background())
 	if err != nil {
 		return err
 	}
 
 	var p *tea.Program
 	appState := app.State{
-		Entries: logManager.Entries,
+		Entries:      logManager.Entries,
+		Groups:       logManager.Groups,
+		GroupMapping: logManager.GroupMapping,
 		Input: models.InputState{
 			Focused: true,
 		},
@@ -197,19 +265,57 @@ func Main(args []string) error {
 	appState.SubmitState.SetOnRestore(appState.Input.Append)
 	appState.ChildSubmitState.SetOnRestore(appState.ChildInputState.Append)
 
-	refreshEntries := func() {
-		err := logManager.InitWithHistory(appState.ShowHistory)
+	refreshEntries := func(ctx context.Context) {
+		err := logManager.InitWithHistory(ctx, appState.ShowHistory)
 		if err != nil {
 			// TODO: Handle error appropriately
 			appState.StatusBar.Error = err.Error()
 			return
 		}
 		appState.Entries = logManager.Entries
+		appState.Groups = logManager.Groups
+		appState.GroupMapping = logManager.GroupMapping
+	}
+
+	// applyChanges brings in what was changed elsewhere, keeping the
+	// views of entries and what is selected. It runs as an action, not
+	// to reload entries while another action changes them.
+	applyChanges := func(ctx context.Context) error {
+		changed, err := logManager.Reload(ctx, appState.ShowHistory)
+		if err != nil {
+			return err
+		}
+		if changed {
+			appState.Entries = logManager.Entries
+			appState.Groups = logManager.Groups
+			appState.GroupMapping = logManager.GroupMapping
+		}
+		happenings, changed, err := logManager.HappeningManager.Reload()
+		if err != nil {
+			return err
+		}
+		if changed {
+			appState.Happening.SetHappenings(happenings)
+		}
+		return nil
+	}
+	// waitApplyChanges waits for applyChanges to run, so the changes
+	// told meanwhile are applied by one run after it
+	waitApplyChanges := func(ctx context.Context) {
+		done := make(chan struct{})
+		appState.Enqueue(func(ctx context.Context) error {
+			defer close(done)
+			return applyChanges(ctx)
+		})
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
 	}
 
 	appState.RefreshEntries = func(ctx context.Context) error {
 		// Run refresh asynchronously to avoid blocking the UI
-		refreshEntries()
+		refreshEntries(ctx)
 		return nil
 	}
 	appState.OnAdd = func(ctx context.Context, viewType models.LogEntryViewType, value string) error {
@@ -222,9 +328,7 @@ func Main(args []string) error {
 		}
 
 		return appState.SubmitState.Do(ctx, value, func() error {
-			_, err := logManager.Add(models.LogEntry{
-				Text: value,
-			})
+			_, err := logManager.Add(ctx, newEntryFromInput(value))
 			if err != nil {
 				return err
 			}
@@ -247,34 +351,29 @@ func Main(args []string) error {
 			// Check if the parent is a group entry
 			if viewType == models.LogEntryViewType_Group {
 				// Create a rootless log entry (ParentID = 0) and bind to group
-				logID, err := logManager.Add(models.LogEntry{
-					Text: text,
-				})
+				logID, err := logManager.Add(ctx, newEntryFromInput(text))
 				if err != nil {
 					return err
 				}
 
 				// Bind the new log to the group
-				_, err = exp.LogGroupStore.Add(&exp.LogIDGroupMapping{
-					LogID:   logID,
-					GroupID: parentID,
-				})
+				err = logManager.SetEntryGroup(ctx, logID, storedGroupID(parentID))
 				if err != nil {
 					return fmt.Errorf("failed to bind log to group: %w", err)
 				}
 
 				appState.Entries = logManager.Entries
+				appState.GroupMapping = logManager.GroupMapping
 				id = logID
 				subEntryType = models.LogEntryViewType_Log
 				return nil
 			}
 
 			// Regular child entry creation for log entries
+			entry := newEntryFromInput(text)
+			entry.ParentID = parentID
 			var err error
-			id, err = logManager.Add(models.LogEntry{
-				Text:     text,
-				ParentID: parentID,
-			})
+			id, err = logManager.Add(ctx, entry)
 			if err != nil {
 				return err
 			}
@@ -288,81 +387,86 @@ func Main(args []string) error {
 		}
 		return subEntryType, id, err
 	}
-	appState.OnUpdate = func(viewType models.LogEntryViewType, id int64, text string) error {
+	appState.OnUpdate = func(ctx context.Context, viewType models.LogEntryViewType, id int64, text string) error {
+		if viewType == models.LogEntryViewType_Group {
+			if id == states.GROUP_OTHER_ID {
+				return fmt.Errorf("the Other group cannot be renamed")
+			}
+			err := logManager.RenameGroup(ctx, id, text)
+			if err != nil {
+				return err
+			}
+			appState.Groups = logManager.Groups
+			return nil
+		}
 		if viewType != models.LogEntryViewType_Log {
 			return nil
 		}
-		err := logManager.Update(id, models.LogEntryOptional{
-			Text: &text,
-		})
+		err := logManager.Update(ctx, id, updateFromInput(text))
 		if err != nil {
 			return err
 		}
 		appState.Entries = logManager.Entries
 		return nil
 	}
-	appState.OnRemoveFromGroup = func(viewType models.LogEntryViewType, id int64) error {
+	appState.OnRemoveFromGroup = func(ctx context.Context, viewType models.LogEntryViewType, id int64) error {
 		if viewType != models.LogEntryViewType_Log {
 			return nil
 		}
-		exp.LogGroupStore.Add(&exp.LogIDGroupMapping{
-			LogID:   id,
-			GroupID: 0,
-		})
-		appState.Entries = logManager.Entries
+		err := logManager.SetEntryGroup(ctx, id, 0)
+		if err != nil {
+			return err
+		}
+		appState.GroupMapping = logManager.GroupMapping
 		return nil
 	}
 
-	appState.OnDelete = func(viewType models.LogEntryViewType, id int64) error {
+	appState.OnDelete = func(ctx context.Context, viewType models.LogEntryViewType, id int64) error {
+		if viewType == models.LogEntryViewType_Group {
+			if id == states.GROUP_OTHER_ID {
+				return fmt.Errorf("the Other group cannot be deleted")
+			}
+			err := logManager.DeleteGroup(ctx, id)
+			if err != nil {
+				return err
+			}
+			appState.Groups = logManager.Groups
+			appState.GroupMapping = logManager.GroupMapping
+			return nil
+		}
 		if viewType != models.LogEntryViewType_Log {
 			return nil
 		}
 		if appState.ViewMode == states.ViewMode_Group {
 			// delete from group
-			exp.LogGroupStore.Add(&exp.LogIDGroupMapping{
-				LogID:   id,
-				GroupID: 0,
-			})
+			err := logManager.SetEntryGroup(ctx, id, 0)
+			if err != nil {
+				return err
+			}
+			appState.GroupMapping = logManager.GroupMapping
 			return nil
 		}
-		err := logManager.Delete(id)
+		err := logManager.Delete(ctx, id)
 		if err != nil {
 			return err
 		}
 		appState.Entries = logManager.Entries
 		return nil
 	}
-	appState.OnToggle = func(viewType models.LogEntryViewType, id int64) error {
+	appState.OnToggle = func(ctx context.Context, viewType models.LogEntryViewType, id int64) error {
 		if viewType != models.LogEntryViewType_Log {
 			return nil
 		}
-		foundEntry, err := logManager.Get(id)
-		if err != nil {
-			return err
-		}
-
-		done := !foundEntry.Data.Done
-		var doneTime *time.Time
-		if done {
-			now := time.Now()
-			doneTime = &now
-		}
-		err = logManager.Update(id, models.LogEntryOptional{
-			Done:     &done,
-			DoneTime: &doneTime,
-		})
-		if err != nil {
-			return err
-		}
+		err := toggleDone(ctx, logManager, id)
 		appState.Entries = logManager.Entries
-		return nil
+		return err
 	}
-	appState.OnPromote = func(viewType models.LogEntryViewType, id int64) error {
+	appState.OnPromote = func(ctx context.Context, viewType models.LogEntryViewType, id int64) error {
 		if viewType != models.LogEntryViewType_Log {
 			return nil
 		}
 		currentTime := time.Now().UnixMilli()
-		err := logManager.Update(id, models.LogEntryOptional{
+		err := logManager.Update(ctx, id, models.LogEntryOptional{
 			AdjustedTopTime: &currentTime,
 		})
 		if err != nil {
@@ -371,20 +475,24 @@ func Main(args []string) error {
 		appState.Entries = logManager.Entries
 		return nil
 	}
-	appState.OnUpdateHighlight = func(viewType models.LogEntryViewType, id int64, highlightLevel int) {
+	appState.OnUpdateHighlight = func(ctx context.Context, viewType models.LogEntryViewType, id int64, highlightLevel int) {
 		if viewType != models.LogEntryViewType_Log {
 			return
 		}
-		logManager.Update(id, models.LogEntryOptional{
+		err := logManager.Update(ctx, id, models.LogEntryOptional{
 			HighlightLevel: &highlightLevel,
 		})
+		if err != nil {
+			appState.StatusBar.Error = appState.ErrorMessage(err)
+			return
+		}
 		appState.Entries = logManager.Entries
 	}
 
-	appState.OnMove = func(id models.EntryIdentity, newParentID models.EntryIdentity) error {
-		applog.Infof(context.TODO(), "moving: %v, %v to %v,%v", id.EntryType, id.ID, newParentID.EntryType, newParentID.ID)
+	appState.OnMove = func(ctx context.Context, id models.EntryIdentity, newParentID models.EntryIdentity) error {
+		applog.Infof(ctx, "moving: %v, %v to %v,%v", id.EntryType, id.ID, newParentID.EntryType, newParentID.ID)
 		if id.EntryType == models.LogEntryViewType_Log && newParentID.EntryType == models.LogEntryViewType_Log {
-			err := logManager.Move(id.ID, newParentID.ID)
+			err := logManager.Move(ctx, id.ID, newParentID.ID)
 			if err != nil {
 				return err
 			}
@@ -393,15 +501,36 @@ func Main(args []string) error {
 		}
 		if id.EntryType == models.LogEntryViewType_Log && newParentID.EntryType == models.LogEntryViewType_Group {
 			// id -> group
-			exp.LogGroupStore.Add(&exp.LogIDGroupMapping{
-				LogID:   id.ID,
-				GroupID: newParentID.ID,
-			})
+			err := logManager.SetEntryGroup(ctx, id.ID, storedGroupID(newParentID.ID))
+			if err != nil {
+				return err
+			}
+			appState.GroupMapping = logManager.GroupMapping
 		}
 		return nil
 	}
-	appState.OnAddNote = func(id int64, text string) error {
-		err := logManager.AddNote(id, models.Note{
+	appState.OnAddGroup = func(ctx context.Context, name string) error {
+		id, err := logManager.AddGroup(ctx, name)
+		if err != nil {
+			return err
+		}
+		appState.Groups = logManager.Groups
+		appState.Select(models.LogEntryViewType_Group, id)
+		return nil
+	}
+	appState.OnReorderGroup = func(ctx context.Context, id int64, delta int) error {
+		if id == states.GROUP_OTHER_ID {
+			return nil
+		}
+		err := logManager.MoveGroup(ctx, id, delta)
+		if err != nil {
+			return err
+		}
+		appState.Groups = logManager.Groups
+		return nil
+	}
+	appState.OnAddNote = func(ctx context.Context, id int64, text string) error {
+		err := logManager.AddNote(ctx, id, models.Note{
 			Text: text,
 		})
 		if err != nil {
@@ -410,36 +539,61 @@ func Main(args []string) error {
 		appState.Entries = logManager.Entries
 		return nil
 	}
-	appState.OnUpdateNote = func(entryID int64, noteID int64, text string) {
-		logManager.UpdateNote(entryID, noteID, models.NoteOptional{
+	appState.OnUpdateNote = func(ctx context.Context, entryID int64, noteID int64, text string) {
+		err := logManager.UpdateNote(ctx, entryID, noteID, models.NoteOptional{
 			Text: &text,
 		})
+		if err != nil {
+			appState.StatusBar.Error = appState.ErrorMessage(err)
+			return
+		}
 		appState.Entries = logManager.Entries
 	}
-	appState.OnDeleteNote = func(entryID int64, noteID int64) {
-		logManager.DeleteNote(entryID, noteID)
+	appState.OnDeleteNote = func(ctx context.Context, entryID int64, noteID int64) {
+		logManager.DeleteNote(ctx, entryID, noteID)
 		appState.Entries = logManager.Entries
 	}
-	appState.OnShowTop = func(id int64, text string, duration time.Duration) {
-		// first make highlight level 5
-		highlightLevel := 5
-		err := logManager.Update(id, models.LogEntryOptional{
-			HighlightLevel: &highlightLevel,
-		})
-		if err != nil {
-			appState.StatusBar.Error = err.Error()
-			return
+	appState.OnUndo = func(ctx context.Context) error {
+		_, err := logManager.Undo(ctx)
+		appState.Entries = logManager.Entries
+		appState.GroupMapping = logManager.GroupMapping
+		return err
+	}
+	appState.OnRedo = func(ctx context.Context) error {
+		_, err := logManager.Redo(ctx)
+		appState.Entries = logManager.Entries
+		appState.GroupMapping = logManager.GroupMapping
+		return err
+	}
+	appState.OnRetry = func(ctx context.Context) error {
+		refreshEntries(ctx)
+		err := logManager.RetryConflicted(ctx)
+		appState.Entries = logManager.Entries
+		appState.GroupMapping = logManager.GroupMapping
+		return err
+	}
+	if services.ServerClient != nil {
+		appState.OnSetToken = func(ctx context.Context, token string) error {
+			services.ServerClient.SetToken(token)
+			if err := saveServerToken(serverAddr, token); err != nil {
+				return err
+			}
+			if syncer != nil {
+				// push what waited for the token, the status tells how it went
+				syncer.Sync(ctx)
+			}
+			refreshEntries(ctx)
+			return nil
 		}
+	}
+	appState.OnShowTop = func(ctx context.Context, id int64, text string, duration time.Duration) {
+		err := showTop(ctx, logManager, id, text, duration)
 		appState.Entries = logManager.Entries
-
-		// Send command to macOS app to show floating progress bar
-		err = macos.SendTopCommand(id, text, duration)
 		if err != nil {
-			// Set error in status bar if command fails
-			appState.StatusBar.Error = fmt.Sprintf("Failed to show top: %v", err)
+			appState.StatusBar.Error = appState.ErrorMessage(err)
 		}
 	}
-	appState.OnToggleVisibility = func(id int64) error {
+	appState.OnToggleVisibility = func(ctx context.Context, id int64) error {
 		targetEntry, err := logManager.Get(id)
 		if err != nil {
 			return err
@@ -449,7 +603,6 @@ func Main(args []string) error {
 		targetEntry.IncludeHistory = !targetEntry.IncludeHistory
 
 		// Load children based on history inclusion setting
-		ctx := context.Background()
 		fullEntry, err := logManager.GetTree(ctx, id, targetEntry.IncludeHistory)
 		if err != nil {
 			return fmt.Errorf("load children: %w", err)
@@ -461,7 +614,7 @@ func Main(args []string) error {
 		appState.Entries = logManager.Entries
 		return nil
 	}
-	appState.OnToggleNotesDisplay = func(id int64) error {
+	appState.OnToggleNotesDisplay = func(ctx context.Context, id int64) error {
 		targetEntry, err := logManager.Get(id)
 		if err != nil {
 			return err
@@ -477,6 +630,17 @@ func Main(args []string) error {
 	appState.OnToggleCollapsed = func(ctx context.Context, entryType models.LogEntryViewType, id int64) error {
 		return HandleToggleCollapsed(ctx, &appState, logManager, entryType, id)
 	}
+	appState.OnMigrateStorage = func(ctx context.Context, targetType string, targetAddr string, targetToken string, progress func(msg string)) error {
+		if targetType == storageType {
+			return fmt.Errorf("already using %s storage", storageType)
+		}
+		target, err := createLogServices(targetType, targetAddr, targetToken)
+		if err != nil {
+			return err
+		}
+		_, err = exchange.Migrate(ctx, services, target, migrateProgress(progress))
+		return err
+	}
 	appState.Happening = states.HappeningState{
 		LoadHappenings: func(ctx context.Context) ([]*models.Happening, error) {
 			return logManager.HappeningManager.LoadHappenings(ctx)
@@ -600,6 +764,26 @@ func Main(args []string) error {
 		})
 	}
 
+	appState.Trash = states.TrashState{
+		LoadTrash: func(ctx context.Context) ([]*models.LogEntryView, error) {
+			return logManager.Trash(ctx)
+		},
+		Restore: func(ctx context.Context, id int64) error {
+			err := logManager.Undelete(ctx, id)
+			appState.Entries = logManager.Entries
+			return err
+		},
+	}
+
+	appState.Revisions = states.RevisionsState{
+		LoadRevisions: logManager.ListRevisions,
+		Restore: func(ctx context.Context, revision models.Revision) error {
+			err := logManager.RestoreRevision(ctx, revision)
+			appState.Entries = logManager.Entries
+			return err
+		},
+	}
+
 	// Initialize learning state
 	appState.Learning = states.LearningState{
 		LoadMaterials: func(ctx context.Context, offset int, limit int) ([]*models.LearningMaterial, int64, error) {
@@ -648,16 +832,67 @@ func Main(args []string) error {
 
 	appState.Quit = func() {
 		model.quit = true
+		appState.Cancel()
 		if openedFile != nil {
 			openedFile.Close()
 		}
 	}
 
 	p = tea.NewProgram(model, tea.WithAltScreen())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if syncer != nil {
+		appState.StatusBar.Sync = syncer.Status().String()
+		syncer.OnSync(func(changed bool) {
+			status := syncer.Status()
+			appState.StatusBar.Sync = status.String()
+			if errors.Is(status.Err, storagehttp.ErrUnauthorized) {
+				appState.StatusBar.Error = appState.ErrorMessage(status.Err)
+			}
+			if changed {
+				// not waiting for it: an action may be syncing
+				appState.Enqueue(applyChanges)
+			}
+			appState.Refresh()
+		})
+		go syncer.Run(ctx, replica.DefaultInterval)
+		// entries and notes come through the replica, happenings directly
+		go watchChanges(ctx, &appState, services.Changes, func(ctx context.Context) {
+			syncer.Sync(ctx)
+			waitApplyChanges(ctx)
+		})
+	} else {
+		go watchChanges(ctx, &appState, services.Changes, waitApplyChanges)
+		err := startBackups(ctx, storageType, func(err error) {
+			appState.StatusBar.Error = fmt.Sprintf("backup: %v", err)
+			appState.Refresh()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := listenControl(ctx, &appState, logManager); err != nil {
+		appState.StatusBar.Error = fmt.Sprintf("control socket: %v", err)
+	}
 	_, err = p.Run()
 	return err
 }
 
+// watchChanges calls apply whenever feed tells of a change, until
+// ctx is done
+func watchChanges(ctx context.Context, appState *states.State, feed storage.ChangeFeed, apply func(ctx context.Context)) {
+	if feed == nil {
+		return
+	}
+	err := feed.Watch(ctx, func() {
+		apply(ctx)
+	})
+	if err != nil && ctx.Err() == nil {
+		appState.StatusBar.Error = fmt.Sprintf("watch changes: %v", err)
+		appState.Refresh()
+	}
+}
+
 func handleTool(args []string) error {
 	return tool.Handle(args)
 }
@@ -672,6 +907,14 @@ func (m *Model) Init() tea.Cmd {
 }
 
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// go-dom-tui does not pass ctrl+r on, so redo is bound here
+	if key, ok := msg.(tea.KeyMsg); ok && key.Type == tea.KeyCtrlR {
+		state := m.app.State
+		if state.OnRedo != nil {
+			state.Enqueue(state.OnRedo)
+		}
+		return m, nil
+	}
 	m.app.Update(msg)
 	if m.quit {
 		return m, tea.Quit
@@ -0,0 +1,137 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+	"golang.org/x/term"
+)
+
+const searchHelp = `
+search - Search todos, their notes and happenings
+
+Usage: todo search <query> [OPTIONS]
+
+Query syntax:
+  deploy release               Both words, in the todo text or its notes
+  deploy OR release            Either word, AND binds tighter than OR
+  (deploy OR release) staging  Parentheses group
+  "staging db"                 Exact phrase
+  migr*                        Words starting with migr
+  note:rollback                Only match in notes, also note:"roll back"
+  done:yes, done:no            Only done or not done todos, no happenings
+  before:2025-09-01            Created before a date, also today, yesterday, 3d, 2w
+
+Options:
+  --limit <n>                  Maximum number of results (default 50)
+  --json                       Output results as JSON
+  --storage <type>             Storage backend: sqlite (default), file, or server
+  --server-addr <addr>         Server address (required when --storage=server)
+  --server-token <token>       Server authentication token (optional when --storage=server)
+  -h,--help                    Show this help message
+
+Examples:
+  todo search deploy
+  todo search 'note:"root cause" done:no'
+  todo search 'release OR deploy before:2w'
+`
+
+func handleSearch(args []string) error {
+	var storageType string
+	var serverAddr string
+	var serverToken string
+	var jsonOutput bool
+	var limit int
+
+	args, err := flags.String("--storage", &storageType).
+		String("--server-addr", &serverAddr).
+		String("--server-token", &serverToken).
+		Bool("--json", &jsonOutput).
+		Int("--limit", &limit).
+		Help("-h,--help", searchHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires a query, see todo search --help")
+	}
+	queryText := strings.Join(args, " ")
+
+	// Apply config defaults
+	storageConfig, err := ApplyConfigDefaults(storageType, serverAddr, serverToken)
+	if err != nil {
+		return err
+	}
+	services, err := createLogServices(storageConfig.StorageType, storageConfig.ServerAddr, storageConfig.ServerToken)
+	if err != nil {
+		return err
+	}
+
+	results, err := services.Search.Search(context.Background(), storage.SearchOptions{
+		Query: queryText,
+		Limit: limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+	isTTY := term.IsTerminal(int(os.Stdout.Fd()))
+	renderSearchResults(os.Stdout, isTTY, results)
+	return nil
+}
+
+// renderSearchResults prints a line per result, followed by the
+// matching part of its notes. Matches are bold on a terminal.
+func renderSearchResults(out io.Writer, isTTY bool, results []models.SearchResult) {
+	if len(results) == 0 {
+		io.WriteString(out, "no results\n")
+		return
+	}
+	for _, result := range results {
+		bullet := "•"
+		switch {
+		case result.Kind == models.SearchResultKind_Happening:
+			bullet = "◆"
+		case result.Done:
+			bullet = "✓"
+		}
+		text := result.Snippet
+		if text == "" {
+			text = result.Text
+		}
+		fmt.Fprintf(out, "%s %s (%d)\n", bullet, renderHighlights(text, isTTY), result.ID)
+		if result.NoteSnippet != "" {
+			fmt.Fprintf(out, "    note: %s\n", renderHighlights(strings.ReplaceAll(result.NoteSnippet, "\n", " "), isTTY))
+		}
+	}
+}
+
+func renderHighlights(snippet string, isTTY bool) string {
+	if !isTTY {
+		return models.StripHighlights(snippet)
+	}
+	matchStyle := lipgloss.NewStyle().Bold(true)
+	var b strings.Builder
+	for _, part := range models.SplitHighlights(snippet) {
+		if part.Match {
+			b.WriteString(matchStyle.Render(part.Text))
+		} else {
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String()
+}
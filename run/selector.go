@@ -0,0 +1,212 @@
+package run
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xhd2015/todo/control"
+	"github.com/xhd2015/todo/models"
+)
+
+// selectEntries returns the entries matched by selectors, each once,
+// in the order of the selectors. A selector is an ID like "12" or a
+// path of texts from the top level like "Work/Release/*", each part a
+// pattern as of compileGlob, where "\/" is a "/" of the text. A leading
+// "/" makes digits a path. Every selector must match some entry.
+func selectEntries(entries []*models.LogEntryView, selectors []string) ([]*models.LogEntryView, error) {
+	var selected []*models.LogEntryView
+	seen := make(map[int64]bool)
+	for _, selector := range selectors {
+		matched, err := matchSelector(entries, selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range matched {
+			if !seen[entry.Data.ID] {
+				seen[entry.Data.ID] = true
+				selected = append(selected, entry)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// selectEntry returns the only entry matched by selector
+func selectEntry(entries []*models.LogEntryView, selector string) (*models.LogEntryView, error) {
+	matched, err := matchSelector(entries, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) > 1 {
+		return nil, fmt.Errorf("%w: %s matches %d todos, expecting one", control.ErrAmbiguous, selector, len(matched))
+	}
+	return matched[0], nil
+}
+
+// selectParent returns the ID of the entry selected as a parent, 0
+// for the top level, given as "", "0" or "/"
+func selectParent(entries []*models.LogEntryView, selector string) (int64, error) {
+	if selector == "" || selector == "0" || selector == "/" {
+		return 0, nil
+	}
+	parent, err := selectEntry(entries, selector)
+	if err != nil {
+		return 0, err
+	}
+	return parent.Data.ID, nil
+}
+
+func matchSelector(entries []*models.LogEntryView, selector string) ([]*models.LogEntryView, error) {
+	if id, err := strconv.ParseInt(selector, 10, 64); err == nil {
+		entry := findEntry(entries, id)
+		if entry == nil {
+			return nil, fmt.Errorf("%w: no todo with ID %d", control.ErrNotFound, id)
+		}
+		return []*models.LogEntryView{entry}, nil
+	}
+
+	parts := splitSelector(selector)
+	if len(parts) > 1 && parts[0] == "" {
+		parts = parts[1:]
+	}
+	if len(parts) > 1 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) == 1 && parts[0] == "" {
+		return nil, fmt.Errorf("%w: empty selector %q", control.ErrInvalid, selector)
+	}
+	var matched []*models.LogEntryView
+	for i, part := range parts {
+		pattern, err := compileGlob(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad pattern %q in %s: %v", control.ErrInvalid, part, selector, err)
+		}
+		// the first part matches the top level, the others the
+		// children of what the one before matched
+		candidates := entries
+		if i > 0 {
+			candidates = nil
+			for _, entry := range matched {
+				candidates = append(candidates, entry.Children...)
+			}
+		}
+		matched = nil
+		for _, entry := range candidates {
+			if pattern.MatchString(entry.Data.Text) {
+				matched = append(matched, entry)
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: no todo matches %s", control.ErrNotFound, selector)
+	}
+	return matched, nil
+}
+
+// splitSelector splits selector at each "/" not escaped as "\/",
+// keeping the escapes for compileGlob
+func splitSelector(selector string) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(selector); i++ {
+		switch c := selector[i]; {
+		case c == '\\' && i+1 < len(selector):
+			part.WriteByte(c)
+			part.WriteByte(selector[i+1])
+			i++
+		case c == '/':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(c)
+		}
+	}
+	return append(parts, part.String())
+}
+
+// compileGlob compiles a part of a selector into a regexp matching
+// whole texts. Unlike path.Match, the wildcards match "/" too: * any
+// characters, ? any one character and [...] one of a class like
+// [a-z] or [^0-9]. A \ takes the character after it literally.
+func compileGlob(part string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`^(?s:`)
+	for i := 0; i < len(part); {
+		r, size := utf8.DecodeRuneInString(part[i:])
+		i += size
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i == len(part) {
+				return nil, fmt.Errorf("trailing \\")
+			}
+			r, size = utf8.DecodeRuneInString(part[i:])
+			i += size
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		case '[':
+			n, err := writeClass(&b, part[i:])
+			if err != nil {
+				return nil, err
+			}
+			i += n
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString(`)$`)
+	return regexp.Compile(b.String())
+}
+
+// writeClass writes the class starting after a "[" of a glob as a
+// regexp class, returning the length read up to the closing "]"
+func writeClass(b *strings.Builder, class string) (int, error) {
+	b.WriteByte('[')
+	i := 0
+	if strings.HasPrefix(class, "^") {
+		b.WriteByte('^')
+		i++
+	}
+	start := i
+	for i < len(class) {
+		r, size := utf8.DecodeRuneInString(class[i:])
+		i += size
+		switch {
+		case r == ']' && i-size > start:
+			b.WriteByte(']')
+			return i, nil
+		case r == '-' && i-size > start && i < len(class) && class[i] != ']':
+			b.WriteByte('-')
+			continue
+		case r == '\\':
+			if i == len(class) {
+				break
+			}
+			r, size = utf8.DecodeRuneInString(class[i:])
+			i += size
+		}
+		if r < utf8.RuneSelf && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return 0, fmt.Errorf("unclosed [")
+}
+
+func findEntry(entries []*models.LogEntryView, id int64) *models.LogEntryView {
+	for _, entry := range entries {
+		if entry.Data.ID == id {
+			return entry
+		}
+		if found := findEntry(entry.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
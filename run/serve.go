@@ -0,0 +1,110 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/todo/data"
+	applog "github.com/xhd2015/todo/log"
+	"github.com/xhd2015/todo/models"
+	"github.com/xhd2015/todo/server"
+)
+
+const serveHelp = `
+todo serve - Serve local storage over HTTP for --storage=server clients
+
+Usage: todo serve [OPTIONS]
+
+Options:
+  --addr <addr>                    listen address (default: 127.0.0.1:7070)
+  --storage <type>                 storage backend to serve: file or sqlite (default: from config, or file)
+  --token <token>                  bearer token clients must send, defaults to $TODO_SERVER_TOKEN
+                                   the storage is backed up on startup and every hour, see todo backup --help
+  -h,--help                        show this help message
+
+Clients connect with:
+  todo --storage=server --server-addr=http://<addr>/api/todo/termui --server-token=<token>
+`
+
+func handleServe(args []string) error {
+	var addr string
+	var storageType string
+	var token string
+
+	args, err := flags.String("--addr", &addr).
+		String("--storage", &storageType).
+		String("--token", &token).
+		Help("-h,--help", serveHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra arguments: %s", strings.Join(args, " "))
+	}
+	if addr == "" {
+		addr = "127.0.0.1:7070"
+	}
+	if token == "" {
+		token = os.Getenv("TODO_SERVER_TOKEN")
+	}
+	if token == "" {
+		return fmt.Errorf("requires --token or $TODO_SERVER_TOKEN")
+	}
+
+	storageConfig, err := ApplyConfigDefaults(storageType, "", "")
+	if err != nil {
+		return err
+	}
+	storageType = storageConfig.StorageType
+	if storageType == "server" {
+		return fmt.Errorf("cannot serve from server storage, use --storage=file or --storage=sqlite")
+	}
+
+	// recorded so that todo backup restore does not replace the
+	// storage under it
+	savedConfig, err := data.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if savedConfig != nil && processAlive(savedConfig.ServingPID) {
+		return fmt.Errorf("todo serve is already running with PID %d", savedConfig.ServingPID)
+	}
+	if savedConfig == nil {
+		savedConfig = &models.Config{}
+	}
+	savedConfig.ServingPID = os.Getpid()
+	if err := data.SaveConfig(savedConfig); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := applog.Init(); err != nil {
+		return fmt.Errorf("failed to initialize logging: %w", err)
+	}
+
+	services, err := createLogServices(storageType, "", "")
+	if err != nil {
+		return err
+	}
+
+	err = startBackups(context.Background(), storageType, func(err error) {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+	})
+	if err != nil {
+		return err
+	}
+
+	srv := server.New(services, token)
+	go func() {
+		if err := srv.WatchStorage(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "watch changes: %v\n", err)
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving %s storage on http://%s%s\n", storageType, addr, server.APIPrefix)
+	return http.ListenAndServe(addr, srv)
+}
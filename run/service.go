@@ -2,10 +2,12 @@ package run
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/xhd2015/todo/data"
 	"github.com/xhd2015/todo/data/storage/filestore"
 	"github.com/xhd2015/todo/data/storage/http"
+	"github.com/xhd2015/todo/data/storage/replica"
 	"github.com/xhd2015/todo/data/storage/sqlite"
 	"github.com/xhd2015/todo/internal/config"
 )
@@ -37,28 +39,34 @@ func createLogServices(storageType string, serverAddr string, serverToken string
 		services.StateRecording = &sqlite.StateRecordingSQLiteStore{
 			SQLiteStore: sqliteStore,
 		}
-	case "file":
-		recordFile, err := config.GetRecordJSONFile()
-		if err != nil {
-			return nil, err
+		services.Group = &sqlite.GroupSQLiteStore{
+			SQLiteStore: sqliteStore,
 		}
-
-		services.LogEntry, err = filestore.NewLogEntryService(recordFile)
-		if err != nil {
-			return nil, err
+		services.Search = &sqlite.SearchSQLiteStore{
+			SQLiteStore: sqliteStore,
 		}
-		services.LogNote, err = filestore.NewLogNoteService(recordFile)
-		if err != nil {
-			return nil, err
+		services.Revision = &sqlite.RevisionSQLiteStore{
+			SQLiteStore: sqliteStore,
 		}
-		services.Happening, err = filestore.NewHappeningService(recordFile)
+		services.Changes = sqliteStore
+	case "file":
+		recordFile, err := config.GetRecordJSONFile()
 		if err != nil {
 			return nil, err
 		}
-		services.StateRecording, err = filestore.NewStateRecordingService(recordFile)
+
+		store, err := filestore.Open(recordFile)
 		if err != nil {
 			return nil, err
 		}
+		services.LogEntry = store.LogEntryService()
+		services.LogNote = store.LogNoteService()
+		services.Happening = store.HappeningService()
+		services.StateRecording = store.StateRecordingService()
+		services.Group = store.GroupService()
+		services.Search = store.SearchService()
+		services.Revision = store.RevisionService()
+		services.Changes = store
 	case "server":
 		if serverAddr == "" {
 			return nil, fmt.Errorf("requires --server-addr")
@@ -67,11 +75,20 @@ func createLogServices(storageType string, serverAddr string, serverToken string
 			return nil, fmt.Errorf("requires --server-token")
 		}
 
-		client := http.NewClient(serverAddr, serverToken)
+		options, err := serverClientOptions()
+		if err != nil {
+			return nil, err
+		}
+		client := http.NewClientWithOptions(serverAddr, serverToken, options)
+		services.ServerClient = client
+		services.Changes = client
 		services.LogEntry = http.NewLogEntryService(client)
 		services.LogNote = http.NewLogNoteService(client)
 		services.Happening = http.NewHappeningService(client)
 		services.StateRecording = http.NewStateRecordingService(client)
+		services.Group = http.NewGroupService(client)
+		services.Search = http.NewSearchService(client)
+		services.Revision = http.NewRevisionService(client)
 		services.LearningMaterials = http.NewLearningMaterialsService(client)
 
 	default:
@@ -81,6 +98,48 @@ func createLogServices(storageType string, serverAddr string, serverToken string
 	return services, nil
 }
 
+// serverClientOptions returns the options of the server client,
+// http.DefaultOptions as changed by the config
+func serverClientOptions() (http.Options, error) {
+	options := http.DefaultOptions
+	savedConfig, err := data.LoadConfig()
+	if err != nil {
+		return options, err
+	}
+	if savedConfig == nil || savedConfig.ServerClient == nil {
+		return options, nil
+	}
+	conf := savedConfig.ServerClient
+	if conf.Timeout != "" {
+		options.Timeout, err = time.ParseDuration(conf.Timeout)
+		if err != nil || options.Timeout <= 0 {
+			return options, fmt.Errorf("invalid server client timeout %q in config", conf.Timeout)
+		}
+	}
+	if conf.Retries != nil {
+		options.Retries = *conf.Retries
+	}
+	return options, nil
+}
+
+// openReplica makes services serve entries and notes from a local
+// replica of the server, see package replica. Revisions are still
+// listed by the server, which records them as the changes are pushed.
+func openReplica(services *data.Services, serverAddr string) (*replica.Replica, error) {
+	replicaFile, err := config.GetReplicaFile(serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	store, err := sqlite.New(replicaFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replica: %w", err)
+	}
+	r := replica.New(store, services.LogEntry, services.LogNote)
+	services.LogEntry = r.LogEntryService()
+	services.LogNote = r.LogNoteService()
+	return r, nil
+}
+
 func CreateLogManager(storageType string, serverAddr string, serverToken string) (*data.LogManager, *data.Services, error) {
 	services, err := createLogServices(storageType, serverAddr, serverToken)
 	if err != nil {
@@ -0,0 +1,130 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/todo/data"
+)
+
+const trashHelp = `
+todo trash - Manage deleted todos
+
+Usage: todo trash <cmd> [OPTIONS]
+
+Available sub commands:
+  list                             list the todos in trash, most recently deleted first
+  purge --older-than <age>         permanently delete todos deleted more than <age> ago
+
+Options:
+  --older-than <age>               (purge) age like 30d, 2w or 12h, 0d purges everything
+  --storage <type>                 storage backend: file (default), sqlite, or server
+  --server-addr <addr>             server address (required when --storage=server)
+  --server-token <token>           server authentication token (optional when --storage=server)
+  -h,--help                        show this help message
+
+Deleted todos can be browsed and restored in the app with /trash.
+
+Examples:
+  todo trash list
+  todo trash purge --older-than 30d
+`
+
+func handleTrash(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("requires sub command: list, purge")
+	}
+	cmd := args[0]
+	args = args[1:]
+	if cmd == "--help" || cmd == "-h" || cmd == "help" {
+		fmt.Print(strings.TrimPrefix(trashHelp, "\n"))
+		return nil
+	}
+
+	var storageType string
+	var serverAddr string
+	var serverToken string
+	var olderThan string
+	args, err := flags.String("--storage", &storageType).
+		String("--server-addr", &serverAddr).
+		String("--server-token", &serverToken).
+		String("--older-than", &olderThan).
+		Help("-h,--help", trashHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra arguments: %s", strings.Join(args, " "))
+	}
+
+	var age time.Duration
+	switch cmd {
+	case "list":
+	case "purge":
+		if olderThan == "" {
+			return fmt.Errorf("purge requires --older-than, e.g. --older-than 30d")
+		}
+		age, err = parseAge(olderThan)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unrecognized trash sub command: %s", cmd)
+	}
+
+	storageConfig, err := ApplyConfigDefaults(storageType, serverAddr, serverToken)
+	if err != nil {
+		return err
+	}
+	services, err := createLogServices(storageConfig.StorageType, storageConfig.ServerAddr, storageConfig.ServerToken)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if cmd == "purge" {
+		purged, err := services.LogEntry.Purge(ctx, time.Now().Add(-age))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("purged %d todos\n", purged)
+		return nil
+	}
+
+	entries, err := data.NewLogManager(services).Trash(ctx)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("trash is empty")
+		return nil
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s  %s (%d)\n", entry.Data.DeletedTime.Format("2006-01-02 15:04"), entry.Data.Text, entry.Data.ID)
+	}
+	return nil
+}
+
+var agePattern = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// parseAge accepts 30d and 2w besides Go durations like 12h
+func parseAge(s string) (time.Duration, error) {
+	if m := agePattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if m[2] == "w" {
+			n *= 7
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q, expecting e.g. 30d, 2w or 12h", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// changeKeepAlive is how often an idle /changes stream gets a comment,
+// so that proxies keep it open and dead clients are noticed
+const changeKeepAlive = 30 * time.Second
+
+// changes counts the changes of entries, notes, happenings and groups
+// for the clients of /changes
+type changes struct {
+	mu      sync.Mutex
+	version int64
+	// changed is closed and replaced on every change
+	changed chan struct{}
+}
+
+func newChanges() *changes {
+	return &changes{
+		// starting from the time tells a restarted server apart
+		version: time.Now().UnixNano(),
+		changed: make(chan struct{}),
+	}
+}
+
+func (c *changes) bump() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// current returns the version and a channel closed on the next change
+func (c *changes) current() (int64, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version, c.changed
+}
+
+// handleChange registers a request that changes data, /changes tells
+// its clients after each, whether it succeeded or not
+func (s *Server) handleChange(api string, h http.HandlerFunc) {
+	s.handle(api, func(w http.ResponseWriter, r *http.Request) {
+		h(w, r)
+		s.changes.bump()
+	})
+}
+
+// registerChanges serves GET /changes, a stream of server-sent events
+// with the version of the data, sent on connecting and on every change
+func (s *Server) registerChanges() {
+	s.mux.HandleFunc("GET "+APIPrefix+"/changes", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeJSON(w, http.StatusOK, Response{Code: CodeInternal, Msg: "streaming unsupported"})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		keepAlive := time.NewTicker(changeKeepAlive)
+		defer keepAlive.Stop()
+		var sent int64
+		for {
+			version, changed := s.changes.current()
+			if version != sent {
+				if _, err := fmt.Fprintf(w, "event: change\ndata: %d\n\n", version); err != nil {
+					return
+				}
+				flusher.Flush()
+				sent = version
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-changed:
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// WatchStorage tells the clients of /changes about changes made to the
+// storage other than through the server, e.g. by the todo command,
+// until ctx is done. It returns nil if the storage cannot tell.
+func (s *Server) WatchStorage(ctx context.Context) error {
+	if s.services.Changes == nil {
+		return nil
+	}
+	return s.services.Changes.Watch(ctx, s.changes.bump)
+}
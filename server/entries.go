@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+func (s *Server) registerEntries() {
+	entries := s.services.LogEntry
+
+	s.handle("/entries/list", handle(func(ctx context.Context, req *storage.LogEntryListOptions) (any, error) {
+		if err := validateSort(req.SortBy, req.SortOrder); err != nil {
+			return nil, err
+		}
+		list, total, err := entries.List(ctx, *req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"entries": nonNil(list), "total": total}, nil
+	}))
+	s.handleChange("/entries/add", handle(func(ctx context.Context, req *models.LogEntry) (any, error) {
+		id, err := entries.Add(ctx, *req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"id": id}, nil
+	}))
+	s.handleChange("/entries/delete", handle(func(ctx context.Context, req *idRequest) (any, error) {
+		return nil, entries.Delete(ctx, req.ID)
+	}))
+	s.handleChange("/entries/undelete", handle(func(ctx context.Context, req *idRequest) (any, error) {
+		return nil, entries.Undelete(ctx, req.ID)
+	}))
+	s.handleChange("/entries/purge", handle(func(ctx context.Context, req *struct {
+		DeletedBefore time.Time `json:"deleted_before"`
+	}) (any, error) {
+		if req.DeletedBefore.IsZero() {
+			return nil, badRequest("deleted_before is required")
+		}
+		purged, err := entries.Purge(ctx, req.DeletedBefore)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"purged": purged}, nil
+	}))
+	s.handleChange("/entries/restore", handle(func(ctx context.Context, req *struct {
+		Entries []models.LogEntry `json:"entries"`
+		Notes   []models.Note     `json:"notes"`
+	}) (any, error) {
+		restorer, ok := entries.(storage.LogEntryRestorer)
+		if !ok {
+			return nil, badRequest("restoring entries is not supported by this storage")
+		}
+		return nil, restorer.Restore(ctx, req.Entries, req.Notes)
+	}))
+	s.handleChange("/entries/update", handle(func(ctx context.Context, req *struct {
+		ID     int64           `json:"id"`
+		Update json.RawMessage `json:"update"`
+	}) (any, error) {
+		update, err := models.DecodeLogEntryOptional(req.Update)
+		if err != nil {
+			return nil, badRequest("invalid update: %v", err)
+		}
+		return nil, entries.Update(ctx, req.ID, update)
+	}))
+	s.handleChange("/entries/move", handle(func(ctx context.Context, req *struct {
+		ID          int64 `json:"id"`
+		NewParentID int64 `json:"new_parent_id"`
+	}) (any, error) {
+		return nil, entries.Move(ctx, req.ID, req.NewParentID)
+	}))
+	s.handle("/entries/getTree", handle(func(ctx context.Context, req *struct {
+		ID             int64 `json:"id"`
+		IncludeHistory bool  `json:"include_history"`
+	}) (any, error) {
+		list, err := entries.GetTree(ctx, req.ID, req.IncludeHistory)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"entries": nonNil(list)}, nil
+	}))
+}
+
+type idRequest struct {
+	ID int64 `json:"id"`
+}
+
+// nonNil makes empty lists encode as [] instead of null
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
+
+func requireID(id int64, what string) error {
+	if id == 0 {
+		return badRequest("%s id is required", what)
+	}
+	return nil
+}
@@ -1,3 +0,0 @@
-module github.com/xhd2015/todo/server
-
-go 1.24.1
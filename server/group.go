@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+
+	"github.com/xhd2015/todo/models"
+)
+
+func (s *Server) registerGroups() {
+	groups := s.services.Group
+
+	s.handle("/group/list", handle(func(ctx context.Context, req *struct{}) (any, error) {
+		list, err := groups.ListGroups(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"groups": nonNil(list)}, nil
+	}))
+	s.handleChange("/group/add", handle(func(ctx context.Context, req *struct {
+		Group models.Group `json:"group"`
+	}) (any, error) {
+		if req.Group.Name == "" {
+			return nil, badRequest("group name cannot be empty")
+		}
+		id, err := groups.AddGroup(ctx, req.Group)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"id": id}, nil
+	}))
+	s.handleChange("/group/update", handle(func(ctx context.Context, req *struct {
+		ID     int64                `json:"id"`
+		Update models.GroupOptional `json:"update"`
+	}) (any, error) {
+		if req.Update.Name != nil && *req.Update.Name == "" {
+			return nil, badRequest("group name cannot be empty")
+		}
+		if err := groups.UpdateGroup(ctx, req.ID, req.Update); err != nil {
+			return nil, err
+		}
+		return map[string]any{"success": true}, nil
+	}))
+	s.handleChange("/group/delete", handle(func(ctx context.Context, req *struct {
+		ID int64 `json:"id"`
+	}) (any, error) {
+		if err := groups.DeleteGroup(ctx, req.ID); err != nil {
+			return nil, err
+		}
+		return map[string]any{"success": true}, nil
+	}))
+	s.handle("/group/memberships", handle(func(ctx context.Context, req *struct{}) (any, error) {
+		memberships, err := groups.ListMemberships(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"memberships": nonNil(memberships)}, nil
+	}))
+	s.handleChange("/group/setMembership", handle(func(ctx context.Context, req *struct {
+		Membership models.GroupMembership `json:"membership"`
+	}) (any, error) {
+		if req.Membership.EntryID == 0 {
+			return nil, badRequest("entry_id is required")
+		}
+		if err := groups.SetMembership(ctx, req.Membership); err != nil {
+			return nil, err
+		}
+		return map[string]any{"success": true}, nil
+	}))
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+func (s *Server) registerHappenings() {
+	happenings := s.services.Happening
+
+	s.handle("/happening/list", handle(func(ctx context.Context, req *struct {
+		Search string `json:"search"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+	}) (any, error) {
+		// like lifelog, the list pages from the most recent happening
+		list, total, err := happenings.List(storage.HappeningListOptions{
+			Filter:    req.Search,
+			SortBy:    "create_time",
+			SortOrder: "desc",
+			Offset:    req.Offset,
+			Limit:     req.Limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"happenings": nonNil(list), "total": total}, nil
+	}))
+	s.handleChange("/happening/add", handle(func(ctx context.Context, req *struct {
+		Content    string    `json:"content"`
+		Scope      string    `json:"scope"`
+		CreateTime time.Time `json:"create_time"`
+		UpdateTime time.Time `json:"update_time"`
+	}) (any, error) {
+		if req.Content == "" {
+			return nil, badRequest("happening content cannot be empty")
+		}
+		happening, err := happenings.Add(ctx, &models.Happening{
+			Content:    req.Content,
+			CreateTime: req.CreateTime,
+			UpdateTime: req.UpdateTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"happening": happening}, nil
+	}))
+	s.handleChange("/happening/update", handle(func(ctx context.Context, req *struct {
+		ID   int64                     `json:"id"`
+		Data *models.HappeningOptional `json:"data"`
+	}) (any, error) {
+		if err := requireID(req.ID, "happening"); err != nil {
+			return nil, err
+		}
+		if req.Data == nil {
+			return nil, badRequest("update data is required")
+		}
+		happening, err := happenings.Update(ctx, req.ID, req.Data)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"happening": happening}, nil
+	}))
+	s.handleChange("/happening/delete", handle(func(ctx context.Context, req *idRequest) (any, error) {
+		if err := requireID(req.ID, "happening"); err != nil {
+			return nil, err
+		}
+		if err := happenings.Delete(ctx, req.ID); err != nil {
+			return nil, err
+		}
+		return map[string]any{"success": true}, nil
+	}))
+}
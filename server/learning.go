@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+
+	"github.com/xhd2015/todo/models"
+)
+
+// local backends have no learning materials, so without a
+// LearningService the list is empty and lookups are not found
+func (s *Server) registerLearning() {
+	s.handle("/learning/list", handle(func(ctx context.Context, req *struct {
+		Offset int `json:"offset"`
+		Limit  int `json:"limit"`
+	}) (any, error) {
+		if s.learning == nil {
+			return map[string]any{"data": []*models.LearningMaterial{}, "count": 0}, nil
+		}
+		materials, count, err := s.learning.ListMaterials(ctx, req.Offset, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"data": nonNil(materials), "count": count}, nil
+	}))
+	s.handle("/learning/content", handle(func(ctx context.Context, req *struct {
+		ID     int64 `json:"id"`
+		Offset int   `json:"offset"`
+		Limit  int   `json:"limit"`
+	}) (any, error) {
+		if s.learning == nil {
+			return nil, notFound("learning material %d not found", req.ID)
+		}
+		return s.learning.GetMaterialContent(ctx, req.ID, req.Offset, req.Limit)
+	}))
+	s.handle("/learning/recording/get", handle(func(ctx context.Context, req *struct {
+		MaterialID int64 `json:"material_id"`
+	}) (any, error) {
+		if s.learning == nil {
+			return nil, notFound("learning material %d not found", req.MaterialID)
+		}
+		offset, err := s.learning.GetReadingPosition(ctx, req.MaterialID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"material_id": req.MaterialID, "offset": offset}, nil
+	}))
+	s.handle("/learning/recording/updateOffset", handle(func(ctx context.Context, req *struct {
+		MaterialID int64 `json:"material_id"`
+		Offset     int64 `json:"offset"`
+	}) (any, error) {
+		if s.learning == nil {
+			return nil, notFound("learning material %d not found", req.MaterialID)
+		}
+		if err := s.learning.UpdateReadingPosition(ctx, req.MaterialID, req.Offset); err != nil {
+			return nil, err
+		}
+		return map[string]any{"success": true}, nil
+	}))
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+func (s *Server) registerNotes() {
+	notes := s.services.LogNote
+
+	s.handle("/notes/list", handle(func(ctx context.Context, req *struct {
+		EntryID int64                      `json:"entry_id"`
+		Options storage.LogNoteListOptions `json:"options"`
+	}) (any, error) {
+		if err := requireID(req.EntryID, "entry"); err != nil {
+			return nil, err
+		}
+		if err := validateSort(req.Options.SortBy, req.Options.SortOrder); err != nil {
+			return nil, err
+		}
+		list, total, err := notes.List(ctx, req.EntryID, req.Options)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"notes": nonNil(list), "total": total}, nil
+	}))
+	s.handle("/notes/listForEntries", handle(func(ctx context.Context, req *struct {
+		EntryIDs []int64 `json:"entry_ids"`
+	}) (any, error) {
+		notesMap, err := notes.ListForEntries(ctx, req.EntryIDs)
+		if err != nil {
+			return nil, err
+		}
+		if notesMap == nil {
+			notesMap = map[int64][]models.Note{}
+		}
+		return map[string]any{"notes_map": notesMap}, nil
+	}))
+	s.handleChange("/notes/add", handle(func(ctx context.Context, req *struct {
+		EntryID int64       `json:"entry_id"`
+		Note    models.Note `json:"note"`
+	}) (any, error) {
+		if err := requireID(req.EntryID, "entry"); err != nil {
+			return nil, err
+		}
+		id, err := notes.Add(ctx, req.EntryID, req.Note)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"id": id}, nil
+	}))
+	s.handleChange("/notes/delete", handle(func(ctx context.Context, req *struct {
+		EntryID int64 `json:"entry_id"`
+		NoteID  int64 `json:"note_id"`
+	}) (any, error) {
+		return nil, notes.Delete(ctx, req.EntryID, req.NoteID)
+	}))
+	s.handleChange("/notes/update", handle(func(ctx context.Context, req *struct {
+		EntryID int64               `json:"entry_id"`
+		NoteID  int64               `json:"note_id"`
+		Update  models.NoteOptional `json:"update"`
+	}) (any, error) {
+		return nil, notes.Update(ctx, req.EntryID, req.NoteID, req.Update)
+	}))
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"context"
+
+	"github.com/xhd2015/todo/data/storage"
+)
+
+func (s *Server) registerRevisions() {
+	revisions := s.services.Revision
+
+	s.handle("/revisions/list", handle(func(ctx context.Context, req *storage.RevisionListOptions) (any, error) {
+		list, err := revisions.ListRevisions(ctx, *req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"revisions": nonNil(list)}, nil
+	}))
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/internal/query"
+)
+
+func (s *Server) registerSearch() {
+	search := s.services.Search
+
+	s.handle("/search", handle(func(ctx context.Context, req *struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}) (any, error) {
+		// report query syntax errors as the client's fault
+		if _, err := query.Parse(req.Query, time.Now()); err != nil {
+			return nil, badRequest("%v", err)
+		}
+		results, err := search.Search(ctx, storage.SearchOptions{
+			Query: req.Query,
+			Limit: req.Limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"results": nonNil(results)}, nil
+	}))
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
+	storagehttp "github.com/xhd2015/todo/data/storage/http"
+	applog "github.com/xhd2015/todo/log"
+	"github.com/xhd2015/todo/models"
+)
+
+// APIPrefix is the path prefix of the termui protocol,
+// the client's server address is expected to include it
+const APIPrefix = "/api/todo/termui"
+
+// response codes carried in Response.Code
+const (
+	CodeOK           = 0
+	CodeBadRequest   = 400
+	CodeUnauthorized = 401
+	CodeNotFound     = 404
+	CodeConflict     = storagehttp.CodeConflict
+	CodeInternal     = 500
+)
+
+// Response mirrors storagehttp.ServerResponse
+type Response struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data any    `json:"data,omitempty"`
+}
+
+// LearningService serves the /learning/* endpoints,
+// *storagehttp.LearningMaterialsHttpService satisfies it
+type LearningService interface {
+	ListMaterials(ctx context.Context, offset int, limit int) ([]*models.LearningMaterial, int64, error)
+	GetMaterialContent(ctx context.Context, id int64, offset int, limit int) (*storagehttp.MaterialContentResponse, error)
+	GetReadingPosition(ctx context.Context, materialID int64) (int64, error)
+	UpdateReadingPosition(ctx context.Context, materialID int64, offset int64) error
+}
+
+// Server exposes data.Services over the termui HTTP protocol
+type Server struct {
+	services *data.Services
+	token    string
+	learning LearningService
+	mux      *http.ServeMux
+	changes  *changes
+}
+
+// New creates a server backed by services. Every request must carry
+// "Authorization: Bearer <token>"; an empty token disables the check.
+func New(services *data.Services, token string) *Server {
+	s := &Server{
+		services: services,
+		token:    token,
+		mux:      http.NewServeMux(),
+		changes:  newChanges(),
+	}
+	if services.LearningMaterials != nil {
+		s.learning = services.LearningMaterials
+	}
+	s.registerEntries()
+	s.registerNotes()
+	s.registerHappenings()
+	s.registerStates()
+	s.registerGroups()
+	s.registerSearch()
+	s.registerRevisions()
+	s.registerLearning()
+	s.registerChanges()
+	return s
+}
+
+// SetLearningService overrides the service behind /learning/*
+func (s *Server) SetLearningService(learning LearningService) {
+	s.learning = learning
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, Response{Code: CodeUnauthorized, Msg: "unauthorized"})
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *Server) handle(api string, h http.HandlerFunc) {
+	s.mux.HandleFunc("POST "+APIPrefix+api, h)
+}
+
+// handle decodes the request body into Req, calls fn and wraps the result
+func handle[Req any](fn func(ctx context.Context, req *Req) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusOK, Response{Code: CodeBadRequest, Msg: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+		resp, err := fn(r.Context(), &req)
+		if err != nil {
+			applog.Errorf(r.Context(), "%s: %v", r.URL.Path, err)
+			resp := Response{Code: errorCode(err), Msg: err.Error()}
+			var conflict *storage.ConflictError
+			if errors.As(err, &conflict) {
+				resp.Code = CodeConflict
+				resp.Data = conflict
+			}
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		writeJSON(w, http.StatusOK, Response{Code: CodeOK, Data: resp})
+	}
+}
+
+// requestError marks errors caused by the request itself
+type requestError struct {
+	code int
+	msg  string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...any) error {
+	return &requestError{code: CodeBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...any) error {
+	return &requestError{code: CodeNotFound, msg: fmt.Sprintf(format, args...)}
+}
+
+func errorCode(err error) int {
+	if e, ok := err.(*requestError); ok {
+		return e.code
+	}
+	// the client drops a change to what is gone, but retries a
+	// failure of the server
+	if errors.Is(err, storage.ErrNotFound) {
+		return CodeNotFound
+	}
+	return CodeInternal
+}
+
+// validateSort rejects sort options that are not plain column names,
+// since backends interpolate them into queries
+func validateSort(sortBy string, sortOrder string) error {
+	if !sortColumnPattern.MatchString(sortBy) {
+		return badRequest("invalid sort field: %q", sortBy)
+	}
+	if sortOrder != "" && sortOrder != "asc" && sortOrder != "desc" {
+		return badRequest("invalid sort order: %q", sortOrder)
+	}
+	return nil
+}
+
+var sortColumnPattern = regexp.MustCompile(`^[a-z_]*$`)
+
+func writeJSON(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/todo/data"
+	"github.com/xhd2015/todo/data/storage"
+	storagehttp "github.com/xhd2015/todo/data/storage/http"
+	"github.com/xhd2015/todo/data/storage/sqlite"
+	"github.com/xhd2015/todo/models"
+)
+
+func newTestServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	store, err := sqlite.New(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	services := &data.Services{
+		LogEntry:       &sqlite.LogEntrySQLiteStore{SQLiteStore: store},
+		LogNote:        &sqlite.LogNoteSQLiteStore{SQLiteStore: store},
+		Happening:      &sqlite.HappeningSQLiteStore{SQLiteStore: store},
+		StateRecording: &sqlite.StateRecordingSQLiteStore{SQLiteStore: store},
+		Group:          &sqlite.GroupSQLiteStore{SQLiteStore: store},
+		Search:         &sqlite.SearchSQLiteStore{SQLiteStore: store},
+	}
+	ts := httptest.NewServer(New(services, token))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestEntriesAndNotesThroughHTTPClient(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t, "secret")
+	client := storagehttp.NewClient(ts.URL+APIPrefix, "secret")
+	entries := storagehttp.NewLogEntryService(client)
+	notes := storagehttp.NewLogNoteService(client)
+
+	rootID, err := entries.Add(ctx, models.LogEntry{Text: "root", CreateTime: time.Now(), UpdateTime: time.Now()})
+	if err != nil {
+		t.Fatalf("add root: %v", err)
+	}
+	childID, err := entries.Add(ctx, models.LogEntry{Text: "child", ParentID: rootID, CreateTime: time.Now(), UpdateTime: time.Now()})
+	if err != nil {
+		t.Fatalf("add child: %v", err)
+	}
+	otherID, err := entries.Add(ctx, models.LogEntry{Text: "other", CreateTime: time.Now(), UpdateTime: time.Now()})
+	if err != nil {
+		t.Fatalf("add other: %v", err)
+	}
+
+	list, total, err := entries.List(ctx, storage.LogEntryListOptions{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 3 || len(list) != 3 {
+		t.Fatalf("expected 3 entries, got total=%d len=%d", total, len(list))
+	}
+
+	// done then undone must clear done_time on the server side
+	done := true
+	now := time.Now()
+	doneTime := &now
+	if err := entries.Update(ctx, childID, models.LogEntryOptional{Done: &done, DoneTime: &doneTime}); err != nil {
+		t.Fatalf("update done: %v", err)
+	}
+	tree, err := entries.GetTree(context.Background(), rootID, true)
+	if err != nil {
+		t.Fatalf("get tree: %v", err)
+	}
+	child := findEntry(tree, childID)
+	if child == nil || !child.Done || child.DoneTime == nil {
+		t.Fatalf("expected child done with done time, got %+v", child)
+	}
+	undone := false
+	var noDoneTime *time.Time
+	text := "child renamed"
+	if err := entries.Update(ctx, childID, models.LogEntryOptional{Done: &undone, DoneTime: &noDoneTime, Text: &text}); err != nil {
+		t.Fatalf("update undone: %v", err)
+	}
+	tree, err = entries.GetTree(context.Background(), rootID, false)
+	if err != nil {
+		t.Fatalf("get tree: %v", err)
+	}
+	child = findEntry(tree, childID)
+	if child == nil || child.Done || child.DoneTime != nil || child.Text != text {
+		t.Fatalf("expected child undone and renamed, got %+v", child)
+	}
+
+	if err := entries.Move(ctx, childID, otherID); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	tree, err = entries.GetTree(context.Background(), otherID, false)
+	if err != nil {
+		t.Fatalf("get tree: %v", err)
+	}
+	if findEntry(tree, childID) == nil {
+		t.Fatalf("expected child under other after move, got %+v", tree)
+	}
+
+	noteID, err := notes.Add(ctx, childID, models.Note{Text: "a note", CreateTime: time.Now(), UpdateTime: time.Now()})
+	if err != nil {
+		t.Fatalf("add note: %v", err)
+	}
+	noteText := "edited note"
+	if err := notes.Update(ctx, childID, noteID, models.NoteOptional{Text: &noteText}); err != nil {
+		t.Fatalf("update note: %v", err)
+	}
+	noteList, noteTotal, err := notes.List(ctx, childID, storage.LogNoteListOptions{})
+	if err != nil {
+		t.Fatalf("list notes: %v", err)
+	}
+	if noteTotal != 1 || len(noteList) != 1 || noteList[0].Text != noteText {
+		t.Fatalf("unexpected notes: total=%d %+v", noteTotal, noteList)
+	}
+	notesMap, err := notes.ListForEntries(ctx, []int64{childID, rootID})
+	if err != nil {
+		t.Fatalf("list notes for entries: %v", err)
+	}
+	if len(notesMap[childID]) != 1 || len(notesMap[rootID]) != 0 {
+		t.Fatalf("unexpected notes map: %+v", notesMap)
+	}
+	if err := notes.Delete(ctx, childID, noteID); err != nil {
+		t.Fatalf("delete note: %v", err)
+	}
+
+	if err := entries.Delete(ctx, rootID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	_, total, err = entries.List(ctx, storage.LogEntryListOptions{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 2 {
+		t.Fatalf("expected 2 entries after delete, got %d", total)
+	}
+
+	if _, _, err := entries.List(ctx, storage.LogEntryListOptions{SortBy: "id; DROP TABLE log_entries"}); err == nil {
+		t.Fatalf("expected invalid sort field to be rejected")
+	}
+}
+
+func TestHappeningsStatesAndLearning(t *testing.T) {
+	ts := newTestServer(t, "secret")
+	client := storagehttp.NewClient(ts.URL+APIPrefix, "secret")
+	ctx := context.Background()
+
+	happenings := storagehttp.NewHappeningService(client)
+	h, err := happenings.Add(ctx, &models.Happening{Content: "went running"})
+	if err != nil {
+		t.Fatalf("add happening: %v", err)
+	}
+	content := "went running 5km"
+	updated, err := happenings.Update(ctx, h.ID, &models.HappeningOptional{Content: &content})
+	if err != nil {
+		t.Fatalf("update happening: %v", err)
+	}
+	if updated.Content != content {
+		t.Fatalf("expected updated content, got %q", updated.Content)
+	}
+	list, total, err := happenings.List(storage.HappeningListOptions{})
+	if err != nil {
+		t.Fatalf("list happenings: %v", err)
+	}
+	if total != 1 || len(list) != 1 || list[0].Content != content {
+		t.Fatalf("unexpected happenings: total=%d %+v", total, list)
+	}
+	if err := happenings.Delete(ctx, h.ID); err != nil {
+		t.Fatalf("delete happening: %v", err)
+	}
+
+	states := storagehttp.NewStateRecordingService(client)
+	created, err := states.CreateState(ctx, &models.State{Name: "energy", Scope: "human"})
+	if err != nil {
+		t.Fatalf("create state: %v", err)
+	}
+	if err := states.RecordStateEvent(ctx, "energy", 2.5); err != nil {
+		t.Fatalf("record event: %v", err)
+	}
+	state, err := states.GetState(ctx, "energy")
+	if err != nil {
+		t.Fatalf("get state: %v", err)
+	}
+	if state.ID != created.ID || state.Score != 2.5 {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	stateList, err := states.ListStates(ctx, "human")
+	if err != nil {
+		t.Fatalf("list states: %v", err)
+	}
+	if len(stateList) != 1 {
+		t.Fatalf("expected 1 state, got %d", len(stateList))
+	}
+	events, err := states.GetStateEvents(ctx, state.ID, 10)
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	if len(events) != 1 || events[0].DeltaScore != 2.5 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if _, err := states.GetStateHistory(ctx, storage.GetStateHistoryOptions{Names: []string{"energy"}, Days: 7}); err != nil {
+		t.Fatalf("get history: %v", err)
+	}
+
+	learning := storagehttp.NewLearningMaterialsService(client)
+	materials, count, err := learning.ListMaterials(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("list materials: %v", err)
+	}
+	if count != 0 || len(materials) != 0 {
+		t.Fatalf("expected no learning materials, got %d", count)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t, "secret")
+
+	for _, token := range []string{"", "wrong"} {
+		client := storagehttp.NewClient(ts.URL+APIPrefix, token)
+		_, _, err := storagehttp.NewLogEntryService(client).List(ctx, storage.LogEntryListOptions{})
+		if !errors.Is(err, storagehttp.ErrUnauthorized) {
+			t.Fatalf("expected token %q to be rejected, got %v", token, err)
+		}
+	}
+}
+
+func TestCancelledRequest(t *testing.T) {
+	ts := newTestServer(t, "secret")
+	client := storagehttp.NewClient(ts.URL+APIPrefix, "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := storagehttp.NewLogEntryService(client).Add(ctx, models.LogEntry{Text: "never"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the add cancelled, got %v", err)
+	}
+	if _, err := storagehttp.NewLogNoteService(client).ListForEntries(ctx, []int64{1}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the list cancelled, got %v", err)
+	}
+	list, _, err := storagehttp.NewLogEntryService(client).List(context.Background(), storage.LogEntryListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("expected nothing added, got %+v", list)
+	}
+}
+
+func TestDueAndScheduledTimeRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t, "secret")
+	entries := storagehttp.NewLogEntryService(storagehttp.NewClient(ts.URL+APIPrefix, "secret"))
+
+	due := time.Date(2025, 9, 4, 17, 0, 0, 0, time.Local)
+	scheduled := time.Date(2025, 9, 3, 9, 0, 0, 0, time.Local)
+	id, err := entries.Add(ctx, models.LogEntry{Text: "fix build", DueTime: &due, ScheduledTime: &scheduled})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	tree, err := entries.GetTree(ctx, id, true)
+	if err != nil {
+		t.Fatalf("get tree: %v", err)
+	}
+	entry := findEntry(tree, id)
+	if entry == nil || entry.DueTime == nil || !entry.DueTime.Equal(due) || entry.ScheduledTime == nil || !entry.ScheduledTime.Equal(scheduled) {
+		t.Fatalf("expected due %v and scheduled %v, got %+v", due, scheduled, entry)
+	}
+
+	var noDue *time.Time
+	if err := entries.Update(ctx, id, models.LogEntryOptional{DueTime: &noDue}); err != nil {
+		t.Fatalf("clear due: %v", err)
+	}
+	tree, err = entries.GetTree(ctx, id, true)
+	if err != nil {
+		t.Fatalf("get tree: %v", err)
+	}
+	entry = findEntry(tree, id)
+	if entry.DueTime != nil || entry.ScheduledTime == nil {
+		t.Fatalf("expected due cleared and scheduled kept, got %+v", entry)
+	}
+}
+
+func TestChangesOfStorage(t *testing.T) {
+	interval := sqlite.WatchInterval
+	sqlite.WatchInterval = 10 * time.Millisecond
+	defer func() { sqlite.WatchInterval = interval }()
+
+	file := filepath.Join(t.TempDir(), "todo.db")
+	served, err := sqlite.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer served.Close()
+	local, err := sqlite.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	srv := New(&data.Services{LogEntry: &sqlite.LogEntrySQLiteStore{SQLiteStore: served}, Changes: served}, "secret")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.WatchStorage(ctx)
+
+	changes := make(chan struct{}, 1)
+	client := storagehttp.NewClient(ts.URL+APIPrefix, "secret")
+	go client.Watch(ctx, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+	time.Sleep(200 * time.Millisecond)
+
+	// written by the todo command, say, not through the server
+	if _, err := (&sqlite.LogEntrySQLiteStore{SQLiteStore: local}).Add(ctx, models.LogEntry{Text: "local"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the change of the storage told")
+	}
+}
+
+func findEntry(entries []models.LogEntry, id int64) *models.LogEntry {
+	for i := range entries {
+		if entries[i].ID == id {
+			return &entries[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+
+	"github.com/xhd2015/todo/data/storage"
+	"github.com/xhd2015/todo/models"
+)
+
+func (s *Server) registerStates() {
+	states := s.services.StateRecording
+
+	s.handle("/state/get", handle(func(ctx context.Context, req *struct {
+		Name string `json:"name"`
+	}) (any, error) {
+		if req.Name == "" {
+			return nil, badRequest("name cannot be empty")
+		}
+		state, err := states.GetState(ctx, req.Name)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"state": state}, nil
+	}))
+	s.handle("/state/recordEvent", handle(func(ctx context.Context, req *struct {
+		Name       string  `json:"name"`
+		DeltaScore float64 `json:"delta_score"`
+	}) (any, error) {
+		if req.Name == "" {
+			return nil, badRequest("name cannot be empty")
+		}
+		if err := states.RecordStateEvent(ctx, req.Name, req.DeltaScore); err != nil {
+			return nil, err
+		}
+		return map[string]any{"success": true}, nil
+	}))
+	s.handle("/state/create", handle(func(ctx context.Context, req *struct {
+		State *models.State `json:"state"`
+	}) (any, error) {
+		if req.State == nil {
+			return nil, badRequest("state is required")
+		}
+		state, err := states.CreateState(ctx, req.State)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"state": state}, nil
+	}))
+	s.handle("/state/addEvent", handle(func(ctx context.Context, req *struct {
+		Event *models.StateEvent `json:"event"`
+	}) (any, error) {
+		if req.Event == nil {
+			return nil, badRequest("event is required")
+		}
+		event, err := states.AddStateEvent(ctx, req.Event)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"event": event}, nil
+	}))
+	s.handle("/state/list", handle(func(ctx context.Context, req *struct {
+		Scope string `json:"scope"`
+	}) (any, error) {
+		list, err := states.ListStates(ctx, req.Scope)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"states": nonNil(list)}, nil
+	}))
+	s.handle("/state/events", handle(func(ctx context.Context, req *struct {
+		StateID int64 `json:"state_id"`
+		Limit   int   `json:"limit"`
+	}) (any, error) {
+		events, err := states.GetStateEvents(ctx, req.StateID, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"events": nonNil(events)}, nil
+	}))
+	s.handle("/state/history", handle(func(ctx context.Context, req *struct {
+		Names []string `json:"names"`
+		Days  int      `json:"days"`
+	}) (any, error) {
+		history, err := states.GetStateHistory(ctx, storage.GetStateHistoryOptions{
+			Names: req.Names,
+			Days:  req.Days,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"history": nonNil(history)}, nil
+	}))
+}
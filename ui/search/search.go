@@ -1,8 +1,11 @@
 package search
 
 import (
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/xhd2015/todo/internal/query"
 	"github.com/xhd2015/todo/models"
 )
 
@@ -28,67 +31,91 @@ func FilterEntries(entries []*models.LogEntryView, fn func(entry *models.LogEntr
 	return filtered
 }
 
-// FilterEntriesQuery filters entries and their children based on search query
-// Also searches within notes and highlights matched parts
-func FilterEntriesQuery(entries []*models.LogEntryView, query string) []*models.LogEntryView {
-	query = strings.ToLower(query)
-
-	return FilterEntries(entries, func(entry *models.LogEntryView) bool {
-		// Search in entry text
-		if query == "" {
+// FilterEntriesQuery filters entries and their children by a search query,
+// see package query for the syntax, and highlights the matches in texts and
+// notes. Words match as prefixes since the query is typed live. Siblings are
+// ranked by the best score in their sub-tree, except groups which keep their
+// order. A query that does not parse matches nothing.
+func FilterEntriesQuery(entries []*models.LogEntryView, queryText string) []*models.LogEntryView {
+	if strings.TrimSpace(queryText) == "" {
+		// clear the labels of a previous search
+		return FilterEntries(entries, func(entry *models.LogEntryView) bool {
 			entry.MatchTexts = nil
 			return true
-		}
+		})
+	}
+	q, err := query.Parse(queryText, time.Now())
+	if err != nil {
+		return nil
+	}
+	q.MatchPrefixes()
 
-		entryTextIdx := strings.Index(strings.ToLower(entry.Data.Text), query)
-		var matchTexts []models.MatchText
-		if entryTextIdx >= 0 {
-			matchTexts = []models.MatchText{
-				{
-					Text: entry.Data.Text[:entryTextIdx],
-				},
-				{
-					Text:  entry.Data.Text[entryTextIdx : entryTextIdx+len(query)],
-					Match: true,
-				},
-				{
-					Text: entry.Data.Text[entryTextIdx+len(query):],
-				},
-			}
+	scores := make(map[*models.LogEntryView]float64)
+	filtered := FilterEntries(entries, func(entry *models.LogEntryView) bool {
+		noteTexts := make([]string, 0, len(entry.Notes))
+		for _, note := range entry.Notes {
+			noteTexts = append(noteTexts, note.Data.Text)
 		}
-		entry.MatchTexts = matchTexts
-
-		// Search in notes
-		hasNoteMatch := false
+		entry.MatchTexts = nil
+		if !q.Keep(models.SearchResultKind_Entry, entry.Data.Done, entry.Data.CreateTime) {
+			return false
+		}
+		score, ok := q.Match(query.Document{
+			Text:  entry.Data.Text,
+			Notes: strings.Join(noteTexts, "\n"),
+		})
+		if !ok {
+			return false
+		}
+		scores[entry] = score
+		entry.MatchTexts = highlight(q, entry.Data.Text, false)
 
 		cloneNotes := make([]*models.NoteView, len(entry.Notes))
 		for i, note := range entry.Notes {
 			cloneNote := *note
-
-			noteTextIdx := strings.Index(strings.ToLower(cloneNote.Data.Text), query)
-			var noteMatchTexts []models.MatchText
-			if noteTextIdx >= 0 {
-				noteMatchTexts = []models.MatchText{
-					{
-						Text: cloneNote.Data.Text[:noteTextIdx],
-					},
-					{
-						Text:  cloneNote.Data.Text[noteTextIdx : noteTextIdx+len(query)],
-						Match: true,
-					},
-					{
-						Text: cloneNote.Data.Text[noteTextIdx+len(query):],
-					},
-				}
-				hasNoteMatch = true
-			}
-			cloneNote.MatchTexts = noteMatchTexts
+			cloneNote.MatchTexts = highlight(q, cloneNote.Data.Text, true)
 			cloneNotes[i] = &cloneNote
 		}
-
 		entry.Notes = cloneNotes
-
-		// Return true if either entry text or any note matches
-		return entryTextIdx >= 0 || hasNoteMatch
+		return true
 	})
+	rankEntries(filtered, scores)
+	return filtered
+}
+
+// highlight returns the parts of text with the matches marked,
+// nil when nothing matches
+func highlight(q *query.Query, text string, notes bool) []models.MatchText {
+	highlighted := q.Highlight(text, notes)
+	if highlighted == text {
+		return nil
+	}
+	return models.SplitHighlights(highlighted)
+}
+
+// rankEntries sorts siblings by the best score in their sub-tree and
+// returns the best score of entries
+func rankEntries(entries []*models.LogEntryView, scores map[*models.LogEntryView]float64) float64 {
+	best := make(map[*models.LogEntryView]float64, len(entries))
+	var top float64
+	hasGroup := false
+	for _, entry := range entries {
+		score := scores[entry]
+		if childScore := rankEntries(entry.Children, scores); childScore > score {
+			score = childScore
+		}
+		best[entry] = score
+		if score > top {
+			top = score
+		}
+		if entry.ViewType == models.LogEntryViewType_Group {
+			hasGroup = true
+		}
+	}
+	if !hasGroup {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return best[entries[i]] > best[entries[j]]
+		})
+	}
+	return top
 }
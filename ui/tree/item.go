@@ -2,6 +2,7 @@ package tree
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/xhd2015/todo/models"
@@ -27,10 +28,25 @@ func RenderItem(entry *models.LogEntryView, showID bool, renderStrikeThrough boo
 		visibilityIndicator = " (*)"
 	}
 
+	var dueIndicator string
+	if entry.Data.DueTime != nil && !entry.Data.Done {
+		now := time.Now()
+		label := "due"
+		if entry.Data.DueStatus(now) == models.DueStatus_Overdue {
+			label = "overdue"
+		}
+		dueIndicator = fmt.Sprintf(" (%s %s)", label, models.FormatDueTime(*entry.Data.DueTime, now))
+	}
+
+	var repeatIndicator string
+	if entry.Data.Repeat != "" {
+		repeatIndicator = " ↻ " + entry.Data.Repeat
+	}
+
 	var idIndicator string
 	if showID {
 		idIndicator = fmt.Sprintf(" (%d)", entry.Data.ID)
 	}
 
-	return bullet + " " + text + visibilityIndicator + idIndicator
+	return bullet + " " + text + dueIndicator + repeatIndicator + visibilityIndicator + idIndicator
 }
@@ -48,3 +48,16 @@ func renderEntriesWithState(entries []*models.LogEntryView, prefix string, hasVe
 		}
 	}
 }
+
+// Walk calls fn for each entry before its children, with the depth
+// of the entry, 0 for top-level
+func Walk(entries []*models.LogEntryView, fn func(depth int, entry *models.LogEntryView)) {
+	walk(entries, 0, fn)
+}
+
+func walk(entries []*models.LogEntryView, depth int, fn func(depth int, entry *models.LogEntryView)) {
+	for _, entry := range entries {
+		fn(depth, entry)
+		walk(entry.Children, depth+1, fn)
+	}
+}